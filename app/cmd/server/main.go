@@ -5,6 +5,7 @@ package main
 
 import (
 	"context"
+	"crypto/subtle"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -14,20 +15,28 @@ import (
 	"net/http/pprof"
 	"os"
 	"os/signal"
+	"runtime"
 	"runtime/debug"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"package-indexer/internal/server"
+	"package-indexer/internal/wire"
 )
 
 // Server configuration constants
 const (
+	defaultAddr                   = ":8080"
 	defaultShutdownTimeout        = 30 * time.Second
 	defaultAdminReadHeaderTimeout = 5 * time.Second
 	defaultAdminReadTimeout       = 10 * time.Second
 	defaultAdminWriteTimeout      = 10 * time.Second
 	defaultAdminIdleTimeout       = 60 * time.Second
+	defaultCommandLogMaxSize      = 100 << 20 // Rotate the command log at 100 MiB
+	defaultCommandLogBackups      = 3
+	memStatsTTL                   = 2 * time.Second // ReadMemStats stops the world, so scrapes share a cached reading
 )
 
 // Prometheus metric definitions
@@ -38,6 +47,65 @@ type prometheusMetric struct {
 	value      interface{}
 }
 
+// adminConfig holds the admin HTTP server options. Zero values give an unauthenticated
+// plain-HTTP server on Addr.
+type adminConfig struct {
+	Addr          string
+	User          string // Basic-auth user; auth is enabled when User or Pass is set
+	Pass          string // Basic-auth password
+	PublicHealthz bool   // Serve /healthz and /ready without auth so probes need no credentials
+	TLSCert       string // PEM certificate file; HTTPS is used when TLSCert and TLSKey are set
+	TLSKey        string // PEM private key file
+	DisablePprof  bool   // Leave the /debug/pprof/ handlers unmounted
+	ReloadFile    string // Snapshot re-read by POST /reload; the endpoint is unmounted if empty
+}
+
+// authEnabled reports whether basic auth protects the admin endpoints
+func (c adminConfig) authEnabled() bool {
+	return c.User != "" || c.Pass != ""
+}
+
+// tlsEnabled reports whether the admin server is served over HTTPS
+func (c adminConfig) tlsEnabled() bool {
+	return c.TLSCert != "" && c.TLSKey != ""
+}
+
+// memStatsCache caches runtime.ReadMemStats results for a short TTL so frequent scrapes
+// do not repeatedly stop the world
+type memStatsCache struct {
+	mu        sync.Mutex
+	ttl       time.Duration
+	fetched   time.Time
+	heapAlloc uint64
+}
+
+// HeapAlloc returns the cached heap allocation in bytes, refreshing it once the TTL expires
+func (c *memStatsCache) HeapAlloc() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if time.Since(c.fetched) >= c.ttl {
+		var ms runtime.MemStats
+		runtime.ReadMemStats(&ms)
+		c.heapAlloc = ms.HeapAlloc
+		c.fetched = time.Now()
+	}
+	return c.heapAlloc
+}
+
+// addrList is a repeatable string flag collecting listen addresses in order
+type addrList []string
+
+// String returns the comma-joined addresses for flag usage output
+func (a *addrList) String() string {
+	return strings.Join(*a, ",")
+}
+
+// Set appends an address each time the flag is given
+func (a *addrList) Set(value string) error {
+	*a = append(*a, value)
+	return nil
+}
+
 // writePrometheusMetric writes a single Prometheus metric in standard format
 func writePrometheusMetric(w io.Writer, metric prometheusMetric) {
 	fmt.Fprintf(w, "# HELP %s %s\n", metric.name, metric.help)
@@ -45,6 +113,55 @@ func writePrometheusMetric(w io.Writer, metric prometheusMetric) {
 	fmt.Fprintf(w, "%s %v\n\n", metric.name, metric.value)
 }
 
+// commandLatencyMetric names the per-outcome command latency histogram family
+const commandLatencyMetric = "package_indexer_command_duration_seconds"
+
+// metricsEnabledMetric is the only metric served when recording is disabled
+const metricsEnabledMetric = "package_indexer_metrics_enabled"
+
+// writePrometheusHistogram writes a histogram family with one labelled series per outcome
+func writePrometheusHistogram(w io.Writer, name, help string, histograms []server.LatencyHistogram) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s histogram\n", name)
+	for _, h := range histograms {
+		for i, bound := range server.LatencyBuckets {
+			fmt.Fprintf(w, "%s_bucket{outcome=%q,le=\"%g\"} %d\n", name, h.Outcome, bound.Seconds(), h.Cumulative[i])
+		}
+		fmt.Fprintf(w, "%s_bucket{outcome=%q,le=\"+Inf\"} %d\n", name, h.Outcome, h.Count)
+		fmt.Fprintf(w, "%s_sum{outcome=%q} %g\n", name, h.Outcome, h.Sum.Seconds())
+		fmt.Fprintf(w, "%s_count{outcome=%q} %d\n", name, h.Outcome, h.Count)
+	}
+	fmt.Fprintln(w)
+}
+
+// metricRequested reports whether name is selected by the ?name= values (all if none)
+func metricRequested(names []string, name string) bool {
+	return len(names) == 0 || len(filterPrometheusMetrics([]prometheusMetric{{name: name}}, names)) > 0
+}
+
+// filterPrometheusMetrics returns the metrics whose names appear in names, preserving
+// their order. Each entry may hold several comma-separated names; no names selects all.
+func filterPrometheusMetrics(metrics []prometheusMetric, names []string) []prometheusMetric {
+	if len(names) == 0 {
+		return metrics
+	}
+
+	wanted := make(map[string]bool)
+	for _, entry := range names {
+		for _, name := range strings.Split(entry, ",") {
+			wanted[strings.TrimSpace(name)] = true
+		}
+	}
+
+	var filtered []prometheusMetric
+	for _, metric := range metrics {
+		if wanted[metric.name] {
+			filtered = append(filtered, metric)
+		}
+	}
+	return filtered
+}
+
 func main() {
 	if err := run(); err != nil {
 		// Use slog for structured error logging at exit
@@ -59,12 +176,110 @@ func main() {
 // for production servers requiring reliable operational characteristics.
 func run() error {
 	// Parse command line flags
-	addr := flag.String("addr", ":8080", "Server listen address")
+	var addrs addrList
+	flag.Var(&addrs, "addr", "Server listen address (repeatable to listen on several addresses; default :8080)")
+	network := flag.String("network", "tcp", "Listen network: tcp (dual-stack), tcp4 (IPv4 only) or tcp6 (IPv6 only)")
+	backlog := flag.Int("backlog", 0, "Listen backlog (accept queue) size; 0 keeps the OS default, values are capped by the kernel")
 	quiet := flag.Bool("quiet", false, "Disable logging for performance")
+	noMetrics := flag.Bool("no-metrics", false, "Disable metrics recording for benchmarking raw protocol and indexer performance")
 	adminAddr := flag.String("admin", "", "Admin HTTP server address (disabled if empty)")
+	adminUser := flag.String("admin-user", "", "Basic-auth user required for admin endpoints (auth disabled if user and pass are empty)")
+	adminPass := flag.String("admin-pass", "", "Basic-auth password required for admin endpoints")
+	adminHealthzPublic := flag.Bool("admin-healthz-public", false, "Serve /healthz and /ready without basic auth when admin auth is enabled")
+	adminTLSCert := flag.String("admin-tls-cert", "", "PEM certificate file for serving the admin server over HTTPS")
+	adminTLSKey := flag.String("admin-tls-key", "", "PEM private key file for serving the admin server over HTTPS")
+	statsdAddr := flag.String("statsd-addr", "", "Push metrics to this StatsD UDP address (disabled if empty)")
+	statsdInterval := flag.Duration("statsd-interval", defaultStatsdInterval, "Interval between StatsD metric pushes")
+	adminRequired := flag.Bool("admin-required", false, "Exit if the admin HTTP server fails to start instead of running without it")
 	shutdownTimeoutFlag := flag.Duration("shutdown-timeout", defaultShutdownTimeout, "Graceful shutdown timeout")
+	shutdownReadinessDelay := flag.Duration("shutdown-readiness-delay", 0, "Keep serving and reporting ready for this long after a shutdown signal before draining")
 	readTimeoutFlag := flag.Duration("read-timeout", server.DefaultReadTimeout, "Connection read timeout")
+	adaptiveReadTimeout := flag.Bool("adaptive-read-timeout", false, "Adapt each connection's read timeout to the client's observed command rate, starting at -read-timeout")
+	minReadTimeout := flag.Duration("min-read-timeout", 0, "Lower bound of the adaptive read timeout (0 uses -read-timeout, so it never tightens below it)")
+	maxReadTimeout := flag.Duration("max-read-timeout", server.DefaultMaxReadTimeout, "Upper bound of the adaptive read timeout")
+	indexReadTimeout := flag.Duration("index-read-timeout", 0, "Deadline for the rest of an INDEX line once its command name arrives (0 uses -read-timeout)")
+	queryReadTimeout := flag.Duration("query-read-timeout", 0, "Deadline for the rest of a QUERY line once its command name arrives (0 uses -read-timeout)")
+	maxConnLifetime := flag.Duration("max-conn-lifetime", 0, "Close client connections this old once their current command completes (0 disables)")
+	tcpNoDelay := flag.Bool("tcp-nodelay", false, "Disable Nagle's algorithm on client connections")
+	verbose := flag.Bool("verbose", false, "Include detail payloads in replies (e.g. QUERY dependency counts, missing INDEX dependencies)")
+	escapedNames := flag.Bool("escape-names", false, "Allow backslash-escaped | and , inside package names (e.g. \"a\\|b\")")
+	labeledDeps := flag.Bool("labeled-deps", false, "Accept required/optional labels on INDEX dependencies (e.g. \"db:optional\"); optional ones do not block removal")
+	requestIDs := flag.Bool("request-ids", false, "Accept an \"ID:<id> \" prefix on commands and echo it in replies (\"OK [ID:<id>]\") and the command log")
+	strictDeps := flag.Bool("strict-deps", false, "Treat empty dependency slots (e.g. \"b,,c\") as a protocol error")
+	preloadFile := flag.String("preload", "", "Index packages from a brew-dependencies format file before accepting connections")
+	commandTimeout := flag.Duration("command-timeout", 0, "Maximum time a single command may take before ERROR is returned (0 disables)")
+	framingFlag := flag.String("framing", "blank", "Multi-line reply framing: blank (empty line), dot (\".\" line) or length (line count in header)")
+	commandLogFile := flag.String("command-log-file", "", "Write a per-command access log to this file (disabled if empty)")
+	commandLogMaxSize := flag.Int64("command-log-max-size", defaultCommandLogMaxSize, "Rotate the command log when it would exceed this many bytes")
+	commandLogBackups := flag.Int("command-log-backups", defaultCommandLogBackups, "Number of rotated command log files (.1, .2, ...) to keep")
+	maxPipelineDepth := flag.Int("max-pipeline-depth", 0, "Read up to this many pipelined commands ahead of their replies, then stop reading until replies drain (0 serves one command at a time)")
+	maxConns := flag.Int("max-conns", 0, "Hard cap on concurrently served connections; extra connections receive ERROR and are closed (0 disables)")
+	softMaxConns := flag.Int("soft-max-conns", 0, "Log a rate-limited warning while active connections exceed this, still accepting (0 disables)")
+	rateLimitPerConn := flag.Float64("rate-limit-per-conn", 0, "Commands per second each connection may run; extras get ERROR (0 disables)")
+	rateLimitGlobal := flag.Float64("rate-limit-global", 0, "Commands per second across all connections; extras get ERROR (0 disables)")
+	maxPackages := flag.Int("max-packages", 0, "Cap on distinct indexed packages; INDEX of a new package returns FAIL once reached (0 disables)")
+	rejectCycles := flag.Bool("reject-cycles", false, "FAIL INDEX and ADDDEP commands that would create a dependency cycle")
+	evictLRU := flag.Bool("evict-lru", false, "At -max-packages, evict the least recently used package with no dependents instead of failing INDEX")
+	maxGoroutines := flag.Int("max-goroutines", 0, "Refuse new connections while the process runs this many goroutines (0 disables)")
+	enablePprof := flag.Bool("enable-pprof", true, "Mount the /debug/pprof/ handlers on the admin server")
+	blockProfileRate := flag.Int("block-profile-rate", 0, "Enable the block profiler, sampling one event per this many nanoseconds blocked (0 leaves it off)")
+	mutexProfileFraction := flag.Int("mutex-profile-fraction", 0, "Enable the mutex profiler, sampling 1/n contention events (0 leaves it off)")
+	allowCommands := flag.String("allow-commands", "", "Comma-separated commands the server executes (e.g. QUERY,CAPS); others receive ERROR (empty allows all)")
+	denyCommands := flag.String("deny-commands", "", "Comma-separated commands refused with ERROR (e.g. INDEX,REMOVE for a read-only server)")
+	resultCacheSize := flag.Int("result-cache-size", 0, "Cache up to this many QUERY/STATUS/EDGES/DEPTH/PATH replies until the graph changes (0 disables)")
+	readOnly := flag.Bool("readonly", false, "Serve reads only: reject INDEX, REMOVE and every other mutating command with \"ERROR read-only\" (e.g. a replica loaded with -preload)")
+	shedLatency := flag.Duration("shed-latency", 0, "Reject new connections while p99 command latency exceeds this (0 disables)")
 	flag.Parse()
+	if len(addrs) == 0 {
+		addrs = addrList{defaultAddr}
+	}
+	framing, err := wire.ParseFraming(*framingFlag)
+	if err != nil {
+		return err
+	}
+	allowed, err := wire.ParseCommandList(*allowCommands)
+	if err != nil {
+		return fmt.Errorf("invalid -allow-commands: %w", err)
+	}
+	denied, err := wire.ParseCommandList(*denyCommands)
+	if err != nil {
+		return fmt.Errorf("invalid -deny-commands: %w", err)
+	}
+	switch *network {
+	case "tcp", "tcp4", "tcp6":
+	default:
+		return fmt.Errorf("invalid -network %q (want tcp, tcp4 or tcp6)", *network)
+	}
+	if *maxConns > 0 && *softMaxConns >= *maxConns {
+		return fmt.Errorf("-soft-max-conns (%d) must be below -max-conns (%d)", *softMaxConns, *maxConns)
+	}
+	if *rateLimitPerConn < 0 || *rateLimitGlobal < 0 {
+		return fmt.Errorf("-rate-limit-per-conn and -rate-limit-global must not be negative")
+	}
+	if *statsdAddr != "" && *noMetrics {
+		return fmt.Errorf("-statsd-addr cannot be used with -no-metrics")
+	}
+	if *statsdAddr != "" && *statsdInterval <= 0 {
+		return fmt.Errorf("-statsd-interval must be positive")
+	}
+	if *adaptiveReadTimeout {
+		floor := *minReadTimeout
+		if floor == 0 {
+			floor = *readTimeoutFlag
+		}
+		if floor < 0 || floor > *maxReadTimeout {
+			return fmt.Errorf("-min-read-timeout (%s) must be non-negative and at most -max-read-timeout (%s)", floor, *maxReadTimeout)
+		}
+	}
+	if *evictLRU && *maxPackages <= 0 {
+		return fmt.Errorf("-evict-lru requires -max-packages")
+	}
+	if *evictLRU && *resultCacheSize > 0 {
+		return fmt.Errorf("-result-cache-size cannot be used with -evict-lru (cache hits would not refresh recency)")
+	}
+	if (*adminTLSCert == "") != (*adminTLSKey == "") {
+		return fmt.Errorf("-admin-tls-cert and -admin-tls-key must be set together")
+	}
 
 	// Setup structured logging
 	var handler slog.Handler
@@ -77,6 +292,14 @@ func run() error {
 	}
 	slog.SetDefault(slog.New(handler))
 
+	// Block and mutex profiles are empty unless sampling is switched on at startup
+	if *blockProfileRate > 0 {
+		runtime.SetBlockProfileRate(*blockProfileRate)
+	}
+	if *mutexProfileFraction > 0 {
+		runtime.SetMutexProfileFraction(*mutexProfileFraction)
+	}
+
 	// Application context
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -85,30 +308,120 @@ func run() error {
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
 
+	// Optional audit log of every command, written to a size-rotated file
+	var commandLog *slog.Logger
+	if *commandLogFile != "" {
+		w, err := server.NewRotatingWriter(*commandLogFile, *commandLogMaxSize, *commandLogBackups)
+		if err != nil {
+			return fmt.Errorf("failed to open command log: %w", err)
+		}
+		defer w.Close()
+		commandLog = slog.New(slog.NewJSONHandler(w, nil))
+	}
+
+	var metricsRecorder server.MetricsRecorder // nil selects the default recorder
+	if *noMetrics {
+		metricsRecorder = server.NopMetrics{}
+	}
+
 	// Create and start main TCP server
-	srv := server.NewServer(*addr, *readTimeoutFlag)
+	srv := server.NewServerWithConfig(server.Config{
+		Addr:             addrs[0],
+		AdditionalAddrs:  addrs[1:],
+		Network:          *network,
+		Backlog:          *backlog,
+		ReadTimeout:      *readTimeoutFlag,
+		IndexReadTimeout: *indexReadTimeout,
+		QueryReadTimeout: *queryReadTimeout,
+		MaxConnLifetime:  *maxConnLifetime,
+		TCPNoDelay:       *tcpNoDelay,
+		Verbose:          *verbose,
+		StrictDeps:       *strictDeps,
+		EscapedNames:     *escapedNames,
+		LabeledDeps:      *labeledDeps,
+		RequestIDs:       *requestIDs,
+		CommandTimeout:   *commandTimeout,
+		Framing:          framing,
+		CommandLog:       commandLog,
+		MaxGoroutines:    *maxGoroutines,
+		MaxConns:         *maxConns,
+		MaxPipelineDepth: *maxPipelineDepth,
+		SoftMaxConns:     *softMaxConns,
+		RateLimitPerConn: *rateLimitPerConn,
+		RateLimitGlobal:  *rateLimitGlobal,
+		MaxPackages:      *maxPackages,
+		EvictLRU:         *evictLRU,
+		RejectCycles:     *rejectCycles,
+		AllowCommands:    allowed,
+		DenyCommands:     denied,
+		ReadOnly:         *readOnly,
+		ResultCacheSize:  *resultCacheSize,
+
+		ShedLatencyThreshold:   *shedLatency,
+		ShutdownReadinessDelay: *shutdownReadinessDelay,
+		Metrics:                metricsRecorder,
+		AdaptiveReadTimeout:    *adaptiveReadTimeout,
+		MinReadTimeout:         *minReadTimeout,
+		MaxReadTimeout:         *maxReadTimeout,
+	})
+
+	// Preload packages before the listener opens so the first client sees a complete index
+	if *preloadFile != "" {
+		count, err := preloadPackages(srv, *preloadFile)
+		if err != nil {
+			return fmt.Errorf("preload failed: %w", err)
+		}
+		slog.Info("Preloaded packages", "file", *preloadFile, "count", count)
+	}
+
 	serverErr := make(chan error, 1)
 	go func() {
-		slog.Info("Starting package indexer server", "addr", *addr)
+		slog.Info("Starting package indexer server", "addrs", addrs.String())
 		serverErr <- srv.StartWithContext(ctx)
 	}()
 
+	// Optionally push metrics to StatsD for environments that do not scrape Prometheus
+	if *statsdAddr != "" {
+		if err := startStatsdPusher(ctx, *statsdAddr, *statsdInterval, srv); err != nil {
+			return fmt.Errorf("invalid -statsd-addr: %w", err)
+		}
+	}
+
 	// Start optional admin HTTP server for observability
 	var adminServer *http.Server
+	var adminErr <-chan error // nil (never ready) when the admin server is disabled
 	if *adminAddr != "" {
-		adminServer = startAdminServer(ctx, *adminAddr, srv)
+		adminServer, adminErr = startAdminServerWithConfig(ctx, adminConfig{
+			Addr:          *adminAddr,
+			User:          *adminUser,
+			Pass:          *adminPass,
+			PublicHealthz: *adminHealthzPublic,
+			TLSCert:       *adminTLSCert,
+			TLSKey:        *adminTLSKey,
+			DisablePprof:  !*enablePprof,
+			ReloadFile:    *preloadFile,
+		}, srv)
 	}
 
-	// Wait for stop signal or server error
-	select {
-	case <-stop:
-		slog.Info("Received shutdown signal")
-	case err := <-serverErr:
-		return fmt.Errorf("server error: %w", err)
+	// Wait for stop signal or server error; admin failures are fatal only when required
+	for stopped := false; !stopped; {
+		select {
+		case <-stop:
+			slog.Info("Received shutdown signal")
+			stopped = true
+		case err := <-serverErr:
+			return fmt.Errorf("server error: %w", err)
+		case err := <-adminErr:
+			if *adminRequired {
+				return fmt.Errorf("admin server failed: %w", err)
+			}
+			slog.Warn("Admin server unavailable, continuing without it", "error", err)
+			adminErr = nil
+		}
 	}
 
-	// Initiate graceful shutdown with timeout
-	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), *shutdownTimeoutFlag)
+	// Initiate graceful shutdown with timeout; the readiness delay does not eat into it
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), *shutdownTimeoutFlag+*shutdownReadinessDelay)
 	defer shutdownCancel()
 
 	// Shutdown main server
@@ -126,17 +439,304 @@ func run() error {
 	return nil
 }
 
+// preloadPackages indexes the packages declared in the given file
+func preloadPackages(srv *server.Server, path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return srv.Preload(f)
+}
+
+// reloadPackages atomically replaces the index with the packages declared in the given
+// file, keeping the current index if the file cannot be read or indexed
+func reloadPackages(srv *server.Server, path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return srv.Reload(f)
+}
+
+// collectMetrics gathers every scalar metric the server exports, shared by the Prometheus
+// endpoint and the StatsD pusher
+func collectMetrics(srv *server.Server, memStats *memStatsCache) []prometheusMetric {
+	metrics := srv.GetMetrics()
+	stats := srv.GetStats()
+	limits := srv.Config()
+	ops := srv.OperationStats()
+
+	// Define all metrics in a structured way to eliminate duplication
+	return []prometheusMetric{
+		{
+			name:       "package_indexer_connections_total",
+			help:       "Total number of connections handled.",
+			metricType: "counter",
+			value:      metrics.ConnectionsTotal,
+		},
+		{
+			name:       "package_indexer_commands_processed_total",
+			help:       "Total number of commands processed.",
+			metricType: "counter",
+			value:      metrics.CommandsProcessed,
+		},
+		{
+			name:       "package_indexer_errors_total",
+			help:       "Total number of processing errors.",
+			metricType: "counter",
+			value:      metrics.ErrorCount,
+		},
+		{
+			name:       "package_indexer_server_overloaded_total",
+			help:       "Total number of connections rejected by load shedding.",
+			metricType: "counter",
+			value:      metrics.ServerOverloaded,
+		},
+		{
+			name:       "package_indexer_command_timeouts_total",
+			help:       "Total number of commands that exceeded the command timeout.",
+			metricType: "counter",
+			value:      metrics.CommandTimeouts,
+		},
+		{
+			name:       "package_indexer_panics_recovered_total",
+			help:       "Total number of connection handler panics recovered.",
+			metricType: "counter",
+			value:      metrics.PanicsRecovered,
+		},
+		{
+			name:       "package_indexer_goroutine_rejected_total",
+			help:       "Total number of connections refused by the goroutine ceiling.",
+			metricType: "counter",
+			value:      metrics.GoroutineRejected,
+		},
+		{
+			name:       "package_indexer_responses_ok_total",
+			help:       "Total number of commands answered with OK.",
+			metricType: "counter",
+			value:      metrics.ResponsesOK,
+		},
+		{
+			name:       "package_indexer_responses_fail_total",
+			help:       "Total number of commands answered with FAIL.",
+			metricType: "counter",
+			value:      metrics.ResponsesFail,
+		},
+		{
+			name:       "package_indexer_responses_error_total",
+			help:       "Total number of commands answered with ERROR.",
+			metricType: "counter",
+			value:      metrics.ResponsesError,
+		},
+		{
+			name:       "package_indexer_connections_rejected_total",
+			help:       "Total number of connections refused by the hard connection limit.",
+			metricType: "counter",
+			value:      metrics.ConnsRejected,
+		},
+		{
+			name:       "package_indexer_soft_limit_warnings_total",
+			help:       "Total number of connections accepted above the soft connection limit.",
+			metricType: "counter",
+			value:      metrics.SoftLimitWarnings,
+		},
+		{
+			name:       "package_indexer_result_cache_hits_total",
+			help:       "Total number of read commands answered from the result cache.",
+			metricType: "counter",
+			value:      metrics.ResultCacheHits,
+		},
+		{
+			name:       "package_indexer_result_cache_misses_total",
+			help:       "Total number of cacheable read commands that had to reach the index.",
+			metricType: "counter",
+			value:      metrics.ResultCacheMisses,
+		},
+		{
+			name:       "package_indexer_circuit_breaker_open_total",
+			help:       "Total number of times a downstream circuit breaker tripped open.",
+			metricType: "counter",
+			value:      metrics.CircuitBreakerOpen,
+		},
+		{
+			name:       "package_indexer_indexer_index_attempts_total",
+			help:       "Total number of index operations attempted by the indexer.",
+			metricType: "counter",
+			value:      ops.IndexAttempts,
+		},
+		{
+			name:       "package_indexer_indexer_index_successes_total",
+			help:       "Total number of index operations the indexer accepted.",
+			metricType: "counter",
+			value:      ops.IndexSuccesses,
+		},
+		{
+			name:       "package_indexer_indexer_remove_attempts_total",
+			help:       "Total number of remove operations attempted by the indexer.",
+			metricType: "counter",
+			value:      ops.RemoveAttempts,
+		},
+		{
+			name:       "package_indexer_indexer_remove_blocked_total",
+			help:       "Total number of remove operations refused because of dependents.",
+			metricType: "counter",
+			value:      ops.RemoveBlocked,
+		},
+		{
+			name:       "package_indexer_indexer_remove_pinned_total",
+			help:       "Total number of remove operations refused because the package was pinned.",
+			metricType: "counter",
+			value:      ops.RemovePinned,
+		},
+		{
+			name:       "package_indexer_query_hits_total",
+			help:       "Total number of queries for indexed packages.",
+			metricType: "counter",
+			value:      ops.QueryHits,
+		},
+		{
+			name:       "package_indexer_query_misses_total",
+			help:       "Total number of queries for packages that are not indexed.",
+			metricType: "counter",
+			value:      ops.QueryMisses,
+		},
+		{
+			name:       "package_indexer_capacity_rejections_total",
+			help:       "Total number of new packages refused because the package limit was reached.",
+			metricType: "counter",
+			value:      ops.CapacityRejections,
+		},
+		{
+			name:       "package_indexer_evictions_total",
+			help:       "Total number of packages evicted to make room in LRU mode.",
+			metricType: "counter",
+			value:      ops.Evictions,
+		},
+		{
+			name:       "package_indexer_command_duration_seconds_avg",
+			help:       "Mean command processing time in seconds since start.",
+			metricType: "gauge",
+			value:      metrics.AvgCommandDuration.Seconds(),
+		},
+		{
+			name:       "package_indexer_packages_indexed_current",
+			help:       "Current number of indexed packages.",
+			metricType: "gauge",
+			value:      stats.Indexed,
+		},
+		{
+			name:       "package_indexer_packages_pinned_current",
+			help:       "Current number of pinned packages.",
+			metricType: "gauge",
+			value:      len(srv.Pinned()),
+		},
+		{
+			name:       "package_indexer_uptime_seconds",
+			help:       "Server uptime in seconds.",
+			metricType: "gauge",
+			value:      metrics.Uptime.Seconds(),
+		},
+		{
+			name:       "package_indexer_goroutines",
+			help:       "Current number of goroutines.",
+			metricType: "gauge",
+			value:      runtime.NumGoroutine(),
+		},
+		{
+			name:       "package_indexer_rate_limit_per_conn",
+			help:       "Configured per-connection command rate limit in commands per second (0 means disabled).",
+			metricType: "gauge",
+			value:      limits.RateLimitPerConn,
+		},
+		{
+			name:       "package_indexer_rate_limit_global",
+			help:       "Configured server-wide command rate limit in commands per second (0 means disabled).",
+			metricType: "gauge",
+			value:      limits.RateLimitGlobal,
+		},
+		{
+			name:       "package_indexer_heap_bytes",
+			help:       "Bytes of allocated heap objects (cached for a few seconds).",
+			metricType: "gauge",
+			value:      memStats.HeapAlloc(),
+		},
+	}
+}
+
+// metricsDeltaHandler returns a handler reporting metric deltas since its previous
+// invocation. The first call reports deltas since server start.
+func metricsDeltaHandler(srv *server.Server) http.HandlerFunc {
+	var (
+		mu       sync.Mutex
+		previous server.MetricsSnapshot
+	)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		current := srv.GetMetrics()
+		delta := current.Delta(previous)
+		previous = current
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"connections_total":            delta.ConnectionsTotal,
+			"commands_processed":           delta.CommandsProcessed,
+			"errors":                       delta.ErrorCount,
+			"packages_indexed":             delta.PackagesIndexed,
+			"server_overloaded":            delta.ServerOverloaded,
+			"command_timeouts":             delta.CommandTimeouts,
+			"panics_recovered":             delta.PanicsRecovered,
+			"goroutine_rejected":           delta.GoroutineRejected,
+			"responses_ok":                 delta.ResponsesOK,
+			"responses_fail":               delta.ResponsesFail,
+			"responses_error":              delta.ResponsesError,
+			"conns_rejected":               delta.ConnsRejected,
+			"soft_limit_warnings":          delta.SoftLimitWarnings,
+			"result_cache_hits":            delta.ResultCacheHits,
+			"result_cache_misses":          delta.ResultCacheMisses,
+			"circuit_breaker_open":         delta.CircuitBreakerOpen,
+			"avg_command_duration_seconds": delta.AvgCommandDuration.Seconds(),
+			"elapsed_seconds":              delta.Uptime.Seconds(),
+		})
+	}
+}
+
 // startAdminServer creates and starts the optional admin HTTP server for observability.
 // Provides health checks, metrics endpoint, and pprof debugging capabilities isolated
 // from the main TCP protocol. Designed for production monitoring and debugging workflows.
-func startAdminServer(ctx context.Context, addr string, srv *server.Server) *http.Server {
+// The returned channel receives the error if the server fails to bind or serve.
+func startAdminServer(ctx context.Context, addr string, srv *server.Server) (*http.Server, <-chan error) {
+	return startAdminServerWithConfig(ctx, adminConfig{Addr: addr}, srv)
+}
+
+// startAdminServerWithConfig starts the admin HTTP server with the full set of options
+func startAdminServerWithConfig(ctx context.Context, cfg adminConfig, srv *server.Server) (*http.Server, <-chan error) {
+	addr := cfg.Addr
 	mux := http.NewServeMux()
 
-	// Health check endpoint with readiness/liveness semantics
-	// Readiness: TCP listener must be operational
-	// Liveness: Process is running (always true if we reach this handler)
+	// Liveness endpoint: returns 200 whenever the process can serve HTTP, so a liveness
+	// probe never restarts a server that is merely starting up or draining
 	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		response := map[string]interface{}{
+			"status":     "healthy",
+			"readiness":  srv.IsReady(), // Informational; probe /ready for readiness
+			"liveness":   true,          // Process operational
+			"subsystems": srv.Health(),  // Per-subsystem ok/degraded/failed diagnostics
+		}
+
+		json.NewEncoder(w).Encode(response)
+	})
+
+	// Readiness endpoint: 200 only while the TCP listener is bound and the server is not
+	// shutting down, so load balancers stop routing before connections are drained
+	mux.HandleFunc("/ready", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
 
 		ready := srv.IsReady()
 		status := http.StatusOK
@@ -144,65 +744,112 @@ func startAdminServer(ctx context.Context, addr string, srv *server.Server) *htt
 			status = http.StatusServiceUnavailable
 		}
 		w.WriteHeader(status)
-
-		// In production, readiness would check if TCP server is accepting connections
-		// For this implementation, we assume readiness once the main server starts
-		response := map[string]interface{}{
-			"status":    "healthy",
-			"readiness": ready, // TCP listener operational
-			"liveness":  true,  // Process operational
-		}
-
-		json.NewEncoder(w).Encode(response)
+		json.NewEncoder(w).Encode(map[string]interface{}{"ready": ready})
 	})
 
 	// Metrics endpoint exposing operational statistics in Prometheus format
 	// Enables integration with industry-standard monitoring tools like Prometheus and Grafana
+	memStats := &memStatsCache{ttl: memStatsTTL}
 	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
-		metrics := srv.GetMetrics()
-		stats := srv.GetStats()
-
-		// Define all metrics in a structured way to eliminate duplication
-		prometheusMetrics := []prometheusMetric{
-			{
-				name:       "package_indexer_connections_total",
-				help:       "Total number of connections handled.",
-				metricType: "counter",
-				value:      metrics.ConnectionsTotal,
-			},
-			{
-				name:       "package_indexer_commands_processed_total",
-				help:       "Total number of commands processed.",
-				metricType: "counter",
-				value:      metrics.CommandsProcessed,
-			},
-			{
-				name:       "package_indexer_errors_total",
-				help:       "Total number of processing errors.",
-				metricType: "counter",
-				value:      metrics.ErrorCount,
-			},
-			{
-				name:       "package_indexer_packages_indexed_current",
-				help:       "Current number of indexed packages.",
-				metricType: "gauge",
-				value:      stats.Indexed,
-			},
-			{
-				name:       "package_indexer_uptime_seconds",
-				help:       "Server uptime in seconds.",
+		if !srv.MetricsEnabled() {
+			fmt.Fprintln(w, "# Metrics recording is disabled (-no-metrics)")
+			writePrometheusMetric(w, prometheusMetric{
+				name:       metricsEnabledMetric,
+				help:       "Whether the server records metrics (0 with -no-metrics).",
 				metricType: "gauge",
-				value:      metrics.Uptime.Seconds(),
-			},
+				value:      0,
+			})
+			return
 		}
+		prometheusMetrics := collectMetrics(srv, memStats)
 
-		// Write all metrics using the helper function
-		for _, metric := range prometheusMetrics {
+		// Write all metrics (or only those named via ?name=) using the helper function
+		names := r.URL.Query()["name"]
+		for _, metric := range filterPrometheusMetrics(prometheusMetrics, names) {
 			writePrometheusMetric(w, metric)
 		}
+		if metricRequested(names, commandLatencyMetric) {
+			writePrometheusHistogram(w, commandLatencyMetric,
+				"Command latency in seconds, by reply outcome (ok, fail, error).", srv.LatencyHistograms())
+		}
+	})
+
+	// Delta endpoint reports counter changes since the previous call for ad-hoc debugging
+	mux.HandleFunc("/metrics/delta", metricsDeltaHandler(srv))
+
+	// Subtree size endpoint reports how much of the graph a package reaches, to spot
+	// expensive imports and removals ahead of time
+	mux.HandleFunc("/subtree-size", func(w http.ResponseWriter, r *http.Request) {
+		pkg := r.URL.Query().Get("pkg")
+		if pkg == "" {
+			http.Error(w, "missing pkg query parameter", http.StatusBadRequest)
+			return
+		}
+		deps, dependents, ok := srv.SubtreeSize(pkg)
+		if !ok {
+			http.Error(w, "package not indexed", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"package":                 pkg,
+			"transitive_dependencies": deps,
+			"transitive_dependents":   dependents,
+		})
+	})
+
+	// Orphans endpoint lists isolated packages (no dependencies, no dependents), to help
+	// spot stale standalone packages for cleanup
+	mux.HandleFunc("/orphans", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"orphans": srv.Orphans(),
+		})
+	})
+
+	// Cycles endpoint reports dependency cycles, which leave their packages unremovable,
+	// for diagnosing graphs that were re-indexed into a cyclic state
+	mux.HandleFunc("/cycles", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		cycles := srv.FindCycles()
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"count":  len(cycles),
+			"cycles": cycles,
+		})
+	})
+
+	// Recent errors endpoint lists the latest ERROR replies, oldest first, so failures
+	// can be inspected without tailing logs
+	mux.HandleFunc("/errors", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(srv.RecentErrors())
 	})
 
+	// Reload endpoint re-reads the preload snapshot and swaps it in atomically, so a
+	// replica can refresh without restarting; on failure the current index keeps serving
+	if cfg.ReloadFile != "" {
+		mux.HandleFunc("/reload", func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				w.Header().Set("Allow", http.MethodPost)
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			count, err := reloadPackages(srv, cfg.ReloadFile)
+			if err != nil {
+				slog.Error("Reload failed, keeping current index", "file", cfg.ReloadFile, "error", err)
+				http.Error(w, "reload failed: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			slog.Info("Reloaded packages", "file", cfg.ReloadFile, "count", count)
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"file":     cfg.ReloadFile,
+				"packages": count,
+			})
+		})
+	}
+
 	// Build info endpoint provides versioning details for release diagnostics
 	mux.HandleFunc("/buildinfo", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
@@ -226,27 +873,69 @@ func startAdminServer(ctx context.Context, addr string, srv *server.Server) *htt
 	// Architecture decision: Isolates debugging capabilities from main TCP protocol for security
 	// Provides CPU profiling, memory analysis, goroutine inspection, and more
 	// Access via /debug/pprof/, /debug/pprof/goroutine, /debug/pprof/heap, etc.
-	mux.HandleFunc("/debug/pprof/", pprof.Index)          // Profile index and navigation
-	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline) // Command line arguments
-	mux.HandleFunc("/debug/pprof/profile", pprof.Profile) // CPU profiling
-	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)   // Symbol resolution
-	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)     // Execution tracing
+	// Can be left unmounted (-enable-pprof=false) where profiling must not be exposed
+	if !cfg.DisablePprof {
+		mux.HandleFunc("/debug/pprof/", pprof.Index)          // Profile index and navigation
+		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline) // Command line arguments
+		mux.HandleFunc("/debug/pprof/profile", pprof.Profile) // CPU profiling
+		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)   // Symbol resolution
+		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)     // Execution tracing
+	}
+
+	var handler http.Handler = mux
+	if cfg.authEnabled() {
+		public := map[string]bool{}
+		if cfg.PublicHealthz {
+			public["/healthz"] = true
+			public["/ready"] = true
+		}
+		handler = requireBasicAuth(mux, cfg.User, cfg.Pass, public)
+	}
 
 	adminServer := &http.Server{
 		Addr:              addr,
-		Handler:           mux,
+		Handler:           handler,
 		ReadHeaderTimeout: defaultAdminReadHeaderTimeout,
 		ReadTimeout:       defaultAdminReadTimeout,
 		WriteTimeout:      defaultAdminWriteTimeout,
 		IdleTimeout:       defaultAdminIdleTimeout,
 	}
 
+	errCh := make(chan error, 1)
 	go func() {
-		slog.Info("Starting admin HTTP server", "addr", addr)
-		if err := adminServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		slog.Info("Starting admin HTTP server", "addr", addr, "tls", cfg.tlsEnabled())
+		var err error
+		if cfg.tlsEnabled() {
+			err = adminServer.ListenAndServeTLS(cfg.TLSCert, cfg.TLSKey)
+		} else {
+			err = adminServer.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			slog.Error("Admin server error", "error", err)
+			errCh <- err
 		}
 	}()
 
-	return adminServer
+	return adminServer, errCh
+}
+
+// requireBasicAuth wraps next so every request outside publicPaths must carry the
+// configured basic-auth credentials, otherwise it receives 401 Unauthorized.
+// Credentials are compared in constant time.
+func requireBasicAuth(next http.Handler, user, pass string, publicPaths map[string]bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if publicPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		u, p, ok := r.BasicAuth()
+		userOK := subtle.ConstantTimeCompare([]byte(u), []byte(user)) == 1
+		passOK := subtle.ConstantTimeCompare([]byte(p), []byte(pass)) == 1
+		if !ok || !userOK || !passOK {
+			w.Header().Set("WWW-Authenticate", `Basic realm="package-indexer admin"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
 }
@@ -1,21 +1,32 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
+	"encoding/pem"
 	"flag"
 	"fmt"
 	"io"
 	"log/slog"
+	"math/big"
 	"net"
 	"net/http"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 	"syscall"
 	"testing"
 	"time"
 
+	"package-indexer/internal/indexer"
 	"package-indexer/internal/server"
 )
 
@@ -315,7 +326,7 @@ func TestAdminServer_StartupShutdown(t *testing.T) {
 	defer cancel()
 
 	// Start admin server
-	adminServer := startAdminServer(ctx, adminAddr, srv)
+	adminServer, _ := startAdminServer(ctx, adminAddr, srv)
 	defer func() {
 		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer shutdownCancel()
@@ -327,7 +338,7 @@ func TestAdminServer_StartupShutdown(t *testing.T) {
 
 	// Test that server is running by making a request
 	// It's not "ready" yet because the main server isn't started, so expect 503
-	resp, err := http.Get(fmt.Sprintf("http://%s/healthz", adminAddr))
+	resp, err := http.Get(fmt.Sprintf("http://%s/ready", adminAddr))
 	if err != nil {
 		t.Fatalf("Admin server not responding: %v", err)
 	}
@@ -352,7 +363,7 @@ func TestAdminServer_HealthzEndpoint(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	adminServer := startAdminServer(ctx, adminAddr, srv)
+	adminServer, _ := startAdminServer(ctx, adminAddr, srv)
 	defer func() {
 		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer shutdownCancel()
@@ -361,7 +372,7 @@ func TestAdminServer_HealthzEndpoint(t *testing.T) {
 
 	time.Sleep(100 * time.Millisecond)
 
-	// Test healthz endpoint when server is NOT ready
+	// Test healthz endpoint when server is NOT ready: liveness still holds
 	resp, err := http.Get(fmt.Sprintf("http://%s/healthz", adminAddr))
 	if err != nil {
 		t.Fatalf("Failed to call healthz endpoint: %v", err)
@@ -369,8 +380,8 @@ func TestAdminServer_HealthzEndpoint(t *testing.T) {
 	defer resp.Body.Close()
 
 	// Check status code
-	if resp.StatusCode != http.StatusServiceUnavailable {
-		t.Errorf("Expected status 503 when not ready, got %d", resp.StatusCode)
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status 200 when not ready, got %d", resp.StatusCode)
 	}
 
 	// Start the main server to make it ready
@@ -418,7 +429,7 @@ func TestAdminServer_HealthzEndpoint(t *testing.T) {
 	}
 
 	// Validate response structure
-	expectedFields := []string{"status", "readiness", "liveness"}
+	expectedFields := []string{"status", "readiness", "liveness", "subsystems"}
 	for _, field := range expectedFields {
 		if _, exists := healthResp[field]; !exists {
 			t.Errorf("Missing field %s in health response", field)
@@ -435,6 +446,13 @@ func TestAdminServer_HealthzEndpoint(t *testing.T) {
 	if healthResp["liveness"] != true {
 		t.Errorf("Expected liveness true, got %v", healthResp["liveness"])
 	}
+	subsystems, _ := healthResp["subsystems"].(map[string]interface{})
+	for _, name := range []string{"listener", "indexer"} {
+		sub, _ := subsystems[name].(map[string]interface{})
+		if sub["status"] != server.HealthOK {
+			t.Errorf("Expected subsystem %s ok, got %v", name, subsystems[name])
+		}
+	}
 }
 
 // TestAdminServer_MetricsEndpoint tests the metrics endpoint
@@ -451,7 +469,7 @@ func TestAdminServer_MetricsEndpoint(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	adminServer := startAdminServer(ctx, adminAddr, srv)
+	adminServer, _ := startAdminServer(ctx, adminAddr, srv)
 	defer func() {
 		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer shutdownCancel()
@@ -492,6 +510,12 @@ func TestAdminServer_MetricsEndpoint(t *testing.T) {
 		"# HELP package_indexer_packages_indexed_current",
 		"# TYPE package_indexer_packages_indexed_current gauge",
 		"package_indexer_packages_indexed_current 0",
+		"package_indexer_packages_pinned_current 0",
+		"# TYPE package_indexer_indexer_index_attempts_total counter",
+		"package_indexer_query_hits_total 0",
+		"package_indexer_query_misses_total 0",
+		"# TYPE package_indexer_command_duration_seconds histogram",
+		`package_indexer_command_duration_seconds_count{outcome="error"} 0`,
 	}
 	for _, sub := range expectedSubstrings {
 		if !strings.Contains(bodyStr, sub) {
@@ -514,7 +538,7 @@ func TestAdminServer_BuildInfoEndpoint(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	adminServer := startAdminServer(ctx, adminAddr, srv)
+	adminServer, _ := startAdminServer(ctx, adminAddr, srv)
 	defer shutdownAdminServer(adminServer)()
 
 	time.Sleep(testServerStartupDelay)
@@ -574,7 +598,7 @@ func TestAdminServer_PprofEndpoints(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	adminServer := startAdminServer(ctx, adminAddr, srv)
+	adminServer, _ := startAdminServer(ctx, adminAddr, srv)
 	defer func() {
 		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer shutdownCancel()
@@ -643,7 +667,7 @@ func TestAdminServer_DisabledByDefault(t *testing.T) {
 	if *adminAddr != "" {
 		srv := server.NewServer(*addr, server.DefaultReadTimeout)
 		ctx := context.Background()
-		adminServer = startAdminServer(ctx, *adminAddr, srv)
+		adminServer, _ = startAdminServer(ctx, *adminAddr, srv)
 	}
 
 	if adminServer != nil {
@@ -679,7 +703,7 @@ func TestAdminServer_Integration(t *testing.T) {
 	}()
 
 	// Start admin server
-	adminServer := startAdminServer(ctx, adminAddr, srv)
+	adminServer, _ := startAdminServer(ctx, adminAddr, srv)
 	defer shutdownBothServers(srv, adminServer)()
 
 	time.Sleep(testServerStartupDelay) // Give servers time to start
@@ -774,3 +798,882 @@ func TestRun_GracefulShutdown_Signal(t *testing.T) {
 		t.Fatal("timed out waiting for graceful shutdown")
 	}
 }
+
+// TestAdminServer_MetricsDeltaEndpoint verifies the delta endpoint reports only the
+// activity that happened between consecutive calls.
+func TestAdminServer_MetricsDeltaEndpoint(t *testing.T) {
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to find available port: %v", err)
+	}
+	adminAddr := listener.Addr().String()
+	listener.Close()
+
+	mainListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to find available port for main server: %v", err)
+	}
+	mainAddr := mainListener.Addr().String()
+	mainListener.Close()
+
+	srv := server.NewServer(mainAddr, server.DefaultReadTimeout)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go srv.StartWithContext(ctx)
+	<-srv.Ready()
+
+	adminServer, _ := startAdminServer(ctx, adminAddr, srv)
+	defer shutdownBothServers(srv, adminServer)()
+	time.Sleep(testServerStartupDelay)
+
+	getDelta := func() map[string]float64 {
+		t.Helper()
+		resp, err := http.Get(fmt.Sprintf("http://%s/metrics/delta", adminAddr))
+		if err != nil {
+			t.Fatalf("Failed to call delta endpoint: %v", err)
+		}
+		defer resp.Body.Close()
+		var delta map[string]float64
+		if err := json.NewDecoder(resp.Body).Decode(&delta); err != nil {
+			t.Fatalf("Failed to parse delta response: %v", err)
+		}
+		return delta
+	}
+
+	sendCommands := func(commands ...string) {
+		t.Helper()
+		conn, err := net.Dial("tcp", mainAddr)
+		if err != nil {
+			t.Fatalf("Failed to connect to main server: %v", err)
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		for _, cmd := range commands {
+			fmt.Fprint(conn, cmd)
+			if _, err := reader.ReadString('\n'); err != nil {
+				t.Fatalf("Failed to read response: %v", err)
+			}
+		}
+	}
+
+	sendCommands("INDEX|a|\n")
+	first := getDelta()
+	if first["connections_total"] != 1 || first["commands_processed"] != 1 {
+		t.Errorf("unexpected first delta: %v", first)
+	}
+
+	sendCommands("INDEX|b|a\n", "QUERY|b|\n", "BROKEN\n")
+	second := getDelta()
+	expected := map[string]float64{
+		"connections_total":  1,
+		"commands_processed": 3,
+		"errors":             1,
+		"packages_indexed":   1,
+	}
+	for field, want := range expected {
+		if second[field] != want {
+			t.Errorf("second delta %s = %v, want %v", field, second[field], want)
+		}
+	}
+	if second["elapsed_seconds"] <= 0 {
+		t.Errorf("expected positive elapsed_seconds, got %v", second["elapsed_seconds"])
+	}
+}
+
+// TestAddrList_Repeatable verifies the -addr flag collects every occurrence in order.
+func TestAddrList_Repeatable(t *testing.T) {
+	fs := flag.NewFlagSet("program", flag.ContinueOnError)
+	var addrs addrList
+	fs.Var(&addrs, "addr", "Server listen address")
+
+	if err := fs.Parse([]string{"-addr", "10.0.0.1:8080", "-addr=:9090"}); err != nil {
+		t.Fatalf("failed to parse flags: %v", err)
+	}
+
+	if len(addrs) != 2 || addrs[0] != "10.0.0.1:8080" || addrs[1] != ":9090" {
+		t.Errorf("expected both addresses in order, got %v", addrs)
+	}
+	if addrs.String() != "10.0.0.1:8080,:9090" {
+		t.Errorf("unexpected String() output %q", addrs.String())
+	}
+}
+
+// TestRun_PreloadMalformedFile verifies a malformed preload file fails startup with a clear error.
+func TestRun_PreloadMalformedFile(t *testing.T) {
+	defer isolateFlags(t)()
+
+	path := t.TempDir() + "/preload.txt"
+	if err := os.WriteFile(path, []byte("a: b\nnot a valid line\n"), 0o644); err != nil {
+		t.Fatalf("failed to write preload file: %v", err)
+	}
+
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	os.Args = []string{"program", "-addr", "127.0.0.1:0", "-quiet", "-preload", path}
+
+	err := run()
+	if err == nil || !strings.Contains(err.Error(), "preload failed") {
+		t.Fatalf("expected preload failure from run(), got %v", err)
+	}
+}
+
+// TestAdminServer_BindFailure verifies that an admin bind failure is reported to the
+// caller and is fatal to run() only when -admin-required is set.
+func TestAdminServer_BindFailure(t *testing.T) {
+	occupied, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to reserve admin port: %v", err)
+	}
+	defer occupied.Close()
+	adminAddr := occupied.Addr().String()
+
+	srv := server.NewServer(":0", server.DefaultReadTimeout)
+	adminServer, errCh := startAdminServer(context.Background(), adminAddr, srv)
+	defer shutdownAdminServer(adminServer)()
+
+	select {
+	case err := <-errCh:
+		if err == nil {
+			t.Error("expected a bind error on the admin error channel")
+		}
+	case <-time.After(testShutdownTimeout):
+		t.Fatal("timed out waiting for admin bind failure")
+	}
+
+	defer isolateFlags(t)()
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	os.Args = []string{"program", "-addr", "127.0.0.1:0", "-quiet", "-admin", adminAddr, "-admin-required"}
+
+	done := make(chan error, 1)
+	go func() { done <- run() }()
+
+	select {
+	case err := <-done:
+		if err == nil || !strings.Contains(err.Error(), "admin server failed") {
+			t.Fatalf("expected admin failure from run(), got %v", err)
+		}
+	case <-time.After(testShutdownTimeout):
+		t.Fatal("run() did not exit after required admin server failed")
+	}
+}
+
+// TestAdminServer_BasicAuth verifies admin endpoints reject missing or wrong credentials
+// with 401, accept valid ones, and optionally leave /healthz public.
+func TestAdminServer_BasicAuth(t *testing.T) {
+	for _, publicHealthz := range []bool{false, true} {
+		listener, err := net.Listen("tcp", ":0")
+		if err != nil {
+			t.Fatalf("Failed to find available port: %v", err)
+		}
+		adminAddr := listener.Addr().String()
+		listener.Close()
+
+		srv := server.NewServer(":0", server.DefaultReadTimeout)
+		adminServer, _ := startAdminServerWithConfig(context.Background(), adminConfig{
+			Addr:          adminAddr,
+			User:          "ops",
+			Pass:          "secret",
+			PublicHealthz: publicHealthz,
+		}, srv)
+		time.Sleep(testServerStartupDelay)
+
+		get := func(path, user, pass string) int {
+			t.Helper()
+			req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("http://%s%s", adminAddr, path), nil)
+			if user != "" || pass != "" {
+				req.SetBasicAuth(user, pass)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("request to %s failed: %v", path, err)
+			}
+			resp.Body.Close()
+			return resp.StatusCode
+		}
+
+		for _, path := range []string{"/metrics", "/buildinfo", "/debug/pprof/"} {
+			if status := get(path, "", ""); status != http.StatusUnauthorized {
+				t.Errorf("%s without credentials: expected 401, got %d", path, status)
+			}
+			if status := get(path, "ops", "wrong"); status != http.StatusUnauthorized {
+				t.Errorf("%s with wrong password: expected 401, got %d", path, status)
+			}
+			if status := get(path, "ops", "secret"); status != http.StatusOK {
+				t.Errorf("%s with valid credentials: expected 200, got %d", path, status)
+			}
+		}
+
+		// The main server is not started, so an authorized ready reports 503 while
+		// healthz reports liveness
+		for path, unauthenticated := range map[string]int{"/healthz": http.StatusOK, "/ready": http.StatusServiceUnavailable} {
+			expected := http.StatusUnauthorized
+			if publicHealthz {
+				expected = unauthenticated
+			}
+			if status := get(path, "", ""); status != expected {
+				t.Errorf("%s without credentials (public=%v): expected %d, got %d", path, publicHealthz, expected, status)
+			}
+			if status := get(path, "ops", "secret"); status != unauthenticated {
+				t.Errorf("%s with valid credentials: expected %d, got %d", path, unauthenticated, status)
+			}
+		}
+
+		shutdownAdminServer(adminServer)()
+	}
+}
+
+// writeSelfSignedCert writes a self-signed localhost certificate and key to dir and
+// returns their paths along with a pool trusting the certificate.
+func writeSelfSignedCert(t *testing.T, dir string) (certFile, keyFile string, pool *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+
+	certFile = dir + "/cert.pem"
+	keyFile = dir + "/key.pem"
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err := os.WriteFile(certFile, certPEM, 0o600); err != nil {
+		t.Fatalf("failed to write certificate: %v", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+
+	pool = x509.NewCertPool()
+	pool.AppendCertsFromPEM(certPEM)
+	return certFile, keyFile, pool
+}
+
+// TestAdminServer_TLS verifies the admin server serves /healthz over HTTPS with a
+// self-signed certificate when TLS files are configured.
+func TestAdminServer_TLS(t *testing.T) {
+	certFile, keyFile, pool := writeSelfSignedCert(t, t.TempDir())
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to find available port: %v", err)
+	}
+	adminAddr := listener.Addr().String()
+	listener.Close()
+
+	srv := server.NewServer(":0", server.DefaultReadTimeout)
+	adminServer, _ := startAdminServerWithConfig(context.Background(), adminConfig{
+		Addr:    adminAddr,
+		TLSCert: certFile,
+		TLSKey:  keyFile,
+	}, srv)
+	defer shutdownAdminServer(adminServer)()
+	time.Sleep(testServerStartupDelay)
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+	resp, err := client.Get(fmt.Sprintf("https://%s/ready", adminAddr))
+	if err != nil {
+		t.Fatalf("HTTPS ready request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503 before main server start, got %d", resp.StatusCode)
+	}
+
+	// Plain HTTP is refused by the TLS listener
+	if resp, err := http.Get(fmt.Sprintf("http://%s/healthz", adminAddr)); err == nil {
+		if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusServiceUnavailable {
+			t.Errorf("expected plain HTTP to be rejected, got %d", resp.StatusCode)
+		}
+		resp.Body.Close()
+	}
+}
+
+// TestAdminServer_PprofDisabled verifies the pprof endpoints are not mounted when
+// disabled, while the rest of the admin server keeps serving.
+func TestAdminServer_PprofDisabled(t *testing.T) {
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to find available port: %v", err)
+	}
+	adminAddr := listener.Addr().String()
+	listener.Close()
+
+	srv := server.NewServer(":0", server.DefaultReadTimeout)
+	adminServer, _ := startAdminServerWithConfig(context.Background(), adminConfig{
+		Addr:         adminAddr,
+		DisablePprof: true,
+	}, srv)
+	defer shutdownAdminServer(adminServer)()
+	time.Sleep(testServerStartupDelay)
+
+	for _, path := range []string{"/debug/pprof/", "/debug/pprof/goroutine", "/debug/pprof/cmdline"} {
+		resp, err := http.Get(fmt.Sprintf("http://%s%s", adminAddr, path))
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("GET %s: expected status 404, got %d", path, resp.StatusCode)
+		}
+	}
+
+	resp, err := http.Get(fmt.Sprintf("http://%s/healthz", adminAddr))
+	if err != nil {
+		t.Fatalf("healthz request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected /healthz to stay available, got %d", resp.StatusCode)
+	}
+}
+
+// TestAdminServer_MetricsFilterByName verifies ?name= restricts /metrics output to the
+// requested metric families and that unknown names yield an empty body.
+func TestAdminServer_MetricsFilterByName(t *testing.T) {
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to find available port: %v", err)
+	}
+	adminAddr := listener.Addr().String()
+	listener.Close()
+
+	srv := server.NewServer(":0", server.DefaultReadTimeout)
+	adminServer, _ := startAdminServer(context.Background(), adminAddr, srv)
+	defer shutdownAdminServer(adminServer)()
+	time.Sleep(testServerStartupDelay)
+
+	fetch := func(query string) string {
+		t.Helper()
+		resp, err := http.Get(fmt.Sprintf("http://%s/metrics%s", adminAddr, query))
+		if err != nil {
+			t.Fatalf("Failed to call metrics endpoint: %v", err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("Failed to read response body: %v", err)
+		}
+		return string(body)
+	}
+
+	body := fetch("?name=package_indexer_connections_total")
+	if !strings.Contains(body, "package_indexer_connections_total 0") {
+		t.Errorf("filtered output missing requested metric:\n%s", body)
+	}
+	if strings.Count(body, "# TYPE") != 1 {
+		t.Errorf("expected exactly one metric family, got:\n%s", body)
+	}
+
+	body = fetch("?name=package_indexer_errors_total&name=package_indexer_uptime_seconds")
+	if strings.Count(body, "# TYPE") != 2 || !strings.Contains(body, "package_indexer_errors_total") ||
+		!strings.Contains(body, "package_indexer_uptime_seconds") {
+		t.Errorf("expected errors and uptime metrics only, got:\n%s", body)
+	}
+
+	if body := fetch("?name=does_not_exist"); body != "" {
+		t.Errorf("expected empty output for unknown metric, got:\n%s", body)
+	}
+	if body := fetch(""); !strings.Contains(body, "package_indexer_commands_processed_total") {
+		t.Errorf("unfiltered output should include all metrics, got:\n%s", body)
+	}
+}
+
+// TestAdminServer_MemoryMetrics verifies the goroutine and heap gauges are exported with
+// positive values, and that heap readings are cached within the TTL.
+func TestAdminServer_MemoryMetrics(t *testing.T) {
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to find available port: %v", err)
+	}
+	adminAddr := listener.Addr().String()
+	listener.Close()
+
+	srv := server.NewServer(":0", server.DefaultReadTimeout)
+	adminServer, _ := startAdminServer(context.Background(), adminAddr, srv)
+	defer shutdownAdminServer(adminServer)()
+	time.Sleep(testServerStartupDelay)
+
+	resp, err := http.Get(fmt.Sprintf("http://%s/metrics?name=package_indexer_goroutines,package_indexer_heap_bytes", adminAddr))
+	if err != nil {
+		t.Fatalf("Failed to call metrics endpoint: %v", err)
+	}
+	defer resp.Body.Close()
+
+	values := make(map[string]float64)
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var name string
+		var value float64
+		if line := scanner.Text(); line != "" && !strings.HasPrefix(line, "#") {
+			if _, err := fmt.Sscanf(line, "%s %g", &name, &value); err == nil {
+				values[name] = value
+			}
+		}
+	}
+	if values["package_indexer_goroutines"] <= 0 {
+		t.Errorf("expected positive goroutine count, got %v", values)
+	}
+	if values["package_indexer_heap_bytes"] <= 0 {
+		t.Errorf("expected positive heap bytes, got %v", values)
+	}
+
+	cache := &memStatsCache{ttl: time.Hour}
+	first := cache.HeapAlloc()
+	_ = make([]byte, 1<<20)
+	if second := cache.HeapAlloc(); second != first {
+		t.Errorf("expected cached heap reading within TTL, got %d then %d", first, second)
+	}
+}
+
+// TestAdminServer_SubtreeSizeEndpoint verifies transitive counts for a known graph and
+// error statuses for missing or unknown packages.
+func TestAdminServer_SubtreeSizeEndpoint(t *testing.T) {
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to find available port: %v", err)
+	}
+	adminAddr := listener.Addr().String()
+	listener.Close()
+
+	srv := server.NewServer(":0", server.DefaultReadTimeout)
+	if _, err := srv.Preload(strings.NewReader("app: lib util\nlib: base\nutil: base\n")); err != nil {
+		t.Fatalf("failed to preload graph: %v", err)
+	}
+	adminServer, _ := startAdminServer(context.Background(), adminAddr, srv)
+	defer shutdownAdminServer(adminServer)()
+	time.Sleep(testServerStartupDelay)
+
+	resp, err := http.Get(fmt.Sprintf("http://%s/subtree-size?pkg=base", adminAddr))
+	if err != nil {
+		t.Fatalf("Failed to call subtree-size endpoint: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Package      string `json:"package"`
+		Dependencies int    `json:"transitive_dependencies"`
+		Dependents   int    `json:"transitive_dependents"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if body.Package != "base" || body.Dependencies != 0 || body.Dependents != 3 {
+		t.Errorf("unexpected subtree size for base: %+v", body)
+	}
+
+	for query, status := range map[string]int{"": http.StatusBadRequest, "?pkg=missing": http.StatusNotFound} {
+		resp, err := http.Get(fmt.Sprintf("http://%s/subtree-size%s", adminAddr, query))
+		if err != nil {
+			t.Fatalf("Failed to call subtree-size endpoint: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != status {
+			t.Errorf("subtree-size%s: expected %d, got %d", query, status, resp.StatusCode)
+		}
+	}
+}
+
+// TestAdminServer_ErrorsEndpoint validates that ERROR replies appear in /errors, oldest
+// first, and that the oldest are evicted once the buffer is full.
+func TestAdminServer_ErrorsEndpoint(t *testing.T) {
+	mainListener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to find available port for main server: %v", err)
+	}
+	mainAddr := mainListener.Addr().String()
+	mainListener.Close()
+
+	adminListener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to find available port for admin server: %v", err)
+	}
+	adminAddr := adminListener.Addr().String()
+	adminListener.Close()
+
+	srv := server.NewServer(mainAddr, server.DefaultReadTimeout)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go srv.StartWithContext(ctx)
+
+	adminServer, _ := startAdminServer(ctx, adminAddr, srv)
+	defer shutdownBothServers(srv, adminServer)()
+	time.Sleep(testServerStartupDelay)
+
+	conn, err := net.Dial("tcp", mainAddr)
+	if err != nil {
+		t.Fatalf("Failed to connect to main server: %v", err)
+	}
+	defer conn.Close()
+
+	// Overflow the buffer by two so the first two errors are evicted
+	reader := bufio.NewReader(conn)
+	total := server.RecentErrorsCapacity + 2
+	for i := 0; i < total; i++ {
+		if _, err := fmt.Fprintf(conn, "BOGUS|pkg%d|\n", i); err != nil {
+			t.Fatalf("Failed to send command: %v", err)
+		}
+		if _, err := reader.ReadString('\n'); err != nil {
+			t.Fatalf("Failed to read response: %v", err)
+		}
+	}
+
+	resp, err := http.Get(fmt.Sprintf("http://%s/errors", adminAddr))
+	if err != nil {
+		t.Fatalf("Failed to get errors: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var events []server.ErrorEvent
+	if err := json.NewDecoder(resp.Body).Decode(&events); err != nil {
+		t.Fatalf("Failed to decode errors: %v", err)
+	}
+	if len(events) != server.RecentErrorsCapacity {
+		t.Fatalf("expected %d events, got %d", server.RecentErrorsCapacity, len(events))
+	}
+	if events[0].Line != "BOGUS|pkg2|" || events[len(events)-1].Line != fmt.Sprintf("BOGUS|pkg%d|", total-1) {
+		t.Errorf("unexpected retained range: first %q, last %q", events[0].Line, events[len(events)-1].Line)
+	}
+	if !strings.Contains(events[0].Reason, "unknown command") || events[0].ConnID == 0 {
+		t.Errorf("expected reason and conn id to be recorded, got %+v", events[0])
+	}
+}
+
+// TestAdminServer_OrphansEndpoint validates that only isolated packages are reported
+func TestAdminServer_OrphansEndpoint(t *testing.T) {
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to find available port: %v", err)
+	}
+	adminAddr := listener.Addr().String()
+	listener.Close()
+
+	srv := server.NewServer(":0", server.DefaultReadTimeout)
+	if _, err := srv.Preload(strings.NewReader("app: lib\nlib:\nstandalone:\ntool:\n")); err != nil {
+		t.Fatalf("failed to preload graph: %v", err)
+	}
+	adminServer, _ := startAdminServer(context.Background(), adminAddr, srv)
+	defer shutdownAdminServer(adminServer)()
+	time.Sleep(testServerStartupDelay)
+
+	resp, err := http.Get(fmt.Sprintf("http://%s/orphans", adminAddr))
+	if err != nil {
+		t.Fatalf("Failed to call orphans endpoint: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Orphans []string `json:"orphans"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if strings.Join(body.Orphans, ",") != "standalone,tool" {
+		t.Errorf("expected orphans [standalone tool], got %v", body.Orphans)
+	}
+}
+
+// TestAdminServer_MetricsDisabled validates that /metrics reports disabled recording
+// instead of a page of zeros
+func TestAdminServer_MetricsDisabled(t *testing.T) {
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to find available port: %v", err)
+	}
+	adminAddr := listener.Addr().String()
+	listener.Close()
+
+	srv := server.NewServerWithConfig(server.Config{Addr: ":0", ReadTimeout: server.DefaultReadTimeout, Metrics: server.NopMetrics{}})
+	adminServer, _ := startAdminServer(context.Background(), adminAddr, srv)
+	defer shutdownAdminServer(adminServer)()
+	time.Sleep(testServerStartupDelay)
+
+	resp, err := http.Get(fmt.Sprintf("http://%s/metrics", adminAddr))
+	if err != nil {
+		t.Fatalf("Failed to call metrics endpoint: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	if !strings.Contains(string(body), "package_indexer_metrics_enabled 0") {
+		t.Errorf("expected disabled marker, got:\n%s", body)
+	}
+	if strings.Contains(string(body), "package_indexer_connections_total") {
+		t.Errorf("expected no recorded metrics, got:\n%s", body)
+	}
+}
+
+// TestAdminServer_CyclesEndpoint validates that a cycle created by re-indexing is reported
+func TestAdminServer_CyclesEndpoint(t *testing.T) {
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to find available port: %v", err)
+	}
+	adminAddr := listener.Addr().String()
+	listener.Close()
+
+	// Preload refuses cycles, so build one by re-indexing in the store directly
+	store := indexer.NewIndexer()
+	for _, spec := range []struct {
+		pkg  string
+		deps []string
+	}{{"b", nil}, {"a", []string{"b"}}, {"b", []string{"a"}}, {"tool", nil}} {
+		store.IndexPackage(spec.pkg, spec.deps)
+	}
+	srv := server.NewServerWithConfig(server.Config{Addr: ":0", ReadTimeout: server.DefaultReadTimeout, Store: store})
+	adminServer, _ := startAdminServer(context.Background(), adminAddr, srv)
+	defer shutdownAdminServer(adminServer)()
+	time.Sleep(testServerStartupDelay)
+
+	resp, err := http.Get(fmt.Sprintf("http://%s/cycles", adminAddr))
+	if err != nil {
+		t.Fatalf("Failed to call cycles endpoint: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Count  int        `json:"count"`
+		Cycles [][]string `json:"cycles"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if body.Count != 1 || len(body.Cycles) != 1 || strings.Join(body.Cycles[0], ",") != "a,b" {
+		t.Errorf("expected the single cycle [a b], got %d %v", body.Count, body.Cycles)
+	}
+}
+
+// TestAdminServer_ReadyEndpoint validates that /ready tracks readiness through startup
+// and shutdown while /healthz keeps reporting liveness.
+func TestAdminServer_ReadyEndpoint(t *testing.T) {
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to find available port: %v", err)
+	}
+	adminAddr := listener.Addr().String()
+	listener.Close()
+
+	srv := server.NewServer("127.0.0.1:0", server.DefaultReadTimeout)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	adminServer, _ := startAdminServer(ctx, adminAddr, srv)
+	defer shutdownAdminServer(adminServer)()
+	time.Sleep(testServerStartupDelay)
+
+	status := func(path string) int {
+		t.Helper()
+		resp, err := http.Get(fmt.Sprintf("http://%s%s", adminAddr, path))
+		if err != nil {
+			t.Fatalf("request to %s failed: %v", path, err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if got := status("/ready"); got != http.StatusServiceUnavailable {
+		t.Errorf("/ready before start: expected 503, got %d", got)
+	}
+
+	go srv.StartWithContext(ctx)
+	select {
+	case <-srv.Ready():
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for server to be ready")
+	}
+	if got := status("/ready"); got != http.StatusOK {
+		t.Errorf("/ready while serving: expected 200, got %d", got)
+	}
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer shutdownCancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		t.Fatalf("Shutdown returned error: %v", err)
+	}
+	if got := status("/ready"); got != http.StatusServiceUnavailable {
+		t.Errorf("/ready during shutdown: expected 503, got %d", got)
+	}
+	if got := status("/healthz"); got != http.StatusOK {
+		t.Errorf("/healthz during shutdown: expected 200, got %d", got)
+	}
+}
+
+// TestRun_RateLimitGauges validates that the configured rate limit flags are exported
+// as gauges so dashboards can overlay them against observed throughput.
+func TestRun_RateLimitGauges(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping signal-driven shutdown test in short mode")
+	}
+
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to find available port: %v", err)
+	}
+	adminAddr := listener.Addr().String()
+	listener.Close()
+
+	defer isolateFlags(t)()
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	os.Args = []string{"program", "-addr", "127.0.0.1:0", "-admin", adminAddr, "-quiet",
+		"-rate-limit-per-conn", "20", "-rate-limit-global", "250.5"}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- run()
+	}()
+	time.Sleep(testServerStartupDelay)
+
+	resp, err := http.Get(fmt.Sprintf("http://%s/metrics?name=package_indexer_rate_limit_per_conn,package_indexer_rate_limit_global", adminAddr))
+	if err != nil {
+		t.Fatalf("Failed to call metrics endpoint: %v", err)
+	}
+	values := make(map[string]float64)
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var name string
+		var value float64
+		if line := scanner.Text(); line != "" && !strings.HasPrefix(line, "#") {
+			if _, err := fmt.Sscanf(line, "%s %g", &name, &value); err == nil {
+				values[name] = value
+			}
+		}
+	}
+	resp.Body.Close()
+
+	expected := map[string]float64{
+		"package_indexer_rate_limit_per_conn": 20,
+		"package_indexer_rate_limit_global":   250.5,
+	}
+	for name, want := range expected {
+		if got, ok := values[name]; !ok || got != want {
+			t.Errorf("%s = %v (present %v), expected %v", name, got, ok, want)
+		}
+	}
+
+	p, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatalf("failed to find current process: %v", err)
+	}
+	if err := p.Signal(syscall.SIGINT); err != nil {
+		t.Fatalf("failed to send SIGINT: %v", err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("run() returned unexpected error: %v", err)
+		}
+	case <-time.After(testShutdownTimeout):
+		t.Fatal("timed out waiting for graceful shutdown")
+	}
+}
+
+// TestRun_InvalidCommandList validates that an unknown command name in the allow or deny
+// list fails startup
+func TestRun_InvalidCommandList(t *testing.T) {
+	for _, flagName := range []string{"-allow-commands", "-deny-commands"} {
+		t.Run(flagName, func(t *testing.T) {
+			defer isolateFlags(t)()
+
+			flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+			os.Args = []string{"program", "-addr", ":0", flagName, "QUERY,BOGUS"}
+
+			err := run()
+			if err == nil || !strings.Contains(err.Error(), flagName) {
+				t.Fatalf("expected %s error from run(), got %v", flagName, err)
+			}
+		})
+	}
+}
+
+// TestAdminServer_ReloadEndpoint validates that POST /reload serves the snapshot file's
+// current contents and that a broken file keeps the current index
+func TestAdminServer_ReloadEndpoint(t *testing.T) {
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to find available port: %v", err)
+	}
+	adminAddr := listener.Addr().String()
+	listener.Close()
+
+	snapshot := filepath.Join(t.TempDir(), "snapshot.txt")
+	if err := os.WriteFile(snapshot, []byte("app: base\nbase:\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write snapshot: %v", err)
+	}
+	srv := server.NewServer(":0", server.DefaultReadTimeout)
+	if _, err := preloadPackages(srv, snapshot); err != nil {
+		t.Fatalf("preload failed: %v", err)
+	}
+	adminServer, _ := startAdminServerWithConfig(context.Background(), adminConfig{Addr: adminAddr, ReloadFile: snapshot}, srv)
+	defer shutdownAdminServer(adminServer)()
+	time.Sleep(testServerStartupDelay)
+
+	reloadURL := fmt.Sprintf("http://%s/reload", adminAddr)
+	if resp, err := http.Get(reloadURL); err != nil {
+		t.Fatalf("Failed to call reload endpoint: %v", err)
+	} else {
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusMethodNotAllowed {
+			t.Errorf("expected 405 for GET /reload, got %d", resp.StatusCode)
+		}
+	}
+
+	if err := os.WriteFile(snapshot, []byte("web: lib\nlib:\nextra:\n"), 0o644); err != nil {
+		t.Fatalf("Failed to rewrite snapshot: %v", err)
+	}
+	resp, err := http.Post(reloadURL, "", nil)
+	if err != nil {
+		t.Fatalf("Failed to call reload endpoint: %v", err)
+	}
+	var body struct {
+		Packages int `json:"packages"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&body)
+	resp.Body.Close()
+	if err != nil || resp.StatusCode != http.StatusOK || body.Packages != 3 {
+		t.Fatalf("expected 200 with 3 packages, got %d %+v (%v)", resp.StatusCode, body, err)
+	}
+	if stats := srv.GetStats(); stats.Indexed != 3 {
+		t.Errorf("expected 3 indexed packages after reload, got %d", stats.Indexed)
+	}
+
+	if err := os.WriteFile(snapshot, []byte("not a declaration\n"), 0o644); err != nil {
+		t.Fatalf("Failed to rewrite snapshot: %v", err)
+	}
+	resp, err = http.Post(reloadURL, "", nil)
+	if err != nil {
+		t.Fatalf("Failed to call reload endpoint: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("expected 500 for a malformed snapshot, got %d", resp.StatusCode)
+	}
+	if stats := srv.GetStats(); stats.Indexed != 3 {
+		t.Errorf("expected failed reload to keep 3 packages, got %d", stats.Indexed)
+	}
+}
+
+// TestRun_ResultCacheWithEvictLRU validates that the result cache cannot be combined with
+// LRU eviction, whose recency cache hits would not refresh
+func TestRun_ResultCacheWithEvictLRU(t *testing.T) {
+	defer isolateFlags(t)()
+
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	os.Args = []string{"program", "-addr", ":0", "-max-packages", "10", "-evict-lru", "-result-cache-size", "100"}
+
+	if err := run(); err == nil || !strings.Contains(err.Error(), "-result-cache-size") {
+		t.Fatalf("expected -result-cache-size error from run(), got %v", err)
+	}
+}
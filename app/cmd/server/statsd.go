@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"package-indexer/internal/server"
+)
+
+const (
+	defaultStatsdInterval = 10 * time.Second
+	statsdNamespace       = "package_indexer" // Prometheus prefix, rewritten as "package_indexer." for StatsD
+	maxStatsdPacket       = 1432              // Keeps each datagram within a typical Ethernet MTU
+)
+
+// statsdPusher sends the exported metrics to a StatsD daemon as UDP lines. Counters are
+// sent as deltas since the previous push, since StatsD accumulates counters itself;
+// gauges carry their current value.
+type statsdPusher struct {
+	conn     net.Conn
+	srv      *server.Server
+	memStats *memStatsCache
+	previous map[string]float64 // Counter values at the previous push
+}
+
+// startStatsdPusher pushes metrics to addr every interval until ctx is cancelled. Only
+// resolving the address can fail; send errors are logged and the next push retries.
+func startStatsdPusher(ctx context.Context, addr string, interval time.Duration, srv *server.Server) error {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return err
+	}
+	p := &statsdPusher{
+		conn:     conn,
+		srv:      srv,
+		memStats: &memStatsCache{ttl: memStatsTTL},
+		previous: make(map[string]float64),
+	}
+
+	go func() {
+		defer conn.Close()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := p.push(); err != nil {
+					slog.Warn("Failed to push StatsD metrics", "addr", addr, "error", err)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// push sends one round of metrics, packing as many lines per datagram as fit
+func (p *statsdPusher) push() error {
+	var packet strings.Builder
+	flush := func() error {
+		if packet.Len() == 0 {
+			return nil
+		}
+		_, err := p.conn.Write([]byte(packet.String()))
+		packet.Reset()
+		return err
+	}
+
+	for _, metric := range collectMetrics(p.srv, p.memStats) {
+		line, ok := p.line(metric)
+		if !ok {
+			continue
+		}
+		if packet.Len() > 0 && packet.Len()+1+len(line) > maxStatsdPacket {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(line)
+	}
+	return flush()
+}
+
+// line formats a metric as a StatsD line, e.g. "package_indexer.connections_total:3|c"
+func (p *statsdPusher) line(metric prometheusMetric) (string, bool) {
+	value, ok := metricFloat(metric.value)
+	if !ok {
+		return "", false
+	}
+	name := statsdNamespace + "." + strings.TrimPrefix(metric.name, statsdNamespace+"_")
+
+	kind := "g"
+	if metric.metricType == "counter" {
+		kind = "c"
+		value, p.previous[metric.name] = value-p.previous[metric.name], value
+	}
+	return fmt.Sprintf("%s:%s|%s", name, strconv.FormatFloat(value, 'f', -1, 64), kind), true
+}
+
+// metricFloat converts a collected metric value to float64
+func metricFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case float64:
+		return n, true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"package-indexer/internal/server"
+)
+
+func TestStatsdPusher_SendsMetrics(t *testing.T) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	srv := server.NewServer(":0", server.DefaultReadTimeout)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := startStatsdPusher(ctx, listener.LocalAddr().String(), 10*time.Millisecond, srv); err != nil {
+		t.Fatalf("startStatsdPusher failed: %v", err)
+	}
+
+	// Gather lines across datagrams until both expected metrics have arrived
+	want := []string{
+		"package_indexer.connections_total:0|c",
+		"package_indexer.packages_indexed_current:0|g",
+	}
+	seen := make(map[string]bool)
+	buf := make([]byte, 64*1024)
+	listener.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for len(seen) < len(want) {
+		n, _, err := listener.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("Did not receive expected StatsD lines %v (saw %v): %v", want, seen, err)
+		}
+		for _, line := range strings.Split(string(buf[:n]), "\n") {
+			if !strings.HasPrefix(line, "package_indexer.") {
+				t.Errorf("Unexpected StatsD line %q", line)
+			}
+			for _, w := range want {
+				if line == w {
+					seen[w] = true
+				}
+			}
+			if len(line) > maxStatsdPacket {
+				t.Errorf("Line exceeds packet limit: %q", line)
+			}
+		}
+		if n > maxStatsdPacket {
+			t.Errorf("Datagram of %d bytes exceeds %d", n, maxStatsdPacket)
+		}
+	}
+}
+
+func TestStatsdPusher_CountersSendDeltas(t *testing.T) {
+	p := &statsdPusher{previous: make(map[string]float64)}
+	counter := prometheusMetric{name: "package_indexer_connections_total", metricType: "counter", value: int64(5)}
+
+	if line, _ := p.line(counter); line != "package_indexer.connections_total:5|c" {
+		t.Errorf("First push = %q", line)
+	}
+	counter.value = int64(8)
+	if line, _ := p.line(counter); line != "package_indexer.connections_total:3|c" {
+		t.Errorf("Second push = %q, want delta of 3", line)
+	}
+
+	gauge := prometheusMetric{name: "package_indexer_connections_current", metricType: "gauge", value: 2.5}
+	if line, _ := p.line(gauge); line != "package_indexer.connections_current:2.5|g" {
+		t.Errorf("Gauge = %q", line)
+	}
+}
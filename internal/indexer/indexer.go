@@ -4,7 +4,14 @@
 package indexer
 
 import (
+	"fmt"
+	"hash/fnv"
+	"path"
+	"slices"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 )
 
 // StringSet represents a set of strings using Go's map implementation for O(1) operations.
@@ -38,6 +45,17 @@ func (s StringSet) Len() int {
 	return len(s)
 }
 
+// Sorted returns the items of the set in ascending order, giving map-backed sets a
+// reproducible iteration order for listings and exports
+func (s StringSet) Sorted() []string {
+	items := make([]string, 0, len(s))
+	for item := range s {
+		items = append(items, item)
+	}
+	sort.Strings(items)
+	return items
+}
+
 // Copy creates a copy of the set
 func (s StringSet) Copy() StringSet {
 	result := NewStringSet()
@@ -56,6 +74,85 @@ type Indexer struct {
 	indexed      StringSet            // Tracks indexed packages for O(1) existence checks
 	dependencies map[string]StringSet // Maps package to its dependencies (forward edges)
 	dependents   map[string]StringSet // Maps package to its dependents (reverse edges)
+	maxPackages  int                  // Cap on distinct indexed packages (0 means unlimited)
+	access       *accessClock         // Per-package recency for LRU eviction (nil unless enabled)
+	rejectCycles bool                 // Refuse edges that would close a dependency cycle
+	pinned       StringSet            // Packages protected from removal and eviction
+
+	// Only labeled edges have an entry, so an unlabeled graph pays nothing for labels
+	labels map[string]map[string]string // Maps package to the label of each labeled dependency edge
+
+	// Graph generation, bumped under the write lock by every change so callers can cheaply
+	// tell whether the graph changed; atomic so Version never takes the lock
+	version atomic.Uint64
+
+	// Operation counters are updated outside the graph lock so reads never contend with writes
+	indexAttempts   atomic.Int64
+	indexSuccesses  atomic.Int64
+	removeAttempts  atomic.Int64
+	removeBlocked   atomic.Int64
+	removePinned    atomic.Int64
+	queryHits       atomic.Int64
+	queryMisses     atomic.Int64
+	capacityRejects atomic.Int64
+	evictions       atomic.Int64
+}
+
+// PackageStore is the storage contract the server depends on. The in-memory Indexer is
+// the default implementation; alternative backends (or test doubles) only need to honor
+// the same dependency constraints.
+type PackageStore interface {
+	IndexPackage(pkg string, deps []string) bool
+	IndexPackageMissing(pkg string, deps []string) (missing []string, ok bool)
+	IndexPackageLabeled(pkg string, deps []string, labels map[string]string) bool
+	IndexPackageCAS(pkg string, deps []string, expectedHash string) (hash string, ok bool)
+	RemovePackage(pkg string) RemoveResult
+	CanRemove(pkg string) bool
+	PinPackage(pkg string) bool
+	UnpinPackage(pkg string)
+	RenamePackage(oldName, newName string) bool
+	AddDependencies(pkg string, deps []string) bool
+	RemoveDependencies(pkg string, deps []string) bool
+	QueryPackage(pkg string) bool
+	DependencyCount(pkg string) (int, bool)
+	SubtreeSize(pkg string) (dependencies int, dependents int, ok bool)
+	Status(pkg string) PackageStatus
+	Edges(pkg string) (dependencies []string, dependents []string, ok bool)
+	DependencyDepth(pkg string) (int, bool)
+	FindPath(from, to string) ([]string, bool)
+	Orphans() []string
+	Pinned() []string
+	FindCycles() [][]string
+	Search(pattern string) []string
+	OperationStats() OperationStats
+	GetStats() (indexed int, totalDeps int, totalReverseDeps int)
+	Restore(specs []PackageSpec) error
+	Version() uint64
+}
+
+// Compile-time check that Indexer satisfies PackageStore
+var _ PackageStore = (*Indexer)(nil)
+
+// PackageStatus is a consistent snapshot of a package's existence and direct edge counts
+type PackageStatus struct {
+	Indexed      bool
+	Dependencies int  // Direct dependencies
+	Dependents   int  // Direct dependents
+	Pinned       bool // Protected from removal by PinPackage
+}
+
+// OperationStats counts the operations the indexer has served since creation, independent
+// of how the server wraps or reports them.
+type OperationStats struct {
+	IndexAttempts      int64 // IndexPackage calls
+	IndexSuccesses     int64 // IndexPackage calls whose dependencies were all indexed
+	RemoveAttempts     int64 // RemovePackage calls
+	RemoveBlocked      int64 // RemovePackage calls refused because the package had dependents
+	RemovePinned       int64 // RemovePackage calls refused because the package was pinned
+	QueryHits          int64 // QueryPackage calls for an indexed package
+	QueryMisses        int64 // QueryPackage calls for a package that is not indexed
+	CapacityRejections int64 // Index calls for new packages refused because the package limit was reached
+	Evictions          int64 // Packages evicted to make room for new ones in LRU mode
 }
 
 // RemoveResult represents the outcome of a remove operation using type-safe enums.
@@ -66,8 +163,21 @@ const (
 	RemoveResultOK         RemoveResult = iota // Package successfully removed
 	RemoveResultNotIndexed                     // Package was not indexed (idempotent success)
 	RemoveResultBlocked                        // Package has dependents (cannot remove)
+	RemoveResultPinned                         // Package is pinned (cannot remove until unpinned)
+)
+
+// Dependency edge labels. An unlabeled edge is required; an optional edge still records
+// the dependency but does not block removing it.
+const (
+	LabelRequired = "required"
+	LabelOptional = "optional"
 )
 
+// ValidLabel reports whether label is a known dependency edge label
+func ValidLabel(label string) bool {
+	return label == LabelRequired || label == LabelOptional
+}
+
 // removeDependentReference removes a reverse dependency reference with cleanup
 func (idx *Indexer) removeDependentReference(dependency string, pkg string) {
 	if idx.dependents[dependency] != nil {
@@ -80,19 +190,178 @@ func (idx *Indexer) removeDependentReference(dependency string, pkg string) {
 
 // NewIndexer creates a new empty package indexer
 func NewIndexer() *Indexer {
+	return NewIndexerWithMaxPackages(0)
+}
+
+// NewIndexerWithMaxPackages creates an empty indexer holding at most maxPackages distinct
+// packages to bound memory. Once full, indexing a new package fails while re-indexing an
+// existing one still succeeds. Zero means unlimited.
+func NewIndexerWithMaxPackages(maxPackages int) *Indexer {
 	return &Indexer{
 		indexed:      NewStringSet(),
 		dependencies: make(map[string]StringSet),
 		dependents:   make(map[string]StringSet),
+		labels:       make(map[string]map[string]string),
+		pinned:       NewStringSet(),
+		maxPackages:  maxPackages,
 	}
 }
 
+// NewIndexerWithEviction creates an empty indexer holding at most maxPackages distinct
+// packages that, once full, makes room for a new package by evicting the least recently
+// used unpinned package with no dependents. Indexing fails only if every package is
+// pinned or still depended upon.
+func NewIndexerWithEviction(maxPackages int) *Indexer {
+	idx := NewIndexerWithMaxPackages(maxPackages)
+	idx.access = newAccessClock()
+	return idx
+}
+
+// SetRejectCycles controls whether indexing may create a dependency cycle. Each INDEX only
+// requires its dependencies to exist, so re-indexing can still close a loop (a depends on
+// b, then b is re-indexed to depend on a), leaving every package in it unremovable. When
+// enabled, such updates FAIL instead.
+func (idx *Indexer) SetRejectCycles(enabled bool) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.rejectCycles = enabled
+}
+
+// createsCycleLocked reports whether giving pkg the dependencies deps would close a cycle,
+// i.e. whether pkg is itself one of them or one of them already depends on pkg directly or
+// transitively. Walks pkg's dependents, so new packages (which have none) cost nothing.
+// The caller must hold the lock.
+func (idx *Indexer) createsCycleLocked(pkg string, deps []string) bool {
+	if len(deps) == 0 || !idx.indexed.Contains(pkg) {
+		return false
+	}
+	wanted := NewStringSet()
+	for _, dep := range deps {
+		wanted.Add(dep)
+	}
+
+	visited := NewStringSet()
+	stack := []string{pkg}
+	for len(stack) > 0 {
+		current := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if visited.Contains(current) {
+			continue
+		}
+		if wanted.Contains(current) {
+			return true
+		}
+		visited.Add(current)
+		for dependent := range idx.dependents[current] {
+			stack = append(stack, dependent)
+		}
+	}
+	return false
+}
+
 // IndexPackage attempts to add/update a package with given dependencies.
 // Returns true if successful (OK), false if dependencies missing (FAIL).
 func (idx *Indexer) IndexPackage(pkg string, deps []string) bool {
+	idx.indexAttempts.Add(1)
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	return idx.indexLocked(pkg, deps, nil)
+}
+
+// IndexPackageMissing indexes pkg like IndexPackage, additionally returning the sorted,
+// de-duplicated dependencies that are not indexed when that is why it failed. A failure
+// with no missing dependencies has another cause, e.g. the package limit or a cycle.
+func (idx *Indexer) IndexPackageMissing(pkg string, deps []string) (missing []string, ok bool) {
+	idx.indexAttempts.Add(1)
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if missing := idx.missingLocked(deps); len(missing) > 0 {
+		return missing, false // FAIL - dependencies not indexed
+	}
+	return nil, idx.indexLocked(pkg, deps, nil)
+}
+
+// missingLocked returns the sorted, de-duplicated deps that are not indexed; the caller
+// must hold the lock
+func (idx *Indexer) missingLocked(deps []string) []string {
+	var missing StringSet
+	for _, dep := range deps {
+		if !idx.indexed.Contains(dep) {
+			if missing == nil {
+				missing = NewStringSet()
+			}
+			missing.Add(dep)
+		}
+	}
+	if missing == nil {
+		return nil
+	}
+	return missing.Sorted()
+}
+
+// IndexPackageLabeled indexes pkg like IndexPackage, recording labels by dependency name
+// on the matching edges; dependencies without an entry are required. Only required edges
+// block removing the dependency. Re-indexing replaces the package's labels along with its
+// dependencies.
+func (idx *Indexer) IndexPackageLabeled(pkg string, deps []string, labels map[string]string) bool {
+	idx.indexAttempts.Add(1)
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	return idx.indexLocked(pkg, deps, labels)
+}
+
+// IndexPackageCAS indexes pkg like IndexPackage, but only if the package is not yet indexed
+// or its current dependency set hashes to expectedHash (see DependencyHash). Returns the
+// package's dependency hash after the call ("" if it is not indexed) and whether the index
+// was applied; a hash mismatch and a missing dependency both leave the index unchanged.
+func (idx *Indexer) IndexPackageCAS(pkg string, deps []string, expectedHash string) (string, bool) {
+	idx.indexAttempts.Add(1)
+
 	idx.mu.Lock()
 	defer idx.mu.Unlock()
 
+	current := ""
+	if idx.indexed.Contains(pkg) {
+		current = hashSorted(idx.sortedDeps(pkg))
+		if current != expectedHash {
+			return current, false // FAIL - concurrent modification
+		}
+	}
+
+	if !idx.indexLocked(pkg, deps, nil) {
+		return current, false
+	}
+	return hashSorted(idx.sortedDeps(pkg)), true
+}
+
+// DependencyHash returns a stable hash of a dependency set as 16 lowercase hex digits:
+// FNV-1a 64 over the sorted, de-duplicated names joined by commas. Order and repeated
+// names do not change the hash.
+func DependencyHash(deps []string) string {
+	set := NewStringSet()
+	for _, dep := range deps {
+		set.Add(dep)
+	}
+	return hashSorted(set.Sorted())
+}
+
+// hashSorted hashes an already sorted, de-duplicated dependency list
+func hashSorted(deps []string) string {
+	h := fnv.New64a()
+	h.Write([]byte(strings.Join(deps, ",")))
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+// indexLocked applies an index operation with optional edge labels; the caller must hold
+// the write lock
+func (idx *Indexer) indexLocked(pkg string, deps []string, labels map[string]string) bool {
 	// Check if all dependencies are already indexed
 	for _, dep := range deps {
 		if !idx.indexed.Contains(dep) {
@@ -100,6 +369,17 @@ func (idx *Indexer) IndexPackage(pkg string, deps []string) bool {
 		}
 	}
 
+	if idx.rejectCycles && idx.createsCycleLocked(pkg, deps) {
+		return false // FAIL - would create a dependency cycle
+	}
+
+	// New packages are refused once the index is full, unless one can be evicted; updates
+	// do not grow it
+	if idx.maxPackages > 0 && !idx.indexed.Contains(pkg) && idx.indexed.Len() >= idx.maxPackages && !idx.evictLocked(deps) {
+		idx.capacityRejects.Add(1)
+		return false // FAIL - package limit reached
+	}
+
 	// Get old dependencies for cleanup
 	oldDeps := idx.dependencies[pkg]
 	if oldDeps == nil {
@@ -130,26 +410,248 @@ func (idx *Indexer) IndexPackage(pkg string, deps []string) bool {
 	// Update package state
 	idx.indexed.Add(pkg)
 	idx.dependencies[pkg] = newDeps
+	idx.setLabelsLocked(pkg, newDeps, labels)
+	idx.recordAccess(pkg)
+	idx.indexSuccesses.Add(1)
+	idx.version.Add(1)
 
 	return true // OK
 }
 
+// setLabelsLocked replaces the edge labels of pkg with those of labels naming one of its
+// dependencies; the caller must hold the write lock
+func (idx *Indexer) setLabelsLocked(pkg string, deps StringSet, labels map[string]string) {
+	delete(idx.labels, pkg)
+	for dep, label := range labels {
+		if !deps.Contains(dep) {
+			continue
+		}
+		if idx.labels[pkg] == nil {
+			idx.labels[pkg] = make(map[string]string)
+		}
+		idx.labels[pkg][dep] = label
+	}
+}
+
+// dropLabelLocked forgets the label of the edge from pkg to dep, if any; the caller must
+// hold the write lock
+func (idx *Indexer) dropLabelLocked(pkg, dep string) {
+	if edges := idx.labels[pkg]; edges != nil {
+		delete(edges, dep)
+		if len(edges) == 0 {
+			delete(idx.labels, pkg)
+		}
+	}
+}
+
+// optionalLocked reports whether the edge from pkg to dep is labeled optional; the caller
+// must hold the lock
+func (idx *Indexer) optionalLocked(pkg, dep string) bool {
+	return idx.labels[pkg][dep] == LabelOptional
+}
+
+// requiredDependentsLocked counts the dependents of pkg whose edge to it is required,
+// i.e. those that block its removal; the caller must hold the lock
+func (idx *Indexer) requiredDependentsLocked(pkg string) int {
+	dependents := idx.dependents[pkg]
+	if len(idx.labels) == 0 {
+		return dependents.Len()
+	}
+	required := 0
+	for dependent := range dependents {
+		if !idx.optionalLocked(dependent, pkg) {
+			required++
+		}
+	}
+	return required
+}
+
+// AddDependencies adds deps to an indexed package's existing dependency set. Fails without
+// changes if the package or any of the new dependencies is not indexed; dependencies the
+// package already has are left as they are.
+func (idx *Indexer) AddDependencies(pkg string, deps []string) bool {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if !idx.indexed.Contains(pkg) {
+		return false
+	}
+	for _, dep := range deps {
+		if !idx.indexed.Contains(dep) {
+			return false // FAIL - dependency not indexed
+		}
+	}
+	if idx.rejectCycles && idx.createsCycleLocked(pkg, deps) {
+		return false // FAIL - would create a dependency cycle
+	}
+
+	for _, dep := range deps {
+		idx.dependencies[pkg].Add(dep)
+		if idx.dependents[dep] == nil {
+			idx.dependents[dep] = NewStringSet()
+		}
+		idx.dependents[dep].Add(pkg)
+	}
+	idx.recordAccess(pkg)
+	idx.version.Add(1)
+	return true
+}
+
+// RemoveDependencies drops deps from an indexed package's dependency set, ignoring any it
+// does not have. Fails only if the package is not indexed.
+func (idx *Indexer) RemoveDependencies(pkg string, deps []string) bool {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if !idx.indexed.Contains(pkg) {
+		return false
+	}
+	for _, dep := range deps {
+		if idx.dependencies[pkg].Contains(dep) {
+			idx.dependencies[pkg].Remove(dep)
+			idx.removeDependentReference(dep, pkg)
+			idx.dropLabelLocked(pkg, dep)
+		}
+	}
+	idx.recordAccess(pkg)
+	idx.version.Add(1)
+	return true
+}
+
 // RemovePackage attempts to remove a package from the index.
-// Cannot remove packages with active dependents. Operation is idempotent.
+// Cannot remove pinned packages or packages with active dependents. Operation is idempotent.
 func (idx *Indexer) RemovePackage(pkg string) RemoveResult {
 	idx.mu.Lock()
 	defer idx.mu.Unlock()
 
+	return idx.removeLocked(pkg)
+}
+
+// CanRemove reports whether RemovePackage would currently succeed, i.e. the package is
+// not indexed or is neither pinned nor required by a dependent, without changing the index
+// (read-only operation)
+func (idx *Indexer) CanRemove(pkg string) bool {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	if idx.indexed.Contains(pkg) {
+		idx.recordAccess(pkg)
+	}
+	return !idx.pinned.Contains(pkg) && idx.requiredDependentsLocked(pkg) == 0
+}
+
+// PinPackage protects an indexed package from removal and eviction, regardless of its
+// dependents, until UnpinPackage is called. The pin is kept across re-indexing and
+// follows the package through a rename. Fails if pkg is not indexed; pinning an already
+// pinned package succeeds.
+func (idx *Indexer) PinPackage(pkg string) bool {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if !idx.indexed.Contains(pkg) {
+		return false
+	}
+	if !idx.pinned.Contains(pkg) {
+		idx.pinned.Add(pkg)
+		idx.version.Add(1)
+	}
+	return true
+}
+
+// UnpinPackage lifts the pin on pkg so it is removable again under the usual dependent
+// rule. Unpinning a package that is not pinned is a no-op.
+func (idx *Indexer) UnpinPackage(pkg string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if idx.pinned.Contains(pkg) {
+		idx.pinned.Remove(pkg)
+		idx.version.Add(1)
+	}
+}
+
+// RemovePackagesBulk removes a set of packages under a single write lock, ordering the
+// removals so that dependents go before their dependencies (leaves first). A package is
+// only blocked if something outside the set still depends on it, directly or through
+// other blocked members. Returns the outcome for every distinct requested package.
+func (idx *Indexer) RemovePackagesBulk(pkgs []string) map[string]RemoveResult {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	results := make(map[string]RemoveResult, len(pkgs))
+
+	// Count each member's dependents; members reaching zero are safe to remove
+	remaining := make(map[string]int, len(pkgs))
+	var ready []string
+	for _, pkg := range pkgs {
+		if _, seen := remaining[pkg]; seen {
+			continue
+		}
+		remaining[pkg] = idx.requiredDependentsLocked(pkg)
+		if remaining[pkg] == 0 {
+			ready = append(ready, pkg)
+		}
+	}
+
+	for len(ready) > 0 {
+		pkg := ready[0]
+		ready = ready[1:]
+
+		deps := idx.sortedDeps(pkg) // Captured before removal drops the edges
+		optional := NewStringSet()
+		for _, dep := range deps {
+			if idx.optionalLocked(pkg, dep) {
+				optional.Add(dep)
+			}
+		}
+		results[pkg] = idx.removeLocked(pkg)
+		for _, dep := range deps {
+			if _, member := remaining[dep]; !member || optional.Contains(dep) {
+				continue
+			}
+			remaining[dep]--
+			if remaining[dep] == 0 {
+				ready = append(ready, dep)
+			}
+		}
+	}
+
+	// Whatever never became ready is still held by an outside dependent
+	for pkg := range remaining {
+		if _, done := results[pkg]; !done {
+			results[pkg] = idx.removeLocked(pkg)
+		}
+	}
+	return results
+}
+
+// removeLocked applies a remove operation; the caller must hold the write lock
+func (idx *Indexer) removeLocked(pkg string) RemoveResult {
+	idx.removeAttempts.Add(1)
+
 	// If not indexed, removal is OK (idempotent)
 	if !idx.indexed.Contains(pkg) {
 		return RemoveResultNotIndexed
 	}
 
-	// Check if any packages depend on this one
-	if dependents := idx.dependents[pkg]; dependents != nil && dependents.Len() > 0 {
+	if idx.pinned.Contains(pkg) {
+		idx.removePinned.Add(1)
+		return RemoveResultPinned // FAIL - pinned
+	}
+
+	// Check if any packages require this one; optional dependents do not block
+	if idx.requiredDependentsLocked(pkg) > 0 {
+		idx.removeBlocked.Add(1)
 		return RemoveResultBlocked // FAIL - has dependents
 	}
 
+	idx.deleteLocked(pkg)
+	return RemoveResultOK // OK
+}
+
+// deleteLocked drops a package without required dependents, along with its edges, so
+// any optional dependents stop depending on it; the caller must hold the write lock
+func (idx *Indexer) deleteLocked(pkg string) {
 	// Remove from index
 	idx.indexed.Remove(pkg)
 
@@ -160,19 +662,540 @@ func (idx *Indexer) RemovePackage(pkg string) RemoveResult {
 		}
 		delete(idx.dependencies, pkg)
 	}
+	delete(idx.labels, pkg)
 
-	// Clean up reverse dependencies (should be empty but defensive)
+	// Drop the edges of remaining (optional) dependents
+	for dependent := range idx.dependents[pkg] {
+		idx.dependencies[dependent].Remove(pkg)
+		idx.dropLabelLocked(dependent, pkg)
+	}
 	delete(idx.dependents, pkg)
 
-	return RemoveResultOK // OK
+	if idx.access != nil {
+		idx.access.forget(pkg)
+	}
+	idx.version.Add(1)
+}
+
+// RenamePackage atomically renames an indexed package, rewriting every forward and
+// reverse edge so dependents now depend on newName. Fails if oldName is not indexed or
+// newName already is.
+func (idx *Indexer) RenamePackage(oldName, newName string) bool {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if !idx.indexed.Contains(oldName) || idx.indexed.Contains(newName) {
+		return false
+	}
+
+	rename := func(pkg string) string {
+		if pkg == oldName {
+			return newName
+		}
+		return pkg
+	}
+	deps, dependents := idx.dependencies[oldName], idx.dependents[oldName]
+
+	// Point each dependency's reverse edge and each dependent's forward edge at the new
+	// name; a self-dependency is carried over through the renamed sets below instead
+	newDeps := NewStringSet()
+	for dep := range deps {
+		newDeps.Add(rename(dep))
+		if dep != oldName {
+			idx.dependents[dep].Remove(oldName)
+			idx.dependents[dep].Add(newName)
+		}
+	}
+	newDependents := NewStringSet()
+	for dependent := range dependents {
+		newDependents.Add(rename(dependent))
+		if dependent != oldName {
+			idx.dependencies[dependent].Remove(oldName)
+			idx.dependencies[dependent].Add(newName)
+		}
+	}
+
+	delete(idx.dependencies, oldName)
+	delete(idx.dependents, oldName)
+	idx.dependencies[newName] = newDeps
+	if newDependents.Len() > 0 {
+		idx.dependents[newName] = newDependents
+	}
+
+	// Carry edge labels over on both sides of each renamed edge
+	for dependent := range dependents {
+		if label, ok := idx.labels[dependent][oldName]; ok && dependent != oldName {
+			delete(idx.labels[dependent], oldName)
+			idx.labels[dependent][newName] = label
+		}
+	}
+	if labels, ok := idx.labels[oldName]; ok {
+		delete(idx.labels, oldName)
+		renamed := make(map[string]string, len(labels))
+		for dep, label := range labels {
+			renamed[rename(dep)] = label
+		}
+		idx.labels[newName] = renamed
+	}
+
+	idx.indexed.Remove(oldName)
+	idx.indexed.Add(newName)
+	if idx.pinned.Contains(oldName) {
+		idx.pinned.Remove(oldName)
+		idx.pinned.Add(newName)
+	}
+	if idx.access != nil {
+		idx.access.rename(oldName, newName)
+	}
+	idx.version.Add(1)
+	return true
 }
 
 // QueryPackage checks if a package is indexed (read-only operation)
 func (idx *Indexer) QueryPackage(pkg string) bool {
+	idx.mu.RLock()
+	found := idx.indexed.Contains(pkg)
+	if found {
+		idx.recordAccess(pkg)
+	}
+	idx.mu.RUnlock()
+
+	if found {
+		idx.queryHits.Add(1)
+	} else {
+		idx.queryMisses.Add(1)
+	}
+	return found
+}
+
+// DependencyCount returns the number of direct dependencies of a package and whether
+// the package is indexed (read-only operation)
+func (idx *Indexer) DependencyCount(pkg string) (int, bool) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	if !idx.indexed.Contains(pkg) {
+		return 0, false
+	}
+	idx.recordAccess(pkg)
+	return idx.dependencies[pkg].Len(), true
+}
+
+// Status returns existence plus direct dependency and dependent counts for pkg, read
+// under a single lock so the three values are mutually consistent
+func (idx *Indexer) Status(pkg string) PackageStatus {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	if !idx.indexed.Contains(pkg) {
+		return PackageStatus{}
+	}
+	idx.recordAccess(pkg)
+	return PackageStatus{
+		Indexed:      true,
+		Dependencies: idx.dependencies[pkg].Len(),
+		Dependents:   idx.dependents[pkg].Len(),
+		Pinned:       idx.pinned.Contains(pkg),
+	}
+}
+
+// Edges returns the direct dependencies and dependents of pkg, each sorted, and whether
+// it is indexed. Both lists come from a single read lock, so they form one consistent view.
+func (idx *Indexer) Edges(pkg string) (dependencies []string, dependents []string, ok bool) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	if !idx.indexed.Contains(pkg) {
+		return nil, nil, false
+	}
+	idx.recordAccess(pkg)
+	return idx.sortedDeps(pkg), idx.dependents[pkg].Sorted(), true
+}
+
+// sortedPackages returns all indexed packages in ascending order. Caller must hold idx.mu.
+func (idx *Indexer) sortedPackages() []string {
+	return idx.indexed.Sorted()
+}
+
+// sortedDeps returns the direct dependencies of pkg in ascending order. Caller must hold idx.mu.
+func (idx *Indexer) sortedDeps(pkg string) []string {
+	return idx.dependencies[pkg].Sorted()
+}
+
+// Packages returns all indexed packages in ascending order (read-only operation)
+func (idx *Indexer) Packages() []string {
 	idx.mu.RLock()
 	defer idx.mu.RUnlock()
 
-	return idx.indexed.Contains(pkg)
+	return idx.sortedPackages()
+}
+
+// Orphans returns the indexed packages that have no dependencies and no dependents
+// (isolated nodes) in ascending order (read-only operation)
+func (idx *Indexer) Orphans() []string {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	orphans := []string{}
+	for _, pkg := range idx.sortedPackages() {
+		if idx.dependencies[pkg].Len() == 0 && idx.dependents[pkg].Len() == 0 {
+			orphans = append(orphans, pkg)
+		}
+	}
+	return orphans
+}
+
+// Pinned returns the pinned packages in ascending order (read-only operation)
+func (idx *Indexer) Pinned() []string {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	return idx.pinned.Sorted()
+}
+
+// Search returns the indexed packages matching pattern, sorted (read-only operation). A
+// pattern containing glob metacharacters ("*", "?", "[") is matched as a whole against
+// each name using path.Match syntax; any other pattern is a name prefix. This scans every
+// package, so it is O(n) in the index size. A malformed glob matches nothing.
+func (idx *Indexer) Search(pattern string) []string {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	glob := strings.ContainsAny(pattern, "*?[")
+	matches := []string{}
+	for pkg := range idx.indexed {
+		var ok bool
+		if glob {
+			ok, _ = path.Match(pattern, pkg)
+		} else {
+			ok = strings.HasPrefix(pkg, pattern)
+		}
+		if ok {
+			matches = append(matches, pkg)
+		}
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+// Dependencies returns the direct dependencies of pkg in ascending order, and whether
+// pkg is indexed (read-only operation)
+func (idx *Indexer) Dependencies(pkg string) ([]string, bool) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	if !idx.indexed.Contains(pkg) {
+		return nil, false
+	}
+	idx.recordAccess(pkg)
+	return idx.sortedDeps(pkg), true
+}
+
+// SubtreeSize returns the number of packages transitively reachable from pkg along
+// forward edges (everything it needs) and reverse edges (everything a cascading removal
+// would affect), and whether pkg is indexed. Computed via BFS under the read lock.
+func (idx *Indexer) SubtreeSize(pkg string) (dependencies int, dependents int, ok bool) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	if !idx.indexed.Contains(pkg) {
+		return 0, 0, false
+	}
+	idx.recordAccess(pkg)
+	return reachable(idx.dependencies, pkg), reachable(idx.dependents, pkg), true
+}
+
+// DependencyDepth returns the length of the longest dependency chain starting at pkg
+// (0 for a leaf) and whether pkg is indexed. Computed via memoized DFS under the read
+// lock; edges closing a cycle (possible via re-indexing) are ignored.
+func (idx *Indexer) DependencyDepth(pkg string) (int, bool) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	if !idx.indexed.Contains(pkg) {
+		return 0, false
+	}
+	idx.recordAccess(pkg)
+
+	depth := make(map[string]int)
+	onPath := NewStringSet()
+	var visit func(name string) int
+	visit = func(name string) int {
+		if d, ok := depth[name]; ok {
+			return d
+		}
+		onPath.Add(name)
+		longest := 0
+		for dep := range idx.dependencies[name] {
+			if onPath.Contains(dep) {
+				continue // Cycle guard
+			}
+			if d := visit(dep) + 1; d > longest {
+				longest = d
+			}
+		}
+		onPath.Remove(name)
+		depth[name] = longest
+		return longest
+	}
+	return visit(pkg), true
+}
+
+// FindPath returns a shortest dependency path from one package to another, both ends
+// included (e.g. [app lib base] when app depends on lib and lib on base), and whether one
+// exists. Computed via BFS along forward edges under the read lock; visiting each package
+// once guards against cycles, and dependencies are expanded in name order so the result
+// is deterministic. A package reaches itself; missing packages have no path.
+func (idx *Indexer) FindPath(from, to string) ([]string, bool) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	if !idx.indexed.Contains(from) || !idx.indexed.Contains(to) {
+		return nil, false
+	}
+	idx.recordAccess(from)
+	idx.recordAccess(to)
+
+	parent := map[string]string{from: ""}
+	queue := []string{from}
+	for len(queue) > 0 {
+		pkg := queue[0]
+		queue = queue[1:]
+		if pkg == to {
+			var path []string
+			for step := to; step != from; step = parent[step] {
+				path = append(path, step)
+			}
+			path = append(path, from)
+			slices.Reverse(path)
+			return path, true
+		}
+		for _, dep := range idx.sortedDeps(pkg) {
+			if _, seen := parent[dep]; !seen {
+				parent[dep] = pkg
+				queue = append(queue, dep)
+			}
+		}
+	}
+	return nil, false
+}
+
+// reachable counts the packages reachable from start in edges, excluding start itself
+func reachable(edges map[string]StringSet, start string) int {
+	seen := NewStringSet()
+	seen.Add(start)
+	queue := []string{start}
+	for len(queue) > 0 {
+		pkg := queue[0]
+		queue = queue[1:]
+		for next := range edges[pkg] {
+			if !seen.Contains(next) {
+				seen.Add(next)
+				queue = append(queue, next)
+			}
+		}
+	}
+	return seen.Len() - 1
+}
+
+// TopologicalOrder returns every indexed package such that each package appears after
+// all of its dependencies, using Kahn's algorithm over the forward edges. Packages that
+// become ready at the same time are ordered by name so the result is deterministic.
+// Returns an error if the graph contains a cycle (possible via re-indexing).
+func (idx *Indexer) TopologicalOrder() ([]string, error) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	remaining := make(map[string]int, idx.indexed.Len())
+	var ready []string
+	for _, pkg := range idx.sortedPackages() {
+		remaining[pkg] = idx.dependencies[pkg].Len()
+		if remaining[pkg] == 0 {
+			ready = append(ready, pkg)
+		}
+	}
+
+	order := make([]string, 0, idx.indexed.Len())
+	for len(ready) > 0 {
+		pkg := ready[0]
+		ready = ready[1:]
+		order = append(order, pkg)
+
+		for _, dependent := range idx.dependents[pkg].Sorted() {
+			remaining[dependent]--
+			if remaining[dependent] == 0 {
+				ready = append(ready, dependent)
+			}
+		}
+	}
+
+	if len(order) != idx.indexed.Len() {
+		return nil, fmt.Errorf("dependency cycle detected among %d packages", idx.indexed.Len()-len(order))
+	}
+	return order, nil
+}
+
+// Restore atomically replaces the whole graph with the packages in specs, which must be
+// in dependency order as returned by ParsePackageSpecs. The new graph is built aside and
+// swapped in under the write lock, so readers see either the old or the new state, never
+// a mix. If any package cannot be indexed (a dependency is missing from specs or the
+// package limit is exceeded) the current graph is left untouched and an error is
+// returned. Pins on packages present in both graphs are kept; operation counters are not
+// reset.
+func (idx *Indexer) Restore(specs []PackageSpec) error {
+	next := NewIndexerWithMaxPackages(idx.maxPackages) // Never evicts while rebuilding
+	for _, spec := range specs {
+		if !next.IndexPackage(spec.Name, spec.Dependencies) {
+			return fmt.Errorf("failed to restore package %q: dependencies not indexed or package limit reached", spec.Name)
+		}
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.indexed = next.indexed
+	idx.dependencies = next.dependencies
+	idx.dependents = next.dependents
+	idx.labels = next.labels
+	for pkg := range idx.pinned {
+		if !idx.indexed.Contains(pkg) {
+			idx.pinned.Remove(pkg)
+		}
+	}
+	if idx.access != nil {
+		idx.access = newAccessClock()
+		for _, spec := range specs {
+			idx.access.touch(spec.Name)
+		}
+	}
+	idx.version.Add(1)
+	return nil
+}
+
+// Version returns the graph generation: a counter bumped by every change to packages,
+// edges or pins (indexing, removal, eviction, renames, dependency edits, pinning and
+// Restore) and by nothing else, so an unchanged version means an unchanged graph.
+// Reads never change it.
+func (idx *Indexer) Version() uint64 {
+	return idx.version.Load()
+}
+
+// FindCycles returns every simple dependency cycle currently in the graph, each listed
+// along its dependency edges starting from its smallest package name (e.g. [a b] for a
+// depending on b and b on a). Cycles are ordered by that sequence, so the result is
+// deterministic. Only strongly connected packages are searched, so acyclic parts of the
+// graph cost a single linear pass; within a densely cyclic component the number of
+// cycles can grow exponentially, so this is meant for diagnostics (read-only operation).
+func (idx *Indexer) FindCycles() [][]string {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	component := idx.componentsLocked()
+	cycles := [][]string{}
+	var path []string
+	onPath := NewStringSet()
+
+	// visit extends the path from pkg along dependencies larger than start within start's
+	// component, recording a cycle whenever an edge leads back to start
+	var visit func(start, pkg string)
+	visit = func(start, pkg string) {
+		path = append(path, pkg)
+		onPath.Add(pkg)
+		for _, dep := range idx.sortedDeps(pkg) {
+			switch {
+			case dep == start:
+				cycles = append(cycles, append([]string(nil), path...))
+			case dep > start && component[dep] == component[start] && !onPath.Contains(dep):
+				visit(start, dep)
+			}
+		}
+		path = path[:len(path)-1]
+		onPath.Remove(pkg)
+	}
+
+	for _, pkg := range idx.sortedPackages() {
+		visit(pkg, pkg)
+	}
+	return cycles
+}
+
+// componentsLocked labels each package with its strongly connected component using
+// Tarjan's algorithm; two packages share a label exactly when each depends on the other
+// transitively. The caller must hold the lock.
+func (idx *Indexer) componentsLocked() map[string]int {
+	var (
+		component = make(map[string]int, idx.indexed.Len())
+		index     = make(map[string]int, idx.indexed.Len()) // DFS discovery order
+		low       = make(map[string]int, idx.indexed.Len()) // Smallest index reachable
+		stack     []string
+		onStack   = NewStringSet()
+		next      int
+		label     int
+	)
+
+	var connect func(pkg string)
+	connect = func(pkg string) {
+		index[pkg], low[pkg] = next, next
+		next++
+		stack = append(stack, pkg)
+		onStack.Add(pkg)
+
+		for dep := range idx.dependencies[pkg] {
+			if _, seen := index[dep]; !seen {
+				connect(dep)
+				low[pkg] = min(low[pkg], low[dep])
+			} else if onStack.Contains(dep) {
+				low[pkg] = min(low[pkg], index[dep])
+			}
+		}
+
+		// pkg is the root of a component: pop it and everything above it
+		if low[pkg] == index[pkg] {
+			for {
+				top := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack.Remove(top)
+				component[top] = label
+				if top == pkg {
+					break
+				}
+			}
+			label++
+		}
+	}
+
+	for pkg := range idx.indexed {
+		if _, seen := index[pkg]; !seen {
+			connect(pkg)
+		}
+	}
+	return component
+}
+
+// OperationStats returns a snapshot of the indexer's operation counters. Each counter is
+// read atomically, though the set is not captured at a single instant.
+func (idx *Indexer) OperationStats() OperationStats {
+	return OperationStats{
+		IndexAttempts:      idx.indexAttempts.Load(),
+		IndexSuccesses:     idx.indexSuccesses.Load(),
+		RemoveAttempts:     idx.removeAttempts.Load(),
+		RemoveBlocked:      idx.removeBlocked.Load(),
+		RemovePinned:       idx.removePinned.Load(),
+		QueryHits:          idx.queryHits.Load(),
+		QueryMisses:        idx.queryMisses.Load(),
+		CapacityRejections: idx.capacityRejects.Load(),
+		Evictions:          idx.evictions.Load(),
+	}
+}
+
+// QueryHitRatio returns the fraction of queries that found an indexed package, or 0 when
+// nothing has been queried yet
+func (s OperationStats) QueryHitRatio() float64 {
+	total := s.QueryHits + s.QueryMisses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.QueryHits) / float64(total)
 }
 
 // GetStats returns current index statistics for monitoring
@@ -211,3 +211,832 @@ func TestStringSet_Operations(t *testing.T) {
 		t.Error("Modifying copy should not affect original")
 	}
 }
+
+// TestIndexer_DependencyCount validates direct dependency counts for leaf packages,
+// packages with multiple dependencies, and packages that are not indexed.
+func TestIndexer_DependencyCount(t *testing.T) {
+	idx := NewIndexer()
+
+	if _, ok := idx.DependencyCount("missing"); ok {
+		t.Error("DependencyCount should report missing package as not indexed")
+	}
+
+	assertIndex(t, idx, "a", nil, true)
+	assertIndex(t, idx, "b", nil, true)
+	assertIndex(t, idx, "c", nil, true)
+	assertIndex(t, idx, "app", []string{"a", "b", "c"}, true)
+
+	if count, ok := idx.DependencyCount("a"); !ok || count != 0 {
+		t.Errorf("DependencyCount(a) = (%d, %v), want (0, true)", count, ok)
+	}
+	if count, ok := idx.DependencyCount("app"); !ok || count != 3 {
+		t.Errorf("DependencyCount(app) = (%d, %v), want (3, true)", count, ok)
+	}
+
+	// Re-indexing replaces the dependency set
+	assertIndex(t, idx, "app", []string{"a"}, true)
+	if count, _ := idx.DependencyCount("app"); count != 1 {
+		t.Errorf("DependencyCount(app) after re-index = %d, want 1", count)
+	}
+}
+
+// TestIndexer_TopologicalOrder validates that every package follows its dependencies
+// on a DAG and that cycles introduced through re-indexing are reported.
+func TestIndexer_TopologicalOrder(t *testing.T) {
+	idx := NewIndexer()
+	assertIndex(t, idx, "base", nil, true)
+	assertIndex(t, idx, "lib", []string{"base"}, true)
+	assertIndex(t, idx, "util", []string{"base"}, true)
+	assertIndex(t, idx, "app", []string{"lib", "util"}, true)
+	assertIndex(t, idx, "tool", []string{"util"}, true)
+
+	order, err := idx.TopologicalOrder()
+	if err != nil {
+		t.Fatalf("TopologicalOrder returned error: %v", err)
+	}
+	if len(order) != 5 {
+		t.Fatalf("expected 5 packages, got %v", order)
+	}
+
+	position := make(map[string]int)
+	for i, pkg := range order {
+		position[pkg] = i
+	}
+	for pkg, deps := range idx.dependencies {
+		for dep := range deps {
+			if position[dep] > position[pkg] {
+				t.Errorf("%s ordered before its dependency %s in %v", pkg, dep, order)
+			}
+		}
+	}
+
+	// Re-indexing a dependency to depend on its dependent creates a cycle
+	cyclic := NewIndexer()
+	assertIndex(t, cyclic, "a", nil, true)
+	assertIndex(t, cyclic, "b", []string{"a"}, true)
+	assertIndex(t, cyclic, "a", []string{"b"}, true)
+	if _, err := cyclic.TopologicalOrder(); err == nil {
+		t.Error("TopologicalOrder should report a cycle")
+	}
+}
+
+// TestIndexer_SubtreeSize validates transitive dependency and dependent counts on a
+// diamond-shaped graph, counting shared packages once.
+func TestIndexer_SubtreeSize(t *testing.T) {
+	idx := NewIndexer()
+	assertIndex(t, idx, "base", nil, true)
+	assertIndex(t, idx, "lib", []string{"base"}, true)
+	assertIndex(t, idx, "util", []string{"base"}, true)
+	assertIndex(t, idx, "app", []string{"lib", "util"}, true)
+	assertIndex(t, idx, "other", nil, true)
+
+	tests := []struct {
+		pkg        string
+		deps       int
+		dependents int
+	}{
+		{"base", 0, 3},
+		{"lib", 1, 1},
+		{"app", 3, 0},
+		{"other", 0, 0},
+	}
+	for _, test := range tests {
+		deps, dependents, ok := idx.SubtreeSize(test.pkg)
+		if !ok || deps != test.deps || dependents != test.dependents {
+			t.Errorf("SubtreeSize(%s) = (%d, %d, %v), want (%d, %d, true)",
+				test.pkg, deps, dependents, ok, test.deps, test.dependents)
+		}
+	}
+
+	if _, _, ok := idx.SubtreeSize("missing"); ok {
+		t.Error("SubtreeSize should report missing package as not indexed")
+	}
+}
+
+// TestIndexer_DeterministicListing validates that package and dependency listings are
+// sorted and identical across repeated calls despite randomized map iteration.
+func TestIndexer_DeterministicListing(t *testing.T) {
+	idx := NewIndexer()
+	names := []string{"zlib", "openssl", "curl", "git", "bash", "node", "python", "make"}
+	for _, name := range names {
+		assertIndex(t, idx, name, nil, true)
+	}
+	assertIndex(t, idx, "app", names, true)
+
+	first := idx.Packages()
+	for i := 0; i < 20; i++ {
+		if again := idx.Packages(); fmt.Sprint(again) != fmt.Sprint(first) {
+			t.Fatalf("Packages() order changed between calls: %v vs %v", first, again)
+		}
+	}
+	for i := 1; i < len(first); i++ {
+		if first[i-1] > first[i] {
+			t.Fatalf("Packages() not sorted: %v", first)
+		}
+	}
+
+	deps, ok := idx.Dependencies("app")
+	if !ok || len(deps) != len(names) {
+		t.Fatalf("Dependencies(app) = %v, %v", deps, ok)
+	}
+	for i := 0; i < 20; i++ {
+		if again, _ := idx.Dependencies("app"); fmt.Sprint(again) != fmt.Sprint(deps) {
+			t.Fatalf("Dependencies() order changed between calls: %v vs %v", deps, again)
+		}
+	}
+	if _, ok := idx.Dependencies("missing"); ok {
+		t.Error("Dependencies should report missing package as not indexed")
+	}
+}
+
+// TestIndexer_Status validates existence and direct edge counts in a single snapshot
+func TestIndexer_Status(t *testing.T) {
+	idx := NewIndexer()
+	assertIndex(t, idx, "a", nil, true)
+	assertIndex(t, idx, "app", []string{"a"}, true)
+
+	if status := idx.Status("a"); status != (PackageStatus{Indexed: true, Dependencies: 0, Dependents: 1}) {
+		t.Errorf("Status(a) = %+v", status)
+	}
+	if status := idx.Status("app"); status != (PackageStatus{Indexed: true, Dependencies: 1, Dependents: 0}) {
+		t.Errorf("Status(app) = %+v", status)
+	}
+	if status := idx.Status("missing"); status.Indexed {
+		t.Errorf("Status(missing) = %+v, expected not indexed", status)
+	}
+}
+
+// TestIndexer_DependencyDepth validates longest-chain depth on chains of varying length,
+// leaves, missing packages and re-indexing cycles.
+func TestIndexer_DependencyDepth(t *testing.T) {
+	idx := NewIndexer()
+	assertIndex(t, idx, "base", nil, true)
+	assertIndex(t, idx, "lib", []string{"base"}, true)
+	assertIndex(t, idx, "util", []string{"lib"}, true)
+	assertIndex(t, idx, "app", []string{"util", "base"}, true)
+
+	for pkg, expected := range map[string]int{"base": 0, "lib": 1, "util": 2, "app": 3} {
+		if depth, ok := idx.DependencyDepth(pkg); !ok || depth != expected {
+			t.Errorf("DependencyDepth(%s) = %d, %v; expected %d, true", pkg, depth, ok, expected)
+		}
+	}
+	if _, ok := idx.DependencyDepth("missing"); ok {
+		t.Error("DependencyDepth should report missing packages")
+	}
+
+	// Re-indexing base on top of app closes a cycle; depth must still terminate
+	assertIndex(t, idx, "base", []string{"app"}, true)
+	if depth, ok := idx.DependencyDepth("app"); !ok || depth != 3 {
+		t.Errorf("DependencyDepth(app) with cycle = %d, %v; expected 3, true", depth, ok)
+	}
+}
+
+// TestIndexer_Orphans validates that only isolated packages are reported, sorted, and
+// that removing a package's last dependent makes it an orphan.
+func TestIndexer_Orphans(t *testing.T) {
+	idx := NewIndexer()
+	if orphans := idx.Orphans(); len(orphans) != 0 {
+		t.Errorf("expected no orphans in empty index, got %v", orphans)
+	}
+
+	assertIndex(t, idx, "zeta", nil, true)
+	assertIndex(t, idx, "base", nil, true)
+	assertIndex(t, idx, "app", []string{"base"}, true)
+	assertIndex(t, idx, "alpha", nil, true)
+
+	if orphans := idx.Orphans(); fmt.Sprint(orphans) != "[alpha zeta]" {
+		t.Errorf("Orphans() = %v, expected [alpha zeta]", orphans)
+	}
+
+	idx.RemovePackage("app")
+	if orphans := idx.Orphans(); fmt.Sprint(orphans) != "[alpha base zeta]" {
+		t.Errorf("Orphans() after removal = %v, expected [alpha base zeta]", orphans)
+	}
+}
+
+func TestIndexer_OperationStats(t *testing.T) {
+	idx := NewIndexer()
+
+	assertIndex(t, idx, "base", nil, true)
+	assertIndex(t, idx, "app", []string{"base"}, true)
+	assertIndex(t, idx, "tool", []string{"missing"}, false)
+	assertIndex(t, idx, "app", []string{"base"}, true) // re-index counts again
+
+	idx.RemovePackage("base")    // blocked by app
+	idx.RemovePackage("missing") // not indexed
+	idx.RemovePackage("app")
+
+	idx.QueryPackage("base")
+	idx.QueryPackage("app")
+	idx.QueryPackage("tool")
+
+	expected := OperationStats{
+		IndexAttempts:  4,
+		IndexSuccesses: 3,
+		RemoveAttempts: 3,
+		RemoveBlocked:  1,
+		QueryHits:      1,
+		QueryMisses:    2,
+	}
+	if stats := idx.OperationStats(); stats != expected {
+		t.Errorf("OperationStats() = %+v, expected %+v", stats, expected)
+	}
+}
+
+func TestIndexer_QueryHitRatio(t *testing.T) {
+	idx := NewIndexer()
+	if ratio := idx.OperationStats().QueryHitRatio(); ratio != 0 {
+		t.Errorf("expected 0 hit ratio before any query, got %v", ratio)
+	}
+
+	assertIndex(t, idx, "base", nil, true)
+	for i := 0; i < 3; i++ {
+		idx.QueryPackage("base")
+	}
+	idx.QueryPackage("ghost")
+
+	stats := idx.OperationStats()
+	if stats.QueryHits != 3 || stats.QueryMisses != 1 {
+		t.Errorf("expected 3 hits and 1 miss, got %d and %d", stats.QueryHits, stats.QueryMisses)
+	}
+	if ratio := stats.QueryHitRatio(); ratio != 0.75 {
+		t.Errorf("QueryHitRatio() = %v, expected 0.75", ratio)
+	}
+}
+
+func TestIndexer_IndexPackageCAS(t *testing.T) {
+	idx := NewIndexer()
+	assertIndex(t, idx, "a", nil, true)
+	assertIndex(t, idx, "b", nil, true)
+
+	// First-time index applies regardless of the expected hash
+	hash, ok := idx.IndexPackageCAS("app", []string{"a"}, "")
+	if !ok || hash != DependencyHash([]string{"a"}) {
+		t.Fatalf("first-time CAS = (%q, %v), expected (%q, true)", hash, ok, DependencyHash([]string{"a"}))
+	}
+
+	// A stale hash is refused and reports the current one
+	stale := DependencyHash(nil)
+	if current, ok := idx.IndexPackageCAS("app", []string{"a", "b"}, stale); ok || current != hash {
+		t.Errorf("mismatched CAS = (%q, %v), expected (%q, false)", current, ok, hash)
+	}
+	if deps, _ := idx.Dependencies("app"); fmt.Sprint(deps) != "[a]" {
+		t.Errorf("mismatched CAS changed dependencies to %v", deps)
+	}
+
+	// The current hash applies the update
+	updated, ok := idx.IndexPackageCAS("app", []string{"b", "a"}, hash)
+	if !ok || updated != DependencyHash([]string{"a", "b"}) {
+		t.Errorf("matching CAS = (%q, %v), expected (%q, true)", updated, ok, DependencyHash([]string{"a", "b"}))
+	}
+}
+
+func TestDependencyHash(t *testing.T) {
+	if DependencyHash([]string{"b", "a", "a"}) != DependencyHash([]string{"a", "b"}) {
+		t.Error("hash should ignore order and duplicates")
+	}
+	if DependencyHash([]string{"a"}) == DependencyHash([]string{"a", "b"}) {
+		t.Error("different dependency sets should hash differently")
+	}
+	if hash := DependencyHash(nil); len(hash) != 16 {
+		t.Errorf("expected 16 hex digits, got %q", hash)
+	}
+}
+
+func TestIndexer_RemovePackagesBulk(t *testing.T) {
+	idx := NewIndexer()
+	assertIndex(t, idx, "base", nil, true)
+	assertIndex(t, idx, "lib", []string{"base"}, true)
+	assertIndex(t, idx, "app", []string{"lib", "base"}, true)
+	assertIndex(t, idx, "keep", nil, true)
+	assertIndex(t, idx, "user", []string{"keep"}, true)
+
+	// Removing dependencies first would fail one by one; the bulk call reorders
+	results := idx.RemovePackagesBulk([]string{"base", "lib", "app", "keep", "ghost", "base"})
+
+	expected := map[string]RemoveResult{
+		"base":  RemoveResultOK,
+		"lib":   RemoveResultOK,
+		"app":   RemoveResultOK,
+		"keep":  RemoveResultBlocked, // user is outside the set
+		"ghost": RemoveResultNotIndexed,
+	}
+	if fmt.Sprint(results) != fmt.Sprint(expected) {
+		t.Errorf("RemovePackagesBulk() = %v, expected %v", results, expected)
+	}
+	if packages := idx.Packages(); fmt.Sprint(packages) != "[keep user]" {
+		t.Errorf("expected only keep and user to remain, got %v", packages)
+	}
+}
+
+func TestIndexer_MaxPackages(t *testing.T) {
+	idx := NewIndexerWithMaxPackages(2)
+	assertIndex(t, idx, "a", nil, true)
+	assertIndex(t, idx, "b", []string{"a"}, true)
+
+	// Full: new packages fail, updates to existing ones still apply
+	assertIndex(t, idx, "c", nil, false)
+	assertIndex(t, idx, "b", nil, true)
+	if _, ok := idx.IndexPackageCAS("c", nil, ""); ok {
+		t.Error("expected CAS of a new package to fail at capacity")
+	}
+	if rejections := idx.OperationStats().CapacityRejections; rejections != 2 {
+		t.Errorf("expected 2 capacity rejections, got %d", rejections)
+	}
+
+	// Removing a package frees a slot
+	idx.RemovePackage("b")
+	assertIndex(t, idx, "c", nil, true)
+}
+
+func TestIndexer_Search(t *testing.T) {
+	idx := NewIndexer()
+	for _, pkg := range []string{"libpng", "libjpeg", "lib", "libjpeg-dev", "zlib", "python"} {
+		assertIndex(t, idx, pkg, nil, true)
+	}
+
+	tests := []struct {
+		pattern  string
+		expected string
+	}{
+		{"lib", "[lib libjpeg libjpeg-dev libpng]"},
+		{"libj", "[libjpeg libjpeg-dev]"},
+		{"*lib", "[lib zlib]"},
+		{"lib*-dev", "[libjpeg-dev]"},
+		{"lib?png", "[]"},
+		{"libp?g", "[libpng]"},
+		{"nomatch", "[]"},
+		{"[", "[]"}, // Malformed glob
+	}
+	for _, test := range tests {
+		matches := idx.Search(test.pattern)
+		if matches == nil {
+			t.Errorf("Search(%q) returned nil, expected empty slice", test.pattern)
+		}
+		if fmt.Sprint(matches) != test.expected {
+			t.Errorf("Search(%q) = %v, expected %s", test.pattern, matches, test.expected)
+		}
+	}
+}
+
+func TestIndexer_Edges(t *testing.T) {
+	idx := NewIndexer()
+	assertIndex(t, idx, "base", nil, true)
+	assertIndex(t, idx, "lib", []string{"base"}, true)
+	assertIndex(t, idx, "app", []string{"lib"}, true)
+	assertIndex(t, idx, "cli", []string{"lib", "base"}, true)
+
+	deps, dependents, ok := idx.Edges("lib")
+	if !ok || fmt.Sprint(deps) != "[base]" || fmt.Sprint(dependents) != "[app cli]" {
+		t.Errorf("Edges(lib) = (%v, %v, %v), expected ([base], [app cli], true)", deps, dependents, ok)
+	}
+	if _, _, ok := idx.Edges("missing"); ok {
+		t.Error("expected Edges of a missing package to report not indexed")
+	}
+}
+
+func TestIndexer_RenamePackage(t *testing.T) {
+	idx := NewIndexer()
+	assertIndex(t, idx, "base", nil, true)
+	assertIndex(t, idx, "lib", []string{"base"}, true)
+	assertIndex(t, idx, "app", []string{"lib"}, true)
+	assertIndex(t, idx, "cli", []string{"lib", "base"}, true)
+	_, depsBefore, reverseBefore := idx.GetStats()
+
+	if !idx.RenamePackage("lib", "libcore") {
+		t.Fatal("expected rename of an indexed package to succeed")
+	}
+	assertQuery(t, idx, "lib", false)
+	assertQuery(t, idx, "libcore", true)
+
+	// Both edge directions follow the new name
+	deps, dependents, _ := idx.Edges("libcore")
+	if fmt.Sprint(deps) != "[base]" || fmt.Sprint(dependents) != "[app cli]" {
+		t.Errorf("Edges(libcore) = (%v, %v), expected ([base], [app cli])", deps, dependents)
+	}
+	if deps, _ := idx.Dependencies("cli"); fmt.Sprint(deps) != "[base libcore]" {
+		t.Errorf("expected cli to depend on [base libcore], got %v", deps)
+	}
+	if _, dependents, _ := idx.Edges("base"); fmt.Sprint(dependents) != "[cli libcore]" {
+		t.Errorf("expected base dependents [cli libcore], got %v", dependents)
+	}
+
+	indexed, depsAfter, reverseAfter := idx.GetStats()
+	if indexed != 4 || depsAfter != depsBefore || reverseAfter != reverseBefore {
+		t.Errorf("GetStats() = (%d, %d, %d), expected (4, %d, %d)", indexed, depsAfter, reverseAfter, depsBefore, reverseBefore)
+	}
+
+	// The renamed package still blocks removal of its dependencies and is removable once
+	// its dependents are gone
+	assertRemove(t, idx, "libcore", RemoveResultBlocked)
+	assertRemove(t, idx, "app", RemoveResultOK)
+	assertRemove(t, idx, "cli", RemoveResultOK)
+	assertRemove(t, idx, "libcore", RemoveResultOK)
+	assertRemove(t, idx, "base", RemoveResultOK)
+
+	// Missing source or taken destination
+	assertIndex(t, idx, "x", nil, true)
+	assertIndex(t, idx, "y", nil, true)
+	if idx.RenamePackage("missing", "z") {
+		t.Error("expected rename of a missing package to fail")
+	}
+	if idx.RenamePackage("x", "y") || idx.RenamePackage("x", "x") {
+		t.Error("expected rename onto an indexed name to fail")
+	}
+}
+
+func TestIndexer_RenamePackageSelfDependency(t *testing.T) {
+	idx := NewIndexer()
+	assertIndex(t, idx, "loop", nil, true)
+	assertIndex(t, idx, "loop", []string{"loop"}, true)
+
+	if !idx.RenamePackage("loop", "cycle") {
+		t.Fatal("expected rename to succeed")
+	}
+	deps, dependents, _ := idx.Edges("cycle")
+	if fmt.Sprint(deps) != "[cycle]" || fmt.Sprint(dependents) != "[cycle]" {
+		t.Errorf("Edges(cycle) = (%v, %v), expected ([cycle], [cycle])", deps, dependents)
+	}
+	if _, _, ok := idx.Edges("loop"); ok {
+		t.Error("expected old name to be gone")
+	}
+}
+
+func TestIndexer_DependencyDeltas(t *testing.T) {
+	idx := NewIndexer()
+	assertIndex(t, idx, "a", nil, true)
+	assertIndex(t, idx, "b", nil, true)
+	assertIndex(t, idx, "c", nil, true)
+	assertIndex(t, idx, "app", []string{"a"}, true)
+
+	if !idx.AddDependencies("app", []string{"b", "c", "a"}) {
+		t.Fatal("expected AddDependencies to succeed")
+	}
+	if deps, _ := idx.Dependencies("app"); fmt.Sprint(deps) != "[a b c]" {
+		t.Errorf("expected app dependencies [a b c], got %v", deps)
+	}
+	for _, dep := range []string{"a", "b", "c"} {
+		if _, dependents, _ := idx.Edges(dep); fmt.Sprint(dependents) != "[app]" {
+			t.Errorf("expected %s dependents [app], got %v", dep, dependents)
+		}
+	}
+
+	// A missing package or dependency fails without partial changes
+	if idx.AddDependencies("app", []string{"missing"}) || idx.AddDependencies("missing", []string{"a"}) {
+		t.Error("expected AddDependencies with an unindexed package to fail")
+	}
+	if deps, _ := idx.Dependencies("app"); fmt.Sprint(deps) != "[a b c]" {
+		t.Errorf("expected failed add to leave [a b c], got %v", deps)
+	}
+
+	if !idx.RemoveDependencies("app", []string{"b", "unrelated"}) {
+		t.Fatal("expected RemoveDependencies to succeed")
+	}
+	if deps, _ := idx.Dependencies("app"); fmt.Sprint(deps) != "[a c]" {
+		t.Errorf("expected app dependencies [a c], got %v", deps)
+	}
+	if _, dependents, _ := idx.Edges("b"); len(dependents) != 0 {
+		t.Errorf("expected b to have no dependents, got %v", dependents)
+	}
+	assertRemove(t, idx, "b", RemoveResultOK)
+	assertRemove(t, idx, "a", RemoveResultBlocked)
+	if idx.RemoveDependencies("missing", []string{"a"}) {
+		t.Error("expected RemoveDependencies of a missing package to fail")
+	}
+
+	// Reverse-edge map entries disappear once a dependency loses its last dependent
+	idx.RemoveDependencies("app", []string{"a", "c"})
+	if _, _, reverse := idx.GetStats(); reverse != 0 {
+		t.Errorf("expected no reverse-edge entries, got %d", reverse)
+	}
+}
+
+func TestIndexer_IndexPackageMissing(t *testing.T) {
+	idx := NewIndexerWithMaxPackages(3)
+	assertIndex(t, idx, "a", nil, true)
+
+	missing, ok := idx.IndexPackageMissing("app", []string{"z", "a", "x", "z"})
+	if ok || fmt.Sprint(missing) != "[x z]" {
+		t.Errorf("IndexPackageMissing with missing deps = %v, %v, expected [x z], false", missing, ok)
+	}
+	if idx.QueryPackage("app") {
+		t.Error("failed index should not add the package")
+	}
+
+	if missing, ok := idx.IndexPackageMissing("app", []string{"a"}); !ok || missing != nil {
+		t.Errorf("IndexPackageMissing with indexed deps = %v, %v, expected nil, true", missing, ok)
+	}
+	assertIndex(t, idx, "b", nil, true)
+	if missing, ok := idx.IndexPackageMissing("c", nil); ok || missing != nil {
+		t.Errorf("IndexPackageMissing over the limit = %v, %v, expected nil, false", missing, ok)
+	}
+	if attempts := idx.OperationStats().IndexAttempts; attempts != 5 {
+		t.Errorf("expected 5 index attempts, got %d", attempts)
+	}
+}
+
+func TestIndexer_CanRemove(t *testing.T) {
+	idx := NewIndexer()
+	assertIndex(t, idx, "base", nil, true)
+	assertIndex(t, idx, "app", []string{"base"}, true)
+
+	tests := []struct {
+		pkg      string
+		expected bool
+	}{
+		{"app", true},     // Indexed without dependents
+		{"base", false},   // Blocked by app
+		{"missing", true}, // Removing a missing package is OK
+	}
+	for _, test := range tests {
+		if got := idx.CanRemove(test.pkg); got != test.expected {
+			t.Errorf("CanRemove(%q) = %v, expected %v", test.pkg, got, test.expected)
+		}
+	}
+
+	// Nothing changed
+	if packages := idx.Packages(); fmt.Sprint(packages) != "[app base]" {
+		t.Errorf("expected [app base] to remain, got %v", packages)
+	}
+	if stats := idx.OperationStats(); stats.RemoveAttempts != 0 || stats.RemoveBlocked != 0 {
+		t.Errorf("expected no remove counters, got %+v", stats)
+	}
+}
+
+func TestIndexer_PinPackage(t *testing.T) {
+	idx := NewIndexer()
+	assertIndex(t, idx, "base", nil, true)
+	assertIndex(t, idx, "app", []string{"base"}, true)
+
+	if idx.PinPackage("missing") {
+		t.Error("expected pinning a missing package to fail")
+	}
+	if !idx.PinPackage("app") || !idx.PinPackage("app") {
+		t.Fatal("expected pinning an indexed package to succeed, even twice")
+	}
+	idx.PinPackage("base")
+
+	// Pins hold regardless of dependents and survive re-indexing
+	assertRemove(t, idx, "app", RemoveResultPinned)
+	assertIndex(t, idx, "app", nil, true)
+	assertRemove(t, idx, "app", RemoveResultPinned)
+	assertRemove(t, idx, "base", RemoveResultPinned)
+	if idx.CanRemove("app") {
+		t.Error("expected CanRemove to report a pinned package as not removable")
+	}
+	if status := idx.Status("app"); !status.Pinned {
+		t.Errorf("expected Status to report app as pinned, got %+v", status)
+	}
+	if pinned := idx.Pinned(); fmt.Sprint(pinned) != "[app base]" {
+		t.Errorf("expected [app base] pinned, got %v", pinned)
+	}
+
+	// The pin follows a rename
+	if !idx.RenamePackage("app", "service") {
+		t.Fatal("expected rename of a pinned package to succeed")
+	}
+	assertRemove(t, idx, "service", RemoveResultPinned)
+
+	// Unpinning restores normal behavior
+	idx.UnpinPackage("service")
+	idx.UnpinPackage("base")
+	idx.UnpinPackage("missing") // No-op
+	assertRemove(t, idx, "service", RemoveResultOK)
+	assertRemove(t, idx, "base", RemoveResultOK)
+	if pinned := idx.Pinned(); len(pinned) != 0 {
+		t.Errorf("expected no pinned packages, got %v", pinned)
+	}
+	if stats := idx.OperationStats(); stats.RemovePinned != 4 || stats.RemoveBlocked != 0 {
+		t.Errorf("expected 4 pinned refusals and none blocked, got %+v", stats)
+	}
+}
+
+func TestIndexer_OptionalDependencies(t *testing.T) {
+	idx := NewIndexer()
+	assertIndex(t, idx, "db", nil, true)
+	assertIndex(t, idx, "cache", nil, true)
+	if !idx.IndexPackageLabeled("app", []string{"db", "cache"}, map[string]string{"db": LabelRequired, "cache": LabelOptional}) {
+		t.Fatal("expected labeled index to succeed")
+	}
+
+	// Only the required edge blocks removal; removing the optional dependency drops the edge
+	assertRemove(t, idx, "db", RemoveResultBlocked)
+	if !idx.CanRemove("cache") {
+		t.Error("expected an optional dependent not to block CanRemove")
+	}
+	assertRemove(t, idx, "cache", RemoveResultOK)
+	if deps, _ := idx.Dependencies("app"); fmt.Sprint(deps) != "[db]" {
+		t.Errorf("expected app to keep only db, got %v", deps)
+	}
+
+	// Re-indexing without labels makes every edge required again
+	assertIndex(t, idx, "cache", nil, true)
+	assertIndex(t, idx, "app", []string{"db", "cache"}, true)
+	assertRemove(t, idx, "cache", RemoveResultBlocked)
+
+	// Labels follow renames on both ends of the edge
+	idx.IndexPackageLabeled("app", []string{"db", "cache"}, map[string]string{"cache": LabelOptional})
+	if !idx.RenamePackage("cache", "store") || !idx.RenamePackage("app", "service") {
+		t.Fatal("expected renames to succeed")
+	}
+	assertRemove(t, idx, "store", RemoveResultOK)
+	assertRemove(t, idx, "db", RemoveResultBlocked)
+	assertRemove(t, idx, "service", RemoveResultOK)
+	assertRemove(t, idx, "db", RemoveResultOK)
+	if stats := idx.Status("db"); stats.Indexed {
+		t.Errorf("expected db to be removed, got %+v", stats)
+	}
+	if len(idx.labels) != 0 {
+		t.Errorf("expected no labels left, got %v", idx.labels)
+	}
+}
+
+func TestIndexer_OptionalDependenciesBulkRemove(t *testing.T) {
+	idx := NewIndexer()
+	assertIndex(t, idx, "base", nil, true)
+	assertIndex(t, idx, "plugin", nil, true)
+	idx.IndexPackageLabeled("app", []string{"base", "plugin"}, map[string]string{"plugin": LabelOptional})
+	assertIndex(t, idx, "tool", []string{"base"}, true)
+
+	results := idx.RemovePackagesBulk([]string{"base", "plugin"})
+	if results["plugin"] != RemoveResultOK || results["base"] != RemoveResultBlocked {
+		t.Errorf("expected plugin removed and base blocked, got %v", results)
+	}
+	if !ValidLabel(LabelOptional) || !ValidLabel(LabelRequired) || ValidLabel("weak") {
+		t.Error("ValidLabel should accept exactly required and optional")
+	}
+}
+
+func TestIndexer_FindPath(t *testing.T) {
+	idx := NewIndexer()
+	assertIndex(t, idx, "base", nil, true)
+	assertIndex(t, idx, "lib", []string{"base"}, true)
+	assertIndex(t, idx, "util", []string{"base"}, true)
+	assertIndex(t, idx, "app", []string{"util", "lib"}, true)
+	assertIndex(t, idx, "tool", nil, true)
+	assertIndex(t, idx, "base", []string{"app"}, true) // Cycle back through app
+
+	tests := []struct {
+		from, to string
+		expected []string
+		ok       bool
+	}{
+		{"app", "base", []string{"app", "lib", "base"}, true}, // Shortest, ties broken by name
+		{"app", "lib", []string{"app", "lib"}, true},          // Direct edge
+		{"base", "util", []string{"base", "app", "util"}, true},
+		{"app", "app", []string{"app"}, true},
+		{"app", "tool", nil, false}, // No path
+		{"tool", "app", nil, false},
+		{"missing", "app", nil, false},
+	}
+	for _, test := range tests {
+		path, ok := idx.FindPath(test.from, test.to)
+		if ok != test.ok || fmt.Sprint(path) != fmt.Sprint(test.expected) {
+			t.Errorf("FindPath(%q, %q) = %v, %v, expected %v, %v", test.from, test.to, path, ok, test.expected, test.ok)
+		}
+	}
+}
+
+func TestIndexer_RejectCycles(t *testing.T) {
+	// Without rejection the two-step cycle is accepted and wedges both packages
+	idx := NewIndexer()
+	assertIndex(t, idx, "b", nil, true)
+	assertIndex(t, idx, "a", []string{"b"}, true)
+	assertIndex(t, idx, "b", []string{"a"}, true)
+	assertRemove(t, idx, "a", RemoveResultBlocked)
+	assertRemove(t, idx, "b", RemoveResultBlocked)
+
+	idx = NewIndexer()
+	idx.SetRejectCycles(true)
+	assertIndex(t, idx, "base", nil, true)
+	assertIndex(t, idx, "b", []string{"base"}, true)
+	assertIndex(t, idx, "a", []string{"b"}, true)
+	assertIndex(t, idx, "top", []string{"a"}, true)
+
+	assertIndex(t, idx, "b", []string{"a"}, false)      // Direct two-step cycle
+	assertIndex(t, idx, "base", []string{"top"}, false) // Longer chain
+	assertIndex(t, idx, "a", []string{"a"}, false)      // Self-dependency
+	if idx.AddDependencies("b", []string{"top"}) {
+		t.Error("expected AddDependencies closing a cycle to fail")
+	}
+
+	// The rejected updates left the graph intact and acyclic
+	if deps, _ := idx.Dependencies("b"); fmt.Sprint(deps) != "[base]" {
+		t.Errorf("expected b to keep [base], got %v", deps)
+	}
+	if _, err := idx.TopologicalOrder(); err != nil {
+		t.Errorf("expected an acyclic graph, got %v", err)
+	}
+
+	// Updates that keep the graph acyclic still apply
+	assertIndex(t, idx, "top", []string{"a", "base"}, true)
+	assertIndex(t, idx, "b", nil, true)
+}
+
+func TestIndexer_FindCycles(t *testing.T) {
+	idx := NewIndexer()
+	if cycles := idx.FindCycles(); cycles == nil || len(cycles) != 0 {
+		t.Errorf("expected an empty, non-nil result for an empty graph, got %v", cycles)
+	}
+
+	// An acyclic diamond reports nothing
+	assertIndex(t, idx, "base", nil, true)
+	assertIndex(t, idx, "left", []string{"base"}, true)
+	assertIndex(t, idx, "right", []string{"base"}, true)
+	assertIndex(t, idx, "top", []string{"left", "right"}, true)
+	if cycles := idx.FindCycles(); len(cycles) != 0 {
+		t.Errorf("expected no cycles in a DAG, got %v", cycles)
+	}
+
+	// Re-indexing closes cycles: base -> top -> {left, right} -> base, plus a separate
+	// two-package cycle and a self-dependency
+	assertIndex(t, idx, "base", []string{"top"}, true)
+	assertIndex(t, idx, "y", nil, true)
+	assertIndex(t, idx, "x", []string{"y"}, true)
+	assertIndex(t, idx, "y", []string{"x"}, true)
+	assertIndex(t, idx, "self", nil, true)
+	assertIndex(t, idx, "self", []string{"self"}, true)
+
+	expected := "[[base top left] [base top right] [self] [x y]]"
+	if cycles := idx.FindCycles(); fmt.Sprint(cycles) != expected {
+		t.Errorf("FindCycles() = %v, expected %s", cycles, expected)
+	}
+}
+
+func TestIndexer_Restore(t *testing.T) {
+	idx := NewIndexer()
+	assertIndex(t, idx, "old", nil, true)
+	assertIndex(t, idx, "shared", nil, true)
+	idx.PinPackage("old")
+	idx.PinPackage("shared")
+
+	specs, err := ParsePackageSpecs("app: shared\nshared:\n")
+	if err != nil {
+		t.Fatalf("ParsePackageSpecs failed: %v", err)
+	}
+	if err := idx.Restore(specs); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if packages := idx.Packages(); fmt.Sprint(packages) != "[app shared]" {
+		t.Errorf("expected restored packages [app shared], got %v", packages)
+	}
+	if pinned := idx.Pinned(); fmt.Sprint(pinned) != "[shared]" {
+		t.Errorf("expected only the surviving pin, got %v", pinned)
+	}
+	if deps, _, ok := idx.Edges("app"); !ok || fmt.Sprint(deps) != "[shared]" {
+		t.Errorf("expected restored edge app -> shared, got %v", deps)
+	}
+
+	// A snapshot that cannot be indexed leaves the graph untouched
+	if err := idx.Restore([]PackageSpec{{Name: "web", Dependencies: []string{"missing"}}}); err == nil {
+		t.Fatal("expected Restore with a missing dependency to fail")
+	}
+	if packages := idx.Packages(); fmt.Sprint(packages) != "[app shared]" {
+		t.Errorf("expected failed restore to keep [app shared], got %v", packages)
+	}
+
+	limited := NewIndexerWithMaxPackages(1)
+	if err := limited.Restore(specs); err == nil {
+		t.Error("expected Restore beyond the package limit to fail")
+	}
+}
+
+func TestIndexer_Version(t *testing.T) {
+	idx := NewIndexer()
+	version := idx.Version()
+	expectBump := func(op string, bumped bool) {
+		t.Helper()
+		next := idx.Version()
+		if bumped && next != version+1 {
+			t.Errorf("%s: expected version %d, got %d", op, version+1, next)
+		}
+		if !bumped && next != version {
+			t.Errorf("%s: expected version to stay %d, got %d", op, version, next)
+		}
+		version = next
+	}
+
+	assertIndex(t, idx, "base", nil, true)
+	expectBump("INDEX", true)
+	assertIndex(t, idx, "app", []string{"missing"}, false)
+	expectBump("failed INDEX", false)
+	idx.QueryPackage("base")
+	idx.Status("base")
+	expectBump("reads", false)
+	assertIndex(t, idx, "app", []string{"base"}, true)
+	expectBump("INDEX", true)
+	idx.RemovePackage("base")
+	expectBump("blocked REMOVE", false)
+	idx.PinPackage("app")
+	expectBump("PIN", true)
+	idx.PinPackage("app")
+	expectBump("repeated PIN", false)
+	idx.UnpinPackage("app")
+	expectBump("UNPIN", true)
+	idx.RenamePackage("app", "web")
+	expectBump("RENAME", true)
+	idx.RemovePackage("web")
+	expectBump("REMOVE", true)
+	idx.RemovePackage("web")
+	expectBump("REMOVE of a missing package", false)
+}
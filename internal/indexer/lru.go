@@ -0,0 +1,89 @@
+package indexer
+
+import "sync"
+
+// accessClock records when each package was last used, for LRU eviction. Every operation
+// naming an indexed package counts as a use: indexing it or changing its dependencies,
+// and every read of it (QueryPackage, DependencyCount, Status, Edges, Dependencies,
+// SubtreeSize, DependencyDepth, CanRemove, and both ends of FindPath). Whole-index scans
+// such as Packages, Search and Orphans do not. It has its own mutex so reads holding only
+// the indexer's read lock can update it.
+type accessClock struct {
+	mu   sync.Mutex
+	tick uint64
+	last map[string]uint64 // Package name to the tick of its latest access
+}
+
+// newAccessClock creates an empty access clock
+func newAccessClock() *accessClock {
+	return &accessClock{last: make(map[string]uint64)}
+}
+
+// touch marks pkg as the most recently used package
+func (c *accessClock) touch(pkg string) {
+	c.mu.Lock()
+	c.tick++
+	c.last[pkg] = c.tick
+	c.mu.Unlock()
+}
+
+// forget drops the recency entry of a package that left the index
+func (c *accessClock) forget(pkg string) {
+	c.mu.Lock()
+	delete(c.last, pkg)
+	c.mu.Unlock()
+}
+
+// rename moves a package's recency entry to its new name
+func (c *accessClock) rename(oldName, newName string) {
+	c.mu.Lock()
+	if tick, ok := c.last[oldName]; ok {
+		delete(c.last, oldName)
+		c.last[newName] = tick
+	}
+	c.mu.Unlock()
+}
+
+// recordAccess marks pkg as recently used when LRU eviction is enabled. The caller must
+// hold at least the read lock so the package cannot be removed concurrently.
+func (idx *Indexer) recordAccess(pkg string) {
+	if idx.access != nil {
+		idx.access.touch(pkg)
+	}
+}
+
+// evictLocked makes room for a new package by removing the least recently used unpinned
+// package that nothing requires, never one of the incoming package's dependencies.
+// Ties go to the smallest name so eviction is deterministic. Returns false if eviction
+// is disabled or no package is removable. The scan is O(n); the caller must hold the
+// write lock.
+func (idx *Indexer) evictLocked(deps []string) bool {
+	if idx.access == nil {
+		return false
+	}
+
+	needed := NewStringSet()
+	for _, dep := range deps {
+		needed.Add(dep)
+	}
+
+	idx.access.mu.Lock()
+	victim, oldest := "", uint64(0)
+	for pkg := range idx.indexed {
+		if idx.requiredDependentsLocked(pkg) > 0 || needed.Contains(pkg) || idx.pinned.Contains(pkg) {
+			continue
+		}
+		last := idx.access.last[pkg]
+		if victim == "" || last < oldest || (last == oldest && pkg < victim) {
+			victim, oldest = pkg, last
+		}
+	}
+	idx.access.mu.Unlock()
+
+	if victim == "" {
+		return false
+	}
+	idx.deleteLocked(victim)
+	idx.evictions.Add(1)
+	return true
+}
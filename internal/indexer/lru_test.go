@@ -0,0 +1,112 @@
+package indexer
+
+import (
+	"fmt"
+	"testing"
+)
+
+// TestIndexer_EvictionPicksLeastRecentlyUsed validates that a full evicting indexer
+// removes the least recently used dependent-free package to admit a new one.
+func TestIndexer_EvictionPicksLeastRecentlyUsed(t *testing.T) {
+	idx := NewIndexerWithEviction(3)
+	assertIndex(t, idx, "a", nil, true)
+	assertIndex(t, idx, "b", nil, true)
+	assertIndex(t, idx, "c", nil, true)
+
+	// Querying a makes b the least recently used
+	idx.QueryPackage("a")
+	assertIndex(t, idx, "d", nil, true)
+	if packages := idx.Packages(); fmt.Sprint(packages) != "[a c d]" {
+		t.Errorf("expected b to be evicted, got %v", packages)
+	}
+
+	// Re-indexing an existing package never evicts
+	assertIndex(t, idx, "c", nil, true)
+	if evictions := idx.OperationStats().Evictions; evictions != 1 {
+		t.Errorf("expected 1 eviction, got %d", evictions)
+	}
+}
+
+// TestIndexer_EvictionSkipsPackagesWithDependents validates that packages still depended
+// upon, and the incoming package's own dependencies, are never evicted.
+func TestIndexer_EvictionSkipsPackagesWithDependents(t *testing.T) {
+	idx := NewIndexerWithEviction(3)
+	assertIndex(t, idx, "base", nil, true)
+	assertIndex(t, idx, "lib", []string{"base"}, true)
+	assertIndex(t, idx, "app", []string{"lib"}, true)
+
+	// base and lib have dependents, so app is the only candidate despite being newest
+	assertIndex(t, idx, "tool", []string{"base"}, true)
+	if packages := idx.Packages(); fmt.Sprint(packages) != "[base lib tool]" {
+		t.Errorf("expected app to be evicted, got %v", packages)
+	}
+
+	// lib and tool are now dependent-free, but both are the new package's dependencies
+	assertIndex(t, idx, "plugin", []string{"lib", "tool"}, false)
+	if packages := idx.Packages(); fmt.Sprint(packages) != "[base lib tool]" {
+		t.Errorf("failed eviction should leave the index unchanged, got %v", packages)
+	}
+
+	stats := idx.OperationStats()
+	if stats.Evictions != 1 || stats.CapacityRejections != 1 {
+		t.Errorf("expected 1 eviction and 1 capacity rejection, got %+v", stats)
+	}
+}
+
+// TestIndexer_EvictionSkipsPinnedPackages validates that a pinned package is never
+// evicted even when it is the least recently used.
+func TestIndexer_EvictionSkipsPinnedPackages(t *testing.T) {
+	idx := NewIndexerWithEviction(2)
+	assertIndex(t, idx, "old", nil, true)
+	assertIndex(t, idx, "new", nil, true)
+	idx.PinPackage("old")
+
+	assertIndex(t, idx, "next", nil, true)
+	if packages := idx.Packages(); fmt.Sprint(packages) != "[next old]" {
+		t.Errorf("expected new to be evicted instead of pinned old, got %v", packages)
+	}
+
+	idx.PinPackage("next")
+	assertIndex(t, idx, "last", nil, false)
+}
+
+// TestIndexer_EvictionRecencyFromReads validates that every read naming a package counts
+// as a use, so a package read only through it is not evicted as least recently used.
+func TestIndexer_EvictionRecencyFromReads(t *testing.T) {
+	reads := map[string]func(idx *Indexer){
+		"QueryPackage":    func(idx *Indexer) { idx.QueryPackage("a") },
+		"DependencyCount": func(idx *Indexer) { idx.DependencyCount("a") },
+		"Status":          func(idx *Indexer) { idx.Status("a") },
+		"Edges":           func(idx *Indexer) { idx.Edges("a") },
+		"Dependencies":    func(idx *Indexer) { idx.Dependencies("a") },
+		"SubtreeSize":     func(idx *Indexer) { idx.SubtreeSize("a") },
+		"DependencyDepth": func(idx *Indexer) { idx.DependencyDepth("a") },
+		"CanRemove":       func(idx *Indexer) { idx.CanRemove("a") },
+		"FindPath":        func(idx *Indexer) { idx.FindPath("a", "a") },
+	}
+	for name, read := range reads {
+		t.Run(name, func(t *testing.T) {
+			idx := NewIndexerWithEviction(2)
+			assertIndex(t, idx, "a", nil, true)
+			assertIndex(t, idx, "b", nil, true)
+
+			// Reading a makes b the least recently used
+			read(idx)
+			assertIndex(t, idx, "c", nil, true)
+			if packages := idx.Packages(); fmt.Sprint(packages) != "[a c]" {
+				t.Errorf("expected b to be evicted after reading a, got %v", packages)
+			}
+		})
+	}
+
+	// Whole-index scans do not refresh recency
+	idx := NewIndexerWithEviction(2)
+	assertIndex(t, idx, "a", nil, true)
+	assertIndex(t, idx, "b", nil, true)
+	idx.Search("a")
+	idx.Orphans()
+	assertIndex(t, idx, "c", nil, true)
+	if packages := idx.Packages(); fmt.Sprint(packages) != "[b c]" {
+		t.Errorf("expected a to be evicted after scans, got %v", packages)
+	}
+}
@@ -0,0 +1,156 @@
+package indexer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// LineFormat defines the regular expression pattern for valid dependency specification
+// lines ("name: dep1 dep2"), as used by the brew-dependencies data and preload files.
+const LineFormat = "^\\S+:( +)?(\\S+ *)*"
+
+// formatWhitespace is the whitespace class of \s in LineFormat's RE2 syntax
+const formatWhitespace = " \t\n\f\r"
+
+// matchesLineFormat reports whether line matches LineFormat without running a regexp:
+// its first run of non-whitespace characters, starting at the beginning of the line,
+// must contain a colon after at least one other character. Everything after that is
+// accepted by the pattern's optional tail.
+func matchesLineFormat(line string) bool {
+	end := strings.IndexAny(line, formatWhitespace)
+	if end < 0 {
+		end = len(line)
+	}
+	return end > 1 && strings.IndexByte(line[1:end], ':') >= 0
+}
+
+// MaxSpecLineLength bounds a single declaration line read by ParsePackageSpecsReader
+const MaxSpecLineLength = 1 << 20
+
+// CommentPrefix marks a line as an annotation to be ignored by the parsers
+const CommentPrefix = "#"
+
+// IsIgnorableLine reports whether a line carries no declaration: it is empty, contains
+// only whitespace, or is a comment beginning with CommentPrefix.
+func IsIgnorableLine(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	return trimmed == "" || strings.HasPrefix(trimmed, CommentPrefix)
+}
+
+// PackageSpec is a package declaration with the names of its direct dependencies
+type PackageSpec struct {
+	Name         string
+	Dependencies []string
+}
+
+// TokeniseLine parses a single line in LineFormat. The first returned token is the
+// package name; any subsequent tokens are its dependencies.
+func TokeniseLine(line string) ([]string, error) {
+	if !matchesLineFormat(line) {
+		return nil, fmt.Errorf("Invalid line: %#v", line)
+	}
+
+	tokens := strings.Fields(line)
+	tokens[0] = strings.TrimRight(tokens[0], ":")
+	return tokens, nil
+}
+
+// ParsePackageSpecs parses text containing one declaration per line and returns the
+// packages in an order that can be indexed sequentially: every package follows its
+// dependencies. Dependencies that are never declared on their own line are treated as
+// packages without dependencies. Blank and comment lines are skipped; malformed lines
+// and dependency cycles are errors.
+func ParsePackageSpecs(text string) ([]PackageSpec, error) {
+	return ParsePackageSpecsReader(strings.NewReader(text))
+}
+
+// ParsePackageSpecsReader is ParsePackageSpecs reading r line by line, so very large
+// files are never held in memory as a whole; only the parsed declarations are kept.
+// Lines longer than MaxSpecLineLength are an error.
+func ParsePackageSpecsReader(r io.Reader) ([]PackageSpec, error) {
+	var specs []PackageSpec
+	declared := make(map[string]int)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), MaxSpecLineLength)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := scanner.Text()
+		if IsIgnorableLine(line) {
+			continue
+		}
+
+		tokens, err := TokeniseLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+
+		name, deps := tokens[0], tokens[1:]
+		if i, ok := declared[name]; ok {
+			specs[i].Dependencies = append(specs[i].Dependencies, deps...)
+		} else {
+			declared[name] = len(specs)
+			specs = append(specs, PackageSpec{Name: name, Dependencies: deps})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read package specs: %w", err)
+	}
+
+	for i := 0; i < len(specs); i++ {
+		for _, dep := range specs[i].Dependencies {
+			if _, ok := declared[dep]; !ok {
+				declared[dep] = len(specs)
+				specs = append(specs, PackageSpec{Name: dep})
+			}
+		}
+	}
+
+	return orderSpecs(specs)
+}
+
+// orderSpecs returns specs such that every package follows its dependencies, using a
+// depth-first traversal that reports cycles as errors.
+func orderSpecs(specs []PackageSpec) ([]PackageSpec, error) {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	byName := make(map[string]PackageSpec, len(specs))
+	for _, spec := range specs {
+		byName[spec.Name] = spec
+	}
+
+	state := make(map[string]int, len(specs))
+	ordered := make([]PackageSpec, 0, len(specs))
+
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visiting:
+			return fmt.Errorf("dependency cycle detected at package %q", name)
+		case visited:
+			return nil
+		}
+		state[name] = visiting
+		spec := byName[name]
+		for _, dep := range spec.Dependencies {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		state[name] = visited
+		ordered = append(ordered, spec)
+		return nil
+	}
+
+	for _, spec := range specs {
+		if err := visit(spec.Name); err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
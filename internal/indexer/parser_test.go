@@ -0,0 +1,144 @@
+package indexer
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// TestTokeniseLine validates parsing of declarations with and without dependencies
+// and rejection of lines missing the colon separator.
+func TestTokeniseLine(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected []string
+	}{
+		{"a:", []string{"a"}},
+		{"abcde:  autoconf  automake  cd-discid ", []string{"abcde", "autoconf", "automake", "cd-discid"}},
+		{"node: brotli", []string{"node", "brotli"}},
+	}
+
+	for _, test := range tests {
+		tokens, err := TokeniseLine(test.line)
+		if err != nil {
+			t.Errorf("TokeniseLine(%q) returned error: %v", test.line, err)
+			continue
+		}
+		if !reflect.DeepEqual(tokens, test.expected) {
+			t.Errorf("TokeniseLine(%q) = %#v, want %#v", test.line, tokens, test.expected)
+		}
+	}
+
+	if _, err := TokeniseLine("missing tokens"); err == nil {
+		t.Error("TokeniseLine should reject a line without a colon")
+	}
+}
+
+// TestParsePackageSpecsReader validates streaming parsing, line numbers in errors and
+// the line length bound.
+func TestParsePackageSpecsReader(t *testing.T) {
+	specs, err := ParsePackageSpecsReader(strings.NewReader("app: base\r\nbase:\r\n"))
+	if err != nil {
+		t.Fatalf("ParsePackageSpecsReader returned error: %v", err)
+	}
+	if len(specs) != 2 || specs[0].Name != "base" || specs[1].Name != "app" {
+		t.Errorf("unexpected specs: %+v", specs)
+	}
+
+	if _, err := ParsePackageSpecsReader(strings.NewReader("a:\n\nbroken\n")); err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Errorf("expected line 3 error, got %v", err)
+	}
+
+	long := "a: " + strings.Repeat("x", MaxSpecLineLength) + "\n"
+	if _, err := ParsePackageSpecsReader(strings.NewReader(long)); err == nil {
+		t.Error("expected an error for a line longer than MaxSpecLineLength")
+	}
+}
+
+// TestMatchesLineFormat validates that the hand-written matcher agrees with the
+// LineFormat regular expression it replaces.
+func TestMatchesLineFormat(t *testing.T) {
+	pattern := regexp.MustCompile(LineFormat)
+	lines := []string{
+		"", ":", "::", "a:", "a::", ":a", "a", "a b:", " a:", "\ta:", "a:b", "a:b c",
+		"a :b", "ab:  c  d ", "a\t:", "a:\tb", "missing tokens", "node: brotli", "x\vy:",
+	}
+	for _, line := range lines {
+		if got, want := matchesLineFormat(line), pattern.MatchString(line); got != want {
+			t.Errorf("matchesLineFormat(%q) = %v, regexp says %v", line, got, want)
+		}
+	}
+}
+
+// BenchmarkTokeniseLine measures tokenising a typical brew declaration
+func BenchmarkTokeniseLine(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		if _, err := TokeniseLine("abcde:  autoconf  automake  cd-discid "); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// TestParsePackageSpecs validates indexable ordering, implicit leaf packages, and
+// error reporting for broken lines and cycles.
+func TestParsePackageSpecs(t *testing.T) {
+	specs, err := ParsePackageSpecs("app: lib util\nlib: base\nutil: base\n\nbase:\nlib: extra\n")
+	if err != nil {
+		t.Fatalf("ParsePackageSpecs returned error: %v", err)
+	}
+
+	position := make(map[string]int)
+	deps := make(map[string][]string)
+	for i, spec := range specs {
+		position[spec.Name] = i
+		deps[spec.Name] = spec.Dependencies
+	}
+	if len(specs) != 5 {
+		t.Fatalf("expected 5 packages including implicit leaf, got %d: %v", len(specs), specs)
+	}
+	for _, spec := range specs {
+		for _, dep := range spec.Dependencies {
+			if position[dep] > position[spec.Name] {
+				t.Errorf("%s ordered before its dependency %s", spec.Name, dep)
+			}
+		}
+	}
+	if !reflect.DeepEqual(deps["lib"], []string{"base", "extra"}) {
+		t.Errorf("repeated declarations should merge dependencies, got %v", deps["lib"])
+	}
+
+	brokenCases := map[string]string{
+		"broken line": "a: b c\nz\nb: c z\n",
+		"cycle":       "a: b\nb: a\n",
+	}
+	for name, text := range brokenCases {
+		if _, err := ParsePackageSpecs(text); err == nil {
+			t.Errorf("%s: expected error for %q", name, text)
+		}
+	}
+
+	specs, err = ParsePackageSpecs("")
+	if err != nil || len(specs) != 0 {
+		t.Errorf("empty text should parse to no packages, got %v, %v", specs, err)
+	}
+}
+
+// TestParsePackageSpecs_Comments validates that comment and whitespace-only lines are
+// skipped without disturbing line numbers in error messages.
+func TestParsePackageSpecs_Comments(t *testing.T) {
+	text := "# preload graph\napp: lib\n\n   \n  # leaf packages\nlib:\n"
+	specs, err := ParsePackageSpecs(text)
+	if err != nil {
+		t.Fatalf("ParsePackageSpecs returned error: %v", err)
+	}
+	expected := []PackageSpec{{Name: "lib", Dependencies: []string{}}, {Name: "app", Dependencies: []string{"lib"}}}
+	if !reflect.DeepEqual(specs, expected) {
+		t.Errorf("ParsePackageSpecs = %#v, want %#v", specs, expected)
+	}
+
+	_, err = ParsePackageSpecs("# header\napp: lib\nbroken\n")
+	if err == nil || !strings.HasPrefix(err.Error(), "line 3:") {
+		t.Errorf("expected line 3 error after comment, got %v", err)
+	}
+}
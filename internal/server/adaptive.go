@@ -0,0 +1,49 @@
+package server
+
+import "time"
+
+// Adaptive read deadline tuning
+const (
+	adaptiveGapMultiplier = 4 // Deadline allowed per average inter-command gap
+	adaptiveSmoothing     = 4 // EWMA weight divisor: each gap moves the average by 1/4 of the difference
+)
+
+// adaptiveDeadline derives a connection's idle read timeout from the client's recent
+// inter-command gaps. The smoothed gap starts where the fixed ReadTimeout would put it,
+// so a new connection gets the usual deadline; a client that keeps sending quickly sees
+// it tighten toward Min, while a steadily slow client earns more room up to Max. It is
+// owned by a single connection goroutine and needs no locking.
+type adaptiveDeadline struct {
+	avgGap   time.Duration // Exponentially weighted average gap between commands
+	last     time.Time     // When the previous command (or the connection) arrived
+	min, max time.Duration
+}
+
+// newAdaptiveDeadline creates an estimator for a connection accepted at started
+func newAdaptiveDeadline(initial, min, max time.Duration, started time.Time) *adaptiveDeadline {
+	return &adaptiveDeadline{
+		avgGap: initial / adaptiveGapMultiplier,
+		last:   started,
+		min:    min,
+		max:    max,
+	}
+}
+
+// observe records that a complete command arrived at now
+func (a *adaptiveDeadline) observe(now time.Time) {
+	gap := now.Sub(a.last)
+	a.last = now
+	a.avgGap += (gap - a.avgGap) / adaptiveSmoothing
+}
+
+// timeout returns the idle read timeout for the next command, clamped to [min, max]
+func (a *adaptiveDeadline) timeout() time.Duration {
+	timeout := a.avgGap * adaptiveGapMultiplier
+	if timeout < a.min {
+		return a.min
+	}
+	if a.max > 0 && timeout > a.max {
+		return a.max
+	}
+	return timeout
+}
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"package-indexer/internal/wire"
+)
+
+// TestAdaptiveDeadline validates that the timeout starts at the fixed read timeout,
+// tightens for fast clients, loosens for slow ones, and stays within its bounds.
+func TestAdaptiveDeadline(t *testing.T) {
+	start := time.Unix(0, 0)
+	fast := newAdaptiveDeadline(time.Second, 100*time.Millisecond, 10*time.Second, start)
+	if got := fast.timeout(); got != time.Second {
+		t.Fatalf("initial timeout = %v, expected the read timeout", got)
+	}
+	now := start
+	for i := 0; i < 20; i++ {
+		now = now.Add(time.Millisecond)
+		fast.observe(now)
+	}
+	if got := fast.timeout(); got != 100*time.Millisecond {
+		t.Errorf("fast client timeout = %v, expected the 100ms minimum", got)
+	}
+
+	slow := newAdaptiveDeadline(time.Second, 100*time.Millisecond, 10*time.Second, start)
+	now = start
+	previous := slow.timeout()
+	for i := 0; i < 5; i++ {
+		now = now.Add(2 * time.Second)
+		slow.observe(now)
+		if got := slow.timeout(); got <= previous {
+			t.Errorf("slow client timeout did not grow: %v after %v", got, previous)
+		}
+		previous = slow.timeout()
+	}
+	for i := 0; i < 20; i++ {
+		now = now.Add(time.Minute)
+		slow.observe(now)
+	}
+	if got := slow.timeout(); got != 10*time.Second {
+		t.Errorf("very slow client timeout = %v, expected the 10s maximum", got)
+	}
+}
+
+// TestServeConn_AdaptiveReadTimeout validates that a client sending at a steady slow rate
+// earns a deadline beyond the fixed read timeout, and is still closed once it goes idle.
+func TestServeConn_AdaptiveReadTimeout(t *testing.T) {
+	const readTimeout = 300 * time.Millisecond
+	s := NewServerWithConfig(Config{
+		Addr:                ":0",
+		ReadTimeout:         readTimeout,
+		AdaptiveReadTimeout: true,
+		MinReadTimeout:      50 * time.Millisecond,
+		MaxReadTimeout:      2 * time.Second,
+	})
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	defer s.cancel()
+
+	client, server := net.Pipe()
+	defer client.Close()
+	s.wg.Add(1)
+	go s.handleConnection(server)
+
+	reader := bufio.NewReader(client)
+	send := func(gap time.Duration) {
+		t.Helper()
+		time.Sleep(gap)
+		if _, err := client.Write([]byte("QUERY|pkg|\n")); err != nil {
+			t.Fatalf("write after %v gap failed: %v", gap, err)
+		}
+		if resp, err := reader.ReadString('\n'); err != nil || resp != wire.FAIL.String() {
+			t.Fatalf("expected FAIL after %v gap, got %q (err %v)", gap, resp, err)
+		}
+	}
+
+	// A steady pace below the read timeout, then a pause longer than it
+	for i := 0; i < 4; i++ {
+		send(200 * time.Millisecond)
+	}
+	send(2 * readTimeout)
+
+	// Going idle still ends the connection within the maximum
+	idleStart := time.Now()
+	client.SetReadDeadline(time.Now().Add(s.config.MaxReadTimeout + readyWaitTimeout))
+	if _, err := reader.ReadString('\n'); err == nil {
+		t.Fatal("expected the server to close the idle connection")
+	}
+	if idle := time.Since(idleStart); idle > s.config.MaxReadTimeout+readyWaitTimeout/2 {
+		t.Errorf("idle connection closed after %v, expected within the 2s maximum", idle)
+	}
+}
+
+// TestServeConn_AdaptiveReadTimeoutBurst validates that without an explicit minimum the
+// adaptive timeout never tightens below the fixed read timeout, so a client that sends a
+// burst of commands and then pauses for less than the read timeout is not dropped.
+func TestServeConn_AdaptiveReadTimeoutBurst(t *testing.T) {
+	const readTimeout = 300 * time.Millisecond
+	s := NewServerWithConfig(Config{
+		Addr:                ":0",
+		ReadTimeout:         readTimeout,
+		AdaptiveReadTimeout: true,
+		MaxReadTimeout:      2 * time.Second,
+	})
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	defer s.cancel()
+
+	client, server := net.Pipe()
+	defer client.Close()
+	s.wg.Add(1)
+	go s.handleConnection(server)
+
+	reader := bufio.NewReader(client)
+	send := func(gap time.Duration) {
+		t.Helper()
+		time.Sleep(gap)
+		if _, err := client.Write([]byte("QUERY|pkg|\n")); err != nil {
+			t.Fatalf("write after %v gap failed: %v", gap, err)
+		}
+		if resp, err := reader.ReadString('\n'); err != nil || resp != wire.FAIL.String() {
+			t.Fatalf("expected FAIL after %v gap, got %q (err %v)", gap, resp, err)
+		}
+	}
+
+	// A burst of back-to-back commands, then a pause just under the read timeout
+	for i := 0; i < 20; i++ {
+		send(0)
+	}
+	send(readTimeout * 2 / 3)
+}
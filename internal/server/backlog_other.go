@@ -0,0 +1,13 @@
+//go:build !unix
+
+package server
+
+import (
+	"fmt"
+	"net"
+)
+
+// setBacklog is unsupported on this platform; the runtime default backlog is used
+func setBacklog(l net.Listener, backlog int) error {
+	return fmt.Errorf("custom listen backlog is not supported on this platform")
+}
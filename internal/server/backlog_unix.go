@@ -0,0 +1,32 @@
+//go:build unix
+
+package server
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// setBacklog resizes the accept queue of a bound listener. The Go runtime always listens
+// with the system maximum it detects (SOMAXCONN or net.core.somaxconn), so the socket is
+// re-listened with the requested size; Linux and the BSDs update the backlog of a socket
+// that is already listening. The kernel still caps the value at its configured maximum.
+func setBacklog(l net.Listener, backlog int) error {
+	tl, ok := l.(*net.TCPListener)
+	if !ok {
+		return fmt.Errorf("backlog requires a TCP listener, got %T", l)
+	}
+	raw, err := tl.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var listenErr error
+	if err := raw.Control(func(fd uintptr) {
+		listenErr = syscall.Listen(int(fd), backlog)
+	}); err != nil {
+		return err
+	}
+	return listenErr
+}
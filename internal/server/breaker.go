@@ -0,0 +1,143 @@
+package server
+
+import (
+	"sync"
+	"time"
+)
+
+// breakerState is the state of a circuit breaker
+type breakerState int
+
+// Circuit breaker states
+const (
+	breakerClosed   breakerState = iota // Calls flow; consecutive failures are counted
+	breakerOpen                         // Calls are refused until the cooldown elapses
+	breakerHalfOpen                     // A single probe call decides whether to close or reopen
+)
+
+// String returns the state name for logging
+func (s breakerState) String() string {
+	switch s {
+	case breakerClosed:
+		return "closed"
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// circuitBreaker stops forwarding to a repeatedly failing downstream (e.g. a slow
+// notification subscriber) so it cannot hold up mutations. After failureThreshold
+// consecutive failures it opens; once cooldown has elapsed it lets one probe through,
+// closing on success and reopening on failure.
+type circuitBreaker struct {
+	failureThreshold int
+	cooldown         time.Duration
+	onOpen           func()           // Invoked each time the breaker trips open (may be nil)
+	now              func() time.Time // Clock, replaceable in tests
+
+	mu       sync.Mutex
+	state    breakerState
+	failures int // Consecutive failures while closed
+	openedAt time.Time
+	probing  bool // A half-open probe is in flight
+}
+
+// newCircuitBreaker creates a closed breaker tripping after failureThreshold consecutive
+// failures and probing again after cooldown
+func newCircuitBreaker(failureThreshold int, cooldown time.Duration, onOpen func()) *circuitBreaker {
+	if failureThreshold < 1 {
+		failureThreshold = 1
+	}
+	return &circuitBreaker{
+		failureThreshold: failureThreshold,
+		cooldown:         cooldown,
+		onOpen:           onOpen,
+		now:              time.Now,
+	}
+}
+
+// newCircuitBreaker creates a breaker whose trips are counted in the server's
+// CircuitBreakerOpen metric
+func (s *Server) newCircuitBreaker(failureThreshold int, cooldown time.Duration) *circuitBreaker {
+	return newCircuitBreaker(failureThreshold, cooldown, s.metrics.IncrementCircuitBreakerOpen)
+}
+
+// allow reports whether a call may proceed. While open it refuses calls until the
+// cooldown elapses, then admits exactly one half-open probe.
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = breakerHalfOpen
+		b.probing = true
+		return true
+	case breakerHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+// recordSuccess reports a successful call, closing the breaker
+func (b *circuitBreaker) recordSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.state = breakerClosed
+	b.failures = 0
+	b.probing = false
+}
+
+// recordFailure reports a failed call, opening the breaker once the threshold is reached
+// or immediately if a half-open probe failed
+func (b *circuitBreaker) recordFailure() {
+	b.mu.Lock()
+	tripped := false
+	switch b.state {
+	case breakerHalfOpen:
+		tripped = true
+	case breakerClosed:
+		b.failures++
+		tripped = b.failures >= b.failureThreshold
+	}
+	if tripped {
+		b.tripLocked()
+	}
+	onOpen := b.onOpen
+	b.mu.Unlock()
+
+	if tripped && onOpen != nil {
+		onOpen()
+	}
+}
+
+// tripLocked opens the breaker; the caller holds mu
+func (b *circuitBreaker) tripLocked() {
+	b.state = breakerOpen
+	b.openedAt = b.now()
+	b.failures = 0
+	b.probing = false
+}
+
+// currentState returns the breaker state, promoting open to half-open once the cooldown
+// has elapsed so callers observe when a probe would be admitted
+func (b *circuitBreaker) currentState() breakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == breakerOpen && b.now().Sub(b.openedAt) >= b.cooldown {
+		return breakerHalfOpen
+	}
+	return b.state
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+// TestCircuitBreaker_Transitions validates that consecutive failures trip the breaker,
+// the cooldown admits a single half-open probe, and a successful probe closes it while
+// a failed one reopens it.
+func TestCircuitBreaker_Transitions(t *testing.T) {
+	metrics := NewMetrics()
+	clock := time.Now()
+	b := newCircuitBreaker(3, time.Second, metrics.IncrementCircuitBreakerOpen)
+	b.now = func() time.Time { return clock }
+
+	// Failures below the threshold keep it closed; a success resets the count
+	b.recordFailure()
+	b.recordFailure()
+	b.recordSuccess()
+	b.recordFailure()
+	b.recordFailure()
+	if state := b.currentState(); state != breakerClosed || !b.allow() {
+		t.Fatalf("expected closed breaker below threshold, got %v", state)
+	}
+
+	// The third consecutive failure trips it
+	b.recordFailure()
+	if state := b.currentState(); state != breakerOpen {
+		t.Fatalf("expected open breaker after threshold failures, got %v", state)
+	}
+	if b.allow() {
+		t.Error("open breaker should refuse calls during cooldown")
+	}
+
+	// After the cooldown exactly one probe is admitted
+	clock = clock.Add(time.Second)
+	if state := b.currentState(); state != breakerHalfOpen {
+		t.Errorf("expected half-open after cooldown, got %v", state)
+	}
+	if !b.allow() {
+		t.Fatal("half-open breaker should admit a probe")
+	}
+	if b.allow() {
+		t.Error("half-open breaker should admit only one probe at a time")
+	}
+
+	// A failed probe reopens immediately
+	b.recordFailure()
+	if state := b.currentState(); state != breakerOpen {
+		t.Fatalf("expected failed probe to reopen breaker, got %v", state)
+	}
+
+	// A successful probe closes it
+	clock = clock.Add(time.Second)
+	if !b.allow() {
+		t.Fatal("expected probe after second cooldown")
+	}
+	b.recordSuccess()
+	if state := b.currentState(); state != breakerClosed || !b.allow() {
+		t.Errorf("expected closed breaker after successful probe, got %v", state)
+	}
+
+	if opens := metrics.GetSnapshot().CircuitBreakerOpen; opens != 2 {
+		t.Errorf("expected 2 breaker opens, got %d", opens)
+	}
+}
+
+// TestServer_CircuitBreakerMetric validates that a breaker created by the server counts
+// each trip in the server's metrics.
+func TestServer_CircuitBreakerMetric(t *testing.T) {
+	srv := NewServer(":0", DefaultReadTimeout)
+	b := srv.newCircuitBreaker(2, time.Minute)
+
+	b.recordFailure()
+	if opens := srv.GetMetrics().CircuitBreakerOpen; opens != 0 {
+		t.Errorf("expected no trips below the threshold, got %d", opens)
+	}
+	b.recordFailure()
+	if opens := srv.GetMetrics().CircuitBreakerOpen; opens != 1 {
+		t.Errorf("expected 1 trip after reaching the threshold, got %d", opens)
+	}
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"sync"
+
+	"package-indexer/internal/wire"
+)
+
+// resultCache memoizes replies to read-only commands for a single graph version. Every
+// lookup carries the store's current version; once it moves on, all entries are dropped
+// at once, so no per-entry invalidation is needed.
+type resultCache struct {
+	maxEntries int
+
+	mu      sync.Mutex
+	version uint64
+	entries map[string]wire.Reply
+}
+
+// newResultCache creates a cache holding at most maxEntries replies
+func newResultCache(maxEntries int) *resultCache {
+	return &resultCache{
+		maxEntries: maxEntries,
+		entries:    make(map[string]wire.Reply),
+	}
+}
+
+// get returns the cached reply for key if it was stored at the given graph version
+func (c *resultCache) get(version uint64, key string) (wire.Reply, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if version < c.version {
+		return wire.Reply{}, false // A lookup with a stale version never matches
+	}
+	c.advanceLocked(version)
+	reply, ok := c.entries[key]
+	return reply, ok
+}
+
+// put stores a reply computed at the given graph version. Replies from an older version
+// than the cache already holds are dropped; a full cache starts over rather than
+// tracking recency.
+func (c *resultCache) put(version uint64, key string, reply wire.Reply) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if version < c.version {
+		return
+	}
+	c.advanceLocked(version)
+	if len(c.entries) >= c.maxEntries {
+		clear(c.entries)
+	}
+	c.entries[key] = reply
+}
+
+// advanceLocked drops every entry once the graph version moves past the cached one;
+// caller holds mu
+func (c *resultCache) advanceLocked(version uint64) {
+	if version > c.version {
+		clear(c.entries)
+		c.version = version
+	}
+}
+
+// cacheKeySeparator joins the fields of a cache key; a newline cannot occur in a name
+const cacheKeySeparator = "\n"
+
+// cacheKey returns the cache key of a read-only command whose reply depends only on the
+// graph, and false for commands that must always run
+func cacheKey(cmd *wire.Command) (string, bool) {
+	switch cmd.Type {
+	case wire.QueryCommand, wire.StatusCommand, wire.EdgesCommand, wire.DepthCommand:
+		return cmd.Type.String() + cacheKeySeparator + cmd.Package, true
+	case wire.PathCommand:
+		return cmd.Type.String() + cacheKeySeparator + cmd.Package + cacheKeySeparator + cmd.Target, true
+	default:
+		return "", false
+	}
+}
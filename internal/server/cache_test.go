@@ -0,0 +1,97 @@
+package server
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+
+	"package-indexer/internal/wire"
+)
+
+func TestResultCache_Versioning(t *testing.T) {
+	c := newResultCache(10)
+	ok := wire.NewReply(wire.OK)
+
+	if _, hit := c.get(1, "QUERY\na"); hit {
+		t.Fatal("expected a miss on an empty cache")
+	}
+	c.put(1, "QUERY\na", ok)
+	if reply, hit := c.get(1, "QUERY\na"); !hit || reply.Code != wire.OK {
+		t.Errorf("expected a hit at the same version, got %v %v", reply, hit)
+	}
+
+	// A newer version invalidates everything cached before it
+	if _, hit := c.get(2, "QUERY\na"); hit {
+		t.Error("expected a miss after the version changed")
+	}
+
+	// A reply computed at an older version is never stored or served
+	c.put(1, "QUERY\nb", ok)
+	if _, hit := c.get(2, "QUERY\nb"); hit {
+		t.Error("expected a stale put to be dropped")
+	}
+	c.put(2, "QUERY\nb", ok)
+	if _, hit := c.get(1, "QUERY\nb"); hit {
+		t.Error("expected a lookup with a stale version to miss")
+	}
+	if _, hit := c.get(2, "QUERY\nb"); !hit {
+		t.Error("expected a stale lookup to leave current entries in place")
+	}
+}
+
+func TestResultCache_FullResets(t *testing.T) {
+	c := newResultCache(2)
+	for _, key := range []string{"a", "b", "c"} {
+		c.put(1, key, wire.NewReply(wire.OK))
+	}
+	if len(c.entries) != 1 {
+		t.Errorf("expected a full cache to start over, holding 1 entry, got %d", len(c.entries))
+	}
+	if _, hit := c.get(1, "c"); !hit {
+		t.Error("expected the entry that triggered the reset to be cached")
+	}
+}
+
+// TestServer_ResultCache validates that cached reads skip the store while its version is
+// unchanged and reach it again once the version moves on
+func TestServer_ResultCache(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	store := &recordingStore{queryResult: true}
+	srv := NewServerWithConfig(Config{Store: store, ResultCacheSize: 16})
+
+	for i := 0; i < 3; i++ {
+		if reply := srv.processRequest(logger, "QUERY|a|\n").String(); reply != "OK\n" {
+			t.Fatalf("QUERY|a| = %q, expected OK", reply)
+		}
+	}
+	if len(store.calls) != 1 {
+		t.Errorf("expected repeated QUERY to hit the cache, store saw %v", store.calls)
+	}
+
+	// Different commands and packages are cached separately
+	srv.processRequest(logger, "QUERY|b|\n")
+	srv.processRequest(logger, "STATUS|a|\n")
+	if len(store.calls) != 3 {
+		t.Errorf("expected distinct reads to miss, store saw %v", store.calls)
+	}
+
+	// Mutations always reach the store; a version change invalidates the cache
+	srv.processRequest(logger, "INDEX|c|\n")
+	store.version++
+	store.queryResult = false
+	if reply := srv.processRequest(logger, "QUERY|a|\n").String(); reply != "FAIL\n" {
+		t.Errorf("expected a fresh reply after the version changed, got %q", reply)
+	}
+	if len(store.calls) != 5 {
+		t.Errorf("expected the mutation and the re-query to reach the store, got %v", store.calls)
+	}
+
+	if metrics := srv.GetMetrics(); metrics.ResultCacheHits != 2 || metrics.ResultCacheMisses != 4 {
+		t.Errorf("expected 2 hits and 4 misses, got %d and %d", metrics.ResultCacheHits, metrics.ResultCacheMisses)
+	}
+
+	// Hits would not refresh recency, so the cache is off with LRU eviction
+	if lru := NewServerWithConfig(Config{ResultCacheSize: 16, EvictLRU: true, MaxPackages: 10}); lru.cache != nil {
+		t.Error("expected the result cache to be disabled with EvictLRU")
+	}
+}
@@ -0,0 +1,166 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+	"testing"
+
+	"package-indexer/internal/wire"
+)
+
+// TestRotatingWriter_Rotation validates size-based rotation, backup shifting, and the
+// retention limit.
+func TestRotatingWriter_Rotation(t *testing.T) {
+	path := t.TempDir() + "/commands.log"
+	w, err := NewRotatingWriter(path, 20, 2)
+	if err != nil {
+		t.Fatalf("NewRotatingWriter returned error: %v", err)
+	}
+	defer w.Close()
+
+	for i := 0; i < 5; i++ {
+		if _, err := fmt.Fprintf(w, "record-%d-abcdefgh\n", i); err != nil {
+			t.Fatalf("write %d failed: %v", i, err)
+		}
+	}
+
+	expected := map[string]string{
+		path:        "record-4-abcdefgh\n",
+		path + ".1": "record-3-abcdefgh\n",
+		path + ".2": "record-2-abcdefgh\n",
+	}
+	for file, want := range expected {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Errorf("expected %s to exist: %v", file, err)
+		} else if string(data) != want {
+			t.Errorf("%s = %q, expected %q", file, data, want)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("expected no backup beyond the retention limit, got %v", err)
+	}
+
+	if _, err := NewRotatingWriter(path, 0, 1); err == nil {
+		t.Error("expected error for non-positive max size")
+	}
+}
+
+// TestServer_CommandLog validates that every command is logged with its result and that
+// enough traffic rotates the log file.
+func TestServer_CommandLog(t *testing.T) {
+	path := t.TempDir() + "/commands.log"
+	w, err := NewRotatingWriter(path, 1024, 3)
+	if err != nil {
+		t.Fatalf("NewRotatingWriter returned error: %v", err)
+	}
+	defer w.Close()
+
+	srv := NewServerWithConfig(Config{
+		Addr:        ":0",
+		ReadTimeout: DefaultReadTimeout,
+		CommandLog:  slog.New(slog.NewJSONHandler(w, nil)),
+	})
+	srv.ctx, srv.cancel = context.WithCancel(context.Background())
+	defer srv.cancel()
+
+	clientConn, serverConn := net.Pipe()
+	srv.wg.Add(1)
+	go srv.handleConnection(serverConn)
+
+	reader := bufio.NewReader(clientConn)
+	for i := 0; i < 50; i++ {
+		if _, err := fmt.Fprintf(clientConn, "INDEX|pkg%d|\n", i); err != nil {
+			t.Fatalf("failed to write command: %v", err)
+		}
+		if _, err := reader.ReadString('\n'); err != nil {
+			t.Fatalf("failed to read response: %v", err)
+		}
+	}
+	clientConn.Close()
+
+	if _, err := os.Stat(path + ".1"); err != nil {
+		t.Fatalf("expected rotated command log %s.1: %v", path, err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read command log: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	var record map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[len(lines)-1]), &record); err != nil {
+		t.Fatalf("command log record is not JSON: %v", err)
+	}
+	if record["msg"] != CommandLogMessage || record[CommandLogLineKey] != "INDEX|pkg49|" || record[CommandLogResultKey] != "OK" {
+		t.Errorf("unexpected last command record: %v", record)
+	}
+}
+
+// TestServer_RequestID validates that a request id prefix round-trips into the reply and
+// the command log record, and that commands without one are unaffected.
+func TestServer_RequestID(t *testing.T) {
+	var log bytes.Buffer
+	srv := NewServerWithConfig(Config{
+		Addr:        ":0",
+		ReadTimeout: DefaultReadTimeout,
+		RequestIDs:  true,
+		CommandLog:  slog.New(slog.NewJSONHandler(&log, nil)),
+	})
+	srv.ctx, srv.cancel = context.WithCancel(context.Background())
+	defer srv.cancel()
+
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	srv.wg.Add(1)
+	go srv.handleConnection(serverConn)
+
+	reader := bufio.NewReader(clientConn)
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"ID:trace-42 INDEX|pkg|\n", "OK [ID:trace-42]\n"},
+		{"ID:trace-43 QUERY|missing|\n", "FAIL [ID:trace-43]\n"},
+		{"QUERY|pkg|\n", "OK\n"},
+	}
+	for _, test := range tests {
+		if _, err := fmt.Fprint(clientConn, test.input); err != nil {
+			t.Fatalf("failed to write command: %v", err)
+		}
+		if reply, err := reader.ReadString('\n'); err != nil || reply != test.expected {
+			t.Errorf("reply to %q = %q (%v), expected %q", test.input, reply, err, test.expected)
+		}
+	}
+
+	lines := strings.Split(strings.TrimSpace(log.String()), "\n")
+	if len(lines) != len(tests) {
+		t.Fatalf("expected %d command records, got %d: %q", len(tests), len(lines), lines)
+	}
+	for i, want := range []string{"trace-42", "trace-43", ""} {
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(lines[i]), &record); err != nil {
+			t.Fatalf("command log record is not JSON: %v", err)
+		}
+		id, _ := record[CommandLogRequestIDKey].(string)
+		if id != want {
+			t.Errorf("record %d request id = %q, expected %q", i, id, want)
+		}
+		if line := record[CommandLogLineKey]; strings.HasPrefix(fmt.Sprint(line), wire.RequestIDPrefix) {
+			t.Errorf("record %d line %q should not include the request id", i, line)
+		}
+	}
+
+	// Off by default: the token is not a command
+	plain := NewServer(":0", DefaultReadTimeout)
+	if reply := plain.processRequest(slog.Default(), "ID:trace-44 QUERY|pkg|\n"); reply.Code != wire.ERROR {
+		t.Errorf("default server answered a request id prefix with %v, expected ERROR", reply.Code)
+	}
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"time"
+)
+
+// Subsystem health states reported by Health
+const (
+	HealthOK       = "ok"
+	HealthDegraded = "degraded"
+	HealthFailed   = "failed"
+)
+
+// Indexer probe thresholds: a probe slower than indexerProbeSlow suggests lock contention,
+// and one that has not returned by indexerProbeTimeout is treated as a stuck indexer
+const (
+	indexerProbeSlow    = 100 * time.Millisecond
+	indexerProbeTimeout = time.Second
+)
+
+// SubsystemHealth is the status of one subsystem, with an optional explanation
+type SubsystemHealth struct {
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Health reports per-subsystem status for the /healthz endpoint. It covers the TCP
+// listener and the store; each entry is ok, degraded or failed.
+func (s *Server) Health() map[string]SubsystemHealth {
+	return map[string]SubsystemHealth{
+		"listener": s.listenerHealth(),
+		"indexer":  s.indexerHealth(),
+	}
+}
+
+// listenerHealth is ok while the listener is bound and accepting, degraded while bound
+// but not ready (starting up or draining), and failed when nothing is bound
+func (s *Server) listenerHealth() SubsystemHealth {
+	s.mu.Lock()
+	bound := s.listener != nil
+	s.mu.Unlock()
+
+	switch {
+	case !bound:
+		return SubsystemHealth{Status: HealthFailed, Detail: "listener not bound"}
+	case !s.IsReady():
+		return SubsystemHealth{Status: HealthDegraded, Detail: "listener bound but not accepting"}
+	default:
+		return SubsystemHealth{Status: HealthOK}
+	}
+}
+
+// indexerProbe is a store health check in flight. Every /healthz request arriving before
+// it returns shares it, so a stuck store holds at most one probe goroutine however often
+// it is polled.
+type indexerProbe struct {
+	start   time.Time
+	done    chan struct{} // Closed once the stats read returns
+	elapsed time.Duration // How long the stats read took; valid once done is closed
+}
+
+// indexerHealth probes the store with a stats read, which needs the read lock, so a
+// writer holding the lock for too long shows up as degraded or failed
+func (s *Server) indexerHealth() SubsystemHealth {
+	probe := s.indexerProbe()
+	select {
+	case <-probe.done:
+		if probe.elapsed > indexerProbeSlow {
+			return SubsystemHealth{Status: HealthDegraded, Detail: "slow response: " + probe.elapsed.Round(time.Millisecond).String()}
+		}
+		return SubsystemHealth{Status: HealthOK}
+	case <-time.After(time.Until(probe.start.Add(indexerProbeTimeout))):
+		return SubsystemHealth{Status: HealthFailed, Detail: "no response within " + indexerProbeTimeout.String()}
+	}
+}
+
+// indexerProbe returns the probe in flight, starting one if there is none
+func (s *Server) indexerProbe() *indexerProbe {
+	s.probeMu.Lock()
+	defer s.probeMu.Unlock()
+	if s.probe != nil {
+		return s.probe
+	}
+
+	probe := &indexerProbe{start: time.Now(), done: make(chan struct{})}
+	s.probe = probe
+	go func() {
+		s.indexer.GetStats()
+		probe.elapsed = time.Since(probe.start)
+		s.probeMu.Lock()
+		s.probe = nil
+		s.probeMu.Unlock()
+		close(probe.done)
+	}()
+	return probe
+}
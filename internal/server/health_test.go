@@ -0,0 +1,87 @@
+package server
+
+import (
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"package-indexer/internal/indexer"
+)
+
+// TestServer_Health validates subsystem statuses across the listener lifecycle and for
+// a slow store.
+func TestServer_Health(t *testing.T) {
+	srv := NewServer(":0", DefaultReadTimeout)
+	health := srv.Health()
+	if got := health["listener"].Status; got != HealthFailed {
+		t.Errorf("listener before bind = %q, want %q", got, HealthFailed)
+	}
+	if got := health["indexer"].Status; got != HealthOK {
+		t.Errorf("indexer = %q, want %q", got, HealthOK)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer ln.Close()
+	srv.SetListener(ln)
+	if got := srv.Health()["listener"].Status; got != HealthDegraded {
+		t.Errorf("listener bound but not ready = %q, want %q", got, HealthDegraded)
+	}
+	srv.isReady.Store(true)
+	if got := srv.Health()["listener"].Status; got != HealthOK {
+		t.Errorf("listener ready = %q, want %q", got, HealthOK)
+	}
+
+	slow := NewFaultInjectingStore()
+	slow.Latency = 2 * indexerProbeSlow
+	srv = NewServerWithConfig(Config{Addr: ":0", ReadTimeout: DefaultReadTimeout, Store: slow})
+	if got := srv.Health()["indexer"]; got.Status != HealthDegraded || got.Detail == "" {
+		t.Errorf("slow indexer = %+v, want %q with detail", got, HealthDegraded)
+	}
+
+	slow.Latency = indexerProbeTimeout + 500*time.Millisecond
+	if got := srv.Health()["indexer"].Status; got != HealthFailed {
+		t.Errorf("stuck indexer = %q, want %q", got, HealthFailed)
+	}
+}
+
+// stuckStatsStore blocks GetStats until released, counting the calls
+type stuckStatsStore struct {
+	indexer.PackageStore
+	calls   atomic.Int32
+	release chan struct{}
+}
+
+func (s *stuckStatsStore) GetStats() (int, int, int) {
+	s.calls.Add(1)
+	<-s.release
+	return s.PackageStore.GetStats()
+}
+
+// TestServer_HealthSingleProbe validates that health checks against a stuck store share
+// one probe instead of each leaving a blocked goroutine behind, and that a fresh probe
+// starts once the store recovers.
+func TestServer_HealthSingleProbe(t *testing.T) {
+	store := &stuckStatsStore{PackageStore: indexer.NewIndexer(), release: make(chan struct{})}
+	srv := NewServerWithConfig(Config{Addr: ":0", ReadTimeout: DefaultReadTimeout, Store: store})
+
+	for i := 0; i < 3; i++ {
+		if got := srv.Health()["indexer"].Status; got != HealthFailed {
+			t.Errorf("check %d of stuck indexer = %q, want %q", i+1, got, HealthFailed)
+		}
+	}
+	if calls := store.calls.Load(); calls != 1 {
+		t.Errorf("expected 1 probe of the stuck store, got %d", calls)
+	}
+
+	close(store.release)
+	waitFor(t, readyWaitTimeout, func() bool {
+		return srv.Health()["indexer"].Status == HealthOK
+	})
+	if calls := store.calls.Load(); calls < 2 {
+		t.Errorf("expected a new probe after recovery, got %d calls", calls)
+	}
+}
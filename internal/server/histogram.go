@@ -0,0 +1,91 @@
+package server
+
+import (
+	"sync/atomic"
+	"time"
+
+	"package-indexer/internal/wire"
+)
+
+// LatencyBuckets are the upper bounds of the command latency histogram buckets, spanning
+// in-memory index operations up to commands stuck behind a hot lock
+var LatencyBuckets = [...]time.Duration{
+	100 * time.Microsecond,
+	250 * time.Microsecond,
+	500 * time.Microsecond,
+	time.Millisecond,
+	2500 * time.Microsecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+}
+
+// latencyOutcomes labels the per-outcome histograms, indexed by wire.Response
+var latencyOutcomes = [...]string{wire.OK: "ok", wire.FAIL: "fail", wire.ERROR: "error"}
+
+// latencyHistogram counts observations per bucket with atomic operations. The last
+// bucket catches observations above every bound.
+type latencyHistogram struct {
+	counts   [len(LatencyBuckets) + 1]int64
+	sumNanos int64
+}
+
+// observe records a single latency
+func (h *latencyHistogram) observe(d time.Duration) {
+	bucket := len(LatencyBuckets)
+	for i, bound := range LatencyBuckets {
+		if d <= bound {
+			bucket = i
+			break
+		}
+	}
+	atomic.AddInt64(&h.counts[bucket], 1)
+	atomic.AddInt64(&h.sumNanos, int64(d))
+}
+
+// LatencyHistogram is a point-in-time view of the latency histogram for one outcome,
+// shaped for Prometheus export
+type LatencyHistogram struct {
+	Outcome    string  // "ok", "fail" or "error"
+	Cumulative []int64 // Observations at or below each of LatencyBuckets
+	Count      int64   // Total observations, the implicit +Inf bucket
+	Sum        time.Duration
+}
+
+// snapshot returns the cumulative view of the histogram
+func (h *latencyHistogram) snapshot(outcome string) LatencyHistogram {
+	snap := LatencyHistogram{Outcome: outcome, Cumulative: make([]int64, len(LatencyBuckets))}
+	for i := range h.counts {
+		snap.Count += atomic.LoadInt64(&h.counts[i])
+		if i < len(LatencyBuckets) {
+			snap.Cumulative[i] = snap.Count
+		}
+	}
+	snap.Sum = time.Duration(atomic.LoadInt64(&h.sumNanos))
+	return snap
+}
+
+// ObserveLatency records a command's latency in the histogram for its response code, so
+// slow failures and timeouts do not skew the latency of successful commands
+func (m *Metrics) ObserveLatency(code wire.Response, d time.Duration) {
+	if int(code) < 0 || int(code) >= len(m.latency) {
+		code = wire.ERROR
+	}
+	m.latency[code].observe(d)
+}
+
+// LatencyHistograms returns the per-outcome latency histograms in ok, fail, error order
+func (m *Metrics) LatencyHistograms() []LatencyHistogram {
+	histograms := make([]LatencyHistogram, len(m.latency))
+	for i := range m.latency {
+		histograms[i] = m.latency[i].snapshot(latencyOutcomes[i])
+	}
+	return histograms
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"package-indexer/internal/wire"
+)
+
+// TestLatencyHistogram_Buckets validates bucket placement, cumulative counts and the
+// overflow bucket above the largest bound.
+func TestLatencyHistogram_Buckets(t *testing.T) {
+	var h latencyHistogram
+	h.observe(50 * time.Microsecond) // First bucket
+	h.observe(time.Millisecond)      // Exactly on a bound
+	h.observe(time.Minute)           // Above every bound
+
+	snap := h.snapshot("ok")
+	if snap.Count != 3 {
+		t.Fatalf("expected 3 observations, got %d", snap.Count)
+	}
+	if snap.Cumulative[0] != 1 {
+		t.Errorf("expected 1 observation in the first bucket, got %d", snap.Cumulative[0])
+	}
+	if last := snap.Cumulative[len(LatencyBuckets)-1]; last != 2 {
+		t.Errorf("expected 2 observations at or below the largest bound, got %d", last)
+	}
+	if expected := time.Minute + time.Millisecond + 50*time.Microsecond; snap.Sum != expected {
+		t.Errorf("expected sum %v, got %v", expected, snap.Sum)
+	}
+}
+
+// TestServer_LatencyByOutcome validates that each reply outcome is recorded in its own
+// latency histogram.
+func TestServer_LatencyByOutcome(t *testing.T) {
+	s := NewServer(":0", DefaultReadTimeout)
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	defer s.cancel()
+
+	client, server := net.Pipe()
+	defer client.Close()
+	s.wg.Add(1)
+	go s.handleConnection(server)
+
+	reader := bufio.NewReader(client)
+	for _, exchange := range []struct{ line, expected string }{
+		{"INDEX|a|\n", wire.OK.String()},
+		{"INDEX|b|\n", wire.OK.String()},
+		{"QUERY|missing|\n", wire.FAIL.String()},
+		{"BOGUS|x|\n", wire.ERROR.String()},
+	} {
+		if _, err := client.Write([]byte(exchange.line)); err != nil {
+			t.Fatalf("failed to write %q: %v", exchange.line, err)
+		}
+		if resp, err := reader.ReadString('\n'); err != nil || resp != exchange.expected {
+			t.Fatalf("%q: expected %q, got %q (err %v)", exchange.line, exchange.expected, resp, err)
+		}
+	}
+
+	expected := map[string]int64{"ok": 2, "fail": 1, "error": 1}
+	for _, h := range s.LatencyHistograms() {
+		if h.Count != expected[h.Outcome] {
+			t.Errorf("outcome %q: expected %d observations, got %d", h.Outcome, expected[h.Outcome], h.Count)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ListenFDsEnv names the environment variable through which a parent process (e.g. the
+// previous server binary during a zero-downtime restart) passes already-bound listening
+// sockets as a comma-separated list of file descriptor numbers. When set, the server
+// serves on those sockets instead of binding its configured addresses.
+const ListenFDsEnv = "PACKAGE_INDEXER_LISTEN_FDS"
+
+// systemd socket activation (sd_listen_fds) environment, see sd_listen_fds(3)
+const (
+	systemdListenPIDEnv = "LISTEN_PID"
+	systemdListenFDsEnv = "LISTEN_FDS"
+	systemdFDNamesEnv   = "LISTEN_FDNAMES"
+)
+
+// systemdListenFDsStart is the first descriptor passed by systemd (SD_LISTEN_FDS_START).
+// A variable so tests can simulate activation without clobbering descriptor 3.
+var systemdListenFDsStart uintptr = 3
+
+// inheritedListeners returns listeners passed by systemd socket activation or, failing
+// that, through ListenFDsEnv. Returns nil when neither applies.
+func inheritedListeners() ([]net.Listener, error) {
+	if listeners, err := systemdListeners(); err != nil || len(listeners) > 0 {
+		return listeners, err
+	}
+	return envListeners()
+}
+
+// systemdListeners implements the sd_listen_fds protocol: when LISTEN_PID names this
+// process, descriptors systemdListenFDsStart through +LISTEN_FDS-1 are its listeners.
+// The variables are cleared once consumed, as sd_listen_fds(1) does, so child processes
+// do not try to reuse the descriptors.
+func systemdListeners() ([]net.Listener, error) {
+	pidStr := os.Getenv(systemdListenPIDEnv)
+	if pidStr == "" {
+		return nil, nil
+	}
+	if pid, err := strconv.Atoi(pidStr); err != nil || pid != os.Getpid() {
+		return nil, nil // Activation targets another process
+	}
+
+	count, err := strconv.Atoi(os.Getenv(systemdListenFDsEnv))
+	if err != nil || count < 0 {
+		return nil, fmt.Errorf("invalid %s %q", systemdListenFDsEnv, os.Getenv(systemdListenFDsEnv))
+	}
+	for _, name := range []string{systemdListenPIDEnv, systemdListenFDsEnv, systemdFDNamesEnv} {
+		_ = os.Unsetenv(name)
+	}
+
+	fds := make([]uintptr, count)
+	for i := range fds {
+		fds[i] = systemdListenFDsStart + uintptr(i)
+	}
+	return listenersFromFDs(fds)
+}
+
+// envListeners wraps the file descriptors named by ListenFDsEnv as listeners.
+// Returns nil when the variable is unset. The variable is cleared once consumed so
+// child processes do not try to reuse the descriptors.
+func envListeners() ([]net.Listener, error) {
+	value := os.Getenv(ListenFDsEnv)
+	if value == "" {
+		return nil, nil
+	}
+	_ = os.Unsetenv(ListenFDsEnv)
+
+	var fds []uintptr
+	for _, field := range strings.Split(value, ",") {
+		fd, err := strconv.ParseUint(strings.TrimSpace(field), 10, 0)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s entry %q: %w", ListenFDsEnv, field, err)
+		}
+		fds = append(fds, uintptr(fd))
+	}
+	return listenersFromFDs(fds)
+}
+
+// listenersFromFDs converts inherited socket descriptors into listeners, closing any
+// already-converted listeners on failure
+func listenersFromFDs(fds []uintptr) ([]net.Listener, error) {
+	listeners := make([]net.Listener, 0, len(fds))
+	for _, fd := range fds {
+		f := os.NewFile(fd, "listener-"+strconv.FormatUint(uint64(fd), 10))
+		l, err := net.FileListener(f)
+		_ = f.Close() // FileListener dups the descriptor
+		if err != nil {
+			for _, opened := range listeners {
+				_ = opened.Close()
+			}
+			return nil, fmt.Errorf("failed to use inherited fd %d as listener: %w", fd, err)
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"os"
+	"runtime"
+	"strconv"
+	"testing"
+
+	"package-indexer/internal/wire"
+)
+
+// TestServer_InheritedListener validates that a listener passed by file descriptor is
+// served instead of binding the configured address.
+func TestServer_InheritedListener(t *testing.T) {
+	parent, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to create parent listener: %v", err)
+	}
+	defer parent.Close()
+
+	f, err := parent.(*net.TCPListener).File()
+	if err != nil {
+		t.Skipf("listener file descriptors unsupported: %v", err)
+	}
+	defer f.Close()
+	t.Setenv(ListenFDsEnv, strconv.Itoa(int(f.Fd())))
+
+	// The configured address is unusable, proving the inherited socket is used instead
+	srv := NewServer("invalid-address", DefaultReadTimeout)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- srv.StartWithContext(ctx) }()
+	<-srv.Ready()
+	if !srv.IsReady() {
+		t.Fatalf("server failed to start on inherited listener: %v", <-done)
+	}
+
+	conn, err := net.Dial("tcp", parent.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to dial inherited address: %v", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("INDEX|inherited|\n")); err != nil {
+		t.Fatalf("failed to write command: %v", err)
+	}
+	if resp, err := bufio.NewReader(conn).ReadString('\n'); err != nil || resp != wire.OK.String() {
+		t.Errorf("expected OK from inherited listener, got %q, %v", resp, err)
+	}
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), shutdownWaitTimeout)
+	defer shutdownCancel()
+	_ = srv.Shutdown(shutdownCtx)
+}
+
+// TestInheritedListeners_InvalidFD validates that malformed or unusable descriptors
+// fail startup rather than silently binding elsewhere.
+func TestInheritedListeners_InvalidFD(t *testing.T) {
+	for _, value := range []string{"not-a-number", "99999"} {
+		t.Setenv(ListenFDsEnv, value)
+		if _, err := inheritedListeners(); err == nil {
+			t.Errorf("expected error for %s=%q", ListenFDsEnv, value)
+		}
+	}
+}
+
+// TestSystemdListeners validates socket activation when LISTEN_PID targets this process,
+// and that activation aimed at another process is ignored. Linux only, where systemd runs.
+func TestSystemdListeners(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("systemd socket activation is Linux-specific")
+	}
+
+	parent, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to create activated listener: %v", err)
+	}
+	defer parent.Close()
+	f, err := parent.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatalf("failed to get listener file: %v", err)
+	}
+	defer f.Close()
+
+	oldStart := systemdListenFDsStart
+	systemdListenFDsStart = f.Fd()
+	defer func() { systemdListenFDsStart = oldStart }()
+
+	// Activation for a different process is ignored
+	t.Setenv(systemdListenPIDEnv, strconv.Itoa(os.Getpid()+1))
+	t.Setenv(systemdListenFDsEnv, "1")
+	if listeners, err := inheritedListeners(); err != nil || len(listeners) != 0 {
+		t.Fatalf("expected no listeners for foreign LISTEN_PID, got %v, %v", listeners, err)
+	}
+
+	t.Setenv(systemdListenPIDEnv, strconv.Itoa(os.Getpid()))
+	listeners, err := inheritedListeners()
+	if err != nil || len(listeners) != 1 {
+		t.Fatalf("expected one activated listener, got %v, %v", listeners, err)
+	}
+	defer listeners[0].Close()
+	if listeners[0].Addr().String() != parent.Addr().String() {
+		t.Errorf("activated listener on %s, expected %s", listeners[0].Addr(), parent.Addr())
+	}
+	if os.Getenv(systemdListenFDsEnv) != "" {
+		t.Error("expected LISTEN_FDS to be cleared after activation")
+	}
+}
@@ -6,27 +6,118 @@ package server
 import (
 	"sync/atomic"
 	"time"
+
+	"package-indexer/internal/wire"
+)
+
+// MetricsRecorder is the contract the server records operational events through. *Metrics
+// is the default implementation; alternatives (a no-op recorder, or one backed by another
+// metrics library) only need to accept the same events and report a snapshot.
+type MetricsRecorder interface {
+	IncrementConnections()
+	IncrementCommands()
+	IncrementErrors()
+	IncrementPackages()
+	SetPackages(n int64)
+	IncrementServerOverloaded()
+	IncrementCommandTimeouts()
+	IncrementPanicsRecovered()
+	IncrementGoroutineRejected()
+	IncrementResponsesOK()
+	IncrementResponsesFail()
+	IncrementResponsesError()
+	IncrementConnsRejected()
+	IncrementSoftLimitWarnings()
+	IncrementResultCacheHits()
+	IncrementResultCacheMisses()
+	IncrementCircuitBreakerOpen()
+	AddProcessingTime(d time.Duration)
+	ObserveLatency(code wire.Response, d time.Duration)
+	GetSnapshot() MetricsSnapshot
+	LatencyHistograms() []LatencyHistogram
+}
+
+// Compile-time checks that the recorders satisfy MetricsRecorder
+var (
+	_ MetricsRecorder = (*Metrics)(nil)
+	_ MetricsRecorder = NopMetrics{}
 )
 
+// NopMetrics is a MetricsRecorder that discards every event and reports an empty
+// snapshot, for measuring protocol and indexer performance without the shared atomic
+// counters that every connection otherwise contends on.
+type NopMetrics struct{}
+
+func (NopMetrics) IncrementConnections()                       {}
+func (NopMetrics) IncrementCommands()                          {}
+func (NopMetrics) IncrementErrors()                            {}
+func (NopMetrics) IncrementPackages()                          {}
+func (NopMetrics) SetPackages(int64)                           {}
+func (NopMetrics) IncrementServerOverloaded()                  {}
+func (NopMetrics) IncrementCommandTimeouts()                   {}
+func (NopMetrics) IncrementPanicsRecovered()                   {}
+func (NopMetrics) IncrementGoroutineRejected()                 {}
+func (NopMetrics) IncrementResponsesOK()                       {}
+func (NopMetrics) IncrementResponsesFail()                     {}
+func (NopMetrics) IncrementResponsesError()                    {}
+func (NopMetrics) IncrementConnsRejected()                     {}
+func (NopMetrics) IncrementSoftLimitWarnings()                 {}
+func (NopMetrics) IncrementResultCacheHits()                   {}
+func (NopMetrics) IncrementResultCacheMisses()                 {}
+func (NopMetrics) IncrementCircuitBreakerOpen()                {}
+func (NopMetrics) AddProcessingTime(time.Duration)             {}
+func (NopMetrics) ObserveLatency(wire.Response, time.Duration) {}
+func (NopMetrics) GetSnapshot() MetricsSnapshot                { return MetricsSnapshot{} }
+func (NopMetrics) LatencyHistograms() []LatencyHistogram       { return nil }
+
 // Metrics contains runtime statistics using atomic operations for thread safety.
 // Lock-free design ensures minimal performance impact for production monitoring.
 type Metrics struct {
-	ConnectionsTotal  int64
-	CommandsProcessed int64
-	ErrorCount        int64
-	PackagesIndexed   int64
-	StartTime         time.Time
+	ConnectionsTotal     int64
+	CommandsProcessed    int64
+	ErrorCount           int64
+	PackagesIndexed      int64
+	ServerOverloaded     int64 // Connections rejected by load shedding
+	CommandTimeouts      int64 // Commands that exceeded the command timeout
+	PanicsRecovered      int64 // Connection handlers that panicked and were recovered
+	GoroutineRejected    int64 // Connections refused by the goroutine ceiling
+	ResponsesOK          int64 // Commands answered with OK
+	ResponsesFail        int64 // Commands answered with FAIL
+	ResponsesError       int64 // Commands answered with ERROR
+	ConnsRejected        int64 // Connections refused by the hard connection limit
+	SoftLimitWarnings    int64 // Connections accepted while above the soft connection limit
+	ResultCacheHits      int64 // Read commands answered from the result cache
+	ResultCacheMisses    int64 // Cacheable read commands that had to reach the store
+	CircuitBreakerOpen   int64 // Times a downstream circuit breaker tripped open
+	TotalProcessingNanos int64 // Sum of command processing times, for the mean alongside CommandsProcessed
+	StartTime            time.Time
+
+	latency [len(latencyOutcomes)]latencyHistogram // Command latency by response code
 }
 
 // MetricsSnapshot represents a point-in-time view of server metrics for consistent reporting.
 // Atomic snapshot prevents torn reads during concurrent updates, ensuring reliable metrics
 // data for monitoring dashboards, alerting systems, and operational decision-making.
 type MetricsSnapshot struct {
-	ConnectionsTotal  int64
-	CommandsProcessed int64
-	ErrorCount        int64
-	PackagesIndexed   int64
-	Uptime            time.Duration
+	ConnectionsTotal     int64
+	CommandsProcessed    int64
+	ErrorCount           int64
+	PackagesIndexed      int64
+	ServerOverloaded     int64
+	CommandTimeouts      int64
+	PanicsRecovered      int64
+	GoroutineRejected    int64
+	ResponsesOK          int64
+	ResponsesFail        int64
+	ResponsesError       int64
+	ConnsRejected        int64
+	SoftLimitWarnings    int64
+	ResultCacheHits      int64
+	ResultCacheMisses    int64
+	CircuitBreakerOpen   int64
+	TotalProcessingNanos int64
+	AvgCommandDuration   time.Duration // Mean processing time per command (0 before any command)
+	Uptime               time.Duration
 }
 
 // NewMetrics creates a new metrics instance
@@ -36,6 +127,46 @@ func NewMetrics() *Metrics {
 	}
 }
 
+// Delta returns the per-field change between previous and a fresh snapshot, enabling
+// ad-hoc rate calculation. The Uptime field of the result holds the elapsed time.
+func (m *Metrics) Delta(previous MetricsSnapshot) MetricsSnapshot {
+	return m.GetSnapshot().Delta(previous)
+}
+
+// Delta returns the per-field difference between this snapshot and an earlier one.
+// The Uptime field of the result holds the elapsed time between the two snapshots.
+func (s MetricsSnapshot) Delta(previous MetricsSnapshot) MetricsSnapshot {
+	return MetricsSnapshot{
+		ConnectionsTotal:     s.ConnectionsTotal - previous.ConnectionsTotal,
+		CommandsProcessed:    s.CommandsProcessed - previous.CommandsProcessed,
+		ErrorCount:           s.ErrorCount - previous.ErrorCount,
+		PackagesIndexed:      s.PackagesIndexed - previous.PackagesIndexed,
+		ServerOverloaded:     s.ServerOverloaded - previous.ServerOverloaded,
+		CommandTimeouts:      s.CommandTimeouts - previous.CommandTimeouts,
+		PanicsRecovered:      s.PanicsRecovered - previous.PanicsRecovered,
+		GoroutineRejected:    s.GoroutineRejected - previous.GoroutineRejected,
+		ResponsesOK:          s.ResponsesOK - previous.ResponsesOK,
+		ResponsesFail:        s.ResponsesFail - previous.ResponsesFail,
+		ResponsesError:       s.ResponsesError - previous.ResponsesError,
+		ConnsRejected:        s.ConnsRejected - previous.ConnsRejected,
+		SoftLimitWarnings:    s.SoftLimitWarnings - previous.SoftLimitWarnings,
+		ResultCacheHits:      s.ResultCacheHits - previous.ResultCacheHits,
+		ResultCacheMisses:    s.ResultCacheMisses - previous.ResultCacheMisses,
+		CircuitBreakerOpen:   s.CircuitBreakerOpen - previous.CircuitBreakerOpen,
+		TotalProcessingNanos: s.TotalProcessingNanos - previous.TotalProcessingNanos,
+		AvgCommandDuration:   averageDuration(s.TotalProcessingNanos-previous.TotalProcessingNanos, s.CommandsProcessed-previous.CommandsProcessed),
+		Uptime:               s.Uptime - previous.Uptime,
+	}
+}
+
+// averageDuration returns totalNanos spread over count, or 0 when count is zero
+func averageDuration(totalNanos, count int64) time.Duration {
+	if count <= 0 {
+		return 0
+	}
+	return time.Duration(totalNanos / count)
+}
+
 // IncrementConnections atomically increments the connection counter
 func (m *Metrics) IncrementConnections() {
 	atomic.AddInt64(&m.ConnectionsTotal, 1)
@@ -56,13 +187,99 @@ func (m *Metrics) IncrementPackages() {
 	atomic.AddInt64(&m.PackagesIndexed, 1)
 }
 
+// SetPackages atomically replaces the package counter, for when the whole index is
+// swapped out rather than built up one package at a time
+func (m *Metrics) SetPackages(n int64) {
+	atomic.StoreInt64(&m.PackagesIndexed, n)
+}
+
+// IncrementServerOverloaded atomically increments the load-shedding rejection counter
+func (m *Metrics) IncrementServerOverloaded() {
+	atomic.AddInt64(&m.ServerOverloaded, 1)
+}
+
+// IncrementCommandTimeouts atomically increments the command timeout counter
+func (m *Metrics) IncrementCommandTimeouts() {
+	atomic.AddInt64(&m.CommandTimeouts, 1)
+}
+
+// IncrementPanicsRecovered atomically increments the recovered panic counter
+func (m *Metrics) IncrementPanicsRecovered() {
+	atomic.AddInt64(&m.PanicsRecovered, 1)
+}
+
+// IncrementGoroutineRejected atomically increments the goroutine ceiling rejection counter
+func (m *Metrics) IncrementGoroutineRejected() {
+	atomic.AddInt64(&m.GoroutineRejected, 1)
+}
+
+// IncrementResponsesOK atomically increments the OK response counter
+func (m *Metrics) IncrementResponsesOK() {
+	atomic.AddInt64(&m.ResponsesOK, 1)
+}
+
+// IncrementResponsesFail atomically increments the FAIL response counter
+func (m *Metrics) IncrementResponsesFail() {
+	atomic.AddInt64(&m.ResponsesFail, 1)
+}
+
+// IncrementResponsesError atomically increments the ERROR response counter
+func (m *Metrics) IncrementResponsesError() {
+	atomic.AddInt64(&m.ResponsesError, 1)
+}
+
+// IncrementConnsRejected atomically increments the hard connection limit rejection counter
+func (m *Metrics) IncrementConnsRejected() {
+	atomic.AddInt64(&m.ConnsRejected, 1)
+}
+
+// IncrementSoftLimitWarnings atomically increments the soft connection limit counter
+func (m *Metrics) IncrementSoftLimitWarnings() {
+	atomic.AddInt64(&m.SoftLimitWarnings, 1)
+}
+
+// IncrementResultCacheHits atomically increments the result cache hit counter
+func (m *Metrics) IncrementResultCacheHits() {
+	atomic.AddInt64(&m.ResultCacheHits, 1)
+}
+
+// IncrementResultCacheMisses atomically increments the result cache miss counter
+func (m *Metrics) IncrementResultCacheMisses() {
+	atomic.AddInt64(&m.ResultCacheMisses, 1)
+}
+
+// IncrementCircuitBreakerOpen atomically increments the circuit breaker trip counter
+func (m *Metrics) IncrementCircuitBreakerOpen() {
+	atomic.AddInt64(&m.CircuitBreakerOpen, 1)
+}
+
+// AddProcessingTime atomically adds a command's processing time to the running sum
+func (m *Metrics) AddProcessingTime(d time.Duration) {
+	atomic.AddInt64(&m.TotalProcessingNanos, int64(d))
+}
+
 // GetSnapshot returns a consistent point-in-time view of current metrics
 func (m *Metrics) GetSnapshot() MetricsSnapshot {
-	return MetricsSnapshot{
-		ConnectionsTotal:  atomic.LoadInt64(&m.ConnectionsTotal),
-		CommandsProcessed: atomic.LoadInt64(&m.CommandsProcessed),
-		ErrorCount:        atomic.LoadInt64(&m.ErrorCount),
-		PackagesIndexed:   atomic.LoadInt64(&m.PackagesIndexed),
-		Uptime:            time.Since(m.StartTime),
+	snapshot := MetricsSnapshot{
+		ConnectionsTotal:     atomic.LoadInt64(&m.ConnectionsTotal),
+		CommandsProcessed:    atomic.LoadInt64(&m.CommandsProcessed),
+		ErrorCount:           atomic.LoadInt64(&m.ErrorCount),
+		PackagesIndexed:      atomic.LoadInt64(&m.PackagesIndexed),
+		ServerOverloaded:     atomic.LoadInt64(&m.ServerOverloaded),
+		CommandTimeouts:      atomic.LoadInt64(&m.CommandTimeouts),
+		PanicsRecovered:      atomic.LoadInt64(&m.PanicsRecovered),
+		GoroutineRejected:    atomic.LoadInt64(&m.GoroutineRejected),
+		ResponsesOK:          atomic.LoadInt64(&m.ResponsesOK),
+		ResponsesFail:        atomic.LoadInt64(&m.ResponsesFail),
+		ResponsesError:       atomic.LoadInt64(&m.ResponsesError),
+		ConnsRejected:        atomic.LoadInt64(&m.ConnsRejected),
+		SoftLimitWarnings:    atomic.LoadInt64(&m.SoftLimitWarnings),
+		ResultCacheHits:      atomic.LoadInt64(&m.ResultCacheHits),
+		ResultCacheMisses:    atomic.LoadInt64(&m.ResultCacheMisses),
+		CircuitBreakerOpen:   atomic.LoadInt64(&m.CircuitBreakerOpen),
+		TotalProcessingNanos: atomic.LoadInt64(&m.TotalProcessingNanos),
+		Uptime:               time.Since(m.StartTime),
 	}
+	snapshot.AvgCommandDuration = averageDuration(snapshot.TotalProcessingNanos, snapshot.CommandsProcessed)
+	return snapshot
 }
@@ -1,9 +1,17 @@
 package server
 
 import (
+	"bufio"
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
 	"sync"
 	"testing"
 	"time"
+
+	"package-indexer/internal/wire"
 )
 
 const minUptimeProgress = 1 * time.Millisecond
@@ -56,6 +64,18 @@ func TestMetrics_IncrementOperations(t *testing.T) {
 		{"Commands", (*Metrics).IncrementCommands, func(s *MetricsSnapshot) int64 { return s.CommandsProcessed }},
 		{"Errors", (*Metrics).IncrementErrors, func(s *MetricsSnapshot) int64 { return s.ErrorCount }},
 		{"Packages", (*Metrics).IncrementPackages, func(s *MetricsSnapshot) int64 { return s.PackagesIndexed }},
+		{"ServerOverloaded", (*Metrics).IncrementServerOverloaded, func(s *MetricsSnapshot) int64 { return s.ServerOverloaded }},
+		{"CommandTimeouts", (*Metrics).IncrementCommandTimeouts, func(s *MetricsSnapshot) int64 { return s.CommandTimeouts }},
+		{"PanicsRecovered", (*Metrics).IncrementPanicsRecovered, func(s *MetricsSnapshot) int64 { return s.PanicsRecovered }},
+		{"GoroutineRejected", (*Metrics).IncrementGoroutineRejected, func(s *MetricsSnapshot) int64 { return s.GoroutineRejected }},
+		{"ResponsesOK", (*Metrics).IncrementResponsesOK, func(s *MetricsSnapshot) int64 { return s.ResponsesOK }},
+		{"ResponsesFail", (*Metrics).IncrementResponsesFail, func(s *MetricsSnapshot) int64 { return s.ResponsesFail }},
+		{"ResponsesError", (*Metrics).IncrementResponsesError, func(s *MetricsSnapshot) int64 { return s.ResponsesError }},
+		{"ConnsRejected", (*Metrics).IncrementConnsRejected, func(s *MetricsSnapshot) int64 { return s.ConnsRejected }},
+		{"SoftLimitWarnings", (*Metrics).IncrementSoftLimitWarnings, func(s *MetricsSnapshot) int64 { return s.SoftLimitWarnings }},
+		{"ResultCacheHits", (*Metrics).IncrementResultCacheHits, func(s *MetricsSnapshot) int64 { return s.ResultCacheHits }},
+		{"ResultCacheMisses", (*Metrics).IncrementResultCacheMisses, func(s *MetricsSnapshot) int64 { return s.ResultCacheMisses }},
+		{"CircuitBreakerOpen", (*Metrics).IncrementCircuitBreakerOpen, func(s *MetricsSnapshot) int64 { return s.CircuitBreakerOpen }},
 	}
 
 	for _, tt := range tests {
@@ -70,6 +90,16 @@ func TestMetrics_IncrementOperations(t *testing.T) {
 	}
 }
 
+// TestMetrics_SetPackages validates that the package counter can be replaced outright
+func TestMetrics_SetPackages(t *testing.T) {
+	m := NewMetrics()
+	m.IncrementPackages()
+	m.SetPackages(5)
+	if got := m.GetSnapshot().PackagesIndexed; got != 5 {
+		t.Errorf("Expected 5 packages after SetPackages, got %d", got)
+	}
+}
+
 // TestMetrics_ConcurrentIncrements validates thread safety of atomic operations
 // under high concurrency with race condition detection.
 func TestMetrics_ConcurrentIncrements(t *testing.T) {
@@ -164,6 +194,64 @@ func TestMetrics_MultipleSnapshots(t *testing.T) {
 	}
 }
 
+// TestMetrics_Delta validates per-field differences between snapshots, with Uptime
+// reporting the elapsed time.
+func TestMetrics_Delta(t *testing.T) {
+	m := NewMetrics()
+	m.IncrementConnections()
+	m.IncrementCommands()
+	previous := m.GetSnapshot()
+
+	time.Sleep(minUptimeProgress)
+	m.IncrementCommands()
+	m.IncrementCommands()
+	m.IncrementErrors()
+
+	delta := m.Delta(previous)
+	assertMetrics(t, delta, MetricsSnapshot{CommandsProcessed: 2, ErrorCount: 1})
+	if delta.Uptime < minUptimeProgress {
+		t.Errorf("expected elapsed >= %v, got %v", minUptimeProgress, delta.Uptime)
+	}
+}
+
+// TestServer_AverageCommandDuration validates the running mean of command processing
+// time using commands slowed by a known sleep.
+func TestServer_AverageCommandDuration(t *testing.T) {
+	const sleep = 20 * time.Millisecond
+	s := NewServer(":0", DefaultReadTimeout)
+	s.commandHook = func(cmd *wire.Command) {
+		if cmd.Type == wire.IndexCommand {
+			time.Sleep(sleep)
+		}
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	defer s.cancel()
+
+	client, server := net.Pipe()
+	defer client.Close()
+	s.wg.Add(1)
+	go s.handleConnection(server)
+
+	// Two slow INDEX commands and two fast QUERY commands average to about sleep/2
+	reader := bufio.NewReader(client)
+	for _, line := range []string{"INDEX|a|\n", "QUERY|a|\n", "INDEX|b|\n", "QUERY|b|\n"} {
+		if _, err := client.Write([]byte(line)); err != nil {
+			t.Fatalf("failed to write %q: %v", line, err)
+		}
+		if _, err := reader.ReadString('\n'); err != nil {
+			t.Fatalf("failed to read reply to %q: %v", line, err)
+		}
+	}
+
+	avg := s.GetMetrics().AvgCommandDuration
+	if avg < sleep/2 || avg > sleep {
+		t.Errorf("expected average between %v and %v, got %v", sleep/2, sleep, avg)
+	}
+	if empty := NewMetrics().GetSnapshot().AvgCommandDuration; empty != 0 {
+		t.Errorf("expected zero average before any command, got %v", empty)
+	}
+}
+
 // TestServer_MetricsIntegration validates end-to-end metrics collection through
 // the Server's GetMetrics interface with proper counter increments.
 func TestServer_MetricsIntegration(t *testing.T) {
@@ -194,6 +282,124 @@ func TestServer_MetricsIntegration(t *testing.T) {
 	}
 }
 
+// spyRecorder counts the per-command events the server reports
+type spyRecorder struct {
+	NopMetrics
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+func (s *spyRecorder) record(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls[name]++
+}
+
+func (s *spyRecorder) count(name string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[name]
+}
+
+func (s *spyRecorder) IncrementConnections()    { s.record("connections") }
+func (s *spyRecorder) IncrementCommands()       { s.record("commands") }
+func (s *spyRecorder) IncrementErrors()         { s.record("errors") }
+func (s *spyRecorder) IncrementPackages()       { s.record("packages") }
+func (s *spyRecorder) IncrementResponsesOK()    { s.record("ok") }
+func (s *spyRecorder) IncrementResponsesError() { s.record("error") }
+func (s *spyRecorder) ObserveLatency(wire.Response, time.Duration) {
+	s.record("latency")
+}
+
+// runCommandsWithRecorder serves the commands over a pipe against a server recording
+// into recorder, returning the replies
+func runCommandsWithRecorder(t *testing.T, recorder MetricsRecorder, commands []string) []string {
+	t.Helper()
+	srv := NewServerWithConfig(Config{Addr: ":0", ReadTimeout: DefaultReadTimeout, Metrics: recorder})
+	srv.ctx, srv.cancel = context.WithCancel(context.Background())
+	defer srv.cancel()
+
+	client, server := net.Pipe()
+	srv.wg.Add(1)
+	go srv.handleConnection(server)
+	reader := bufio.NewReader(client)
+
+	var replies []string
+	for _, cmd := range commands {
+		if _, err := client.Write([]byte(cmd)); err != nil {
+			t.Fatalf("failed to write %q: %v", cmd, err)
+		}
+		reply, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("failed to read reply to %q: %v", cmd, err)
+		}
+		replies = append(replies, reply)
+	}
+	client.Close()
+	srv.wg.Wait()
+	return replies
+}
+
+// TestServer_MetricsRecorder validates that the server serves normally with a recorder
+// that keeps nothing, and reports every event to a custom recorder.
+func TestServer_MetricsRecorder(t *testing.T) {
+	commands := []string{"INDEX|a|\n", "QUERY|a|\n", "BOGUS|x|\n"}
+
+	replies := runCommandsWithRecorder(t, NopMetrics{}, commands)
+	if got := strings.Join(replies, ""); got != "OK\nOK\nERROR\n" {
+		t.Errorf("replies with a no-op recorder = %q", got)
+	}
+	if NewServerWithConfig(Config{Metrics: NopMetrics{}}).MetricsEnabled() || !NewServer(":0", DefaultReadTimeout).MetricsEnabled() {
+		t.Error("expected MetricsEnabled to be false only for NopMetrics")
+	}
+
+	spy := &spyRecorder{calls: make(map[string]int)}
+	runCommandsWithRecorder(t, spy, commands)
+	expected := map[string]int{"connections": 1, "commands": 3, "errors": 1, "packages": 1, "ok": 2, "error": 1, "latency": 3}
+	for name, want := range expected {
+		if got := spy.count(name); got != want {
+			t.Errorf("recorded %s = %d, expected %d", name, got, want)
+		}
+	}
+}
+
+// BenchmarkServer_MetricsOverhead compares command throughput across parallel
+// connections with the default recorder and with NopMetrics, quantifying the cost of the
+// shared atomic counters.
+func BenchmarkServer_MetricsOverhead(b *testing.B) {
+	slog.SetDefault(slog.New(slog.NewJSONHandler(io.Discard, nil)))
+
+	for _, recorder := range []struct {
+		name    string
+		metrics MetricsRecorder
+	}{{"metrics", NewMetrics()}, {"nop", NopMetrics{}}} {
+		b.Run(recorder.name, func(b *testing.B) {
+			srv := NewServerWithConfig(Config{Addr: ":0", ReadTimeout: DefaultReadTimeout, Metrics: recorder.metrics})
+			srv.ctx, srv.cancel = context.WithCancel(context.Background())
+			defer srv.cancel()
+			srv.processCommand(slog.Default(), "INDEX|pkg|\n")
+
+			b.RunParallel(func(pb *testing.PB) {
+				client, server := net.Pipe()
+				defer client.Close()
+				srv.wg.Add(1)
+				go srv.handleConnection(server)
+				reader := bufio.NewReader(client)
+				for pb.Next() {
+					if _, err := client.Write([]byte("QUERY|pkg|\n")); err != nil {
+						b.Errorf("write failed: %v", err)
+						return
+					}
+					if _, err := reader.ReadString('\n'); err != nil {
+						b.Errorf("read failed: %v", err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
+
 func BenchmarkMetrics_IncrementConnections(b *testing.B) {
 	m := NewMetrics()
 
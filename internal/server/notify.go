@@ -0,0 +1,40 @@
+package server
+
+import (
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+)
+
+// notifySocketEnv names the systemd notification socket (Type=notify units)
+const notifySocketEnv = "NOTIFY_SOCKET"
+
+// sd_notify states sent at lifecycle transitions
+const (
+	notifyReady    = "READY=1"
+	notifyStopping = "STOPPING=1"
+)
+
+// sdNotify sends a state update to the service manager over the datagram socket named by
+// NOTIFY_SOCKET, following sd_notify(3). It is a no-op when the variable is unset, and
+// failures are logged rather than returned since notification is best-effort.
+func sdNotify(state string) {
+	name := os.Getenv(notifySocketEnv)
+	if name == "" {
+		return
+	}
+	if strings.HasPrefix(name, "@") {
+		name = "\x00" + name[1:] // Abstract namespace socket
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: name, Net: "unixgram"})
+	if err != nil {
+		slog.Warn("Failed to connect to notify socket", "error", err, "state", state)
+		return
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		slog.Warn("Failed to send service notification", "error", err, "state", state)
+	}
+}
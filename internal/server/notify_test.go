@@ -0,0 +1,49 @@
+package server
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+// TestServer_SdNotify validates that READY=1 is sent once the listener binds and
+// STOPPING=1 when shutdown begins, using a fake notify socket.
+func TestServer_SdNotify(t *testing.T) {
+	socketPath := t.TempDir() + "/notify.sock"
+	notify, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socketPath, Net: "unixgram"})
+	if err != nil {
+		t.Skipf("unix datagram sockets unavailable: %v", err)
+	}
+	defer notify.Close()
+	t.Setenv(notifySocketEnv, socketPath)
+
+	receive := func() string {
+		t.Helper()
+		buf := make([]byte, 256)
+		_ = notify.SetReadDeadline(time.Now().Add(readyWaitTimeout))
+		n, err := notify.Read(buf)
+		if err != nil {
+			t.Fatalf("failed to read notification: %v", err)
+		}
+		return string(buf[:n])
+	}
+
+	srv := NewServer("127.0.0.1:0", DefaultReadTimeout)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = srv.StartWithContext(ctx) }()
+	<-srv.Ready()
+
+	if msg := receive(); msg != notifyReady {
+		t.Errorf("expected %q after bind, got %q", notifyReady, msg)
+	}
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), shutdownWaitTimeout)
+	defer shutdownCancel()
+	_ = srv.Shutdown(shutdownCtx)
+
+	if msg := receive(); msg != notifyStopping {
+		t.Errorf("expected %q at shutdown, got %q", notifyStopping, msg)
+	}
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"net"
+	"time"
+)
+
+// commandRead is the outcome of reading one command line from a client
+type commandRead struct {
+	line    string
+	err     error
+	timeout time.Duration // Idle timeout in force for the read, for timeout logging
+}
+
+// readWindow reads commands ahead of the connection's serving loop on its own goroutine,
+// holding at most depth commands that have been read but not yet answered. Once the
+// window is full it stops reading from the connection until replies drain, so a client
+// pipelining faster than it is served is pushed back through TCP flow control instead
+// of having its commands queued in memory.
+type readWindow struct {
+	conn    net.Conn
+	slots   chan struct{} // One token per command read but not yet answered
+	results chan commandRead
+	done    chan struct{} // Closed when the serving loop stops consuming
+	exited  chan struct{} // Closed when the read-ahead goroutine returns
+}
+
+// newReadWindow starts reading commands from conn with read, at most depth ahead
+func newReadWindow(conn net.Conn, depth int, read func() commandRead) *readWindow {
+	w := &readWindow{
+		conn:    conn,
+		slots:   make(chan struct{}, depth),
+		results: make(chan commandRead),
+		done:    make(chan struct{}),
+		exited:  make(chan struct{}),
+	}
+	go w.run(read)
+	return w
+}
+
+// run reads commands while window slots are free, stopping after the first read error
+func (w *readWindow) run(read func() commandRead) {
+	defer close(w.exited)
+	for {
+		select {
+		case w.slots <- struct{}{}:
+		case <-w.done:
+			return
+		}
+		res := read()
+		select {
+		case w.results <- res:
+		case <-w.done:
+			return
+		}
+		if res.err != nil {
+			return
+		}
+	}
+}
+
+// next returns the oldest unconsumed command, waiting for one to be read if necessary
+func (w *readWindow) next() commandRead {
+	return <-w.results
+}
+
+// release frees the slot of a command whose reply has been written, letting reading resume
+func (w *readWindow) release() {
+	<-w.slots
+}
+
+// close stops the read-ahead goroutine and waits for it to exit. The connection is closed
+// to interrupt a pending read, since the goroutine may have just extended its deadline;
+// the caller is about to close it anyway.
+func (w *readWindow) close() {
+	close(w.done)
+	_ = w.conn.Close()
+	<-w.exited
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+
+	"package-indexer/internal/wire"
+)
+
+// TestServer_PipelineDepthStopsReading validates that once MaxPipelineDepth commands are
+// unanswered the server stops reading, and that reading resumes as replies drain.
+func TestServer_PipelineDepthStopsReading(t *testing.T) {
+	baseline := runtime.NumGoroutine()
+	srv := NewServerWithConfig(Config{Addr: ":0", ReadTimeout: DefaultReadTimeout, MaxPipelineDepth: 2})
+	srv.ctx, srv.cancel = context.WithCancel(context.Background())
+	defer srv.cancel()
+
+	// Hold the first command in processing so nothing is answered
+	gate := make(chan struct{})
+	var held bool
+	srv.commandHook = func(cmd *wire.Command) {
+		if !held {
+			held = true
+			<-gate
+		}
+	}
+
+	clientConn, serverConn := net.Pipe()
+	srv.wg.Add(1)
+	go srv.handleConnection(serverConn)
+
+	// The first command is being processed and the second fills the window; net.Pipe
+	// writes only complete once read, so the third write proves reading stopped
+	for i := 0; i < 2; i++ {
+		if _, err := fmt.Fprintf(clientConn, "INDEX|pkg%d|\n", i); err != nil {
+			t.Fatalf("write %d failed: %v", i, err)
+		}
+	}
+	clientConn.SetWriteDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, err := fmt.Fprint(clientConn, "INDEX|pkg2|\n"); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("expected the write beyond the pipeline depth to block, got %v", err)
+	}
+	clientConn.SetWriteDeadline(time.Time{})
+
+	close(gate)
+	reader := bufio.NewReader(clientConn)
+	go fmt.Fprint(clientConn, "INDEX|pkg2|\nQUERY|pkg2|\n")
+	for i := 0; i < 4; i++ {
+		if reply, err := reader.ReadString('\n'); err != nil || reply != "OK\n" {
+			t.Fatalf("reply %d = %q (%v), expected OK", i, reply, err)
+		}
+	}
+
+	clientConn.Close()
+	srv.wg.Wait()
+	assertNoGoroutineLeak(t, baseline)
+}
+
+// TestServer_PipelineDepthOrdering validates that a client pipelining far beyond the depth
+// still receives every reply, in command order.
+func TestServer_PipelineDepthOrdering(t *testing.T) {
+	srv := NewServerWithConfig(Config{Addr: ":0", ReadTimeout: DefaultReadTimeout, MaxPipelineDepth: 3})
+	srv.ctx, srv.cancel = context.WithCancel(context.Background())
+	defer srv.cancel()
+
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	srv.wg.Add(1)
+	go srv.handleConnection(serverConn)
+
+	const commands = 100
+	go func() {
+		for i := 0; i < commands; i++ {
+			// Every other package depends on its predecessor, so misordering would FAIL
+			if i%2 == 0 {
+				fmt.Fprintf(clientConn, "INDEX|pkg%d|\n", i)
+			} else {
+				fmt.Fprintf(clientConn, "INDEX|pkg%d|pkg%d\n", i, i-1)
+			}
+		}
+		fmt.Fprintf(clientConn, "QUERY|pkg%d|\nQUERY|missing|\n", commands-1)
+	}()
+
+	reader := bufio.NewReader(clientConn)
+	for i := 0; i < commands+1; i++ {
+		if reply, err := reader.ReadString('\n'); err != nil || reply != "OK\n" {
+			t.Fatalf("reply %d = %q (%v), expected OK", i, reply, err)
+		}
+	}
+	if reply, err := reader.ReadString('\n'); err != nil || reply != "FAIL\n" {
+		t.Fatalf("final reply = %q (%v), expected FAIL", reply, err)
+	}
+}
@@ -0,0 +1,45 @@
+package server
+
+import (
+	"fmt"
+	"io"
+
+	"package-indexer/internal/indexer"
+)
+
+// Preload indexes every package declared in r (brew-dependencies line format) in
+// dependency order, returning the number of packages indexed. Intended to run before
+// the server starts accepting connections so startup state is deterministic.
+// Malformed lines and cyclic declarations abort the preload with an error.
+func (s *Server) Preload(r io.Reader) (int, error) {
+	specs, err := indexer.ParsePackageSpecsReader(r)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, spec := range specs {
+		if !s.indexer.IndexPackage(spec.Name, spec.Dependencies) {
+			return 0, fmt.Errorf("failed to preload package %q: dependencies not indexed or package limit reached", spec.Name)
+		}
+		s.metrics.IncrementPackages()
+	}
+	return len(specs), nil
+}
+
+// Reload atomically replaces the index with the packages declared in r (same format as
+// Preload), returning the number of packages now indexed. Intended for replicas that
+// periodically refresh from a snapshot file while serving. On a read or parse error, or
+// if the declarations cannot be indexed, the current index is kept and the error is
+// returned. The packages-indexed metric is reset to the size of the restored index.
+func (s *Server) Reload(r io.Reader) (int, error) {
+	specs, err := indexer.ParsePackageSpecsReader(r)
+	if err != nil {
+		return 0, err
+	}
+	if err := s.indexer.Restore(specs); err != nil {
+		return 0, err
+	}
+	indexed, _, _ := s.indexer.GetStats()
+	s.metrics.SetPackages(int64(indexed))
+	return len(specs), nil
+}
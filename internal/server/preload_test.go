@@ -0,0 +1,153 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"package-indexer/internal/wire"
+)
+
+// TestServer_Preload validates that a preloaded graph is indexed in dependency order
+// and immediately queryable over TCP once the server is ready.
+func TestServer_Preload(t *testing.T) {
+	// Declared dependents before dependencies to exercise ordering
+	graph := "app: lib util\nlib: base\nutil: base\nbase:\n"
+	path := filepath.Join(t.TempDir(), "preload.txt")
+	if err := os.WriteFile(path, []byte(graph), 0o644); err != nil {
+		t.Fatalf("failed to write preload file: %v", err)
+	}
+
+	srv := NewServer("127.0.0.1:0", DefaultReadTimeout)
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open preload file: %v", err)
+	}
+	count, err := srv.Preload(f)
+	f.Close()
+	if err != nil {
+		t.Fatalf("Preload returned error: %v", err)
+	}
+	if count != 4 {
+		t.Errorf("expected 4 preloaded packages, got %d", count)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go srv.StartWithContext(ctx)
+	<-srv.Ready()
+
+	conn, err := net.Dial("tcp", srv.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to dial server: %v", err)
+	}
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	for _, cmd := range []string{"QUERY|app|\n", "QUERY|lib|\n", "QUERY|util|\n", "QUERY|base|\n"} {
+		if _, err := conn.Write([]byte(cmd)); err != nil {
+			t.Fatalf("failed to write %q: %v", cmd, err)
+		}
+		resp, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("failed to read response: %v", err)
+		}
+		if resp != wire.OK.String() {
+			t.Errorf("%q: expected OK for preloaded package, got %q", strings.TrimSpace(cmd), resp)
+		}
+	}
+
+	// Dependency edges are preserved
+	if _, err := conn.Write([]byte("REMOVE|base|\n")); err != nil {
+		t.Fatalf("failed to write remove: %v", err)
+	}
+	if resp, _ := reader.ReadString('\n'); resp != wire.FAIL.String() {
+		t.Errorf("expected FAIL removing preloaded dependency, got %q", resp)
+	}
+}
+
+// TestServer_Preload_Errors validates that malformed lines and cycles fail the preload.
+func TestServer_Preload_Errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"malformed line", "a: b\nmissing colon\n"},
+		{"cycle", "a: b\nb: a\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			srv := NewServer(":0", DefaultReadTimeout)
+			if _, err := srv.Preload(strings.NewReader(test.input)); err == nil {
+				t.Errorf("expected Preload(%q) to fail", test.input)
+			}
+		})
+	}
+}
+
+// TestServer_Reload validates that reloading replaces the served index with the file's
+// current contents, and that a bad file keeps the current state.
+func TestServer_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.txt")
+	reload := func(srv *Server) (int, error) {
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatalf("failed to open snapshot: %v", err)
+		}
+		defer f.Close()
+		return srv.Reload(f)
+	}
+
+	srv := NewServerWithConfig(Config{Addr: ":0", ReadOnly: true})
+	srv.metrics.IncrementPackages() // Stale count from before the first reload
+	if err := os.WriteFile(path, []byte("app: base\nbase:\n"), 0o644); err != nil {
+		t.Fatalf("failed to write snapshot: %v", err)
+	}
+	if count, err := reload(srv); err != nil || count != 2 {
+		t.Fatalf("Reload = %d, %v; expected 2, nil", count, err)
+	}
+
+	if got := srv.GetMetrics().PackagesIndexed; got != 2 {
+		t.Errorf("PackagesIndexed after reload = %d, expected 2", got)
+	}
+
+	// The snapshot changes underneath the running server
+	if err := os.WriteFile(path, []byte("web: lib\nlib:\ntool:\n"), 0o644); err != nil {
+		t.Fatalf("failed to rewrite snapshot: %v", err)
+	}
+	if count, err := reload(srv); err != nil || count != 3 {
+		t.Fatalf("Reload = %d, %v; expected 3, nil", count, err)
+	}
+	if got := srv.GetMetrics().PackagesIndexed; got != 3 {
+		t.Errorf("PackagesIndexed after second reload = %d, expected 3", got)
+	}
+
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	expected := map[string]string{"QUERY|web|\n": "OK\n", "QUERY|lib|\n": "OK\n", "QUERY|app|\n": "FAIL\n", "QUERY|base|\n": "FAIL\n"}
+	for cmd, want := range expected {
+		if reply := srv.processRequest(logger, cmd).String(); reply != want {
+			t.Errorf("after reload %q = %q, expected %q", strings.TrimSpace(cmd), reply, want)
+		}
+	}
+
+	// A malformed snapshot leaves the reloaded state in place
+	if err := os.WriteFile(path, []byte("web: lib\nmissing colon\n"), 0o644); err != nil {
+		t.Fatalf("failed to rewrite snapshot: %v", err)
+	}
+	if _, err := reload(srv); err == nil {
+		t.Fatal("expected Reload of a malformed snapshot to fail")
+	}
+	if reply := srv.processRequest(logger, "QUERY|web|\n").String(); reply != "OK\n" {
+		t.Errorf("expected state to survive a failed reload, QUERY|web| = %q", reply)
+	}
+	if got := srv.GetMetrics().PackagesIndexed; got != 3 {
+		t.Errorf("PackagesIndexed after failed reload = %d, expected 3", got)
+	}
+}
@@ -0,0 +1,46 @@
+package server
+
+import (
+	"sync"
+	"time"
+)
+
+// rateLimiter is a token bucket admitting commands at a steady rate. The bucket holds
+// one second's worth of tokens (at least one), so a client may burst up to its
+// per-second rate before being limited.
+type rateLimiter struct {
+	rate  float64          // Tokens added per second
+	burst float64          // Bucket capacity
+	now   func() time.Time // Clock, replaceable in tests
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time // When tokens was last refilled
+}
+
+// newRateLimiter creates a full bucket admitting perSecond commands per second
+func newRateLimiter(perSecond float64) *rateLimiter {
+	burst := perSecond
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{rate: perSecond, burst: burst, tokens: burst, now: time.Now, last: time.Now()}
+}
+
+// allow takes a token if one is available, reporting whether the command may run
+func (l *rateLimiter) allow() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
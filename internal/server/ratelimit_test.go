@@ -0,0 +1,115 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"package-indexer/internal/wire"
+)
+
+// TestRateLimiter validates that a full bucket admits a one-second burst, then admits
+// commands only as fast as tokens refill.
+func TestRateLimiter(t *testing.T) {
+	clock := time.Unix(0, 0)
+	l := newRateLimiter(4)
+	l.now = func() time.Time { return clock }
+	l.last = clock
+
+	for i := 0; i < 4; i++ {
+		if !l.allow() {
+			t.Fatalf("command %d of the burst was refused", i+1)
+		}
+	}
+	if l.allow() {
+		t.Error("expected the command after the burst to be refused")
+	}
+
+	clock = clock.Add(time.Second / 4)
+	if !l.allow() {
+		t.Error("expected a command once a token refilled")
+	}
+	if l.allow() {
+		t.Error("expected a single refilled token to admit only one command")
+	}
+
+	// Idle time never fills the bucket beyond its burst
+	clock = clock.Add(time.Minute)
+	for i := 0; i < 4; i++ {
+		l.allow()
+	}
+	if l.allow() {
+		t.Error("expected the bucket to be capped at its burst")
+	}
+}
+
+// TestServeConn_RateLimits validates that commands beyond the per-connection rate get
+// ERROR, and that the global limit is shared across connections.
+func TestServeConn_RateLimits(t *testing.T) {
+	serve := func(srv *Server) (net.Conn, *bufio.Reader) {
+		clientConn, serverConn := net.Pipe()
+		srv.wg.Add(1)
+		go srv.handleConnection(serverConn)
+		return clientConn, bufio.NewReader(clientConn)
+	}
+	send := func(conn net.Conn, reader *bufio.Reader) string {
+		t.Helper()
+		if _, err := conn.Write([]byte("QUERY|pkg|\n")); err != nil {
+			t.Fatalf("failed to write command: %v", err)
+		}
+		reply, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("failed to read reply: %v", err)
+		}
+		return reply
+	}
+
+	t.Run("PerConn", func(t *testing.T) {
+		srv := NewServerWithConfig(Config{Addr: ":0", ReadTimeout: DefaultReadTimeout, RateLimitPerConn: 2, Verbose: true})
+		srv.ctx, srv.cancel = context.WithCancel(context.Background())
+		defer srv.cancel()
+
+		first, firstReader := serve(srv)
+		defer first.Close()
+		for i := 0; i < 2; i++ {
+			if reply := send(first, firstReader); reply != wire.FAIL.String() {
+				t.Errorf("command %d within the rate = %q, expected FAIL", i+1, reply)
+			}
+		}
+		if reply := send(first, firstReader); reply != "ERROR rate-limited\n" {
+			t.Errorf("command beyond the rate = %q, expected ERROR rate-limited", reply)
+		}
+
+		// Another connection has its own allowance
+		second, secondReader := serve(srv)
+		defer second.Close()
+		if reply := send(second, secondReader); reply != wire.FAIL.String() {
+			t.Errorf("command on a fresh connection = %q, expected FAIL", reply)
+		}
+	})
+
+	t.Run("Global", func(t *testing.T) {
+		srv := NewServerWithConfig(Config{Addr: ":0", ReadTimeout: DefaultReadTimeout, RateLimitGlobal: 2})
+		srv.ctx, srv.cancel = context.WithCancel(context.Background())
+		defer srv.cancel()
+
+		first, firstReader := serve(srv)
+		defer first.Close()
+		second, secondReader := serve(srv)
+		defer second.Close()
+		if reply := send(first, firstReader); reply != wire.FAIL.String() {
+			t.Errorf("first command = %q, expected FAIL", reply)
+		}
+		if reply := send(second, secondReader); reply != wire.FAIL.String() {
+			t.Errorf("second command = %q, expected FAIL", reply)
+		}
+		if reply := send(first, firstReader); reply != wire.ERROR.String() {
+			t.Errorf("command beyond the shared rate = %q, expected ERROR", reply)
+		}
+		if errs := srv.GetMetrics().ResponsesError; errs != 1 {
+			t.Errorf("expected 1 ERROR response, got %d", errs)
+		}
+	})
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// Recent error buffer limits
+const (
+	RecentErrorsCapacity = 64  // Number of error events retained; older events are evicted
+	recentErrorLineLimit = 128 // Bytes of the offending line kept per event
+)
+
+// ErrorEvent describes a command that was answered with ERROR
+type ErrorEvent struct {
+	Time   time.Time `json:"time"`
+	ConnID uint64    `json:"conn_id"`
+	Line   string    `json:"line"`   // Offending line, truncated to a bounded excerpt
+	Reason string    `json:"reason"` // Parse or execution failure description
+}
+
+// errorRing is a fixed-capacity ring buffer of recent error events, letting operators
+// inspect the latest failures without tailing logs
+type errorRing struct {
+	mu     sync.Mutex
+	events []ErrorEvent
+	next   int
+}
+
+// newErrorRing creates a ring retaining at most capacity events
+func newErrorRing(capacity int) *errorRing {
+	return &errorRing{events: make([]ErrorEvent, 0, capacity)}
+}
+
+// add records an error event, evicting the oldest once the ring is full
+func (r *errorRing) add(connID uint64, line string, reason string) {
+	line = strings.TrimSuffix(line, "\n")
+	if len(line) > recentErrorLineLimit {
+		line = line[:recentErrorLineLimit]
+	}
+	event := ErrorEvent{Time: time.Now(), ConnID: connID, Line: line, Reason: reason}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.events) < cap(r.events) {
+		r.events = append(r.events, event)
+	} else {
+		r.events[r.next] = event
+	}
+	r.next = (r.next + 1) % cap(r.events)
+}
+
+// snapshot returns the retained events, oldest first
+func (r *errorRing) snapshot() []ErrorEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.events) < cap(r.events) {
+		return append([]ErrorEvent(nil), r.events...)
+	}
+	return append(append([]ErrorEvent(nil), r.events[r.next:]...), r.events[:r.next]...)
+}
@@ -0,0 +1,36 @@
+package server
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestErrorRing_EvictsOldest validates ordering, eviction of the oldest events once
+// full, and truncation of long lines.
+func TestErrorRing_EvictsOldest(t *testing.T) {
+	ring := newErrorRing(3)
+	if events := ring.snapshot(); len(events) != 0 {
+		t.Fatalf("expected empty ring, got %v", events)
+	}
+
+	for i, line := range []string{"a\n", "b\n", "c\n", "d\n", "e\n"} {
+		ring.add(uint64(i), line, "reason")
+	}
+	events := ring.snapshot()
+	var lines []string
+	for _, event := range events {
+		lines = append(lines, event.Line)
+	}
+	if strings.Join(lines, ",") != "c,d,e" {
+		t.Errorf("expected oldest events evicted leaving c,d,e, got %v", lines)
+	}
+	if events[0].ConnID != 2 {
+		t.Errorf("expected conn id 2 for oldest retained event, got %d", events[0].ConnID)
+	}
+
+	ring.add(9, strings.Repeat("x", recentErrorLineLimit*2)+"\n", "too long")
+	events = ring.snapshot()
+	if last := events[len(events)-1]; len(last.Line) != recentErrorLineLimit {
+		t.Errorf("expected line truncated to %d bytes, got %d", recentErrorLineLimit, len(last.Line))
+	}
+}
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"bufio"
+	"net"
+	"time"
+
+	"package-indexer/internal/wire"
+)
+
+// responseWriter is the single path replies take to a client. It applies the
+// connection's multi-line framing, buffers each reply whole and flushes it in one
+// write under a fresh write deadline.
+type responseWriter struct {
+	conn    net.Conn
+	buf     *bufio.Writer
+	framing wire.Framing
+	timeout time.Duration // Write deadline per reply (0 disables)
+}
+
+// newResponseWriter creates a writer for conn using the given framing and per-reply
+// write deadline
+func newResponseWriter(conn net.Conn, framing wire.Framing, timeout time.Duration) *responseWriter {
+	return &responseWriter{conn: conn, buf: bufio.NewWriter(conn), framing: framing, timeout: timeout}
+}
+
+// newResponseWriter creates the writer for a client connection
+func (s *Server) newResponseWriter(conn net.Conn) *responseWriter {
+	return newResponseWriter(conn, s.config.Framing, s.readTimeout)
+}
+
+// write sends a complete reply, with the write deadline covering the whole flush
+func (w *responseWriter) write(reply wire.Reply) error {
+	if w.timeout > 0 {
+		if err := w.conn.SetWriteDeadline(time.Now().Add(w.timeout)); err != nil {
+			return err
+		}
+	}
+	if _, err := reply.WriteFramed(w.buf, w.framing); err != nil {
+		return err
+	}
+	return w.buf.Flush()
+}
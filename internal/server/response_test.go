@@ -0,0 +1,46 @@
+package server
+
+import (
+	"bufio"
+	"net"
+	"testing"
+
+	"package-indexer/internal/wire"
+)
+
+// TestResponseWriter validates single-line and multi-line output. Every reply must be
+// readable as soon as it is written, before the next one is sent.
+func TestResponseWriter(t *testing.T) {
+	replies := []struct {
+		reply    wire.Reply
+		expected []string
+	}{
+		{wire.NewReply(wire.OK), []string{"OK\n"}},
+		{wire.Reply{Code: wire.OK, Lines: []string{"a", "b"}}, []string{"OK\n", "a\n", "b\n", "\n"}},
+		{wire.Reply{Code: wire.FAIL, Detail: "hash=abc"}, []string{"FAIL hash=abc\n"}},
+	}
+
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+	w := newResponseWriter(serverConn, wire.FramingBlankLine, DefaultReadTimeout)
+	reader := bufio.NewReader(clientConn)
+
+	for _, test := range replies {
+		errCh := make(chan error, 1)
+		go func() { errCh <- w.write(test.reply) }()
+
+		for _, want := range test.expected {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				t.Fatalf("failed to read reply line: %v", err)
+			}
+			if line != want {
+				t.Errorf("expected %q, got %q", want, line)
+			}
+		}
+		if err := <-errCh; err != nil {
+			t.Errorf("write failed: %v", err)
+		}
+	}
+}
@@ -6,10 +6,14 @@ package server
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net"
+	"runtime"
+	"runtime/debug"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -24,33 +28,184 @@ var nextConnID uint64
 // Server manages TCP connections using a goroutine-per-connection model.
 // Provides natural connection lifecycle management, scaling to 100+ concurrent clients.
 type Server struct {
-	indexer     *indexer.Indexer
-	addr        string
-	listener    net.Listener
-	wg          sync.WaitGroup // Tracks active connections for graceful shutdown
-	mu          sync.Mutex
-	ctx         context.Context
-	cancel      context.CancelFunc
-	metrics     *Metrics
-	ready       chan bool // Signals when the listener is ready for connections
-	isReady     atomic.Bool
-	readTimeout time.Duration // Configurable per-read deadline to prevent slowloris attacks
+	indexer      indexer.PackageStore
+	addr         string
+	listener     net.Listener   // Primary listener
+	listeners    []net.Listener // All active listeners, including the primary
+	wg           sync.WaitGroup // Tracks active connections for graceful shutdown
+	loops        sync.WaitGroup // Running accept loops; StartWithContext returns once all have exited
+	mu           sync.Mutex
+	ctx          context.Context
+	cancel       context.CancelFunc
+	metrics      MetricsRecorder
+	ready        chan bool             // Signals when the listener is ready for connections
+	onReady      []func(addr net.Addr) // Callbacks invoked with each bound address once listening
+	isReady      atomic.Bool
+	readTimeout  time.Duration // Configurable per-read deadline to prevent slowloris attacks
+	config       Config
+	shedder      *loadShedder // Rejects new connections while command latency is too high (nil if disabled)
+	globalLimit  *rateLimiter // Command rate limit shared by all connections (nil if disabled)
+	parser       wire.Parser
+	allowed      map[wire.CommandType]bool // Commands permitted by Config.AllowCommands (nil permits all)
+	denied       map[wire.CommandType]bool // Commands refused by Config.DenyCommands
+	cache        *resultCache              // Replies to read-only commands for the current graph version (nil if disabled)
+	commandHook  func(cmd *wire.Command)   // Invoked before executing each parsed command; used by tests to simulate slow operations
+	connsMu      sync.Mutex
+	conns        map[uint64]trackedConn // Registry of open client connections, force-closed when shutdown times out
+	recentErrors *errorRing             // Latest ERROR replies for the admin /errors endpoint
+	activeConns  atomic.Int64           // Connections currently being served
+	lastSoftWarn atomic.Int64           // Unix nanoseconds of the last soft connection limit warning
+	probeMu      sync.Mutex
+	probe        *indexerProbe // Store health probe in flight (nil if none)
+}
+
+// Config holds the tunable server options. Zero values preserve the default behavior,
+// so callers only need to set the options they care about.
+type Config struct {
+	Addr             string               // TCP listen address
+	Network          string               // Listen network: "tcp" (default, dual-stack where supported), "tcp4" or "tcp6"
+	Backlog          int                  // Accept queue size for bound listeners (0 keeps the OS default; capped by the kernel)
+	AdditionalAddrs  []string             // Extra addresses served alongside Addr (e.g. internal + external interfaces)
+	ReadTimeout      time.Duration        // Per-read deadline to prevent slowloris attacks
+	IndexReadTimeout time.Duration        // Deadline for the rest of an INDEX line once its command name arrives (0 uses ReadTimeout)
+	QueryReadTimeout time.Duration        // Deadline for the rest of a QUERY line once its command name arrives (0 uses ReadTimeout)
+	MaxConnLifetime  time.Duration        // Close connections this old once their current command completes (0 disables)
+	TCPNoDelay       bool                 // Explicitly disable Nagle's algorithm on accepted TCP connections
+	Verbose          bool                 // Include detail payloads (e.g. dependency counts) in replies
+	StrictDeps       bool                 // Reject empty dependency slots (e.g. "b,,c") with ERROR
+	EscapedNames     bool                 // Accept backslash-escaped separators inside names (e.g. `a\|b`)
+	LabeledDeps      bool                 // Accept required/optional edge labels on INDEX dependencies (e.g. "db:optional")
+	RequestIDs       bool                 // Accept an "ID:<id> " command prefix, echoed in the reply and the command log
+	MaxPipelineDepth int                  // Read up to this many commands ahead of replies, then pause reading (0 serves one at a time)
+	CommandTimeout   time.Duration        // Maximum time a single command may take before ERROR is returned (0 disables)
+	Store            indexer.PackageStore // Backing package store (defaults to a new in-memory Indexer)
+	Metrics          MetricsRecorder      // Operational metrics sink (defaults to a new Metrics)
+	Framing          wire.Framing         // End-of-body marker for multi-line replies (default blank line)
+	CommandLog       *slog.Logger         // Per-command access log, one record per command (nil disables)
+	MaxGoroutines    int                  // Refuse new connections while the process runs this many goroutines (0 disables)
+	MaxConns         int                  // Hard cap on concurrently served connections; extras get ERROR and are closed (0 disables)
+	SoftMaxConns     int                  // Warn (rate-limited) while active connections exceed this, still accepting (0 disables)
+	RateLimitPerConn float64              // Commands per second each connection may run; extras get ERROR (0 disables)
+	RateLimitGlobal  float64              // Commands per second across all connections; extras get ERROR (0 disables)
+	MaxPackages      int                  // Cap on distinct indexed packages for the default Store; new packages FAIL once reached (0 disables)
+	EvictLRU         bool                 // At MaxPackages, evict the least recently used dependent-free package instead of failing
+	RejectCycles     bool                 // FAIL an INDEX or ADDDEP on the default Store that would create a dependency cycle
+
+	// AllowCommands, when non-empty, restricts the server to the listed command types;
+	// DenyCommands refuses the listed types even if allowed. A refused command gets ERROR
+	// without reaching the store, e.g. denying INDEX and REMOVE for a read-only server.
+	AllowCommands []wire.CommandType
+	DenyCommands  []wire.CommandType
+
+	// ResultCacheSize caches up to this many replies to QUERY, STATUS, EDGES, DEPTH and
+	// PATH, valid until the store's graph version changes. Cache hits skip the store, so
+	// they do not count as store queries or refresh LRU recency; the cache is therefore
+	// not used with EvictLRU. Zero disables.
+	ResultCacheSize int
+
+	// ReadOnly refuses every command that can change the index with "ERROR read-only",
+	// e.g. for a replica serving reads from a preloaded snapshot. It applies on top of
+	// AllowCommands and DenyCommands.
+	ReadOnly bool
+
+	// ShedLatencyThreshold enables overload shedding: while the p99 of recent command
+	// latencies exceeds it, new connections receive ERROR and are closed. Zero disables.
+	ShedLatencyThreshold time.Duration
+
+	// AdaptiveReadTimeout replaces the fixed ReadTimeout between commands with a
+	// per-connection timeout of a few times the client's smoothed inter-command gap,
+	// starting at ReadTimeout and clamped to [MinReadTimeout, MaxReadTimeout]. Steadily
+	// slow clients are not dropped prematurely. The timeout only tightens below
+	// ReadTimeout when MinReadTimeout is set lower; zero keeps ReadTimeout as the floor,
+	// so a bursty client that pauses is treated no worse than with a fixed timeout.
+	AdaptiveReadTimeout bool
+	MinReadTimeout      time.Duration
+	MaxReadTimeout      time.Duration
+
+	// ShutdownReadinessDelay keeps the server ready and accepting for this long after
+	// Shutdown is called, so load balancers notice the pending shutdown and stop routing
+	// before connections are drained. Zero marks the server not ready immediately.
+	ShutdownReadinessDelay time.Duration
 }
 
 // Default timeout configuration constants
 const (
-	DefaultReadTimeout = 30 * time.Second // Default per-read deadline to prevent slowloris attacks
+	DefaultReadTimeout = 30 * time.Second       // Default per-read deadline to prevent slowloris attacks
+	rejectWriteTimeout = time.Second            // Bounds the write of a rejection response
+	forceCloseGrace    = 500 * time.Millisecond // Wait for handlers after force-closing lingering connections
+	softLimitWarnEvery = 10 * time.Second       // Minimum interval between soft connection limit warnings
 )
 
+// DefaultMaxReadTimeout is the default ceiling of the adaptive read timeout (zero in
+// Config means no ceiling)
+const DefaultMaxReadTimeout = 5 * time.Minute
+
 // NewServer creates a new server instance
 func NewServer(addr string, readTimeout time.Duration) *Server {
-	return &Server{
-		indexer:     indexer.NewIndexer(),
-		addr:        addr,
-		metrics:     NewMetrics(),
-		ready:       make(chan bool),
-		readTimeout: readTimeout,
+	return NewServerWithConfig(Config{Addr: addr, ReadTimeout: readTimeout})
+}
+
+// NewServerWithConfig creates a new server instance with the full set of tunable options
+func NewServerWithConfig(cfg Config) *Server {
+	s := &Server{
+		indexer:      cfg.Store,
+		addr:         cfg.Addr,
+		metrics:      cfg.Metrics,
+		ready:        make(chan bool),
+		readTimeout:  cfg.ReadTimeout,
+		config:       cfg,
+		parser:       wire.Parser{Strict: cfg.StrictDeps, Escapes: cfg.EscapedNames, Labels: cfg.LabeledDeps},
+		conns:        make(map[uint64]trackedConn),
+		recentErrors: newErrorRing(RecentErrorsCapacity),
+	}
+	if s.metrics == nil {
+		s.metrics = NewMetrics()
+	}
+	if s.indexer == nil {
+		var idx *indexer.Indexer
+		if cfg.EvictLRU && cfg.MaxPackages > 0 {
+			idx = indexer.NewIndexerWithEviction(cfg.MaxPackages)
+		} else {
+			idx = indexer.NewIndexerWithMaxPackages(cfg.MaxPackages)
+		}
+		idx.SetRejectCycles(cfg.RejectCycles)
+		s.indexer = idx
+	}
+	if cfg.ShedLatencyThreshold > 0 {
+		s.shedder = newLoadShedder(cfg.ShedLatencyThreshold)
 	}
+	if cfg.RateLimitGlobal > 0 {
+		s.globalLimit = newRateLimiter(cfg.RateLimitGlobal)
+	}
+	if len(cfg.AllowCommands) > 0 {
+		s.allowed = commandSet(cfg.AllowCommands)
+	}
+	s.denied = commandSet(cfg.DenyCommands)
+	if cfg.ResultCacheSize > 0 && !cfg.EvictLRU {
+		s.cache = newResultCache(cfg.ResultCacheSize)
+	}
+	return s
+}
+
+// commandSet converts a list of command types into a lookup set
+func commandSet(types []wire.CommandType) map[wire.CommandType]bool {
+	set := make(map[wire.CommandType]bool, len(types))
+	for _, ct := range types {
+		set[ct] = true
+	}
+	return set
+}
+
+// commandPermitted reports whether read-only mode and the allow and deny lists let a
+// command type execute
+func (s *Server) commandPermitted(ct wire.CommandType) bool {
+	if s.config.ReadOnly && ct.Mutates() {
+		return false
+	}
+	if s.allowed != nil && !s.allowed[ct] {
+		return false
+	}
+	return !s.denied[ct]
 }
 
 // Start begins listening for connections on the configured address
@@ -58,51 +213,238 @@ func (s *Server) Start() error {
 	return s.StartWithContext(context.Background())
 }
 
-// StartWithContext begins listening for connections with context support for graceful shutdown
+// StartWithContext begins listening for connections with context support for graceful shutdown.
+// Every configured address gets its own accept loop; all loops share the indexer, metrics,
+// and WaitGroup so shutdown drains them together.
 func (s *Server) StartWithContext(ctx context.Context) error {
 	s.mu.Lock()
 	s.ctx, s.cancel = context.WithCancel(ctx)
 	localCtx := s.ctx
 	s.mu.Unlock()
 
-	l, err := net.Listen("tcp", s.addr)
+	listeners, err := s.openListeners()
 	if err != nil {
 		close(s.ready) // Signal readiness even on failure to unblock tests
-		return fmt.Errorf("failed to listen on %s: %w", s.addr, err)
+		return err
 	}
 	s.mu.Lock()
-	s.listener = l
+	s.listener = listeners[0]
+	s.listeners = listeners
 	s.mu.Unlock()
+
+	// Register the accept loops before signalling readiness so a Shutdown racing with
+	// startup never observes an empty WaitGroup while loops are still being added
+	s.wg.Add(len(listeners))
+	s.notifyReady(listeners)
 	s.isReady.Store(true)
 	close(s.ready) // Signal that the listener is ready
+	sdNotify(notifyReady)
 
-	// Close the listener when context is cancelled to unblock Accept
+	// Close the listeners when context is cancelled to unblock Accept
 	go func() {
 		<-localCtx.Done()
-		s.mu.Lock()
-		ln := s.listener
+		s.closeListeners()
+	}()
+
+	s.loops.Add(len(listeners))
+	for _, l := range listeners {
+		slog.Info("Package indexer server listening", "addr", l.Addr().String())
+		go s.runAcceptLoop(localCtx, l)
+	}
+	s.loops.Wait()
+	return nil // Graceful shutdown
+}
+
+// runAcceptLoop serves one listener until it is closed; the caller has already added the
+// loop to both wg and loops
+func (s *Server) runAcceptLoop(ctx context.Context, l net.Listener) {
+	defer s.loops.Done()
+	defer s.wg.Done()
+	s.acceptLoop(ctx, l)
+}
+
+// Rebind replaces the primary listener with one bound to addr without dropping existing
+// connections, e.g. when a config reload changes the listen address. The new listener
+// starts accepting before the old one is closed, so there is no window in which neither
+// accepts; connections accepted by the old listener keep being served. Additional
+// listeners are left untouched.
+func (s *Server) Rebind(addr string) error {
+	s.mu.Lock()
+	ctx, old := s.ctx, s.listener
+	s.mu.Unlock()
+	if ctx == nil || old == nil {
+		return errors.New("server is not listening")
+	}
+
+	l, err := s.listen(addr)
+	if err != nil {
+		return err
+	}
+
+	// Install the new listener under mu and only while the server is still running, so a
+	// concurrent Shutdown either sees it in closeListeners or makes the rebind fail
+	s.mu.Lock()
+	if ctx.Err() != nil {
 		s.mu.Unlock()
+		_ = l.Close()
+		return errors.New("server is shutting down")
+	}
+	s.addr = addr
+	s.listener = l
+	for i, ln := range s.listeners {
+		if ln == old {
+			s.listeners[i] = l
+		}
+	}
+	s.wg.Add(1)
+	s.loops.Add(1)
+	s.mu.Unlock()
+
+	slog.Info("Package indexer server rebound", "from", old.Addr().String(), "to", l.Addr().String())
+	go s.runAcceptLoop(ctx, l)
+
+	// Closing the old listener ends its accept loop
+	if err := old.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+		slog.Warn("Error closing replaced listener", "error", err)
+	}
+	return nil
+}
+
+// openListeners returns listeners inherited from a parent process when present, and
+// otherwise binds every configured address. On failure, already-opened listeners are closed.
+func (s *Server) openListeners() ([]net.Listener, error) {
+	inherited, err := inheritedListeners()
+	if err != nil {
+		return nil, err
+	}
+	if len(inherited) > 0 {
+		return inherited, nil
+	}
+
+	listeners := make([]net.Listener, 0, 1+len(s.config.AdditionalAddrs))
+	for _, addr := range s.listenAddrs() {
+		l, err := s.listen(addr)
+		if err != nil {
+			for _, opened := range listeners {
+				_ = opened.Close()
+			}
+			return nil, err
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
+
+// listen binds a single address on the configured network, applying the configured backlog
+func (s *Server) listen(addr string) (net.Listener, error) {
+	l, err := net.Listen(s.network(), addr)
+	if err == nil && s.config.Backlog > 0 {
+		if err = setBacklog(l, s.config.Backlog); err != nil {
+			_ = l.Close()
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+	return l, nil
+}
+
+// listenAddrs returns the primary address followed by any additional listen addresses
+func (s *Server) listenAddrs() []string {
+	return append([]string{s.addr}, s.config.AdditionalAddrs...)
+}
+
+// network returns the configured listen network, defaulting to dual-stack "tcp"
+func (s *Server) network() string {
+	if s.config.Network == "" {
+		return "tcp"
+	}
+	return s.config.Network
+}
+
+// closeListeners closes every active listener to unblock their accept loops
+func (s *Server) closeListeners() {
+	s.mu.Lock()
+	listeners := append([]net.Listener{s.listener}, s.listeners...)
+	s.mu.Unlock()
+	for _, ln := range listeners {
 		if ln != nil {
 			_ = ln.Close()
 		}
-	}()
-
-	slog.Info("Package indexer server listening", "addr", s.addr)
+	}
+}
 
+// acceptLoop accepts connections from a single listener until the context is cancelled
+// or the listener is closed (e.g. replaced by Rebind)
+func (s *Server) acceptLoop(ctx context.Context, l net.Listener) {
 	for {
 		conn, err := l.Accept()
 		if err != nil {
 			select {
-			case <-s.ctx.Done():
-				return nil // Graceful shutdown
+			case <-ctx.Done():
+				return // Graceful shutdown
 			default:
+				if errors.Is(err, net.ErrClosed) {
+					return
+				}
 				slog.Warn("Failed to accept connection", "error", err)
 				continue
 			}
 		}
 
+		if s.shedder != nil && s.shedder.isShedding() {
+			s.metrics.IncrementServerOverloaded()
+			s.rejectConnection(conn)
+			continue
+		}
+
+		// Crude backstop against runaway goroutine growth under an accept flood
+		if s.config.MaxGoroutines > 0 && runtime.NumGoroutine() >= s.config.MaxGoroutines {
+			s.metrics.IncrementGoroutineRejected()
+			s.rejectConnection(conn)
+			continue
+		}
+
+		active := s.activeConns.Load()
+		if s.config.MaxConns > 0 && active >= int64(s.config.MaxConns) {
+			s.metrics.IncrementConnsRejected()
+			s.rejectConnection(conn)
+			continue
+		}
+		if s.config.SoftMaxConns > 0 && active >= int64(s.config.SoftMaxConns) {
+			s.warnSoftLimit(active + 1)
+		}
+
+		s.activeConns.Add(1)
 		s.wg.Add(1)
-		go s.handleConnection(conn)
+		go func() {
+			defer s.activeConns.Add(-1)
+			s.handleConnection(conn)
+		}()
+	}
+}
+
+// warnSoftLimit counts a connection accepted above the soft limit and logs a warning at
+// most once per softLimitWarnEvery, giving operators headroom visibility without log spam
+func (s *Server) warnSoftLimit(active int64) {
+	s.metrics.IncrementSoftLimitWarnings()
+	now := time.Now().UnixNano()
+	last := s.lastSoftWarn.Load()
+	if now-last < int64(softLimitWarnEvery) || !s.lastSoftWarn.CompareAndSwap(last, now) {
+		return
+	}
+	slog.Warn("Active connections above soft limit",
+		"active", active,
+		"softLimit", s.config.SoftMaxConns,
+		"hardLimit", s.config.MaxConns,
+	)
+}
+
+// rejectConnection sends a fast ERROR to a connection that will not be served and closes it
+func (s *Server) rejectConnection(conn net.Conn) {
+	_ = newResponseWriter(conn, s.config.Framing, rejectWriteTimeout).write(wire.NewReply(wire.ERROR))
+	if err := conn.Close(); err != nil {
+		slog.Warn("Error closing rejected connection", "error", err)
 	}
 }
 
@@ -110,18 +452,102 @@ func (s *Server) StartWithContext(ctx context.Context) error {
 func (s *Server) handleConnection(conn net.Conn) {
 	defer s.wg.Done()
 	defer func() {
-		if err := conn.Close(); err != nil {
+		if err := conn.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
 			slog.Warn("Error closing connection", "error", err)
 		}
 	}()
 
+	if s.config.TCPNoDelay {
+		setNoDelay(conn)
+	}
+
 	connID := atomic.AddUint64(&nextConnID, 1)
-	s.serveConn(s.ctx, conn, connID)
+	started := time.Now()
+	s.trackConn(connID, conn, started)
+	defer s.untrackConn(connID)
+	defer s.recoverConnPanic(connID)
+	s.serveConn(s.ctx, conn, connID, started)
+}
+
+// trackedConn is a connection registry entry
+type trackedConn struct {
+	conn    net.Conn
+	started time.Time // When the handler picked the connection up, for connection age
+}
+
+// trackConn registers an open connection so shutdown can force-close it
+func (s *Server) trackConn(connID uint64, conn net.Conn, started time.Time) {
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+	s.conns[connID] = trackedConn{conn: conn, started: started}
+}
+
+// untrackConn removes a connection from the registry once its handler exits
+func (s *Server) untrackConn(connID uint64) {
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+	delete(s.conns, connID)
+}
+
+// forceCloseConnections closes every registered connection to unblock handlers still
+// reading or writing, returning the number of connections closed
+func (s *Server) forceCloseConnections() int {
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+	for connID, tracked := range s.conns {
+		if err := tracked.conn.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+			slog.Warn("Error force-closing connection", "connID", connID, "error", err)
+		}
+	}
+	return len(s.conns)
+}
+
+// handlerPanic carries a panic raised on a helper goroutine (e.g. a timed command) back
+// to the connection goroutine together with the stack trace of its origin
+type handlerPanic struct {
+	value interface{}
+	stack []byte
+}
+
+// recoverConnPanic recovers a panic in a connection handler, logging it with its stack
+// trace and counting it, so one bad command closes only its own connection
+func (s *Server) recoverConnPanic(connID uint64) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	value, stack := r, debug.Stack()
+	if hp, ok := r.(*handlerPanic); ok {
+		value, stack = hp.value, hp.stack
+	}
+	s.metrics.IncrementPanicsRecovered()
+	slog.Error("Recovered panic in connection handler",
+		"connID", connID,
+		"panic", fmt.Sprint(value),
+		"stack", string(stack),
+	)
+}
+
+// noDelayConn is implemented by connections that support toggling Nagle's algorithm,
+// such as *net.TCPConn. Other connection types (e.g. net.Pipe) are left untouched.
+type noDelayConn interface {
+	SetNoDelay(noDelay bool) error
+}
+
+// setNoDelay disables Nagle's algorithm on TCP connections so small responses are sent
+// immediately. Go enables TCP_NODELAY by default; setting it explicitly keeps latency
+// behavior independent of runtime defaults.
+func setNoDelay(conn net.Conn) {
+	if tc, ok := conn.(noDelayConn); ok {
+		if err := tc.SetNoDelay(true); err != nil {
+			slog.Warn("Failed to set TCP_NODELAY", "error", err)
+		}
+	}
 }
 
 // serveConn contains the core connection processing loop with newline framing,
 // read deadline enforcement, and graceful shutdown coordination.
-func (s *Server) serveConn(ctx context.Context, conn net.Conn, connID uint64) {
+func (s *Server) serveConn(ctx context.Context, conn net.Conn, connID uint64, started time.Time) {
 	clientAddr := conn.RemoteAddr().String()
 	logger := slog.With("connID", connID, "clientAddr", clientAddr)
 
@@ -129,102 +555,614 @@ func (s *Server) serveConn(ctx context.Context, conn net.Conn, connID uint64) {
 
 	s.metrics.IncrementConnections()
 
+	// Connections past their maximum lifetime are closed between commands; read
+	// deadlines never extend beyond the expiry so idle connections close on time too
+	var expires time.Time
+	if s.config.MaxConnLifetime > 0 {
+		expires = started.Add(s.config.MaxConnLifetime)
+	}
+
+	// Idle timeout between commands: fixed, or adapted to the client's pace
+	readTimeout := s.readTimeout
+	var adaptive *adaptiveDeadline
+	if s.config.AdaptiveReadTimeout {
+		floor := s.config.MinReadTimeout
+		if floor == 0 {
+			floor = s.readTimeout // Tightening below the fixed timeout is opt-in
+		}
+		adaptive = newAdaptiveDeadline(s.readTimeout, floor, s.config.MaxReadTimeout, started)
+		readTimeout = adaptive.timeout()
+	}
+
+	var connLimit *rateLimiter
+	if s.config.RateLimitPerConn > 0 {
+		connLimit = newRateLimiter(s.config.RateLimitPerConn)
+	}
+
 	// Initial deadline to prevent slowloris attacks
-	s.setConnectionDeadline(conn, logger, "initial")
+	s.setConnectionDeadline(conn, logger, "initial", readTimeout, expires)
 
 	reader := bufio.NewReader(conn)
+	out := s.newResponseWriter(conn) // Coalesces multi-line replies into a single write
 
-	// Graceful shutdown coordination: Background goroutine monitors for context cancellation
-	// and closes connection to unblock ReadString(), enabling clean shutdown under load
-	doneCh := make(chan struct{})
-	defer close(doneCh) // Ensure the goroutine exits to prevent resource leaks
-	go func() {
-		select {
-		case <-ctx.Done():
-			_ = conn.Close()
-		case <-doneCh:
-		}
-	}()
+	// Graceful shutdown coordination: closing the connection once the context is cancelled
+	// unblocks ReadString(), enabling clean shutdown under load. AfterFunc only starts a
+	// goroutine after cancellation, and stop unregisters it when the connection ends
+	// first, so no per-connection monitor can outlive its connection even if Close blocks.
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	defer stop()
 
-	for {
+	// read is the only path that reads the connection (and its deadlines and adaptive
+	// timeout); with a pipeline window it runs on the window's goroutine
+	read := func() commandRead {
 		// Reset deadline on each read
-		s.setConnectionDeadline(conn, logger, "reset")
+		s.setConnectionDeadline(conn, logger, "reset", readTimeout, expires)
 
-		// Read line from client
+		// Read line from client. bufio.Reader only returns without error once it has seen
+		// the delimiter, so zero-length conn reads (e.g. empty writes on net.Pipe) never
+		// surface as an empty line; a lone "\n" is a real empty command and gets one ERROR.
+		s.applyCommandDeadline(conn, reader, logger, expires)
 		line, err := reader.ReadString('\n')
-		if err != nil {
+		res := commandRead{line: line, err: err, timeout: readTimeout}
+		if err == nil && adaptive != nil {
+			adaptive.observe(time.Now())
+			readTimeout = adaptive.timeout()
+		}
+		return res
+	}
+	next, release := read, func() {}
+	if s.config.MaxPipelineDepth > 0 {
+		window := newReadWindow(conn, s.config.MaxPipelineDepth, read)
+		defer window.close()
+		next, release = window.next, window.release
+	}
+
+	for {
+		if !expires.IsZero() && !time.Now().Before(expires) {
+			logger.Info("Closing connection at max lifetime", "age", time.Since(started).String())
+			return
+		}
+
+		res := next()
+		line := res.line
+		if err := res.err; err != nil {
 			if err == io.EOF {
 				logger.Info("Client disconnected")
 			} else if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
-				logger.Warn("Client timeout")
+				if !expires.IsZero() && !time.Now().Before(expires) {
+					logger.Info("Closing idle connection at max lifetime", "age", time.Since(started).String())
+					return
+				}
+				logger.Warn("Client timeout", "timeout", res.timeout.String())
 			} else {
 				logger.Warn("Error reading from client", "error", err)
 			}
 			return
 		}
 
+		// Split off an optional request id so it can be echoed and logged with the command
+		cmdLogger, requestID := logger, ""
+		if s.config.RequestIDs {
+			if id, rest, found := wire.CutRequestID(line); found {
+				requestID, line = id, rest
+				cmdLogger = logger.With("requestID", id)
+			}
+		}
+
 		// Process the command and get response
 		s.metrics.IncrementCommands()
-		response := s.processCommand(logger, line)
+		start := time.Now()
+		var reply wire.Reply
+		var pending <-chan commandResult
+		if s.rateLimited(connLimit) {
+			cmdLogger.Warn("Command rate limit exceeded")
+			reply = s.rateLimitedReply()
+		} else {
+			reply, pending = s.executeRequest(cmdLogger, line)
+		}
+		reply.RequestID = requestID
+		latency := time.Since(start)
+		s.recordResponse(reply.Code)
+		s.metrics.ObserveLatency(reply.Code, latency)
+		s.metrics.AddProcessingTime(latency)
+		if reply.Code == wire.ERROR {
+			s.recordError(connID, line, reply.Err)
+		}
+		if s.shedder != nil {
+			s.shedder.observe(latency)
+		}
+		if s.config.CommandLog != nil {
+			attrs := []any{
+				"connID", connID,
+				"clientAddr", clientAddr,
+				CommandLogLineKey, strings.TrimSuffix(line, "\n"),
+				CommandLogResultKey, reply.Code.Label(),
+			}
+			if requestID != "" {
+				attrs = append(attrs, CommandLogRequestIDKey, requestID)
+			}
+			s.config.CommandLog.Info(CommandLogMessage, attrs...)
+		}
 
 		// Send response back to client
-		if _, err := conn.Write([]byte(response.String())); err != nil {
+		if err := out.write(reply); err != nil {
 			logger.Warn("Error writing response to client", "error", err)
 			return
 		}
+		s.awaitAbandoned(ctx, cmdLogger, pending)
+		release()
+	}
+}
+
+// rateLimited reports whether the connection's or the server-wide command rate limit
+// refuses the next command. A command refused per connection does not use up the
+// global allowance.
+func (s *Server) rateLimited(connLimit *rateLimiter) bool {
+	if connLimit != nil && !connLimit.allow() {
+		return true
+	}
+	return s.globalLimit != nil && !s.globalLimit.allow()
+}
+
+// rateLimitedReply is the ERROR reply to a command refused by a rate limit
+func (s *Server) rateLimitedReply() wire.Reply {
+	reply := wire.NewErrorReply(errors.New("command rate limit exceeded"))
+	if s.config.Verbose {
+		reply.Detail = "rate-limited"
+	}
+	return reply
+}
+
+// recordResponse counts a reply by response code so error ratios can be derived
+func (s *Server) recordResponse(code wire.Response) {
+	switch code {
+	case wire.OK:
+		s.metrics.IncrementResponsesOK()
+	case wire.FAIL:
+		s.metrics.IncrementResponsesFail()
+	case wire.ERROR:
+		s.metrics.IncrementResponsesError()
+	}
+}
+
+// recordError adds an ERROR reply to the recent errors buffer
+func (s *Server) recordError(connID uint64, line string, err error) {
+	reason := "unknown"
+	if err != nil {
+		reason = err.Error()
 	}
+	s.recentErrors.add(connID, line, reason)
 }
 
-// setConnectionDeadline sets the read deadline and logs any errors with context
-func (s *Server) setConnectionDeadline(conn net.Conn, logger *slog.Logger, context string) {
-	if err := conn.SetReadDeadline(time.Now().Add(s.readTimeout)); err != nil {
+// setConnectionDeadline sets the read deadline timeout from now, capped at expires when it
+// is non-zero, and logs any errors with context
+func (s *Server) setConnectionDeadline(conn net.Conn, logger *slog.Logger, context string, timeout time.Duration, expires time.Time) {
+	deadline := time.Now().Add(timeout)
+	if !expires.IsZero() && expires.Before(deadline) {
+		deadline = expires
+	}
+	if err := conn.SetReadDeadline(deadline); err != nil {
 		logger.Warn("Failed to set read deadline", "error", err, "context", context)
 	}
 }
 
-// processCommand parses and executes a single command
+// applyCommandDeadline replaces the idle read deadline with a command-specific one once
+// the command name of the next line is buffered, so a large INDEX may take longer to
+// arrive than a QUERY. Only already-buffered bytes are inspected; if the name has not
+// fully arrived yet the idle deadline stays in force. Like the idle deadline, it never
+// extends past expires when that is non-zero.
+func (s *Server) applyCommandDeadline(conn net.Conn, reader *bufio.Reader, logger *slog.Logger, expires time.Time) {
+	if s.config.IndexReadTimeout <= 0 && s.config.QueryReadTimeout <= 0 {
+		return
+	}
+	if _, err := reader.Peek(1); err != nil {
+		return // Let ReadString surface the error
+	}
+	buffered, _ := reader.Peek(reader.Buffered())
+	name, _, found := strings.Cut(string(buffered), wire.ProtocolSeparator)
+	if !found {
+		return
+	}
+	if s.config.RequestIDs {
+		_, name, _ = wire.CutRequestID(name)
+	}
+
+	var timeout time.Duration
+	switch name {
+	case wire.IndexCommand.String(), wire.IndexCASCommand.String():
+		timeout = s.config.IndexReadTimeout
+	case wire.QueryCommand.String():
+		timeout = s.config.QueryReadTimeout
+	}
+	if timeout <= 0 {
+		return
+	}
+	s.setConnectionDeadline(conn, logger, "command "+name, timeout, expires)
+}
+
+// commandResult is the outcome of a command run under the command timeout
+type commandResult struct {
+	reply wire.Reply
+	panic *handlerPanic
+}
+
+// executeRequest processes a single command, bounded by the configured command timeout.
+// A command exceeding its deadline is answered with ERROR and counted as a timeout. The
+// deadline is carried into processing, so a command that has not reached the store by
+// then is dropped; a store operation already under way cannot be interrupted and
+// finishes in the background. For a timed-out command the returned channel delivers that
+// eventual result, and the caller must settle it with awaitAbandoned before running the
+// connection's next command.
+func (s *Server) executeRequest(logger *slog.Logger, line string) (wire.Reply, <-chan commandResult) {
+	if s.config.CommandTimeout <= 0 {
+		return s.processRequest(logger, line), nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.CommandTimeout)
+	defer cancel()
+
+	done := make(chan commandResult, 1) // Buffered so an abandoned command never blocks
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- commandResult{panic: &handlerPanic{value: r, stack: debug.Stack()}}
+			}
+		}()
+		done <- commandResult{reply: s.processRequestContext(ctx, logger, line)}
+	}()
+
+	select {
+	case res := <-done:
+		if res.panic != nil {
+			panic(res.panic) // Re-raise on the connection goroutine for recoverConnPanic
+		}
+		return res.reply, nil
+	case <-ctx.Done():
+		logger.Warn("Command timeout", "timeout", s.config.CommandTimeout, "line", strings.TrimSpace(line))
+		s.metrics.IncrementCommandTimeouts()
+		return wire.NewErrorReply(fmt.Errorf("command exceeded timeout of %s", s.config.CommandTimeout)), done
+	}
+}
+
+// awaitAbandoned blocks until a timed-out command has finished, so the connection's
+// commands still run one at a time and in order. A command that completed anyway is
+// logged, since its client was already told it failed; a late panic is re-raised on the
+// connection goroutine like any other. Returns early if ctx is cancelled.
+func (s *Server) awaitAbandoned(ctx context.Context, logger *slog.Logger, pending <-chan commandResult) {
+	if pending == nil {
+		return
+	}
+	select {
+	case res := <-pending:
+		if res.panic != nil {
+			panic(res.panic)
+		}
+		logger.Warn("Timed-out command completed", "result", res.reply.Code.Label())
+	case <-ctx.Done():
+	}
+}
+
+// processCommand parses and executes a single command, returning only the response code
 func (s *Server) processCommand(logger *slog.Logger, line string) wire.Response {
+	return s.processRequest(logger, line).Code
+}
+
+// processRequest parses and executes a single command, returning the full reply
+// including any verbose-mode detail
+func (s *Server) processRequest(logger *slog.Logger, line string) wire.Reply {
+	return s.processRequestContext(context.Background(), logger, line)
+}
+
+// processRequestContext is processRequest for a command with a deadline: once ctx is
+// done the command is answered with ERROR instead of reaching the store
+func (s *Server) processRequestContext(ctx context.Context, logger *slog.Logger, line string) wire.Reply {
 	// Parse the command
-	cmd, err := wire.ParseCommand(line)
+	cmd, err := s.parser.Parse(line)
 	if err != nil {
 		logger.Warn("Parse error", "error", err, "line", strings.TrimSpace(line))
 		s.metrics.IncrementErrors()
-		return wire.ERROR
+		reply := wire.NewErrorReply(err)
+		if s.config.Verbose {
+			reply.Detail = wire.ParseErrorLabel(err)
+		}
+		return reply
 	}
 
 	logger = logger.With("cmd", cmd.Type, "pkg", cmd.Package)
 
-	// Execute the command
+	if !s.commandPermitted(cmd.Type) {
+		logger.Warn("Command not permitted")
+		s.metrics.IncrementErrors()
+		reply := wire.NewErrorReply(fmt.Errorf("command %s is not permitted", cmd.Type))
+		if s.config.ReadOnly && cmd.Type.Mutates() {
+			reply.Detail = "read-only"
+		} else if s.config.Verbose {
+			reply.Detail = "forbidden"
+		}
+		return reply
+	}
+
+	if s.commandHook != nil {
+		s.commandHook(cmd)
+	}
+	if err := ctx.Err(); err != nil {
+		return wire.NewErrorReply(fmt.Errorf("command abandoned before execution: %w", err))
+	}
+
+	// Serve read-only commands from the cache while the graph is unchanged; the version
+	// is read first so a reply racing a mutation is never cached under the newer version
+	if s.cache != nil {
+		if key, ok := cacheKey(cmd); ok {
+			version := s.indexer.Version()
+			if reply, hit := s.cache.get(version, key); hit {
+				s.metrics.IncrementResultCacheHits()
+				return reply
+			}
+			s.metrics.IncrementResultCacheMisses()
+			reply := s.executeCommand(logger, cmd)
+			s.cache.put(version, key, reply)
+			return reply
+		}
+	}
+	return s.executeCommand(logger, cmd)
+}
+
+// executeCommand runs a parsed, permitted command against the store
+func (s *Server) executeCommand(logger *slog.Logger, cmd *wire.Command) wire.Reply {
 	switch cmd.Type {
 	case wire.IndexCommand:
+		if cmd.Labels != nil {
+			return s.indexLabeled(logger, cmd)
+		}
+		if s.config.Verbose {
+			missing, ok := s.indexer.IndexPackageMissing(cmd.Package, cmd.Dependencies)
+			if ok {
+				s.metrics.IncrementPackages()
+				return wire.NewReply(wire.OK)
+			}
+			if len(missing) > 0 {
+				return wire.Reply{Code: wire.FAIL, Detail: "missing: " + strings.Join(missing, wire.DependencySeparator)}
+			}
+			return wire.NewReply(wire.FAIL)
+		}
 		if s.indexer.IndexPackage(cmd.Package, cmd.Dependencies) {
 			s.metrics.IncrementPackages()
-			return wire.OK
+			return wire.NewReply(wire.OK)
 		}
-		return wire.FAIL
+		return wire.NewReply(wire.FAIL)
+
+	case wire.IndexCASCommand:
+		hash, ok := s.indexer.IndexPackageCAS(cmd.Package, cmd.Dependencies, cmd.ExpectedHash)
+		if ok {
+			s.metrics.IncrementPackages()
+			return wire.Reply{Code: wire.OK, Detail: "hash=" + hash}
+		}
+		if hash == "" {
+			return wire.NewReply(wire.FAIL)
+		}
+		return wire.Reply{Code: wire.FAIL, Detail: "hash=" + hash}
 
 	case wire.RemoveCommand:
 		switch s.indexer.RemovePackage(cmd.Package) {
 		case indexer.RemoveResultOK, indexer.RemoveResultNotIndexed:
-			return wire.OK
-		case indexer.RemoveResultBlocked:
-			return wire.FAIL
+			return wire.NewReply(wire.OK)
+		case indexer.RemoveResultBlocked, indexer.RemoveResultPinned:
+			return wire.NewReply(wire.FAIL)
+		}
+		return wire.NewErrorReply(fmt.Errorf("unexpected remove result")) // Should be unreachable
+
+	case wire.CanRemoveCommand:
+		if s.indexer.CanRemove(cmd.Package) {
+			return wire.NewReply(wire.OK)
 		}
-		return wire.ERROR // Should be unreachable
+		return wire.NewReply(wire.FAIL)
+
+	case wire.PinCommand:
+		if s.indexer.PinPackage(cmd.Package) {
+			return wire.NewReply(wire.OK)
+		}
+		return wire.NewReply(wire.FAIL)
+
+	case wire.UnpinCommand:
+		s.indexer.UnpinPackage(cmd.Package)
+		return wire.NewReply(wire.OK)
 
 	case wire.QueryCommand:
+		if s.config.Verbose {
+			if count, ok := s.indexer.DependencyCount(cmd.Package); ok {
+				return wire.Reply{Code: wire.OK, Detail: fmt.Sprintf("deps=%d", count)}
+			}
+			return wire.NewReply(wire.FAIL)
+		}
 		if s.indexer.QueryPackage(cmd.Package) {
-			return wire.OK
+			return wire.NewReply(wire.OK)
+		}
+		return wire.NewReply(wire.FAIL)
+
+	case wire.AddDepCommand:
+		if s.indexer.AddDependencies(cmd.Package, cmd.Dependencies) {
+			return wire.NewReply(wire.OK)
+		}
+		return wire.NewReply(wire.FAIL)
+
+	case wire.RmDepCommand:
+		if s.indexer.RemoveDependencies(cmd.Package, cmd.Dependencies) {
+			return wire.NewReply(wire.OK)
+		}
+		return wire.NewReply(wire.FAIL)
+
+	case wire.RenameCommand:
+		if s.indexer.RenamePackage(cmd.Package, cmd.NewName) {
+			return wire.NewReply(wire.OK)
+		}
+		return wire.NewReply(wire.FAIL)
+
+	case wire.SearchCommand:
+		return wire.Reply{Code: wire.OK, Lines: s.indexer.Search(cmd.Package)}
+
+	case wire.EdgesCommand:
+		deps, dependents, ok := s.indexer.Edges(cmd.Package)
+		if !ok {
+			return wire.NewReply(wire.FAIL)
 		}
-		return wire.FAIL
+		return wire.Reply{Code: wire.OK, Lines: []string{
+			"DEPS: " + strings.Join(deps, wire.DependencySeparator),
+			"DEPENDENTS: " + strings.Join(dependents, wire.DependencySeparator),
+		}}
+
+	case wire.CapsCommand:
+		return wire.Reply{Code: wire.OK, Detail: s.capabilities()}
+
+	case wire.BuildCommand:
+		return wire.Reply{Code: wire.OK, Detail: buildVersion(debug.ReadBuildInfo())}
+
+	case wire.GenCommand:
+		return wire.Reply{Code: wire.OK, Detail: strconv.FormatUint(s.indexer.Version(), 10)}
+
+	case wire.StatusCommand:
+		status := s.indexer.Status(cmd.Package)
+		if !status.Indexed {
+			return wire.Reply{Code: wire.OK, Detail: "indexed=false"}
+		}
+		detail := fmt.Sprintf("indexed=true deps=%d dependents=%d", status.Dependencies, status.Dependents)
+		if status.Pinned {
+			detail += " pinned=true"
+		}
+		return wire.Reply{Code: wire.OK, Detail: detail}
+
+	case wire.PathCommand:
+		if path, ok := s.indexer.FindPath(cmd.Package, cmd.Target); ok {
+			return wire.Reply{Code: wire.OK, Detail: strings.Join(path, wire.DependencySeparator)}
+		}
+		return wire.NewReply(wire.FAIL)
+
+	case wire.DepthCommand:
+		if depth, ok := s.indexer.DependencyDepth(cmd.Package); ok {
+			return wire.Reply{Code: wire.OK, Detail: strconv.Itoa(depth)}
+		}
+		return wire.NewReply(wire.FAIL)
 
 	default:
 		logger.Warn("Unknown command type")
 		s.metrics.IncrementErrors()
-		return wire.ERROR
+		return wire.NewErrorReply(fmt.Errorf("unknown command type %v", cmd.Type))
 	}
 }
 
+// indexLabeled applies an INDEX carrying edge labels, answering ERROR for a label other
+// than required or optional rather than indexing it
+func (s *Server) indexLabeled(logger *slog.Logger, cmd *wire.Command) wire.Reply {
+	for dep, label := range cmd.Labels {
+		if !indexer.ValidLabel(label) {
+			logger.Warn("Unknown dependency label", "dep", dep, "label", label)
+			s.metrics.IncrementErrors()
+			return wire.NewErrorReply(fmt.Errorf("unknown label %q on dependency %s", label, dep))
+		}
+	}
+	if s.indexer.IndexPackageLabeled(cmd.Package, cmd.Dependencies, cmd.Labels) {
+		s.metrics.IncrementPackages()
+		return wire.NewReply(wire.OK)
+	}
+	return wire.NewReply(wire.FAIL)
+}
+
+// capabilities describes the enabled command set, protocol version, and any optional
+// behavior switched on by configuration, e.g. "INDEX,REMOVE,QUERY,CAPS version=2 verbose".
+// Commands refused by the allow or deny lists are not advertised.
+func (s *Server) capabilities() string {
+	var commands []string
+	for _, ct := range []wire.CommandType{
+		wire.IndexCommand,
+		wire.RemoveCommand,
+		wire.QueryCommand,
+		wire.CapsCommand,
+		wire.StatusCommand,
+		wire.DepthCommand,
+		wire.IndexCASCommand,
+		wire.SearchCommand,
+		wire.EdgesCommand,
+		wire.RenameCommand,
+		wire.AddDepCommand,
+		wire.RmDepCommand,
+		wire.CanRemoveCommand,
+		wire.PinCommand,
+		wire.UnpinCommand,
+		wire.BuildCommand,
+		wire.PathCommand,
+		wire.GenCommand,
+	} {
+		if s.commandPermitted(ct) {
+			commands = append(commands, ct.String())
+		}
+	}
+
+	caps := []string{strings.Join(commands, ","), fmt.Sprintf("version=%d", wire.ProtocolVersion)}
+	if s.config.Verbose {
+		caps = append(caps, "verbose")
+	}
+	if s.config.StrictDeps {
+		caps = append(caps, "strict-deps")
+	}
+	if s.config.EscapedNames {
+		caps = append(caps, "escapes")
+	}
+	if s.config.LabeledDeps {
+		caps = append(caps, "labels")
+	}
+	if s.config.RequestIDs {
+		caps = append(caps, "request-ids")
+	}
+	if s.config.RejectCycles {
+		caps = append(caps, "reject-cycles")
+	}
+	if s.config.ReadOnly {
+		caps = append(caps, "readonly")
+	}
+	caps = append(caps, "framing="+s.config.Framing.String())
+	return strings.Join(caps, " ")
+}
+
+// unknownBuild stands in for build details the binary does not carry, e.g. when built
+// without module support or outside a VCS checkout
+const unknownBuild = "unknown"
+
+// buildVersion renders the main module version and VCS commit from debug.ReadBuildInfo
+// results as "<version> <commit>", the same data the /buildinfo admin endpoint reports,
+// with unknownBuild for anything unavailable
+func buildVersion(info *debug.BuildInfo, ok bool) string {
+	version, commit := unknownBuild, unknownBuild
+	if !ok || info == nil {
+		return version + " " + commit
+	}
+	if info.Main.Version != "" {
+		version = info.Main.Version
+	}
+	for _, setting := range info.Settings {
+		if setting.Key == "vcs.revision" && setting.Value != "" {
+			commit = setting.Value
+		}
+	}
+	return version + " " + commit
+}
+
+// Config returns the configuration the server was created with, e.g. so exporters can
+// publish configured limits next to observed throughput
+func (s *Server) Config() Config {
+	return s.config
+}
+
+// LatencyHistograms returns command latency histograms split by outcome (ok, fail, error)
+func (s *Server) LatencyHistograms() []LatencyHistogram {
+	return s.metrics.LatencyHistograms()
+}
+
+// MetricsEnabled reports whether the server records metrics, i.e. it was not configured
+// with NopMetrics
+func (s *Server) MetricsEnabled() bool {
+	_, nop := s.metrics.(NopMetrics)
+	return !nop
+}
+
 // GetMetrics returns a snapshot of current server metrics
 func (s *Server) GetMetrics() MetricsSnapshot {
 	return s.metrics.GetSnapshot()
@@ -238,8 +1176,40 @@ func (s *Server) GetStats() (stats struct{ Indexed int }) {
 	return
 }
 
+// SubtreeSize returns the transitive dependency and dependent counts of pkg, and whether
+// it is indexed. Used to gauge the scope of a removal before attempting it.
+func (s *Server) SubtreeSize(pkg string) (dependencies int, dependents int, ok bool) {
+	return s.indexer.SubtreeSize(pkg)
+}
+
+// OperationStats returns the backing store's own operation counters
+func (s *Server) OperationStats() indexer.OperationStats {
+	return s.indexer.OperationStats()
+}
+
+// Pinned returns the packages currently protected from removal, sorted
+func (s *Server) Pinned() []string {
+	return s.indexer.Pinned()
+}
+
+// Orphans returns the indexed packages with neither dependencies nor dependents, sorted
+func (s *Server) Orphans() []string {
+	return s.indexer.Orphans()
+}
+
+// FindCycles returns the dependency cycles currently in the index; see
+// indexer.Indexer.FindCycles
+func (s *Server) FindCycles() [][]string {
+	return s.indexer.FindCycles()
+}
+
+// RecentErrors returns the most recent ERROR replies, oldest first
+func (s *Server) RecentErrors() []ErrorEvent {
+	return s.recentErrors.snapshot()
+}
+
 // IsReady checks if the server's TCP listener is active and ready to accept connections.
-// Used by the /healthz readiness probe for production monitoring and service discovery.
+// Used by the /ready readiness probe for production monitoring and service discovery.
 func (s *Server) IsReady() bool {
 	return s.isReady.Load()
 }
@@ -250,6 +1220,39 @@ func (s *Server) Ready() <-chan bool {
 	return s.ready
 }
 
+// Addr returns the address of the primary listener, or nil before the server is bound.
+// With ":0" this is the port actually assigned by the OS.
+func (s *Server) Addr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
+}
+
+// OnReady registers a callback invoked once the server is listening, before Ready is
+// closed. It receives the actual bound address, which is useful when listening on ":0";
+// with additional addresses it is called once per listener, primary first. Callbacks
+// must be registered before StartWithContext and are not invoked if binding fails.
+func (s *Server) OnReady(f func(addr net.Addr)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onReady = append(s.onReady, f)
+}
+
+// notifyReady invokes the registered OnReady callbacks for every bound listener
+func (s *Server) notifyReady(listeners []net.Listener) {
+	s.mu.Lock()
+	callbacks := s.onReady
+	s.mu.Unlock()
+	for _, l := range listeners {
+		for _, f := range callbacks {
+			f(l.Addr())
+		}
+	}
+}
+
 // SetListener injects a listener into the server. Used for testing purposes.
 func (s *Server) SetListener(l net.Listener) {
 	s.mu.Lock()
@@ -260,23 +1263,31 @@ func (s *Server) SetListener(l net.Listener) {
 // Shutdown gracefully shuts down the server with configurable timeout
 func (s *Server) Shutdown(ctx context.Context) error {
 	slog.Info("Initiating graceful shutdown...")
+	sdNotify(notifyStopping)
 
-	// Mark server as not ready immediately when shutdown starts
-	// This ensures /healthz returns false during shutdown window
+	// Optionally keep serving as ready while load balancers catch up; an expiring
+	// context cuts the delay short
+	if delay := s.config.ShutdownReadinessDelay; delay > 0 {
+		slog.Info("Delaying readiness change before draining", "delay", delay.String())
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+		}
+	}
+
+	// Mark server as not ready before draining
+	// This ensures /ready returns 503 during shutdown window
 	s.isReady.Store(false)
 
 	s.mu.Lock()
 	cancel := s.cancel
-	ln := s.listener
 	s.mu.Unlock()
 
 	if cancel != nil {
 		cancel()
 	}
 
-	if ln != nil {
-		ln.Close()
-	}
+	s.closeListeners()
 
 	// Wait for connections to finish or timeout
 	done := make(chan struct{})
@@ -288,9 +1299,32 @@ func (s *Server) Shutdown(ctx context.Context) error {
 	select {
 	case <-done:
 		slog.Info("All connections closed gracefully")
+		s.logShutdownReport()
 		return nil
 	case <-ctx.Done():
-		slog.Warn("Shutdown timeout exceeded")
+		slog.Warn("Shutdown timeout exceeded, force-closing lingering connections",
+			"connections", s.forceCloseConnections())
+		select {
+		case <-done:
+			slog.Info("All connections closed after forced closure")
+		case <-time.After(forceCloseGrace):
+			slog.Warn("Connection handlers still running after forced closure")
+		}
+		s.logShutdownReport()
 		return ctx.Err()
 	}
 }
+
+// logShutdownReport emits a single structured record summarizing the server's lifetime,
+// giving operators a clean operational footprint at exit.
+func (s *Server) logShutdownReport() {
+	metrics := s.GetMetrics()
+	stats := s.GetStats()
+	slog.Info("Shutdown report",
+		"connectionsTotal", metrics.ConnectionsTotal,
+		"commandsProcessed", metrics.CommandsProcessed,
+		"errors", metrics.ErrorCount,
+		"packagesIndexed", stats.Indexed,
+		"uptime", metrics.Uptime.String(),
+	)
+}
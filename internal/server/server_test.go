@@ -2,17 +2,23 @@ package server
 
 import (
 	"bufio"
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"log"
 	"log/slog"
 	"net"
+	"runtime"
+	"runtime/debug"
 	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	"package-indexer/internal/indexer"
 	"package-indexer/internal/wire"
 )
 
@@ -56,6 +62,30 @@ func setupServerAndPipe(t *testing.T) (*Server, net.Conn, *bufio.Reader, func())
 	return srv, clientConn, reader, cleanup
 }
 
+// leakSettleTimeout bounds how long exiting goroutines get to finish before a leak is reported
+const leakSettleTimeout = 2 * time.Second
+
+// assertNoGoroutineLeak fails the test unless the goroutine count drops back to baseline
+// within leakSettleTimeout, polling so goroutines that are already exiting are not
+// reported. The failure includes every goroutine's stack to locate the leak.
+func assertNoGoroutineLeak(t *testing.T, baseline int) {
+	t.Helper()
+	deadline := time.Now().Add(leakSettleTimeout)
+	for {
+		current := runtime.NumGoroutine()
+		if current <= baseline {
+			return
+		}
+		if time.Now().After(deadline) {
+			stacks := make([]byte, 1<<20)
+			stacks = stacks[:runtime.Stack(stacks, true)]
+			t.Errorf("goroutine leak: %d running, expected at most %d\n%s", current, baseline, stacks)
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
 // testConnectionErrorHandling is a helper for testing various connection error scenarios
 func testConnectionErrorHandling(t *testing.T, testName string, action func(net.Conn)) {
 	srv := NewServer(":0", DefaultReadTimeout)
@@ -65,8 +95,8 @@ func testConnectionErrorHandling(t *testing.T, testName string, action func(net.
 	srv.ctx, srv.cancel = context.WithCancel(context.Background())
 	defer srv.cancel()
 	done := make(chan bool)
+	srv.wg.Add(1)
 	go func() {
-		srv.wg.Add(1)
 		srv.handleConnection(serverConn)
 		done <- true
 	}()
@@ -191,7 +221,7 @@ func TestStartWithContext_GracefulShutdown(t *testing.T) {
 
 	// Wait for the server to be ready
 	<-s.ready
-	addr := s.listener.Addr().String()
+	addr := s.Addr().String()
 
 	// Connect a client to ensure at least one Accept succeeds
 	conn, err := net.Dial("tcp", addr)
@@ -233,6 +263,7 @@ func TestStartWithContext_GracefulShutdown(t *testing.T) {
 // TestShutdown_TimeoutWhenConnectionsHung validates timeout handling when connections
 // fail to close within the configured shutdown timeout period.
 func TestShutdown_TimeoutWhenConnectionsHung(t *testing.T) {
+	baseline := runtime.NumGoroutine()
 	s := NewServer(":0", DefaultReadTimeout)
 	s.ctx, s.cancel = context.WithCancel(context.Background())
 
@@ -245,6 +276,10 @@ func TestShutdown_TimeoutWhenConnectionsHung(t *testing.T) {
 	if err := s.Shutdown(shutdownCtx); err == nil {
 		t.Fatalf("expected shutdown to time out, but got nil error")
 	}
+
+	// Once the stuck handler finishes, the waiter Shutdown left behind must exit too
+	s.wg.Done()
+	assertNoGoroutineLeak(t, baseline)
 }
 
 // TestNewServer validates server initialization with proper component setup
@@ -556,7 +591,7 @@ func TestServer_StartWithContext_Success(t *testing.T) {
 	<-srv.ready
 
 	// Verify server is listening by connecting to it
-	conn, err := net.Dial("tcp", srv.listener.Addr().String())
+	conn, err := net.Dial("tcp", srv.Addr().String())
 	if err != nil {
 		t.Fatalf("Failed to connect to server: %v", err)
 	}
@@ -592,6 +627,154 @@ func TestServer_StartWithContext_ListenerError(t *testing.T) {
 	}
 }
 
+func TestServer_OnReady(t *testing.T) {
+	srv := NewServer(":0", DefaultReadTimeout)
+
+	bound := make(chan net.Addr, 1)
+	srv.OnReady(func(addr net.Addr) { bound <- addr })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = srv.StartWithContext(ctx) }()
+	<-srv.Ready()
+
+	// The callback runs before Ready is closed, so its address is already available
+	var addr net.Addr
+	select {
+	case addr = <-bound:
+	default:
+		t.Fatal("expected OnReady callback to fire before Ready")
+	}
+	want := srv.Addr().String()
+	if addr.String() != want {
+		t.Errorf("OnReady address = %s, expected %s", addr, want)
+	}
+	if _, port, _ := net.SplitHostPort(addr.String()); port == "0" {
+		t.Errorf("expected the actual bound port, got %s", addr)
+	}
+
+	conn, err := net.Dial("tcp", addr.String())
+	if err != nil {
+		t.Fatalf("failed to connect to the OnReady address: %v", err)
+	}
+	conn.Close()
+}
+
+func TestServer_OnReady_NotCalledOnListenerError(t *testing.T) {
+	srv := NewServer("invalid-address:999999", DefaultReadTimeout)
+	srv.OnReady(func(addr net.Addr) { t.Errorf("unexpected OnReady call with %s", addr) })
+
+	if err := srv.StartWithContext(context.Background()); err == nil {
+		t.Error("Expected error for invalid address, got nil")
+	}
+}
+
+func TestServer_Addr(t *testing.T) {
+	srv := NewServer(":0", DefaultReadTimeout)
+	if addr := srv.Addr(); addr != nil {
+		t.Fatalf("expected nil Addr before start, got %s", addr)
+	}
+
+	bound := make(chan net.Addr, 1)
+	srv.OnReady(func(addr net.Addr) { bound <- addr })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = srv.StartWithContext(ctx) }()
+	<-srv.Ready()
+
+	addr := srv.Addr()
+	if addr == nil {
+		t.Fatal("expected Addr after ready, got nil")
+	}
+	if want := (<-bound).String(); addr.String() != want {
+		t.Errorf("Addr = %s, expected bound address %s", addr, want)
+	}
+	if _, port, _ := net.SplitHostPort(addr.String()); port == "0" {
+		t.Errorf("expected the actual bound port, got %s", addr)
+	}
+}
+
+// TestServer_Rebind validates that replacing the listener keeps existing connections
+// working while new connections are served on the new port only
+func TestServer_Rebind(t *testing.T) {
+	srv := NewServer("127.0.0.1:0", DefaultReadTimeout)
+	if err := srv.Rebind("127.0.0.1:0"); err == nil {
+		t.Fatal("expected Rebind to fail before the server is listening")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stopped := make(chan error, 1)
+	go func() { stopped <- srv.StartWithContext(ctx) }()
+	<-srv.Ready()
+	oldAddr := srv.Addr().String()
+
+	send := func(conn net.Conn, reader *bufio.Reader, cmd string) string {
+		t.Helper()
+		if _, err := conn.Write([]byte(cmd)); err != nil {
+			t.Fatalf("write %q: %v", cmd, err)
+		}
+		resp, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read reply to %q: %v", cmd, err)
+		}
+		return resp
+	}
+
+	existing, err := net.Dial("tcp", oldAddr)
+	if err != nil {
+		t.Fatalf("failed to connect to %s: %v", oldAddr, err)
+	}
+	defer existing.Close()
+	existingReader := bufio.NewReader(existing)
+	if resp := send(existing, existingReader, "INDEX|a|\n"); resp != "OK\n" {
+		t.Fatalf("expected OK before rebind, got %q", resp)
+	}
+
+	if err := srv.Rebind("127.0.0.1:0"); err != nil {
+		t.Fatalf("Rebind failed: %v", err)
+	}
+	newAddr := srv.Addr().String()
+	if newAddr == oldAddr {
+		t.Fatalf("expected a new address after rebind, still %s", oldAddr)
+	}
+
+	if resp := send(existing, existingReader, "QUERY|a|\n"); resp != "OK\n" {
+		t.Errorf("expected existing connection to keep working, got %q", resp)
+	}
+
+	fresh, err := net.Dial("tcp", newAddr)
+	if err != nil {
+		t.Fatalf("failed to connect to rebound address %s: %v", newAddr, err)
+	}
+	defer fresh.Close()
+	if resp := send(fresh, bufio.NewReader(fresh), "QUERY|a|\n"); resp != "OK\n" {
+		t.Errorf("expected new connection to share the index, got %q", resp)
+	}
+
+	if conn, err := net.DialTimeout("tcp", oldAddr, time.Second); err == nil {
+		conn.Close()
+		t.Errorf("expected old address %s to be closed after rebind", oldAddr)
+	}
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), readyWaitTimeout)
+	defer shutdownCancel()
+	existing.Close()
+	fresh.Close()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		t.Fatalf("Shutdown after rebind failed: %v", err)
+	}
+	select {
+	case <-stopped:
+	case <-time.After(readyWaitTimeout):
+		t.Fatal("StartWithContext did not return after shutdown")
+	}
+	if err := srv.Rebind("127.0.0.1:0"); err == nil {
+		t.Error("expected Rebind to fail after shutdown")
+	}
+}
+
 func TestServer_StartWithContext_CancelledContext(t *testing.T) {
 	srv := NewServer(":0", DefaultReadTimeout)
 
@@ -790,7 +973,7 @@ func TestServer_StartWithContext_AcceptLoop(t *testing.T) {
 	// Make multiple connections to test accept loop
 	var conns []net.Conn
 	for i := 0; i < 3; i++ {
-		conn, err := net.Dial("tcp", srv.listener.Addr().String())
+		conn, err := net.Dial("tcp", srv.Addr().String())
 		if err != nil {
 			t.Fatalf("Failed to connect %d: %v", i, err)
 		}
@@ -869,8 +1052,8 @@ func TestServer_HandleConnection_EOF(t *testing.T) {
 	srv.ctx, srv.cancel = context.WithCancel(context.Background())
 	defer srv.cancel()
 	done := make(chan bool)
+	srv.wg.Add(1)
 	go func() {
-		srv.wg.Add(1)
 		srv.handleConnection(serverConn)
 		done <- true
 	}()
@@ -1227,4 +1410,1886 @@ func TestIsReady_ShutdownBehavior(t *testing.T) {
 	case <-time.After(readyWaitTimeout):
 		t.Fatal("timeout waiting for server to shutdown")
 	}
-}
\ No newline at end of file
+}
+
+// recordingNoDelayConn wraps a pipe connection and records SetNoDelay calls so the
+// TCP_NODELAY option can be verified without platform-specific socket inspection.
+type recordingNoDelayConn struct {
+	net.Conn
+	mu      sync.Mutex
+	noDelay bool
+	calls   int
+}
+
+func (c *recordingNoDelayConn) SetNoDelay(noDelay bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.noDelay = noDelay
+	c.calls++
+	return nil
+}
+
+// TestServer_TCPNoDelay verifies the option is applied to connections that support it,
+// skipped when disabled, and that commands still work over a real TCP connection.
+func TestServer_TCPNoDelay(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		srv := NewServerWithConfig(Config{Addr: ":0", ReadTimeout: DefaultReadTimeout, TCPNoDelay: enabled})
+		srv.ctx, srv.cancel = context.WithCancel(context.Background())
+
+		clientConn, serverConn := net.Pipe()
+		rec := &recordingNoDelayConn{Conn: serverConn}
+
+		srv.wg.Add(1)
+		go srv.handleConnection(rec)
+
+		if _, err := clientConn.Write([]byte("INDEX|pkg|\n")); err != nil {
+			t.Fatalf("failed to write command: %v", err)
+		}
+		resp, err := bufio.NewReader(clientConn).ReadString('\n')
+		if err != nil {
+			t.Fatalf("failed to read response: %v", err)
+		}
+		if resp != wire.OK.String() {
+			t.Errorf("expected OK, got %q", resp)
+		}
+
+		rec.mu.Lock()
+		calls, noDelay := rec.calls, rec.noDelay
+		rec.mu.Unlock()
+		if enabled && (calls != 1 || !noDelay) {
+			t.Errorf("expected SetNoDelay(true) once when enabled, got calls=%d noDelay=%v", calls, noDelay)
+		}
+		if !enabled && calls != 0 {
+			t.Errorf("expected no SetNoDelay calls when disabled, got %d", calls)
+		}
+
+		_ = clientConn.Close()
+		srv.cancel()
+		srv.wg.Wait()
+	}
+
+	// Non-TCP connections must be tolerated by the guard
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+	setNoDelay(serverConn)
+
+	// Real TCP connection with the option enabled
+	srv := NewServerWithConfig(Config{Addr: "127.0.0.1:0", ReadTimeout: DefaultReadTimeout, TCPNoDelay: true})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go srv.StartWithContext(ctx)
+	<-srv.Ready()
+
+	conn, err := net.Dial("tcp", srv.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to dial server: %v", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("QUERY|missing|\n")); err != nil {
+		t.Fatalf("failed to write command: %v", err)
+	}
+	resp, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatalf("failed to read response: %v", err)
+	}
+	if resp != wire.FAIL.String() {
+		t.Errorf("expected FAIL, got %q", resp)
+	}
+}
+
+// BenchmarkServer_TCPNoDelay measures request/response round-trip latency over loopback
+// with and without the explicit TCP_NODELAY option.
+func BenchmarkServer_TCPNoDelay(b *testing.B) {
+	slog.SetDefault(slog.New(slog.NewJSONHandler(io.Discard, nil)))
+
+	for _, enabled := range []bool{false, true} {
+		name := "default"
+		if enabled {
+			name = "nodelay"
+		}
+		b.Run(name, func(b *testing.B) {
+			srv := NewServerWithConfig(Config{Addr: "127.0.0.1:0", ReadTimeout: DefaultReadTimeout, TCPNoDelay: enabled})
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go srv.StartWithContext(ctx)
+			<-srv.Ready()
+
+			conn, err := net.Dial("tcp", srv.Addr().String())
+			if err != nil {
+				b.Fatalf("failed to dial server: %v", err)
+			}
+			defer conn.Close()
+			reader := bufio.NewReader(conn)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := conn.Write([]byte("QUERY|pkg|\n")); err != nil {
+					b.Fatalf("write failed: %v", err)
+				}
+				if _, err := reader.ReadString('\n'); err != nil {
+					b.Fatalf("read failed: %v", err)
+				}
+			}
+		})
+	}
+}
+
+// benchmarkGraph indexes a deterministic graph of n packages in which pkg-i depends on
+// pkg-(i/2), so every package but the leaves has dependents
+func benchmarkGraph(b *testing.B, srv *Server, logger *slog.Logger, n int) {
+	b.Helper()
+	srv.processCommand(logger, "INDEX|pkg-0|\n")
+	for i := 1; i < n; i++ {
+		if code := srv.processCommand(logger, fmt.Sprintf("INDEX|pkg-%d|pkg-%d\n", i, i/2)); code != wire.OK {
+			b.Fatalf("failed to index pkg-%d: %v", i, code)
+		}
+	}
+}
+
+// BenchmarkServer_ProcessCommand measures INDEX, QUERY and REMOVE through the full parse
+// and dispatch path against graphs of increasing size. Each iteration leaves the graph as
+// it found it, so results do not drift with b.N.
+func BenchmarkServer_ProcessCommand(b *testing.B) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+
+	for _, size := range []int{100, 1000, 10000} {
+		srv := NewServer(":0", DefaultReadTimeout)
+		benchmarkGraph(b, srv, logger, size)
+		queries := make([]string, size)
+		for i := range queries {
+			queries[i] = fmt.Sprintf("QUERY|pkg-%d|\n", i)
+		}
+
+		b.Run(fmt.Sprintf("INDEX/%d", size), func(b *testing.B) {
+			// Re-indexing an existing package with the same dependencies
+			for i := 0; i < b.N; i++ {
+				srv.processCommand(logger, "INDEX|pkg-5|pkg-2\n")
+			}
+		})
+		b.Run(fmt.Sprintf("QUERY/%d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				srv.processCommand(logger, queries[i%size])
+			}
+		})
+		b.Run(fmt.Sprintf("REMOVE/%d", size), func(b *testing.B) {
+			// A remove of a leaf paired with re-indexing it to restore the graph
+			for i := 0; i < b.N; i++ {
+				srv.processCommand(logger, "REMOVE|leaf|\n")
+				srv.processCommand(logger, "INDEX|leaf|pkg-1\n")
+			}
+		})
+	}
+}
+
+// BenchmarkServer_ConnThroughput measures commands per second over a single loopback TCP
+// connection, cycling through an INDEX, QUERY and REMOVE of the same package so the
+// index is unchanged after every full cycle.
+func BenchmarkServer_ConnThroughput(b *testing.B) {
+	slog.SetDefault(slog.New(slog.NewJSONHandler(io.Discard, nil)))
+
+	srv := NewServerWithConfig(Config{Addr: "127.0.0.1:0", ReadTimeout: DefaultReadTimeout})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go srv.StartWithContext(ctx)
+	<-srv.Ready()
+
+	conn, err := net.Dial("tcp", srv.Addr().String())
+	if err != nil {
+		b.Fatalf("failed to dial server: %v", err)
+	}
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	commands := [][]byte{[]byte("INDEX|bench|\n"), []byte("QUERY|bench|\n"), []byte("REMOVE|bench|\n")}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := conn.Write(commands[i%len(commands)]); err != nil {
+			b.Fatalf("write failed: %v", err)
+		}
+		if resp, err := reader.ReadString('\n'); err != nil || resp != wire.OK.String() {
+			b.Fatalf("command %d failed: %q, %v", i, resp, err)
+		}
+	}
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "cmds/s")
+}
+
+// TestShutdown_LogsReport verifies Shutdown emits a structured summary record with the
+// lifetime counters pulled from GetMetrics/GetStats.
+func TestShutdown_LogsReport(t *testing.T) {
+	var buf syncBuffer
+	originalHandler := slog.Default().Handler()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+	defer slog.SetDefault(slog.New(originalHandler))
+
+	srv, clientConn, reader, cleanup := setupServerAndPipe(t)
+	defer cleanup()
+
+	commands := []string{"INDEX|a|\n", "INDEX|b|a\n", "QUERY|b|\n", "BOGUS|x|\n"}
+	for _, cmd := range commands {
+		if _, err := clientConn.Write([]byte(cmd)); err != nil {
+			t.Fatalf("failed to write %q: %v", cmd, err)
+		}
+		if _, err := reader.ReadString('\n'); err != nil {
+			t.Fatalf("failed to read response: %v", err)
+		}
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), readyWaitTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		t.Fatalf("shutdown returned error: %v", err)
+	}
+
+	var report map[string]interface{}
+	for _, line := range strings.Split(buf.String(), "\n") {
+		var record map[string]interface{}
+		if json.Unmarshal([]byte(line), &record) == nil && record["msg"] == "Shutdown report" {
+			report = record
+		}
+	}
+	if report == nil {
+		t.Fatalf("no shutdown report found in logs:\n%s", buf.String())
+	}
+
+	expected := map[string]float64{
+		"connectionsTotal":  1,
+		"commandsProcessed": 4,
+		"errors":            1,
+		"packagesIndexed":   2,
+	}
+	for field, want := range expected {
+		if got, _ := report[field].(float64); got != want {
+			t.Errorf("report[%s] = %v, want %v", field, report[field], want)
+		}
+	}
+	if _, ok := report["uptime"].(string); !ok {
+		t.Errorf("expected uptime string in report, got %v", report["uptime"])
+	}
+}
+
+// syncBuffer is a goroutine-safe bytes.Buffer for capturing log output in tests.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// TestServer_ProcessRequest_VerboseQuery validates that verbose mode reports direct
+// dependency counts on QUERY and the parse error category on ERROR, while the default
+// mode keeps the bare responses.
+func TestServer_ProcessRequest_VerboseQuery(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	setup := []string{"INDEX|a|\n", "INDEX|b|\n", "INDEX|app|a,b\n"}
+
+	verbose := NewServerWithConfig(Config{Addr: ":0", ReadTimeout: DefaultReadTimeout, Verbose: true})
+	quiet := NewServer(":0", DefaultReadTimeout)
+	for _, cmd := range setup {
+		verbose.processRequest(logger, cmd)
+		quiet.processRequest(logger, cmd)
+	}
+
+	tests := []struct {
+		srv      *Server
+		input    string
+		expected string
+	}{
+		{verbose, "QUERY|a|\n", "OK deps=0\n"},
+		{verbose, "QUERY|app|\n", "OK deps=2\n"},
+		{verbose, "QUERY|missing|\n", "FAIL\n"},
+		{quiet, "QUERY|app|\n", "OK\n"},
+		{quiet, "QUERY|missing|\n", "FAIL\n"},
+		{verbose, "QUREY|app|\n", "ERROR unknown-command\n"},
+		{verbose, "QUERY|app\n", "ERROR bad-format\n"},
+		{quiet, "QUREY|app|\n", "ERROR\n"},
+		{quiet, "QUERY|app\n", "ERROR\n"},
+	}
+
+	for _, test := range tests {
+		if reply := test.srv.processRequest(logger, test.input).String(); reply != test.expected {
+			t.Errorf("processRequest(%q) verbose=%v = %q, expected %q", test.input, test.srv.config.Verbose, reply, test.expected)
+		}
+	}
+}
+
+// TestServer_ProcessRequest_VerboseIndexFailure validates that verbose mode lists the
+// missing dependencies of a failed INDEX, while quiet mode keeps a bare FAIL.
+func TestServer_ProcessRequest_VerboseIndexFailure(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	verbose := NewServerWithConfig(Config{Addr: ":0", ReadTimeout: DefaultReadTimeout, Verbose: true, MaxPackages: 2})
+	quiet := NewServer(":0", DefaultReadTimeout)
+	for _, srv := range []*Server{verbose, quiet} {
+		srv.processRequest(logger, "INDEX|a|\n")
+	}
+
+	tests := []struct {
+		srv      *Server
+		input    string
+		expected string
+	}{
+		{verbose, "INDEX|app|y,a,x,y\n", "FAIL missing: x,y\n"},
+		{verbose, "INDEX|app|a\n", "OK\n"},
+		{verbose, "INDEX|extra|\n", "FAIL\n"}, // Package limit, nothing missing
+		{quiet, "INDEX|app|a,x\n", "FAIL\n"},
+	}
+	for _, test := range tests {
+		if reply := test.srv.processRequest(logger, test.input).String(); reply != test.expected {
+			t.Errorf("processRequest(%q) verbose=%v = %q, expected %q", test.input, test.srv.config.Verbose, reply, test.expected)
+		}
+	}
+}
+
+// TestServer_ProcessCommand_StrictDeps validates that strict dependency parsing turns
+// empty dependency slots into ERROR responses.
+func TestServer_ProcessCommand_StrictDeps(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	srv := NewServerWithConfig(Config{Addr: ":0", ReadTimeout: DefaultReadTimeout, StrictDeps: true})
+
+	srv.processCommand(logger, "INDEX|b|\n")
+	srv.processCommand(logger, "INDEX|c|\n")
+
+	if result := srv.processCommand(logger, "INDEX|a|b,,c\n"); result != wire.ERROR {
+		t.Errorf("expected ERROR for empty dependency slot in strict mode, got %v", result)
+	}
+	if result := srv.processCommand(logger, "INDEX|a|b,c\n"); result != wire.OK {
+		t.Errorf("expected OK for well-formed dependencies in strict mode, got %v", result)
+	}
+}
+
+// TestServer_MultipleListenAddresses validates that every configured address accepts
+// connections, all served by the same indexer, and that shutdown drains them together.
+func TestServer_MultipleListenAddresses(t *testing.T) {
+	srv := NewServerWithConfig(Config{
+		Addr:            "127.0.0.1:0",
+		AdditionalAddrs: []string{"127.0.0.1:0"},
+		ReadTimeout:     DefaultReadTimeout,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() { done <- srv.StartWithContext(ctx) }()
+	<-srv.Ready()
+
+	srv.mu.Lock()
+	listeners := append([]net.Listener(nil), srv.listeners...)
+	srv.mu.Unlock()
+	if len(listeners) != 2 {
+		t.Fatalf("expected 2 listeners, got %d", len(listeners))
+	}
+
+	send := func(addr, cmd string) string {
+		t.Helper()
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatalf("failed to dial %s: %v", addr, err)
+		}
+		defer conn.Close()
+		if _, err := conn.Write([]byte(cmd)); err != nil {
+			t.Fatalf("failed to write to %s: %v", addr, err)
+		}
+		resp, err := bufio.NewReader(conn).ReadString('\n')
+		if err != nil {
+			t.Fatalf("failed to read from %s: %v", addr, err)
+		}
+		return resp
+	}
+
+	first := listeners[0].Addr().String()
+	second := listeners[1].Addr().String()
+
+	if resp := send(first, "INDEX|shared|\n"); resp != wire.OK.String() {
+		t.Errorf("expected OK indexing on first listener, got %q", resp)
+	}
+	if resp := send(second, "QUERY|shared|\n"); resp != wire.OK.String() {
+		t.Errorf("expected second listener to see package indexed via first, got %q", resp)
+	}
+	if resp := send(second, "INDEX|app|shared\n"); resp != wire.OK.String() {
+		t.Errorf("expected OK indexing on second listener, got %q", resp)
+	}
+	if resp := send(first, "REMOVE|shared|\n"); resp != wire.FAIL.String() {
+		t.Errorf("expected FAIL removing shared dependency, got %q", resp)
+	}
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), readyWaitTimeout)
+	defer shutdownCancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		t.Fatalf("shutdown returned error: %v", err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("StartWithContext returned error: %v", err)
+		}
+	case <-time.After(readyWaitTimeout):
+		t.Fatal("timeout waiting for accept loops to exit")
+	}
+	for _, l := range listeners {
+		if _, err := net.Dial("tcp", l.Addr().String()); err == nil {
+			t.Errorf("expected listener %s to be closed after shutdown", l.Addr())
+		}
+	}
+}
+
+// TestServer_CommandTimeout validates that a command exceeding the command timeout is
+// answered with ERROR and counted, while fast commands are unaffected.
+func TestServer_CommandTimeout(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	srv := NewServerWithConfig(Config{Addr: ":0", ReadTimeout: DefaultReadTimeout, CommandTimeout: 20 * time.Millisecond})
+
+	release := make(chan struct{})
+	defer close(release)
+	srv.commandHook = func(cmd *wire.Command) {
+		if cmd.Package == "slow" {
+			<-release
+		}
+	}
+
+	if reply, _ := srv.executeRequest(logger, "INDEX|fast|\n"); reply.Code != wire.OK {
+		t.Errorf("expected OK for fast command, got %v", reply.Code)
+	}
+	if reply, _ := srv.executeRequest(logger, "INDEX|slow|\n"); reply.Code != wire.ERROR {
+		t.Errorf("expected ERROR for command exceeding timeout, got %v", reply.Code)
+	}
+	if timeouts := srv.GetMetrics().CommandTimeouts; timeouts != 1 {
+		t.Errorf("expected 1 command timeout, got %d", timeouts)
+	}
+}
+
+// recordingStore is a mock PackageStore that records dispatched operations and returns
+// canned results, isolating processCommand from the real indexer.
+type recordingStore struct {
+	calls        []string
+	indexResult  bool
+	removeResult indexer.RemoveResult
+	queryResult  bool
+	version      uint64 // Graph version reported by Version
+}
+
+func (s *recordingStore) IndexPackage(pkg string, deps []string) bool {
+	s.calls = append(s.calls, "index:"+pkg+":"+strings.Join(deps, ","))
+	return s.indexResult
+}
+
+func (s *recordingStore) IndexPackageMissing(pkg string, deps []string) ([]string, bool) {
+	s.calls = append(s.calls, "indexmissing:"+pkg+":"+strings.Join(deps, ","))
+	return nil, s.indexResult
+}
+
+func (s *recordingStore) IndexPackageLabeled(pkg string, deps []string, labels map[string]string) bool {
+	s.calls = append(s.calls, "indexlabeled:"+pkg+":"+strings.Join(deps, ","))
+	return s.indexResult
+}
+
+func (s *recordingStore) IndexPackageCAS(pkg string, deps []string, expectedHash string) (string, bool) {
+	s.calls = append(s.calls, "indexcas:"+pkg+":"+strings.Join(deps, ",")+":"+expectedHash)
+	return "", s.indexResult
+}
+
+func (s *recordingStore) RemovePackage(pkg string) indexer.RemoveResult {
+	s.calls = append(s.calls, "remove:"+pkg)
+	return s.removeResult
+}
+
+func (s *recordingStore) CanRemove(pkg string) bool {
+	s.calls = append(s.calls, "canremove:"+pkg)
+	return true
+}
+
+func (s *recordingStore) PinPackage(pkg string) bool {
+	s.calls = append(s.calls, "pin:"+pkg)
+	return false
+}
+
+func (s *recordingStore) UnpinPackage(pkg string) {
+	s.calls = append(s.calls, "unpin:"+pkg)
+}
+
+func (s *recordingStore) RenamePackage(oldName, newName string) bool {
+	s.calls = append(s.calls, "rename:"+oldName+">"+newName)
+	return false
+}
+
+func (s *recordingStore) AddDependencies(pkg string, deps []string) bool {
+	s.calls = append(s.calls, "adddep:"+pkg)
+	return false
+}
+
+func (s *recordingStore) RemoveDependencies(pkg string, deps []string) bool {
+	s.calls = append(s.calls, "rmdep:"+pkg)
+	return false
+}
+
+func (s *recordingStore) QueryPackage(pkg string) bool {
+	s.calls = append(s.calls, "query:"+pkg)
+	return s.queryResult
+}
+
+func (s *recordingStore) DependencyCount(pkg string) (int, bool) {
+	s.calls = append(s.calls, "count:"+pkg)
+	return 0, s.queryResult
+}
+
+func (s *recordingStore) SubtreeSize(pkg string) (int, int, bool) {
+	s.calls = append(s.calls, "subtree:"+pkg)
+	return 0, 0, s.queryResult
+}
+
+func (s *recordingStore) DependencyDepth(pkg string) (int, bool) {
+	s.calls = append(s.calls, "depth:"+pkg)
+	return 0, s.queryResult
+}
+
+func (s *recordingStore) FindPath(from, to string) ([]string, bool) {
+	s.calls = append(s.calls, "path:"+from+">"+to)
+	return nil, s.queryResult
+}
+
+func (s *recordingStore) Orphans() []string {
+	s.calls = append(s.calls, "orphans")
+	return nil
+}
+
+func (s *recordingStore) Pinned() []string {
+	s.calls = append(s.calls, "pinned")
+	return nil
+}
+
+func (s *recordingStore) FindCycles() [][]string {
+	s.calls = append(s.calls, "cycles")
+	return nil
+}
+
+func (s *recordingStore) OperationStats() indexer.OperationStats {
+	return indexer.OperationStats{}
+}
+
+func (s *recordingStore) Search(pattern string) []string {
+	s.calls = append(s.calls, "search:"+pattern)
+	return []string{}
+}
+
+func (s *recordingStore) Edges(pkg string) ([]string, []string, bool) {
+	s.calls = append(s.calls, "edges:"+pkg)
+	return nil, nil, s.queryResult
+}
+
+func (s *recordingStore) Status(pkg string) indexer.PackageStatus {
+	s.calls = append(s.calls, "status:"+pkg)
+	return indexer.PackageStatus{Indexed: s.queryResult}
+}
+
+func (s *recordingStore) GetStats() (int, int, int) {
+	return 0, 0, 0
+}
+
+func (s *recordingStore) Version() uint64 {
+	return s.version
+}
+
+func (s *recordingStore) Restore(specs []indexer.PackageSpec) error {
+	s.calls = append(s.calls, fmt.Sprintf("restore:%d", len(specs)))
+	return nil
+}
+
+// TestServer_ProcessCommand_MockStore validates that processCommand dispatches each
+// command to the matching PackageStore operation and maps its result to a response.
+func TestServer_ProcessCommand_MockStore(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+
+	tests := []struct {
+		name     string
+		store    *recordingStore
+		input    string
+		expected wire.Response
+		call     string
+	}{
+		{"index ok", &recordingStore{indexResult: true}, "INDEX|a|b,c\n", wire.OK, "index:a:b,c"},
+		{"index fail", &recordingStore{}, "INDEX|a|b\n", wire.FAIL, "index:a:b"},
+		{"remove ok", &recordingStore{removeResult: indexer.RemoveResultOK}, "REMOVE|a|\n", wire.OK, "remove:a"},
+		{"remove not indexed", &recordingStore{removeResult: indexer.RemoveResultNotIndexed}, "REMOVE|a|\n", wire.OK, "remove:a"},
+		{"remove blocked", &recordingStore{removeResult: indexer.RemoveResultBlocked}, "REMOVE|a|\n", wire.FAIL, "remove:a"},
+		{"query ok", &recordingStore{queryResult: true}, "QUERY|a|\n", wire.OK, "query:a"},
+		{"query fail", &recordingStore{}, "QUERY|a|\n", wire.FAIL, "query:a"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := NewServerWithConfig(Config{Addr: ":0", ReadTimeout: DefaultReadTimeout, Store: tt.store})
+			if result := srv.processCommand(logger, tt.input); result != tt.expected {
+				t.Errorf("processCommand(%q) = %v, expected %v", tt.input, result, tt.expected)
+			}
+			if len(tt.store.calls) != 1 || tt.store.calls[0] != tt.call {
+				t.Errorf("expected single store call %q, got %v", tt.call, tt.store.calls)
+			}
+		})
+	}
+
+	// Malformed input never reaches the store
+	store := &recordingStore{}
+	srv := NewServerWithConfig(Config{Addr: ":0", ReadTimeout: DefaultReadTimeout, Store: store})
+	if result := srv.processCommand(logger, "BOGUS|a|\n"); result != wire.ERROR || len(store.calls) != 0 {
+		t.Errorf("expected ERROR without store calls, got %v with %v", result, store.calls)
+	}
+}
+
+// benchmarkReplyWrites measures writing a large multi-line reply (as a LIST-style command
+// would produce) over loopback TCP using the given write strategy.
+func benchmarkReplyWrites(b *testing.B, write func(conn net.Conn, reply wire.Reply) error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatalf("failed to listen: %v", err)
+	}
+	defer ln.Close()
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, _ = io.Copy(io.Discard, conn)
+	}()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		b.Fatalf("failed to dial: %v", err)
+	}
+	defer conn.Close()
+
+	reply := wire.Reply{Code: wire.OK}
+	for i := 0; i < 1000; i++ {
+		reply.Lines = append(reply.Lines, "package-"+strings.Repeat("x", i%32))
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := write(conn, reply); err != nil {
+			b.Fatalf("write failed: %v", err)
+		}
+	}
+}
+
+// BenchmarkReplyWrites_PerLine writes each reply line with its own syscall
+func BenchmarkReplyWrites_PerLine(b *testing.B) {
+	benchmarkReplyWrites(b, func(conn net.Conn, reply wire.Reply) error {
+		_, err := reply.WriteTo(conn)
+		return err
+	})
+}
+
+// BenchmarkReplyWrites_Coalesced buffers the reply and flushes once, as serveConn does
+func BenchmarkReplyWrites_Coalesced(b *testing.B) {
+	srv := NewServer(":0", DefaultReadTimeout)
+	var out *responseWriter
+	benchmarkReplyWrites(b, func(conn net.Conn, reply wire.Reply) error {
+		if out == nil {
+			out = srv.newResponseWriter(conn)
+		}
+		return out.write(reply)
+	})
+}
+
+// TestServer_WriteReply_MultiLine validates that a multi-line reply reaches the client
+// intact through the coalescing writer, followed by ordinary single-line replies.
+func TestServer_WriteReply_MultiLine(t *testing.T) {
+	srv := NewServer(":0", DefaultReadTimeout)
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+
+	out := srv.newResponseWriter(serverConn)
+	replies := []wire.Reply{
+		{Code: wire.OK, Lines: []string{"a", "b", "c"}},
+		wire.NewReply(wire.FAIL),
+	}
+	go func() {
+		for _, reply := range replies {
+			if err := out.write(reply); err != nil {
+				t.Errorf("write failed: %v", err)
+			}
+		}
+	}()
+
+	reader := bufio.NewReader(clientConn)
+	expected := []string{"OK\n", "a\n", "b\n", "c\n", "\n", "FAIL\n"}
+	for _, want := range expected {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("failed to read reply line: %v", err)
+		}
+		if line != want {
+			t.Errorf("expected %q, got %q", want, line)
+		}
+	}
+}
+
+// TestServer_WriteReply_Framing validates that the configured framing is applied to
+// multi-line replies on the connection, round-tripping through wire.ReadReply.
+func TestServer_WriteReply_Framing(t *testing.T) {
+	for _, framing := range []wire.Framing{wire.FramingBlankLine, wire.FramingDot, wire.FramingLengthPrefix} {
+		srv := NewServerWithConfig(Config{Addr: ":0", ReadTimeout: DefaultReadTimeout, Framing: framing})
+		clientConn, serverConn := net.Pipe()
+
+		list := wire.Reply{Code: wire.OK, Lines: []string{"a", "b", "c"}}
+		go func() {
+			out := srv.newResponseWriter(serverConn)
+			_ = out.write(list)
+			_ = out.write(wire.NewReply(wire.OK))
+		}()
+
+		reader := bufio.NewReader(clientConn)
+		got, err := wire.ReadReply(reader, framing, true)
+		if err != nil {
+			t.Fatalf("framing %v: ReadReply returned error: %v", framing, err)
+		}
+		if strings.Join(got.Lines, ",") != "a,b,c" {
+			t.Errorf("framing %v: expected lines a,b,c, got %v", framing, got.Lines)
+		}
+		if next, err := wire.ReadReply(reader, framing, false); err != nil || next.Code != wire.OK {
+			t.Errorf("framing %v: expected OK after multi-line reply, got %v, %v", framing, next, err)
+		}
+
+		clientConn.Close()
+		serverConn.Close()
+	}
+}
+
+// TestServer_Network_IPv4Only validates that binding with "tcp4" serves IPv4 clients and
+// refuses IPv6 ones. Skipped where the host has no IPv6 loopback.
+func TestServer_Network_IPv4Only(t *testing.T) {
+	probe, err := net.Listen("tcp6", "[::1]:0")
+	if err != nil {
+		t.Skipf("IPv6 loopback unavailable: %v", err)
+	}
+	probe.Close()
+
+	srv := NewServerWithConfig(Config{Addr: ":0", Network: "tcp4", ReadTimeout: DefaultReadTimeout})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = srv.StartWithContext(ctx) }()
+	<-srv.Ready()
+
+	_, port, _ := net.SplitHostPort(srv.Addr().String())
+
+	conn, err := net.Dial("tcp4", net.JoinHostPort("127.0.0.1", port))
+	if err != nil {
+		t.Fatalf("expected IPv4 client to connect: %v", err)
+	}
+	conn.Close()
+
+	if conn, err := net.DialTimeout("tcp6", net.JoinHostPort("::1", port), time.Second); err == nil {
+		conn.Close()
+		t.Error("expected IPv6 client to be refused by tcp4 listener")
+	}
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), shutdownWaitTimeout)
+	defer shutdownCancel()
+	_ = srv.Shutdown(shutdownCtx)
+}
+
+// TestServer_Network_Invalid validates that an unknown network fails startup
+func TestServer_Network_Invalid(t *testing.T) {
+	srv := NewServerWithConfig(Config{Addr: ":0", Network: "udp", ReadTimeout: DefaultReadTimeout})
+	if err := srv.StartWithContext(context.Background()); err == nil {
+		t.Error("expected error listening on udp network")
+	}
+}
+
+// TestServer_ProcessRequest_Caps validates that CAPS advertises the command set and
+// protocol version, and reflects optional features enabled by configuration.
+func TestServer_ProcessRequest_Caps(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+
+	tests := []struct {
+		name     string
+		cfg      Config
+		expected string
+	}{
+		{"defaults", Config{}, "OK INDEX,REMOVE,QUERY,CAPS,STATUS,DEPTH,INDEXCAS,SEARCH,EDGES,RENAME,ADDDEP,RMDEP,CANREMOVE,PIN,UNPIN,BUILD,PATH,GEN version=2 framing=blank\n"},
+		{"verbose", Config{Verbose: true}, "OK INDEX,REMOVE,QUERY,CAPS,STATUS,DEPTH,INDEXCAS,SEARCH,EDGES,RENAME,ADDDEP,RMDEP,CANREMOVE,PIN,UNPIN,BUILD,PATH,GEN version=2 verbose framing=blank\n"},
+		{"strict and dot framing", Config{StrictDeps: true, Framing: wire.FramingDot},
+			"OK INDEX,REMOVE,QUERY,CAPS,STATUS,DEPTH,INDEXCAS,SEARCH,EDGES,RENAME,ADDDEP,RMDEP,CANREMOVE,PIN,UNPIN,BUILD,PATH,GEN version=2 strict-deps framing=dot\n"},
+		{"reject cycles", Config{RejectCycles: true},
+			"OK INDEX,REMOVE,QUERY,CAPS,STATUS,DEPTH,INDEXCAS,SEARCH,EDGES,RENAME,ADDDEP,RMDEP,CANREMOVE,PIN,UNPIN,BUILD,PATH,GEN version=2 reject-cycles framing=blank\n"},
+		{"escapes", Config{EscapedNames: true},
+			"OK INDEX,REMOVE,QUERY,CAPS,STATUS,DEPTH,INDEXCAS,SEARCH,EDGES,RENAME,ADDDEP,RMDEP,CANREMOVE,PIN,UNPIN,BUILD,PATH,GEN version=2 escapes framing=blank\n"},
+		{"labels", Config{LabeledDeps: true},
+			"OK INDEX,REMOVE,QUERY,CAPS,STATUS,DEPTH,INDEXCAS,SEARCH,EDGES,RENAME,ADDDEP,RMDEP,CANREMOVE,PIN,UNPIN,BUILD,PATH,GEN version=2 labels framing=blank\n"},
+		{"request ids", Config{RequestIDs: true},
+			"OK INDEX,REMOVE,QUERY,CAPS,STATUS,DEPTH,INDEXCAS,SEARCH,EDGES,RENAME,ADDDEP,RMDEP,CANREMOVE,PIN,UNPIN,BUILD,PATH,GEN version=2 request-ids framing=blank\n"},
+		{"command filter", Config{AllowCommands: []wire.CommandType{wire.QueryCommand, wire.CapsCommand, wire.IndexCommand}, DenyCommands: []wire.CommandType{wire.IndexCommand}},
+			"OK QUERY,CAPS version=2 framing=blank\n"},
+		{"read-only", Config{ReadOnly: true},
+			"OK QUERY,CAPS,STATUS,DEPTH,SEARCH,EDGES,CANREMOVE,BUILD,PATH,GEN version=2 readonly framing=blank\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.Addr = ":0"
+			tt.cfg.ReadTimeout = DefaultReadTimeout
+			srv := NewServerWithConfig(tt.cfg)
+			if reply := srv.processRequest(logger, "CAPS||\n").String(); reply != tt.expected {
+				t.Errorf("CAPS = %q, expected %q", reply, tt.expected)
+			}
+		})
+	}
+}
+
+// TestServer_Backlog validates that a custom backlog leaves the listener accepting
+// normally. Unix only, where the backlog can be adjusted.
+func TestServer_Backlog(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("custom backlog is unsupported on Windows")
+	}
+
+	srv := NewServerWithConfig(Config{Addr: "127.0.0.1:0", Backlog: 16, ReadTimeout: DefaultReadTimeout})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- srv.StartWithContext(ctx) }()
+	<-srv.Ready()
+	if !srv.IsReady() {
+		t.Fatalf("server failed to start with custom backlog: %v", <-done)
+	}
+
+	addr := srv.Addr().String()
+
+	for i := 0; i < 3; i++ {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatalf("failed to dial: %v", err)
+		}
+		if _, err := conn.Write([]byte("QUERY|x|\n")); err != nil {
+			t.Fatalf("failed to write: %v", err)
+		}
+		if resp, err := bufio.NewReader(conn).ReadString('\n'); err != nil || resp != wire.FAIL.String() {
+			t.Errorf("expected FAIL, got %q, %v", resp, err)
+		}
+		conn.Close()
+	}
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), shutdownWaitTimeout)
+	defer shutdownCancel()
+	_ = srv.Shutdown(shutdownCtx)
+}
+
+// TestServer_MaxGoroutines validates that connections arriving while the goroutine
+// ceiling is reached are refused with ERROR and counted, and that a generous ceiling
+// leaves connections unaffected.
+func TestServer_MaxGoroutines(t *testing.T) {
+	tests := []struct {
+		name     string
+		ceiling  int
+		expected string
+		rejected int64
+	}{
+		{"ceiling reached", 1, wire.ERROR.String(), 1},
+		{"ceiling not reached", 1 << 20, wire.FAIL.String(), 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := NewServerWithConfig(Config{Addr: "127.0.0.1:0", MaxGoroutines: tt.ceiling, ReadTimeout: DefaultReadTimeout})
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go func() { _ = srv.StartWithContext(ctx) }()
+			<-srv.Ready()
+
+			addr := srv.Addr().String()
+
+			conn, err := net.Dial("tcp", addr)
+			if err != nil {
+				t.Fatalf("failed to dial: %v", err)
+			}
+			defer conn.Close()
+			_, _ = conn.Write([]byte("QUERY|x|\n"))
+			if resp, _ := bufio.NewReader(conn).ReadString('\n'); resp != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, resp)
+			}
+			if rejected := srv.GetMetrics().GoroutineRejected; rejected != tt.rejected {
+				t.Errorf("expected %d goroutine rejections, got %d", tt.rejected, rejected)
+			}
+
+			shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), shutdownWaitTimeout)
+			defer shutdownCancel()
+			_ = srv.Shutdown(shutdownCtx)
+		})
+	}
+}
+
+// TestServer_ProcessRequest_Status validates the combined STATUS reply for packages with
+// and without dependents and for missing packages.
+func TestServer_ProcessRequest_Status(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	srv := NewServer(":0", DefaultReadTimeout)
+	for _, cmd := range []string{"INDEX|a|\n", "INDEX|b|\n", "INDEX|app|a,b\n"} {
+		srv.processRequest(logger, cmd)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"STATUS|a|\n", "OK indexed=true deps=0 dependents=1\n"},
+		{"STATUS|app|\n", "OK indexed=true deps=2 dependents=0\n"},
+		{"STATUS|missing|\n", "OK indexed=false\n"},
+		{"STATUS||\n", "ERROR\n"},
+	}
+
+	for _, test := range tests {
+		if reply := srv.processRequest(logger, test.input).String(); reply != test.expected {
+			t.Errorf("processRequest(%q) = %q, expected %q", test.input, reply, test.expected)
+		}
+	}
+}
+
+// TestServeConn_MaxConnLifetime validates that a connection keeps being served within its
+// lifetime and is closed by the server once the lifetime elapses.
+func TestServeConn_MaxConnLifetime(t *testing.T) {
+	const lifetime = 150 * time.Millisecond
+	s := NewServerWithConfig(Config{Addr: ":0", ReadTimeout: DefaultReadTimeout, MaxConnLifetime: lifetime})
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	defer s.cancel()
+
+	client, server := net.Pipe()
+	defer client.Close()
+	started := time.Now()
+	s.wg.Add(1)
+	go s.handleConnection(server)
+
+	reader := bufio.NewReader(client)
+	if _, err := client.Write([]byte("INDEX|pkg|\n")); err != nil {
+		t.Fatalf("failed to write command: %v", err)
+	}
+	if resp, err := reader.ReadString('\n'); err != nil || resp != wire.OK.String() {
+		t.Fatalf("expected OK within the lifetime, got %q (err %v)", resp, err)
+	}
+
+	// Stay idle: the server closes the connection when the lifetime expires
+	if _, err := reader.ReadString('\n'); err != io.EOF {
+		t.Errorf("expected the server to close the connection, got %v", err)
+	}
+	if age := time.Since(started); age < lifetime || age > lifetime+readyWaitTimeout {
+		t.Errorf("connection closed after %v, expected about %v", age, lifetime)
+	}
+}
+
+// TestServeConn_NoMonitorLeak validates that serving and closing many connections leaves
+// no per-connection goroutines behind while the server keeps running.
+func TestServeConn_NoMonitorLeak(t *testing.T) {
+	srv := NewServerWithConfig(Config{Addr: "127.0.0.1:0", ReadTimeout: DefaultReadTimeout})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go srv.StartWithContext(ctx)
+	<-srv.Ready()
+	addr := srv.Addr().String()
+	baseline := runtime.NumGoroutine()
+
+	for i := 0; i < 50; i++ {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatalf("failed to dial: %v", err)
+		}
+		if _, err := conn.Write([]byte("QUERY|pkg|\n")); err != nil {
+			t.Fatalf("failed to write: %v", err)
+		}
+		if _, err := bufio.NewReader(conn).ReadString('\n'); err != nil {
+			t.Fatalf("failed to read: %v", err)
+		}
+		conn.Close()
+	}
+
+	assertNoGoroutineLeak(t, baseline)
+}
+
+// TestServer_LifecycleNoGoroutineLeak validates that a full start, serve and shutdown
+// cycle, including connections still open at shutdown, leaves no goroutines behind.
+func TestServer_LifecycleNoGoroutineLeak(t *testing.T) {
+	baseline := runtime.NumGoroutine()
+
+	srv := NewServerWithConfig(Config{
+		Addr:            "127.0.0.1:0",
+		AdditionalAddrs: []string{"127.0.0.1:0"},
+		ReadTimeout:     DefaultReadTimeout,
+		CommandTimeout:  time.Second,
+	})
+	startErr := make(chan error, 1)
+	go func() { startErr <- srv.StartWithContext(context.Background()) }()
+	<-srv.Ready()
+	addr := srv.Addr().String()
+
+	// Finished connections plus idle ones that shutdown has to close
+	var open []net.Conn
+	for i := 0; i < 10; i++ {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatalf("failed to dial: %v", err)
+		}
+		if _, err := conn.Write([]byte("INDEX|pkg|\n")); err != nil {
+			t.Fatalf("failed to write: %v", err)
+		}
+		if _, err := bufio.NewReader(conn).ReadString('\n'); err != nil {
+			t.Fatalf("failed to read: %v", err)
+		}
+		if i%2 == 0 {
+			conn.Close()
+		} else {
+			open = append(open, conn)
+		}
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), readyWaitTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+	select {
+	case <-startErr:
+	case <-time.After(readyWaitTimeout):
+		t.Fatal("StartWithContext did not return after shutdown")
+	}
+	for _, conn := range open {
+		conn.Close()
+	}
+
+	assertNoGoroutineLeak(t, baseline)
+}
+
+// TestShutdown_ReadinessDelay validates that the server stays ready and keeps serving new
+// connections during the readiness delay, and only then becomes not ready.
+func TestShutdown_ReadinessDelay(t *testing.T) {
+	const delay = 300 * time.Millisecond
+	srv := NewServerWithConfig(Config{Addr: "127.0.0.1:0", ReadTimeout: DefaultReadTimeout, ShutdownReadinessDelay: delay})
+	go func() { _ = srv.StartWithContext(context.Background()) }()
+	<-srv.Ready()
+
+	addr := srv.Addr().String()
+
+	shutdownDone := make(chan error, 1)
+	started := time.Now()
+	go func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), readyWaitTimeout)
+		defer cancel()
+		shutdownDone <- srv.Shutdown(shutdownCtx)
+	}()
+
+	time.Sleep(delay / 3)
+	if !srv.IsReady() {
+		t.Error("expected server to stay ready during the readiness delay")
+	}
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("expected new connections to be accepted during the delay: %v", err)
+	}
+	_, _ = conn.Write([]byte("INDEX|pkg|\n"))
+	resp, _ := bufio.NewReader(conn).ReadString('\n')
+	conn.Close()
+	if resp != wire.OK.String() {
+		t.Errorf("expected OK during the delay, got %q", resp)
+	}
+
+	select {
+	case err := <-shutdownDone:
+		if err != nil {
+			t.Errorf("unexpected shutdown error: %v", err)
+		}
+	case <-time.After(readyWaitTimeout):
+		t.Fatal("shutdown did not complete")
+	}
+	if elapsed := time.Since(started); elapsed < delay {
+		t.Errorf("shutdown finished after %v, before the %v readiness delay", elapsed, delay)
+	}
+	if srv.IsReady() {
+		t.Error("expected server to be not ready after shutdown")
+	}
+}
+
+// TestShutdown_ForceClosesStuckConnections validates that a handler blocked in a read
+// that context cancellation cannot reach is unblocked by forced closure on timeout.
+func TestShutdown_ForceClosesStuckConnections(t *testing.T) {
+	baseline := runtime.NumGoroutine()
+	srv := NewServer(":0", DefaultReadTimeout)
+	srv.ctx = context.Background() // Never cancelled, so only forced closure unblocks the read
+
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+	handlerDone := make(chan struct{})
+	srv.wg.Add(1)
+	go func() {
+		defer close(handlerDone)
+		srv.handleConnection(serverConn)
+	}()
+
+	// Wait for the handler to register and block reading an idle client
+	deadline := time.Now().Add(readyWaitTimeout)
+	for {
+		srv.connsMu.Lock()
+		tracked := len(srv.conns)
+		srv.connsMu.Unlock()
+		if tracked == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for connection to be registered")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != context.DeadlineExceeded {
+		t.Errorf("expected DeadlineExceeded, got %v", err)
+	}
+
+	select {
+	case <-handlerDone:
+	case <-time.After(readyWaitTimeout):
+		t.Fatal("handler still running after forced closure")
+	}
+	if _, err := clientConn.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("expected client to observe closed connection, got %v", err)
+	}
+	srv.connsMu.Lock()
+	tracked := len(srv.conns)
+	srv.connsMu.Unlock()
+	if tracked != 0 {
+		t.Errorf("expected empty connection registry, got %d entries", tracked)
+	}
+	clientConn.Close()
+	assertNoGoroutineLeak(t, baseline)
+}
+
+// TestServer_ResponseCodeMetrics validates that each reply served over a connection is
+// counted under its response code for a mixed workload.
+func TestServer_ResponseCodeMetrics(t *testing.T) {
+	s := NewServer(":0", DefaultReadTimeout)
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	defer s.cancel()
+
+	client, server := net.Pipe()
+	defer client.Close()
+	s.wg.Add(1)
+	go s.handleConnection(server)
+
+	workload := []string{
+		"INDEX|a|\n",     // OK
+		"INDEX|b|a\n",    // OK
+		"QUERY|b|\n",     // OK
+		"INDEX|c|zzz\n",  // FAIL: missing dependency
+		"REMOVE|a|\n",    // FAIL: b depends on a
+		"BOGUS|x|\n",     // ERROR
+		"INDEX|broken\n", // ERROR
+	}
+	reader := bufio.NewReader(client)
+	for _, line := range workload {
+		if _, err := client.Write([]byte(line)); err != nil {
+			t.Fatalf("failed to write %q: %v", line, err)
+		}
+		if _, err := reader.ReadString('\n'); err != nil {
+			t.Fatalf("failed to read response to %q: %v", line, err)
+		}
+	}
+
+	metrics := s.GetMetrics()
+	if metrics.ResponsesOK != 3 || metrics.ResponsesFail != 2 || metrics.ResponsesError != 2 {
+		t.Errorf("expected 3 OK / 2 FAIL / 2 ERROR, got %d / %d / %d",
+			metrics.ResponsesOK, metrics.ResponsesFail, metrics.ResponsesError)
+	}
+	if metrics.CommandsProcessed != int64(len(workload)) {
+		t.Errorf("expected %d commands, got %d", len(workload), metrics.CommandsProcessed)
+	}
+}
+
+// TestServeConn_EmptyLine validates that empty writes are ignored and a lone newline is
+// answered with exactly one ERROR, after which the connection keeps serving commands.
+func TestServeConn_EmptyLine(t *testing.T) {
+	s := NewServer(":0", DefaultReadTimeout)
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	defer s.cancel()
+
+	client, server := net.Pipe()
+	defer client.Close()
+	s.wg.Add(1)
+	go s.handleConnection(server)
+
+	// A zero-length write must not produce a response
+	if _, err := client.Write([]byte{}); err != nil {
+		t.Fatalf("failed to write empty payload: %v", err)
+	}
+	if _, err := client.Write([]byte("\n")); err != nil {
+		t.Fatalf("failed to write empty line: %v", err)
+	}
+	reader := bufio.NewReader(client)
+	if resp, err := reader.ReadString('\n'); err != nil || resp != wire.ERROR.String() {
+		t.Fatalf("expected single ERROR for empty line, got %q (err %v)", resp, err)
+	}
+
+	// The next response must belong to the next command, proving no extra ERRORs were queued
+	if _, err := client.Write([]byte("INDEX|pkg|\n")); err != nil {
+		t.Fatalf("failed to write command: %v", err)
+	}
+	if resp, err := reader.ReadString('\n'); err != nil || resp != wire.OK.String() {
+		t.Errorf("expected OK after empty line, got %q (err %v)", resp, err)
+	}
+	if commands := s.GetMetrics().CommandsProcessed; commands != 2 {
+		t.Errorf("expected 2 commands processed, got %d", commands)
+	}
+}
+
+// TestServer_ProcessRequest_Depth validates DEPTH replies for a chain, a leaf and a
+// missing package.
+func TestServer_ProcessRequest_Depth(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	srv := NewServer(":0", DefaultReadTimeout)
+	for _, cmd := range []string{"INDEX|a|\n", "INDEX|b|a\n", "INDEX|c|b,a\n"} {
+		srv.processRequest(logger, cmd)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"DEPTH|c|\n", "OK 2\n"},
+		{"DEPTH|a|\n", "OK 0\n"},
+		{"DEPTH|missing|\n", "FAIL\n"},
+	}
+	for _, test := range tests {
+		if reply := srv.processRequest(logger, test.input).String(); reply != test.expected {
+			t.Errorf("processRequest(%q) = %q, expected %q", test.input, reply, test.expected)
+		}
+	}
+}
+
+// TestServer_ProcessRequest_IndexCAS validates that INDEXCAS applies to new packages and
+// matching hashes, and reports the current hash on a mismatch.
+func TestServer_ProcessRequest_IndexCAS(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	srv := NewServer(":0", DefaultReadTimeout)
+	srv.processRequest(logger, "INDEX|a|\n")
+	srv.processRequest(logger, "INDEX|b|\n")
+
+	emptyHash := indexer.DependencyHash(nil)
+	aHash := indexer.DependencyHash([]string{"a"})
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"first-time index", "INDEXCAS|app|a|whatever\n", "OK hash=" + aHash + "\n"},
+		{"mismatched hash", "INDEXCAS|app|a,b|" + emptyHash + "\n", "FAIL hash=" + aHash + "\n"},
+		{"matching hash", "INDEXCAS|app|a,b|" + aHash + "\n", "OK hash=" + indexer.DependencyHash([]string{"b", "a"}) + "\n"},
+		{"missing dependency", "INDEXCAS|tool|ghost|\n", "FAIL\n"},
+	}
+	for _, test := range tests {
+		if reply := srv.processRequest(logger, test.input).String(); reply != test.expected {
+			t.Errorf("%s: processRequest(%q) = %q, expected %q", test.name, test.input, reply, test.expected)
+		}
+	}
+
+	if reply := srv.processRequest(logger, "STATUS|app|\n").String(); reply != "OK indexed=true deps=2 dependents=0\n" {
+		t.Errorf("expected app to have both dependencies after CAS, got %q", reply)
+	}
+}
+
+// TestServer_ProcessRequest_MaxPackages validates that the default store honors the
+// package limit: new packages FAIL once it is reached while re-indexes succeed.
+func TestServer_ProcessRequest_MaxPackages(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	srv := NewServerWithConfig(Config{Addr: ":0", ReadTimeout: DefaultReadTimeout, MaxPackages: 1})
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"INDEX|a|\n", "OK\n"},
+		{"INDEX|b|\n", "FAIL\n"},
+		{"INDEX|a|\n", "OK\n"},
+		{"QUERY|b|\n", "FAIL\n"},
+	}
+	for _, test := range tests {
+		if reply := srv.processRequest(logger, test.input).String(); reply != test.expected {
+			t.Errorf("processRequest(%q) = %q, expected %q", test.input, reply, test.expected)
+		}
+	}
+	if rejections := srv.OperationStats().CapacityRejections; rejections != 1 {
+		t.Errorf("expected 1 capacity rejection, got %d", rejections)
+	}
+}
+
+// TestServer_ProcessRequest_Search validates that SEARCH returns matching packages as a
+// framed multi-line reply, including an empty body when nothing matches.
+func TestServer_ProcessRequest_Search(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	srv := NewServer(":0", DefaultReadTimeout)
+	for _, cmd := range []string{"INDEX|libb|\n", "INDEX|liba|\n", "INDEX|app|liba\n"} {
+		srv.processRequest(logger, cmd)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"SEARCH|lib|\n", "OK\nliba\nlibb\n\n"},
+		{"SEARCH|*b|\n", "OK\nlibb\n\n"},
+		{"SEARCH|none|\n", "OK\n\n"},
+	}
+	for _, test := range tests {
+		if reply := srv.processRequest(logger, test.input).String(); reply != test.expected {
+			t.Errorf("processRequest(%q) = %q, expected %q", test.input, reply, test.expected)
+		}
+	}
+}
+
+// TestServer_ProcessRequest_Edges validates that EDGES reports both edge directions for a
+// package in the middle of a chain, and FAILs for a missing package.
+func TestServer_ProcessRequest_Edges(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	srv := NewServer(":0", DefaultReadTimeout)
+	for _, cmd := range []string{"INDEX|a|\n", "INDEX|b|\n", "INDEX|mid|b,a\n", "INDEX|y|mid\n", "INDEX|x|mid\n"} {
+		srv.processRequest(logger, cmd)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"EDGES|mid|\n", "OK\nDEPS: a,b\nDEPENDENTS: x,y\n\n"},
+		{"EDGES|a|\n", "OK\nDEPS: \nDEPENDENTS: mid\n\n"},
+		{"EDGES|missing|\n", "FAIL\n"},
+	}
+	for _, test := range tests {
+		if reply := srv.processRequest(logger, test.input).String(); reply != test.expected {
+			t.Errorf("processRequest(%q) = %q, expected %q", test.input, reply, test.expected)
+		}
+	}
+}
+
+// TestServer_ProcessRequest_RejectCycles validates that a cycle closed across two INDEX
+// commands is refused only when cycle rejection is enabled.
+func TestServer_ProcessRequest_RejectCycles(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	for _, reject := range []bool{false, true} {
+		srv := NewServerWithConfig(Config{Addr: ":0", ReadTimeout: DefaultReadTimeout, RejectCycles: reject})
+		for _, cmd := range []string{"INDEX|b|\n", "INDEX|a|b\n"} {
+			if reply := srv.processRequest(logger, cmd).String(); reply != "OK\n" {
+				t.Fatalf("processRequest(%q) = %q, expected OK", cmd, reply)
+			}
+		}
+
+		expected := "OK\n"
+		if reject {
+			expected = "FAIL\n"
+		}
+		if reply := srv.processRequest(logger, "INDEX|b|a\n").String(); reply != expected {
+			t.Errorf("RejectCycles=%v: closing the cycle = %q, expected %q", reject, reply, expected)
+		}
+		if reply := srv.processRequest(logger, "ADDDEP|b|a\n").String(); reply != expected {
+			t.Errorf("RejectCycles=%v: ADDDEP closing the cycle = %q, expected %q", reject, reply, expected)
+		}
+	}
+}
+
+// TestServer_ProcessRequest_CanRemove validates that CANREMOVE predicts REMOVE for
+// removable, blocked and missing packages without changing the index.
+func TestServer_ProcessRequest_CanRemove(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	srv := NewServer(":0", DefaultReadTimeout)
+	for _, cmd := range []string{"INDEX|base|\n", "INDEX|app|base\n"} {
+		srv.processRequest(logger, cmd)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"CANREMOVE|app|\n", "OK\n"},
+		{"CANREMOVE|base|\n", "FAIL\n"},
+		{"CANREMOVE|missing|\n", "OK\n"},
+	}
+	for _, test := range tests {
+		if reply := srv.processRequest(logger, test.input).String(); reply != test.expected {
+			t.Errorf("processRequest(%q) = %q, expected %q", test.input, reply, test.expected)
+		}
+	}
+
+	if stats := srv.GetStats(); stats.Indexed != 2 {
+		t.Errorf("expected both packages to remain indexed, got %d", stats.Indexed)
+	}
+	if attempts := srv.OperationStats().RemoveAttempts; attempts != 0 {
+		t.Errorf("expected CANREMOVE not to count as a remove attempt, got %d", attempts)
+	}
+	for _, cmd := range []string{"QUERY|app|\n", "QUERY|base|\n"} {
+		if reply := srv.processRequest(logger, cmd).String(); reply != "OK\n" {
+			t.Errorf("processRequest(%q) = %q after CANREMOVE, expected OK", cmd, reply)
+		}
+	}
+}
+
+// TestServer_ProcessRequest_Build validates that BUILD answers a well-formed version and
+// commit, and that missing build info falls back to placeholders.
+func TestServer_ProcessRequest_Build(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	srv := NewServer(":0", DefaultReadTimeout)
+
+	reply := srv.processRequest(logger, "BUILD||\n").String()
+	fields := strings.Fields(reply)
+	if !strings.HasSuffix(reply, "\n") || len(fields) != 3 || fields[0] != "OK" {
+		t.Fatalf("BUILD = %q, expected \"OK <version> <commit>\"", reply)
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && fields[1] != info.Main.Version {
+		t.Errorf("BUILD version = %q, expected %q", fields[1], info.Main.Version)
+	}
+
+	tests := []struct {
+		info     *debug.BuildInfo
+		ok       bool
+		expected string
+	}{
+		{nil, false, "unknown unknown"},
+		{&debug.BuildInfo{}, true, "unknown unknown"},
+		{&debug.BuildInfo{
+			Main:     debug.Module{Version: "v1.2.3"},
+			Settings: []debug.BuildSetting{{Key: "vcs", Value: "git"}, {Key: "vcs.revision", Value: "abc123"}},
+		}, true, "v1.2.3 abc123"},
+	}
+	for _, test := range tests {
+		if got := buildVersion(test.info, test.ok); got != test.expected {
+			t.Errorf("buildVersion(%+v, %v) = %q, expected %q", test.info, test.ok, got, test.expected)
+		}
+	}
+}
+
+// TestServer_ProcessRequest_Path validates that PATH answers the dependency chain between
+// two packages, a direct edge, and FAIL when no path exists.
+func TestServer_ProcessRequest_Path(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	srv := NewServer(":0", DefaultReadTimeout)
+	for _, cmd := range []string{"INDEX|base|\n", "INDEX|x|base\n", "INDEX|y|x\n", "INDEX|app|y\n", "INDEX|tool|\n"} {
+		srv.processRequest(logger, cmd)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"PATH|app|base\n", "OK app,y,x,base\n"},
+		{"PATH|x|base\n", "OK x,base\n"},
+		{"PATH|base|app\n", "FAIL\n"}, // Edges only lead toward dependencies
+		{"PATH|app|tool\n", "FAIL\n"},
+		{"PATH|app|missing\n", "FAIL\n"},
+		{"PATH|app|\n", "ERROR\n"},
+	}
+	for _, test := range tests {
+		if reply := srv.processRequest(logger, test.input).String(); reply != test.expected {
+			t.Errorf("processRequest(%q) = %q, expected %q", test.input, reply, test.expected)
+		}
+	}
+}
+
+// TestServer_ProcessRequest_Pin validates that PIN blocks REMOVE of a package without
+// dependents, that STATUS reports the pin, and that UNPIN restores normal removal.
+func TestServer_ProcessRequest_Pin(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	srv := NewServer(":0", DefaultReadTimeout)
+
+	steps := []struct {
+		input    string
+		expected string
+	}{
+		{"PIN|app|\n", "FAIL\n"}, // Not indexed yet
+		{"INDEX|app|\n", "OK\n"},
+		{"PIN|app|\n", "OK\n"},
+		{"INDEX|app|\n", "OK\n"}, // Re-indexing keeps the pin
+		{"STATUS|app|\n", "OK indexed=true deps=0 dependents=0 pinned=true\n"},
+		{"CANREMOVE|app|\n", "FAIL\n"},
+		{"REMOVE|app|\n", "FAIL\n"},
+		{"UNPIN|app|\n", "OK\n"},
+		{"UNPIN|app|\n", "OK\n"}, // Idempotent
+		{"STATUS|app|\n", "OK indexed=true deps=0 dependents=0\n"},
+		{"REMOVE|app|\n", "OK\n"},
+	}
+	for _, step := range steps {
+		if reply := srv.processRequest(logger, step.input).String(); reply != step.expected {
+			t.Errorf("processRequest(%q) = %q, expected %q", step.input, reply, step.expected)
+		}
+	}
+	if pinned := srv.OperationStats().RemovePinned; pinned != 1 {
+		t.Errorf("expected 1 remove refused by a pin, got %d", pinned)
+	}
+}
+
+// TestServer_ProcessRequest_DependencyDeltas validates that ADDDEP and RMDEP adjust an
+// indexed package's dependencies in place, keeping removal blocking in step.
+func TestServer_ProcessRequest_DependencyDeltas(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	srv := NewServer(":0", DefaultReadTimeout)
+	for _, cmd := range []string{"INDEX|a|\n", "INDEX|b|\n", "INDEX|app|a\n"} {
+		srv.processRequest(logger, cmd)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"ADDDEP|app|b\n", "OK\n"},
+		{"EDGES|app|\n", "OK\nDEPS: a,b\nDEPENDENTS: \n\n"},
+		{"REMOVE|b|\n", "FAIL\n"},
+		{"ADDDEP|app|missing\n", "FAIL\n"},
+		{"ADDDEP|missing|a\n", "FAIL\n"},
+		{"RMDEP|app|b,unrelated\n", "OK\n"},
+		{"EDGES|app|\n", "OK\nDEPS: a\nDEPENDENTS: \n\n"},
+		{"REMOVE|b|\n", "OK\n"},
+		{"RMDEP|missing|a\n", "FAIL\n"},
+	}
+	for _, test := range tests {
+		if reply := srv.processRequest(logger, test.input).String(); reply != test.expected {
+			t.Errorf("processRequest(%q) = %q, expected %q", test.input, reply, test.expected)
+		}
+	}
+}
+
+// TestServer_ProcessRequest_EscapedNames validates that escaped separators reach the
+// indexer as part of the names when enabled.
+func TestServer_ProcessRequest_EscapedNames(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	srv := NewServerWithConfig(Config{Addr: ":0", ReadTimeout: DefaultReadTimeout, EscapedNames: true})
+
+	for _, cmd := range []string{`INDEX|c\,d|` + "\n", `INDEX|a\|b|c\,d` + "\n"} {
+		if reply := srv.processRequest(logger, cmd).String(); reply != "OK\n" {
+			t.Errorf("processRequest(%q) = %q, expected OK", cmd, reply)
+		}
+	}
+	deps, dependents, ok := srv.indexer.Edges("a|b")
+	if !ok || len(deps) != 1 || deps[0] != "c,d" || len(dependents) != 0 {
+		t.Errorf("Edges(a|b) = (%q, %q, %v), expected ([c,d], [], true)", deps, dependents, ok)
+	}
+}
+
+// TestServer_ProcessRequest_LabeledDeps validates that an optional dependency does not
+// block removal while a required one does, and that unknown labels are an ERROR.
+func TestServer_ProcessRequest_LabeledDeps(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	srv := NewServerWithConfig(Config{Addr: ":0", ReadTimeout: DefaultReadTimeout, LabeledDeps: true})
+
+	steps := []struct {
+		input    string
+		expected string
+	}{
+		{"INDEX|db|\n", "OK\n"},
+		{"INDEX|cache|\n", "OK\n"},
+		{"INDEX|app|db:required,cache:optional\n", "OK\n"},
+		{"INDEX|app|db:weak\n", "ERROR\n"},
+		{"REMOVE|db|\n", "FAIL\n"},
+		{"REMOVE|cache|\n", "OK\n"},
+		{"EDGES|app|\n", "OK\nDEPS: db\nDEPENDENTS: \n\n"},
+		{"INDEX|app|missing:optional\n", "FAIL\n"}, // Optional dependencies must still be indexed
+	}
+	for _, step := range steps {
+		if reply := srv.processRequest(logger, step.input).String(); reply != step.expected {
+			t.Errorf("processRequest(%q) = %q, expected %q", step.input, reply, step.expected)
+		}
+	}
+
+	// Without the option the colon is part of the dependency name
+	plain := NewServer(":0", DefaultReadTimeout)
+	plain.processRequest(logger, "INDEX|cache|\n")
+	if reply := plain.processRequest(logger, "INDEX|app|cache:optional\n").String(); reply != "FAIL\n" {
+		t.Errorf("unlabeled server INDEX = %q, expected FAIL for the unknown dependency", reply)
+	}
+}
+
+// TestServer_ProcessRequest_Rename validates that RENAME redirects dependents to the new
+// name and FAILs for a missing source or a taken destination.
+func TestServer_ProcessRequest_Rename(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	srv := NewServer(":0", DefaultReadTimeout)
+	for _, cmd := range []string{"INDEX|a|\n", "INDEX|mid|a\n", "INDEX|x|mid\n"} {
+		srv.processRequest(logger, cmd)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"RENAME|mid|core\n", "OK\n"},
+		{"QUERY|mid|\n", "FAIL\n"},
+		{"EDGES|core|\n", "OK\nDEPS: a\nDEPENDENTS: x\n\n"},
+		{"REMOVE|core|\n", "FAIL\n"}, // x now depends on core
+		{"RENAME|missing|other\n", "FAIL\n"},
+		{"RENAME|core|a\n", "FAIL\n"},
+		{"RENAME|core|\n", "ERROR\n"},
+	}
+	for _, test := range tests {
+		if reply := srv.processRequest(logger, test.input).String(); reply != test.expected {
+			t.Errorf("processRequest(%q) = %q, expected %q", test.input, reply, test.expected)
+		}
+	}
+	if stats := srv.GetStats(); stats.Indexed != 3 {
+		t.Errorf("expected 3 indexed packages after rename, got %d", stats.Indexed)
+	}
+}
+
+// TestServer_ConnectionLimits validates that crossing the soft limit warns without
+// rejecting, while the hard limit refuses further connections.
+func TestServer_ConnectionLimits(t *testing.T) {
+	var logs bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, nil)))
+	defer slog.SetDefault(previous)
+
+	srv := NewServerWithConfig(Config{Addr: "127.0.0.1:0", ReadTimeout: DefaultReadTimeout, SoftMaxConns: 1, MaxConns: 3})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = srv.StartWithContext(ctx) }()
+	<-srv.Ready()
+	defer func() {
+		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), shutdownWaitTimeout)
+		defer shutdownCancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	addr := srv.Addr().String()
+
+	// Each connection is confirmed served before the next dial so counts are deterministic
+	query := func() string {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatalf("failed to dial: %v", err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		_, _ = conn.Write([]byte("QUERY|x|\n"))
+		resp, _ := bufio.NewReader(conn).ReadString('\n')
+		return resp
+	}
+
+	for i := 1; i <= 3; i++ {
+		if resp := query(); resp != wire.FAIL.String() {
+			t.Fatalf("connection %d below hard limit: expected FAIL, got %q", i, resp)
+		}
+	}
+	metrics := srv.GetMetrics()
+	if metrics.SoftLimitWarnings != 2 || metrics.ConnsRejected != 0 {
+		t.Errorf("expected 2 soft limit warnings and no rejections, got %d and %d", metrics.SoftLimitWarnings, metrics.ConnsRejected)
+	}
+	if warnings := strings.Count(logs.String(), "Active connections above soft limit"); warnings != 1 {
+		t.Errorf("expected exactly one rate-limited warning log, got %d", warnings)
+	}
+
+	if resp := query(); resp != wire.ERROR.String() {
+		t.Errorf("connection above hard limit: expected ERROR, got %q", resp)
+	}
+	if rejected := srv.GetMetrics().ConnsRejected; rejected != 1 {
+		t.Errorf("expected 1 hard limit rejection, got %d", rejected)
+	}
+}
+
+// TestServeConn_CommandReadDeadlines validates that a slowly arriving INDEX line is
+// granted its longer deadline while a QUERY line stalling past its shorter one is cut off.
+// TestServeConn_CommandReadDeadlineLifetime validates that a command-specific read
+// deadline never keeps a connection open past its maximum lifetime
+func TestServeConn_CommandReadDeadlineLifetime(t *testing.T) {
+	const lifetime = 150 * time.Millisecond
+	s := NewServerWithConfig(Config{
+		Addr:             ":0",
+		ReadTimeout:      5 * time.Second,
+		IndexReadTimeout: 5 * time.Second,
+		MaxConnLifetime:  lifetime,
+	})
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	defer s.cancel()
+
+	client, server := net.Pipe()
+	defer client.Close()
+	started := time.Now()
+	s.wg.Add(1)
+	go s.handleConnection(server)
+
+	// The INDEX name arrives, switching to the long INDEX deadline, then the line stalls
+	if _, err := client.Write([]byte("INDEX|pkg|")); err != nil {
+		t.Fatalf("failed to write INDEX prefix: %v", err)
+	}
+	if _, err := bufio.NewReader(client).ReadString('\n'); err != io.EOF {
+		t.Errorf("expected the server to close the connection, got %v", err)
+	}
+	if age := time.Since(started); age < lifetime || age > lifetime+readyWaitTimeout {
+		t.Errorf("connection closed after %v, expected about %v", age, lifetime)
+	}
+}
+
+func TestServeConn_CommandReadDeadlines(t *testing.T) {
+	s := NewServerWithConfig(Config{
+		Addr:             ":0",
+		ReadTimeout:      200 * time.Millisecond,
+		IndexReadTimeout: time.Second,
+		QueryReadTimeout: 50 * time.Millisecond,
+	})
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	defer s.cancel()
+
+	client, server := net.Pipe()
+	defer client.Close()
+	s.wg.Add(1)
+	go s.handleConnection(server)
+	reader := bufio.NewReader(client)
+
+	// INDEX stalls past the idle read timeout but within its own deadline
+	if _, err := client.Write([]byte("INDEX|pkg|")); err != nil {
+		t.Fatalf("failed to write INDEX prefix: %v", err)
+	}
+	time.Sleep(400 * time.Millisecond)
+	if _, err := client.Write([]byte("\n")); err != nil {
+		t.Fatalf("slow INDEX was cut off: %v", err)
+	}
+	if resp, err := reader.ReadString('\n'); err != nil || resp != wire.OK.String() {
+		t.Fatalf("expected OK for slow INDEX, got %q (err %v)", resp, err)
+	}
+
+	// QUERY stalls past its own deadline, though still within the idle read timeout
+	if _, err := client.Write([]byte("QUERY|pkg")); err != nil {
+		t.Fatalf("failed to write QUERY prefix: %v", err)
+	}
+	time.Sleep(150 * time.Millisecond)
+	_ = client.SetDeadline(time.Now().Add(readyWaitTimeout))
+	if _, err := client.Write([]byte("|\n")); err == nil {
+		if resp, err := reader.ReadString('\n'); err == nil {
+			t.Errorf("expected slow QUERY to be cut off, got response %q", resp)
+		}
+	}
+}
+
+// TestServer_ProcessRequest_CommandFilter validates that commands refused by the allow or
+// deny list get ERROR without reaching the store while permitted commands still work
+func TestServer_ProcessRequest_CommandFilter(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	store := indexer.NewIndexer()
+	store.IndexPackage("base", nil)
+
+	tests := []struct {
+		name  string
+		cfg   Config
+		steps []struct{ input, expected string }
+	}{
+		{
+			name: "deny list",
+			cfg:  Config{DenyCommands: []wire.CommandType{wire.IndexCommand, wire.RemoveCommand}},
+			steps: []struct{ input, expected string }{
+				{"INDEX|app|base\n", "ERROR\n"},
+				{"REMOVE|base|\n", "ERROR\n"},
+				{"QUERY|base|\n", "OK\n"},
+				{"QUERY|app|\n", "FAIL\n"},
+			},
+		},
+		{
+			name: "allow list",
+			cfg:  Config{AllowCommands: []wire.CommandType{wire.QueryCommand}},
+			steps: []struct{ input, expected string }{
+				{"QUERY|base|\n", "OK\n"},
+				{"REMOVE|base|\n", "ERROR\n"},
+				{"STATUS|base|\n", "ERROR\n"},
+			},
+		},
+		{
+			name: "verbose",
+			cfg:  Config{DenyCommands: []wire.CommandType{wire.RemoveCommand}, Verbose: true},
+			steps: []struct{ input, expected string }{
+				{"REMOVE|base|\n", "ERROR forbidden\n"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.Store = store
+			srv := NewServerWithConfig(tt.cfg)
+			for _, step := range tt.steps {
+				if reply := srv.processRequest(logger, step.input).String(); reply != step.expected {
+					t.Errorf("processRequest(%q) = %q, expected %q", step.input, reply, step.expected)
+				}
+			}
+		})
+	}
+	if !store.QueryPackage("base") {
+		t.Error("expected denied REMOVE to leave the store untouched")
+	}
+	if store.QueryPackage("app") {
+		t.Error("expected denied INDEX to leave the store untouched")
+	}
+}
+
+// TestServer_ProcessRequest_ReadOnly validates that read-only mode rejects every mutating
+// command with a read-only ERROR while reads are served from the existing index
+func TestServer_ProcessRequest_ReadOnly(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	store := indexer.NewIndexer()
+	store.IndexPackage("base", nil)
+	store.IndexPackage("app", []string{"base"})
+	srv := NewServerWithConfig(Config{Store: store, ReadOnly: true})
+
+	steps := []struct {
+		input    string
+		expected string
+	}{
+		{"INDEX|new|\n", "ERROR read-only\n"},
+		{"INDEXCAS|app|base|0000000000000000\n", "ERROR read-only\n"},
+		{"REMOVE|app|\n", "ERROR read-only\n"},
+		{"RENAME|app|app2\n", "ERROR read-only\n"},
+		{"ADDDEP|app|new\n", "ERROR read-only\n"},
+		{"RMDEP|app|base\n", "ERROR read-only\n"},
+		{"PIN|app|\n", "ERROR read-only\n"},
+		{"UNPIN|app|\n", "ERROR read-only\n"},
+		{"QUERY|app|\n", "OK\n"},
+		{"QUERY|new|\n", "FAIL\n"},
+		{"STATUS|base|\n", "OK indexed=true deps=0 dependents=1\n"},
+		{"DEPTH|app|\n", "OK 1\n"},
+		{"PATH|app|base\n", "OK app,base\n"},
+		{"CANREMOVE|base|\n", "FAIL\n"},
+	}
+	for _, step := range steps {
+		if reply := srv.processRequest(logger, step.input).String(); reply != step.expected {
+			t.Errorf("processRequest(%q) = %q, expected %q", step.input, reply, step.expected)
+		}
+	}
+	if deps, _, ok := store.Edges("app"); !ok || len(deps) != 1 {
+		t.Errorf("expected app to keep its single dependency, got %v (indexed %t)", deps, ok)
+	}
+}
+
+// TestServer_ProcessRequest_Gen validates that GEN reports a graph version that moves on
+// INDEX and REMOVE but not on QUERY
+func TestServer_ProcessRequest_Gen(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	srv := NewServer(":0", DefaultReadTimeout)
+
+	steps := []struct {
+		input    string
+		expected string
+	}{
+		{"GEN||\n", "OK 0\n"},
+		{"INDEX|base|\n", "OK\n"},
+		{"GEN||\n", "OK 1\n"},
+		{"QUERY|base|\n", "OK\n"},
+		{"QUERY|missing|\n", "FAIL\n"},
+		{"GEN||\n", "OK 1\n"},
+		{"INDEX|app|missing\n", "FAIL\n"}, // Failed mutations leave the graph unchanged
+		{"GEN||\n", "OK 1\n"},
+		{"REMOVE|base|\n", "OK\n"},
+		{"GEN||\n", "OK 2\n"},
+	}
+	for _, step := range steps {
+		if reply := srv.processRequest(logger, step.input).String(); reply != step.expected {
+			t.Errorf("processRequest(%q) = %q, expected %q", step.input, reply, step.expected)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"log/slog"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Load shedding tuning constants
+const (
+	shedWindowSize = 100             // Number of recent command latencies considered
+	shedPercentile = 0.99            // Percentile compared against the threshold
+	shedIdleReset  = 5 * time.Second // Stale windows stop shedding once traffic goes quiet
+)
+
+// loadShedder tracks a sliding window of recent command latencies and flips into
+// shedding mode when the window's p99 exceeds the configured threshold. While shedding,
+// new connections are rejected immediately so existing clients can drain the backlog.
+type loadShedder struct {
+	threshold time.Duration
+
+	mu           sync.Mutex
+	samples      []time.Duration // Ring buffer of recent latencies
+	next         int
+	lastObserved time.Time
+
+	shedding atomic.Bool
+}
+
+// newLoadShedder creates a shedder that activates when p99 latency exceeds threshold
+func newLoadShedder(threshold time.Duration) *loadShedder {
+	return &loadShedder{
+		threshold: threshold,
+		samples:   make([]time.Duration, 0, shedWindowSize),
+	}
+}
+
+// observe records a command latency and re-evaluates the shedding state
+func (l *loadShedder) observe(latency time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.samples) < shedWindowSize {
+		l.samples = append(l.samples, latency)
+	} else {
+		l.samples[l.next] = latency
+	}
+	l.next = (l.next + 1) % shedWindowSize
+	l.lastObserved = time.Now()
+
+	l.setShedding(l.percentileLocked(shedPercentile) > l.threshold)
+}
+
+// isShedding reports whether new connections should be rejected. A window that has not
+// seen traffic recently is treated as recovered, since nothing is currently running slow.
+func (l *loadShedder) isShedding() bool {
+	if !l.shedding.Load() {
+		return false
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if time.Since(l.lastObserved) > shedIdleReset {
+		l.samples = l.samples[:0]
+		l.next = 0
+		l.setShedding(false)
+	}
+	return l.shedding.Load()
+}
+
+// setShedding updates the shedding flag and logs state transitions
+func (l *loadShedder) setShedding(shed bool) {
+	if l.shedding.Swap(shed) == shed {
+		return
+	}
+	if shed {
+		slog.Warn("Load shedding activated", "threshold", l.threshold)
+	} else {
+		slog.Info("Load shedding deactivated", "threshold", l.threshold)
+	}
+}
+
+// percentileLocked returns the given percentile of the current window; caller holds mu
+func (l *loadShedder) percentileLocked(p float64) time.Duration {
+	if len(l.samples) == 0 {
+		return 0
+	}
+	sorted := make([]time.Duration, len(l.samples))
+	copy(sorted, l.samples)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	rank := int(p*float64(len(sorted)+1)) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
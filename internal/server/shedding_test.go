@@ -0,0 +1,111 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"package-indexer/internal/wire"
+)
+
+// observeN feeds the same latency into the shedder n times.
+func observeN(l *loadShedder, latency time.Duration, n int) {
+	for i := 0; i < n; i++ {
+		l.observe(latency)
+	}
+}
+
+// TestLoadShedder_ActivatesAndRecovers validates the shedding flag follows the p99 of the
+// latency window in both directions.
+func TestLoadShedder_ActivatesAndRecovers(t *testing.T) {
+	l := newLoadShedder(10 * time.Millisecond)
+
+	observeN(l, time.Millisecond, shedWindowSize)
+	if l.isShedding() {
+		t.Fatal("expected no shedding with latency below threshold")
+	}
+
+	observeN(l, 50*time.Millisecond, shedWindowSize)
+	if !l.isShedding() {
+		t.Fatal("expected shedding once p99 exceeds threshold")
+	}
+
+	observeN(l, time.Millisecond, shedWindowSize)
+	if l.isShedding() {
+		t.Fatal("expected shedding to clear after latency recovers")
+	}
+}
+
+// TestLoadShedder_IdleReset validates a stale slow window stops shedding once traffic
+// has been quiet for the idle reset period.
+func TestLoadShedder_IdleReset(t *testing.T) {
+	l := newLoadShedder(10 * time.Millisecond)
+	observeN(l, 50*time.Millisecond, shedWindowSize)
+
+	l.mu.Lock()
+	l.lastObserved = time.Now().Add(-2 * shedIdleReset)
+	l.mu.Unlock()
+
+	if l.isShedding() {
+		t.Error("expected idle window to stop shedding")
+	}
+}
+
+// TestServer_LoadShedding injects artificial latency and verifies new connections are
+// rejected with ERROR while shedding, then served normally after recovery.
+func TestServer_LoadShedding(t *testing.T) {
+	srv := NewServerWithConfig(Config{
+		Addr:                 "127.0.0.1:0",
+		ReadTimeout:          DefaultReadTimeout,
+		ShedLatencyThreshold: 10 * time.Millisecond,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go srv.StartWithContext(ctx)
+	<-srv.Ready()
+	addr := srv.Addr().String()
+
+	observeN(srv.shedder, 50*time.Millisecond, shedWindowSize)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("failed to dial server: %v", err)
+	}
+	reader := bufio.NewReader(conn)
+	resp, err := reader.ReadString('\n')
+	if err != nil {
+		t.Fatalf("failed to read rejection: %v", err)
+	}
+	if resp != wire.ERROR.String() {
+		t.Errorf("expected ERROR rejection, got %q", resp)
+	}
+	if _, err := reader.ReadString('\n'); err != io.EOF {
+		t.Errorf("expected rejected connection to be closed, got %v", err)
+	}
+	conn.Close()
+
+	if got := srv.GetMetrics().ServerOverloaded; got != 1 {
+		t.Errorf("expected ServerOverloaded=1, got %d", got)
+	}
+
+	observeN(srv.shedder, time.Millisecond, shedWindowSize)
+
+	conn, err = net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("failed to dial server: %v", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("INDEX|pkg|\n")); err != nil {
+		t.Fatalf("failed to write command: %v", err)
+	}
+	resp, err = bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatalf("failed to read response: %v", err)
+	}
+	if resp != wire.OK.String() {
+		t.Errorf("expected OK after recovery, got %q", resp)
+	}
+}
@@ -0,0 +1,262 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"package-indexer/internal/indexer"
+	"package-indexer/internal/wire"
+)
+
+// FaultInjectingStore wraps a real PackageStore and injects configured faults, making
+// error paths in processCommand reachable that the real indexer never produces.
+// Configure faults before handing the store to a server.
+type FaultInjectingStore struct {
+	indexer.PackageStore
+
+	Latency      time.Duration         // Added before every operation
+	FailIndex    bool                  // IndexPackage reports failure without indexing
+	RemoveResult *indexer.RemoveResult // Overrides the RemovePackage result when set
+	FailQuery    bool                  // QueryPackage and DependencyCount report absence
+	PanicIndex   bool                  // IndexPackage panics, simulating a backend bug
+	BlockIndex   chan struct{}         // IndexPackage waits for it to close when set
+}
+
+// NewFaultInjectingStore creates a store backed by a fresh in-memory indexer
+func NewFaultInjectingStore() *FaultInjectingStore {
+	return &FaultInjectingStore{PackageStore: indexer.NewIndexer()}
+}
+
+func (f *FaultInjectingStore) delay() {
+	if f.Latency > 0 {
+		time.Sleep(f.Latency)
+	}
+}
+
+func (f *FaultInjectingStore) IndexPackage(pkg string, deps []string) bool {
+	f.delay()
+	if f.BlockIndex != nil {
+		<-f.BlockIndex
+	}
+	if f.PanicIndex {
+		panic("injected IndexPackage panic")
+	}
+	if f.FailIndex {
+		return false
+	}
+	return f.PackageStore.IndexPackage(pkg, deps)
+}
+
+func (f *FaultInjectingStore) RemovePackage(pkg string) indexer.RemoveResult {
+	f.delay()
+	if f.RemoveResult != nil {
+		return *f.RemoveResult
+	}
+	return f.PackageStore.RemovePackage(pkg)
+}
+
+func (f *FaultInjectingStore) QueryPackage(pkg string) bool {
+	f.delay()
+	if f.FailQuery {
+		return false
+	}
+	return f.PackageStore.QueryPackage(pkg)
+}
+
+func (f *FaultInjectingStore) DependencyCount(pkg string) (int, bool) {
+	f.delay()
+	if f.FailQuery {
+		return 0, false
+	}
+	return f.PackageStore.DependencyCount(pkg)
+}
+
+func (f *FaultInjectingStore) GetStats() (int, int, int) {
+	f.delay()
+	return f.PackageStore.GetStats()
+}
+
+// TestServer_FaultInjection validates that the server responds sanely when the store
+// misbehaves: failures map to FAIL, unknown results to ERROR, and nothing is counted
+// as indexed unless the store accepted it.
+func TestServer_FaultInjection(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	unexpected := indexer.RemoveResult(99)
+	blocked := indexer.RemoveResultBlocked
+
+	tests := []struct {
+		name     string
+		fault    func(*FaultInjectingStore)
+		input    string
+		expected wire.Response
+	}{
+		{"index rejected", func(f *FaultInjectingStore) { f.FailIndex = true }, "INDEX|a|\n", wire.FAIL},
+		{"remove unexpected state", func(f *FaultInjectingStore) { f.RemoveResult = &unexpected }, "REMOVE|a|\n", wire.ERROR},
+		{"remove spuriously blocked", func(f *FaultInjectingStore) { f.RemoveResult = &blocked }, "REMOVE|a|\n", wire.FAIL},
+		{"query lost package", func(f *FaultInjectingStore) { f.FailQuery = true }, "QUERY|a|\n", wire.FAIL},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewFaultInjectingStore()
+			store.PackageStore.IndexPackage("a", nil)
+			tt.fault(store)
+
+			srv := NewServerWithConfig(Config{Addr: ":0", ReadTimeout: DefaultReadTimeout, Store: store})
+			if result := srv.processCommand(logger, tt.input); result != tt.expected {
+				t.Errorf("processCommand(%q) = %v, expected %v", tt.input, result, tt.expected)
+			}
+			if indexed := srv.GetMetrics().PackagesIndexed; indexed != 0 {
+				t.Errorf("expected no packages counted as indexed, got %d", indexed)
+			}
+		})
+	}
+}
+
+// TestServer_FaultInjection_Latency validates that a slow store trips the command
+// timeout instead of stalling the client.
+func TestServer_FaultInjection_Latency(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	store := NewFaultInjectingStore()
+	store.Latency = 100 * time.Millisecond
+
+	srv := NewServerWithConfig(Config{
+		Addr:           ":0",
+		ReadTimeout:    DefaultReadTimeout,
+		CommandTimeout: 10 * time.Millisecond,
+		Store:          store,
+	})
+
+	if reply, _ := srv.executeRequest(logger, "INDEX|a|\n"); reply.Code != wire.ERROR {
+		t.Errorf("expected ERROR from slow store, got %v", reply.Code)
+	}
+	if timeouts := srv.GetMetrics().CommandTimeouts; timeouts != 1 {
+		t.Errorf("expected 1 command timeout, got %d", timeouts)
+	}
+}
+
+// TestServer_CommandTimeout_Abandoned validates what happens to a command after its
+// client was told it timed out: one that had not reached the store is never applied,
+// and one already inside the store finishes before the connection's next command runs
+// and is logged as completed.
+func TestServer_CommandTimeout_Abandoned(t *testing.T) {
+	var logs syncBuffer
+	originalHandler := slog.Default().Handler()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, nil)))
+	defer slog.SetDefault(slog.New(originalHandler))
+
+	store := NewFaultInjectingStore()
+	store.BlockIndex = make(chan struct{})
+	srv := NewServerWithConfig(Config{Addr: ":0", ReadTimeout: DefaultReadTimeout, CommandTimeout: 20 * time.Millisecond, Store: store})
+	srv.ctx, srv.cancel = context.WithCancel(context.Background())
+	defer srv.cancel()
+
+	// Held before reaching the store until well past its deadline
+	hold := make(chan struct{})
+	srv.commandHook = func(cmd *wire.Command) {
+		if cmd.Package == "early" {
+			<-hold
+		}
+	}
+
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	srv.wg.Add(1)
+	go srv.handleConnection(serverConn)
+	reader := bufio.NewReader(clientConn)
+
+	send := func(cmd string) <-chan string {
+		replies := make(chan string, 1)
+		go func() {
+			if _, err := clientConn.Write([]byte(cmd)); err != nil {
+				replies <- "write failed: " + err.Error()
+				return
+			}
+			reply, _ := reader.ReadString('\n')
+			replies <- reply
+		}()
+		return replies
+	}
+	expect := func(replies <-chan string, want string) {
+		t.Helper()
+		select {
+		case reply := <-replies:
+			if reply != want {
+				t.Fatalf("expected %q, got %q", want, reply)
+			}
+		case <-time.After(readyWaitTimeout):
+			t.Fatalf("timed out waiting for %q", want)
+		}
+	}
+
+	expect(send("INDEX|early|\n"), wire.ERROR.String())
+	close(hold)
+	expect(send("QUERY|early|\n"), wire.FAIL.String())
+
+	// The query is sent while the timed-out INDEX is still inside the store; it must
+	// not run until the INDEX has finished
+	expect(send("INDEX|late|\n"), wire.ERROR.String())
+	query := send("QUERY|late|\n")
+	select {
+	case reply := <-query:
+		t.Fatalf("query answered with %q while the timed-out INDEX was still running", reply)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(store.BlockIndex)
+	expect(query, wire.OK.String())
+
+	if !strings.Contains(logs.String(), "Timed-out command completed") {
+		t.Errorf("expected the late completion to be logged, got %s", logs.String())
+	}
+	if timeouts := srv.GetMetrics().CommandTimeouts; timeouts != 2 {
+		t.Errorf("expected 2 command timeouts, got %d", timeouts)
+	}
+}
+
+// TestServer_PanicRecovery validates that a panicking store closes only the offending
+// connection, is counted, and leaves the server serving other connections - both on
+// the direct path and when commands run under a command timeout.
+func TestServer_PanicRecovery(t *testing.T) {
+	for _, timeout := range []time.Duration{0, time.Second} {
+		store := NewFaultInjectingStore()
+		store.PanicIndex = true
+		srv := NewServerWithConfig(Config{Addr: ":0", ReadTimeout: DefaultReadTimeout, CommandTimeout: timeout, Store: store})
+		srv.ctx, srv.cancel = context.WithCancel(context.Background())
+
+		serve := func() (net.Conn, *bufio.Reader) {
+			clientConn, serverConn := net.Pipe()
+			srv.wg.Add(1)
+			go srv.handleConnection(serverConn)
+			return clientConn, bufio.NewReader(clientConn)
+		}
+
+		bad, badReader := serve()
+		if _, err := bad.Write([]byte("INDEX|boom|\n")); err != nil {
+			t.Fatalf("timeout=%v: failed to write command: %v", timeout, err)
+		}
+		if _, err := badReader.ReadString('\n'); err == nil {
+			t.Errorf("timeout=%v: expected panicking connection to be closed", timeout)
+		}
+		bad.Close()
+
+		good, goodReader := serve()
+		if _, err := good.Write([]byte("QUERY|boom|\n")); err != nil {
+			t.Fatalf("timeout=%v: failed to write command: %v", timeout, err)
+		}
+		if resp, err := goodReader.ReadString('\n'); err != nil || resp != wire.FAIL.String() {
+			t.Errorf("timeout=%v: expected server to keep serving, got %q, %v", timeout, resp, err)
+		}
+		good.Close()
+
+		if recovered := srv.GetMetrics().PanicsRecovered; recovered != 1 {
+			t.Errorf("timeout=%v: expected 1 recovered panic, got %d", timeout, recovered)
+		}
+		srv.cancel()
+	}
+}
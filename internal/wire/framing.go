@@ -0,0 +1,178 @@
+package wire
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Framing selects how the end of a multi-line reply body is marked on the wire.
+// Single-line replies are unaffected by framing.
+type Framing int
+
+const (
+	FramingBlankLine    Framing = iota // Body lines followed by an empty line (default)
+	FramingDot                         // Body lines followed by ".\n"; body lines starting with "." are dot-stuffed
+	FramingLengthPrefix                // Header carries the line count ("OK 3\n"), no terminator
+)
+
+const (
+	framingBlankLineStr    = "blank"
+	framingDotStr          = "dot"
+	framingLengthPrefixStr = "length"
+
+	dotTerminator = "."
+)
+
+// String returns the flag name of a framing mode
+func (f Framing) String() string {
+	switch f {
+	case FramingDot:
+		return framingDotStr
+	case FramingLengthPrefix:
+		return framingLengthPrefixStr
+	default:
+		return framingBlankLineStr
+	}
+}
+
+// ParseFraming converts a framing flag name ("blank", "dot" or "length") to a Framing
+func ParseFraming(name string) (Framing, error) {
+	switch name {
+	case framingBlankLineStr:
+		return FramingBlankLine, nil
+	case framingDotStr:
+		return FramingDot, nil
+	case framingLengthPrefixStr:
+		return FramingLengthPrefix, nil
+	default:
+		return FramingBlankLine, fmt.Errorf("unknown framing %q (want blank, dot or length)", name)
+	}
+}
+
+// WriteFramed writes the reply line by line using the given framing. Callers writing to
+// a network connection should pass a buffered writer and flush once so a multi-line
+// reply costs a single syscall.
+func (r Reply) WriteFramed(w io.Writer, framing Framing) (int64, error) {
+	var total int64
+	write := func(s string) error {
+		n, err := io.WriteString(w, s)
+		total += int64(n)
+		return err
+	}
+
+	header := r.Code.Label()
+	if r.Lines != nil && framing == FramingLengthPrefix {
+		header += " " + strconv.Itoa(len(r.Lines))
+	}
+	if r.Detail != "" {
+		header += " " + r.Detail
+	}
+	if r.RequestID != "" {
+		header += " [" + RequestIDPrefix + r.RequestID + "]"
+	}
+	if err := write(header + "\n"); err != nil {
+		return total, err
+	}
+	if r.Lines == nil {
+		return total, nil
+	}
+
+	for _, line := range r.Lines {
+		if framing == FramingDot && strings.HasPrefix(line, dotTerminator) {
+			line = dotTerminator + line
+		}
+		if err := write(line + "\n"); err != nil {
+			return total, err
+		}
+	}
+
+	switch framing {
+	case FramingDot:
+		return total, write(dotTerminator + "\n")
+	case FramingLengthPrefix:
+		return total, nil
+	default:
+		return total, write("\n")
+	}
+}
+
+// ReadReply reads a reply written with WriteFramed. When multiLine is set, an OK reply
+// is expected to carry a body; FAIL and ERROR replies are always single-line. A trailing
+// request id token on the header is returned in RequestID.
+func ReadReply(r *bufio.Reader, framing Framing, multiLine bool) (Reply, error) {
+	header, err := readLine(r)
+	if err != nil {
+		return Reply{}, err
+	}
+
+	var reply Reply
+	if open := strings.LastIndex(header, " ["+RequestIDPrefix); open >= 0 && strings.HasSuffix(header, "]") {
+		reply.RequestID = header[open+len(" ["+RequestIDPrefix) : len(header)-1]
+		header = header[:open]
+	}
+
+	label, detail, _ := strings.Cut(header, " ")
+	switch label {
+	case OK.Label():
+		reply.Code = OK
+	case FAIL.Label():
+		reply.Code = FAIL
+	case ERROR.Label():
+		reply.Code = ERROR
+	default:
+		return Reply{}, fmt.Errorf("unknown response code in %q", header)
+	}
+	reply.Detail = detail
+	if !multiLine || reply.Code != OK {
+		return reply, nil
+	}
+
+	reply.Lines = []string{}
+	if framing == FramingLengthPrefix {
+		countStr, rest, _ := strings.Cut(detail, " ")
+		count, err := strconv.Atoi(countStr)
+		if err != nil || count < 0 {
+			return Reply{}, fmt.Errorf("invalid line count in %q", header)
+		}
+		reply.Detail = rest
+		for i := 0; i < count; i++ {
+			line, err := readLine(r)
+			if err != nil {
+				return Reply{}, err
+			}
+			reply.Lines = append(reply.Lines, line)
+		}
+		return reply, nil
+	}
+
+	for {
+		line, err := readLine(r)
+		if err != nil {
+			return Reply{}, err
+		}
+		switch framing {
+		case FramingDot:
+			if line == dotTerminator {
+				return reply, nil
+			}
+			line = strings.TrimPrefix(line, dotTerminator)
+		default:
+			if line == "" {
+				return reply, nil
+			}
+		}
+		reply.Lines = append(reply.Lines, line)
+	}
+}
+
+// readLine reads a single newline-terminated line and strips the newline
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(line, "\n"), nil
+}
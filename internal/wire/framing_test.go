@@ -0,0 +1,79 @@
+package wire
+
+import (
+	"bufio"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestReply_WriteFramed validates the exact wire output of a LIST-style reply in each
+// framing mode.
+func TestReply_WriteFramed(t *testing.T) {
+	reply := Reply{Code: OK, Lines: []string{"a", ".hidden", "c"}}
+
+	tests := []struct {
+		framing  Framing
+		expected string
+	}{
+		{FramingBlankLine, "OK\na\n.hidden\nc\n\n"},
+		{FramingDot, "OK\na\n..hidden\nc\n.\n"},
+		{FramingLengthPrefix, "OK 3\na\n.hidden\nc\n"},
+	}
+
+	for _, test := range tests {
+		var b strings.Builder
+		if _, err := reply.WriteFramed(&b, test.framing); err != nil {
+			t.Fatalf("WriteFramed(%v) returned error: %v", test.framing, err)
+		}
+		if b.String() != test.expected {
+			t.Errorf("WriteFramed(%v) = %q, expected %q", test.framing, b.String(), test.expected)
+		}
+	}
+}
+
+// TestReadReply_RoundTrip validates that LIST-style replies, including empty bodies,
+// details and single-line failures, survive a write/read round trip in every framing.
+func TestReadReply_RoundTrip(t *testing.T) {
+	replies := []Reply{
+		{Code: OK, Lines: []string{"a", "b", "c"}},
+		{Code: OK, Detail: "count=2", Lines: []string{".dot", "x"}},
+		{Code: OK, Lines: []string{}},
+		{Code: FAIL},
+		{Code: OK, Detail: "count=1", Lines: []string{"a"}, RequestID: "req-7"},
+		{Code: FAIL, RequestID: "req-8"},
+	}
+
+	for _, framing := range []Framing{FramingBlankLine, FramingDot, FramingLengthPrefix} {
+		var b strings.Builder
+		for _, reply := range replies {
+			if _, err := reply.WriteFramed(&b, framing); err != nil {
+				t.Fatalf("WriteFramed(%v) returned error: %v", framing, err)
+			}
+		}
+
+		r := bufio.NewReader(strings.NewReader(b.String()))
+		for _, want := range replies {
+			got, err := ReadReply(r, framing, true)
+			if err != nil {
+				t.Fatalf("ReadReply(%v) returned error: %v", framing, err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("ReadReply(%v) = %+v, expected %+v", framing, got, want)
+			}
+		}
+	}
+}
+
+// TestParseFraming validates flag name conversion in both directions
+func TestParseFraming(t *testing.T) {
+	for _, framing := range []Framing{FramingBlankLine, FramingDot, FramingLengthPrefix} {
+		parsed, err := ParseFraming(framing.String())
+		if err != nil || parsed != framing {
+			t.Errorf("ParseFraming(%q) = %v, %v; expected %v", framing.String(), parsed, err, framing)
+		}
+	}
+	if _, err := ParseFraming("bogus"); err == nil {
+		t.Error("ParseFraming should reject unknown names")
+	}
+}
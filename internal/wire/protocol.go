@@ -4,7 +4,9 @@
 package wire
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"strings"
 )
 
@@ -13,6 +15,10 @@ type Command struct {
 	Type         CommandType
 	Package      string
 	Dependencies []string
+	Labels       map[string]string // INDEX only: edge label by dependency name, nil if none is labeled
+	ExpectedHash string            // INDEXCAS only: dependency-set hash the package must currently have
+	NewName      string            // RENAME only: name the package is renamed to
+	Target       string            // PATH only: package the dependency path must reach
 }
 
 // CommandType represents the type of command
@@ -22,15 +28,107 @@ const (
 	IndexCommand CommandType = iota
 	RemoveCommand
 	QueryCommand
+	CapsCommand      // Capability discovery; takes no package ("CAPS||")
+	StatusCommand    // Existence plus direct dependency/dependent counts in one reply
+	DepthCommand     // Length of the longest dependency chain starting at a package
+	IndexCASCommand  // INDEX applied only if the current dependency set has an expected hash
+	SearchCommand    // Multi-line list of indexed packages matching a prefix or simple glob
+	EdgesCommand     // Direct dependencies and dependents of a package in one multi-line reply
+	RenameCommand    // Atomically renames a package; the third field is the new name
+	AddDepCommand    // Adds dependencies to an indexed package's existing set
+	RmDepCommand     // Removes dependencies from an indexed package's existing set
+	CanRemoveCommand // Reports whether REMOVE would succeed, without removing
+	PinCommand       // Protects an indexed package from removal until it is unpinned
+	UnpinCommand     // Lifts a pin so the package is removable again
+	BuildCommand     // Server build version and VCS commit; takes no package ("BUILD||")
+	PathCommand      // Dependency path between two packages; the third field is the target
+	GenCommand       // Graph version, bumped by every change; takes no package ("GEN||")
 )
 
 const (
-	cmdIndexStr   = "INDEX"
-	cmdRemoveStr  = "REMOVE"
-	cmdQueryStr   = "QUERY"
-	cmdUnknownStr = "UNKNOWN"
+	cmdIndexStr     = "INDEX"
+	cmdRemoveStr    = "REMOVE"
+	cmdQueryStr     = "QUERY"
+	cmdCapsStr      = "CAPS"
+	cmdStatusStr    = "STATUS"
+	cmdDepthStr     = "DEPTH"
+	cmdIndexCASStr  = "INDEXCAS"
+	cmdSearchStr    = "SEARCH"
+	cmdEdgesStr     = "EDGES"
+	cmdRenameStr    = "RENAME"
+	cmdAddDepStr    = "ADDDEP"
+	cmdRmDepStr     = "RMDEP"
+	cmdCanRemoveStr = "CANREMOVE"
+	cmdPinStr       = "PIN"
+	cmdUnpinStr     = "UNPIN"
+	cmdBuildStr     = "BUILD"
+	cmdPathStr      = "PATH"
+	cmdGenStr       = "GEN"
+	cmdUnknownStr   = "UNKNOWN"
 )
 
+// ProtocolVersion identifies the protocol revision advertised by CAPS. Version 1 was the
+// original INDEX/REMOVE/QUERY protocol; version 2 adds reply details, multi-line replies
+// and capability discovery.
+const ProtocolVersion = 2
+
+// commandTypes maps wire command names to their types
+var commandTypes = map[string]CommandType{
+	cmdIndexStr:     IndexCommand,
+	cmdRemoveStr:    RemoveCommand,
+	cmdQueryStr:     QueryCommand,
+	cmdCapsStr:      CapsCommand,
+	cmdStatusStr:    StatusCommand,
+	cmdDepthStr:     DepthCommand,
+	cmdIndexCASStr:  IndexCASCommand,
+	cmdSearchStr:    SearchCommand,
+	cmdEdgesStr:     EdgesCommand,
+	cmdRenameStr:    RenameCommand,
+	cmdAddDepStr:    AddDepCommand,
+	cmdRmDepStr:     RmDepCommand,
+	cmdCanRemoveStr: CanRemoveCommand,
+	cmdPinStr:       PinCommand,
+	cmdUnpinStr:     UnpinCommand,
+	cmdBuildStr:     BuildCommand,
+	cmdPathStr:      PathCommand,
+	cmdGenStr:       GenCommand,
+}
+
+// RequiresPackage reports whether the command must name a package
+func (ct CommandType) RequiresPackage() bool {
+	return ct != CapsCommand && ct != BuildCommand && ct != GenCommand
+}
+
+// Mutates reports whether the command can change the index, i.e. must be refused by a
+// read-only server
+func (ct CommandType) Mutates() bool {
+	switch ct {
+	case IndexCommand, RemoveCommand, IndexCASCommand, RenameCommand,
+		AddDepCommand, RmDepCommand, PinCommand, UnpinCommand:
+		return true
+	default:
+		return false
+	}
+}
+
+// ParseCommandList parses a comma-separated list of command names (e.g. "INDEX,REMOVE"),
+// as used by command allow and deny lists. Names are case-insensitive and surrounding
+// spaces are ignored; an empty list yields nil.
+func ParseCommandList(list string) ([]CommandType, error) {
+	if strings.TrimSpace(list) == "" {
+		return nil, nil
+	}
+	var types []CommandType
+	for _, name := range strings.Split(list, DependencySeparator) {
+		ct, ok := commandTypes[strings.ToUpper(strings.TrimSpace(name))]
+		if !ok {
+			return nil, fmt.Errorf("%w %q", ErrUnknownCommand, strings.TrimSpace(name))
+		}
+		types = append(types, ct)
+	}
+	return types, nil
+}
+
 // String returns the string representation of a command type
 func (ct CommandType) String() string {
 	switch ct {
@@ -40,6 +138,36 @@ func (ct CommandType) String() string {
 		return cmdRemoveStr
 	case QueryCommand:
 		return cmdQueryStr
+	case CapsCommand:
+		return cmdCapsStr
+	case StatusCommand:
+		return cmdStatusStr
+	case DepthCommand:
+		return cmdDepthStr
+	case IndexCASCommand:
+		return cmdIndexCASStr
+	case SearchCommand:
+		return cmdSearchStr
+	case EdgesCommand:
+		return cmdEdgesStr
+	case RenameCommand:
+		return cmdRenameStr
+	case AddDepCommand:
+		return cmdAddDepStr
+	case RmDepCommand:
+		return cmdRmDepStr
+	case CanRemoveCommand:
+		return cmdCanRemoveStr
+	case PinCommand:
+		return cmdPinStr
+	case UnpinCommand:
+		return cmdUnpinStr
+	case BuildCommand:
+		return cmdBuildStr
+	case PathCommand:
+		return cmdPathStr
+	case GenCommand:
+		return cmdGenStr
 	default:
 		return cmdUnknownStr
 	}
@@ -63,6 +191,7 @@ const (
 
 	ProtocolSeparator   = "|" // Separates command fields
 	DependencySeparator = "," // Separates dependency lists
+	LabelSeparator      = ":" // Separates a dependency from its edge label (Parser.Labels)
 )
 
 // String returns the protocol response string with required trailing newline.
@@ -80,61 +209,291 @@ func (r Response) String() string {
 	}
 }
 
+// Label returns the bare response code without the trailing newline, for use as the
+// leading token of a reply that carries additional detail.
+func (r Response) Label() string {
+	return strings.TrimSuffix(r.String(), "\n")
+}
+
+// Reply is a complete protocol response: a response code plus an optional detail payload
+// on the same line (e.g. "OK deps=3\n"). A reply without detail renders exactly like its code.
+// A non-nil Lines slice makes the reply multi-line: the body follows the header, framed
+// according to the connection's Framing (see WriteFramed).
+type Reply struct {
+	Code      Response
+	Detail    string
+	Lines     []string
+	RequestID string // Client request id echoed at the end of the header ("OK [ID:<id>]"); empty for none
+	Err       error  // Cause of an ERROR reply, for server-side diagnostics; never written to the wire
+}
+
+// NewReply creates a reply carrying only a response code
+func NewReply(code Response) Reply {
+	return Reply{Code: code}
+}
+
+// NewErrorReply creates an ERROR reply recording its cause
+func NewErrorReply(err error) Reply {
+	return Reply{Code: ERROR, Err: err}
+}
+
+// String returns the wire representation of the reply with required trailing newline
+func (r Reply) String() string {
+	var b strings.Builder
+	_, _ = r.WriteTo(&b)
+	return b.String()
+}
+
+// WriteTo writes the reply using the default blank-line framing
+func (r Reply) WriteTo(w io.Writer) (int64, error) {
+	return r.WriteFramed(w, FramingBlankLine)
+}
+
+// Parse error categories. Every error returned by Parser.Parse wraps exactly one of
+// these, so callers can distinguish a misspelled command from a structurally broken line.
+var (
+	ErrUnknownCommand = errors.New("unknown command")
+	ErrBadFormat      = errors.New("invalid format")
+)
+
+// ParseErrorLabel returns the short wire label for a parse error ("unknown-command" or
+// "bad-format"), or "" if err is not a parse error
+func ParseErrorLabel(err error) string {
+	switch {
+	case errors.Is(err, ErrUnknownCommand):
+		return "unknown-command"
+	case errors.Is(err, ErrBadFormat):
+		return "bad-format"
+	default:
+		return ""
+	}
+}
+
+// Parser converts protocol lines into Commands. The zero value implements the default
+// tolerant behavior; fields opt into stricter or extended parsing.
+type Parser struct {
+	// Strict rejects empty dependency slots (e.g. "b,,c", "b,c," or ",b") instead of
+	// silently dropping them.
+	Strict bool
+
+	// Escapes lets names contain separators: a backslash makes the next byte literal, so
+	// `INDEX|a\|b|c\,d` indexes "a|b" with dependency "c,d" (`\\` is a literal backslash).
+	Escapes bool
+
+	// Labels accepts an edge label after each INDEX dependency, following its last
+	// LabelSeparator (e.g. `INDEX|app|db:required,cache:optional`). An unlabeled dependency
+	// has no entry in Command.Labels; names can only contain the separator if escaped.
+	Labels bool
+}
+
+// RequestIDPrefix starts the optional request id token a client may put before a command
+// ("ID:<id> INDEX|pkg|deps\n") so the reply can be correlated with it
+const RequestIDPrefix = "ID:"
+
+// CutRequestID splits a leading request id token off a command line, returning the id
+// and the command that follows it. A line without a well-formed token (prefix, non-empty
+// id, then a space) is returned unchanged with found false.
+func CutRequestID(line string) (id, rest string, found bool) {
+	if !strings.HasPrefix(line, RequestIDPrefix) {
+		return "", line, false
+	}
+	id, rest, found = strings.Cut(line[len(RequestIDPrefix):], " ")
+	if !found || id == "" || strings.ContainsAny(id, "[]\n") {
+		return "", line, false
+	}
+	return id, rest, true
+}
+
+// EscapeChar makes the following byte literal when Parser.Escapes is enabled
+const EscapeChar = '\\'
+
+// casFieldCount is the number of |-separated fields in an INDEXCAS line, which carries the
+// expected hash after the dependency list
+const casFieldCount = 4
+
 // ParseCommand parses a line into a Command using exact protocol specification.
 // Format: "COMMAND|package|dependencies\n" with strict validation to prevent
 // false negatives with external test harnesses.
 func ParseCommand(line string) (*Command, error) {
+	return (&Parser{}).Parse(line)
+}
+
+// Parse parses a line into a Command according to the parser configuration
+func (p *Parser) Parse(line string) (*Command, error) {
 	// Must end with newline per protocol specification
 	if !strings.HasSuffix(line, "\n") {
-		return nil, fmt.Errorf("line must end with newline")
+		return nil, fmt.Errorf("%w: line must end with newline", ErrBadFormat)
 	}
 
-	// Remove trailing newline
+	// Remove trailing newline; any other newline means several commands were framed as one
 	line = line[:len(line)-1]
+	if strings.Contains(line, "\n") {
+		return nil, fmt.Errorf("%w: line must contain exactly one newline-terminated command", ErrBadFormat)
+	}
 
-	// Split by pipe - must have exactly 3 parts
-	parts := strings.Split(line, ProtocolSeparator)
-	if len(parts) != 3 {
-		return nil, fmt.Errorf("invalid format: expected 3 parts separated by |, got %d", len(parts))
+	// Split by pipe - must have exactly 3 parts (4 for INDEXCAS)
+	parts, err := p.split(line, ProtocolSeparator)
+	if err != nil {
+		return nil, err
+	}
+	fields := 3
+	if parts[0] == cmdIndexCASStr {
+		fields = casFieldCount
+	}
+	if len(parts) != fields {
+		return nil, fmt.Errorf("%w: expected %d parts separated by |, got %d", ErrBadFormat, fields, len(parts))
 	}
 
 	cmdStr := parts[0]
-	pkg := parts[1]
+	pkg := p.unescape(parts[1])
 	depsStr := parts[2]
 
 	// Parse command type
-	var cmdType CommandType
-	switch cmdStr {
-	case cmdIndexStr:
-		cmdType = IndexCommand
-	case cmdRemoveStr:
-		cmdType = RemoveCommand
-	case cmdQueryStr:
-		cmdType = QueryCommand
-	default:
-		return nil, fmt.Errorf("unknown command: %s", cmdStr)
+	cmdType, ok := commandTypes[cmdStr]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownCommand, cmdStr)
 	}
 
-	// Validate package name (non-empty)
-	if pkg == "" {
-		return nil, fmt.Errorf("package name cannot be empty")
+	// Validate package name (non-empty unless the command takes none)
+	if pkg == "" && cmdType.RequiresPackage() {
+		return nil, fmt.Errorf("%w: package name cannot be empty", ErrBadFormat)
 	}
 
-	// Parse dependencies (comma-separated, empty allowed)
-	var deps []string
-	if depsStr != "" {
-		rawDeps := strings.Split(depsStr, DependencySeparator)
-		for _, dep := range rawDeps {
-			dep = strings.TrimSpace(dep)
-			if dep != "" { // Ignore empty deps from trailing commas
-				deps = append(deps, dep)
-			}
+	// RENAME and PATH carry a single package name where other commands carry dependencies
+	if cmdType == RenameCommand || cmdType == PathCommand {
+		names, err := p.split(depsStr, DependencySeparator)
+		if err != nil {
+			return nil, err
 		}
+		if depsStr == "" || len(names) != 1 {
+			return nil, fmt.Errorf("%w: %s needs a single package name in its third field", ErrBadFormat, cmdStr)
+		}
+		if cmdType == PathCommand {
+			return &Command{Type: cmdType, Package: pkg, Target: p.unescape(depsStr)}, nil
+		}
+		return &Command{Type: cmdType, Package: pkg, NewName: p.unescape(depsStr)}, nil
+	}
+
+	deps, labels, err := p.parseDependencies(depsStr, p.Labels && cmdType == IndexCommand)
+	if err != nil {
+		return nil, err
 	}
 
-	return &Command{
+	cmd := &Command{
 		Type:         cmdType,
 		Package:      pkg,
 		Dependencies: deps,
-	}, nil
+		Labels:       labels,
+	}
+	if cmdType == IndexCASCommand {
+		cmd.ExpectedHash = p.unescape(parts[3])
+	}
+	return cmd, nil
+}
+
+// parseDependencies splits the comma-separated dependency field (empty allowed), and with
+// labeled set also the edge label off each dependency
+func (p *Parser) parseDependencies(depsStr string, labeled bool) ([]string, map[string]string, error) {
+	if depsStr == "" {
+		return nil, nil, nil
+	}
+
+	fields, err := p.split(depsStr, DependencySeparator)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var deps []string
+	var labels map[string]string
+	for _, dep := range fields {
+		label := ""
+		if labeled {
+			if dep, label, err = p.cutLabel(dep); err != nil {
+				return nil, nil, err
+			}
+		}
+		dep = p.unescape(strings.TrimSpace(dep))
+		if dep == "" {
+			if p.Strict {
+				return nil, nil, fmt.Errorf("%w: empty dependency name in %q", ErrBadFormat, depsStr)
+			}
+			continue // Ignore empty deps from trailing commas
+		}
+		deps = append(deps, dep)
+		if label != "" {
+			if labels == nil {
+				labels = make(map[string]string)
+			}
+			labels[dep] = label
+		}
+	}
+	return deps, labels, nil
+}
+
+// cutLabel splits a dependency at its last unescaped LabelSeparator into the (still
+// escaped) name and the label; a dependency without the separator has no label. An empty
+// label is a format error.
+func (p *Parser) cutLabel(field string) (string, string, error) {
+	at := -1
+	for i := 0; i < len(field); i++ {
+		switch {
+		case p.Escapes && field[i] == EscapeChar:
+			i++ // Skip the escaped byte
+		case strings.HasPrefix(field[i:], LabelSeparator):
+			at = i
+		}
+	}
+	if at < 0 {
+		return field, "", nil
+	}
+
+	label := strings.TrimSpace(field[at+len(LabelSeparator):])
+	if label == "" {
+		return "", "", fmt.Errorf("%w: empty label in %q", ErrBadFormat, field)
+	}
+	return field[:at], label, nil
+}
+
+// split divides s at each sep. With escapes enabled, separators preceded by EscapeChar
+// are kept and the escape sequences stay in the fields for unescape, so a field can be
+// split again (dependencies within the dependency field). A trailing lone EscapeChar is
+// a format error.
+func (p *Parser) split(s, sep string) ([]string, error) {
+	if !p.Escapes || !strings.ContainsRune(s, EscapeChar) {
+		return strings.Split(s, sep), nil
+	}
+
+	var fields []string
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == EscapeChar:
+			if i == len(s)-1 {
+				return nil, fmt.Errorf("%w: dangling escape at end of %q", ErrBadFormat, s)
+			}
+			i++ // Skip the escaped byte
+		case strings.HasPrefix(s[i:], sep):
+			fields = append(fields, s[start:i])
+			start = i + len(sep)
+			i = start - 1
+		}
+	}
+	return append(fields, s[start:]), nil
+}
+
+// unescape removes escape characters, keeping the bytes they protect
+func (p *Parser) unescape(s string) string {
+	if !p.Escapes || !strings.ContainsRune(s, EscapeChar) {
+		return s
+	}
+
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] == EscapeChar && i+1 < len(s) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
 }
@@ -1,6 +1,11 @@
 package wire
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
 	"testing"
 )
 
@@ -43,6 +48,55 @@ func TestParseCommand_ValidCases(t *testing.T) {
 				Dependencies: nil,
 			},
 		},
+		{
+			input: "CAPS||\n", // Capability discovery takes no package
+			expected: &Command{
+				Type:         CapsCommand,
+				Package:      "",
+				Dependencies: nil,
+			},
+		},
+		{
+			input: "BUILD||\n", // Build version takes no package
+			expected: &Command{
+				Type:         BuildCommand,
+				Package:      "",
+				Dependencies: nil,
+			},
+		},
+		{
+			input: "GEN||\n", // Graph version takes no package
+			expected: &Command{
+				Type:         GenCommand,
+				Package:      "",
+				Dependencies: nil,
+			},
+		},
+		{
+			input: "INDEXCAS|pkg|dep1|0123456789abcdef\n", // Compare-and-set carries a fourth field
+			expected: &Command{
+				Type:         IndexCASCommand,
+				Package:      "pkg",
+				Dependencies: []string{"dep1"},
+				ExpectedHash: "0123456789abcdef",
+			},
+		},
+		{
+			input: "RENAME|old|new\n",
+			expected: &Command{
+				Type:    RenameCommand,
+				Package: "old",
+				NewName: "new",
+			},
+		},
+		{
+			input: "PATH|app|base\n", // PATH names its target where dependencies usually go
+			expected: &Command{
+				Type:    PathCommand,
+				Package: "app",
+				Target:  "base",
+			},
+		},
 		{
 			input: "INDEX|pkg|dep1,dep2,\n", // Trailing comma
 			expected: &Command{
@@ -64,6 +118,14 @@ func TestParseCommand_ValidCases(t *testing.T) {
 			t.Errorf("ParseCommand(%q) Type = %v, expected %v", test.input, cmd.Type, test.expected.Type)
 		}
 
+		if cmd.ExpectedHash != test.expected.ExpectedHash {
+			t.Errorf("ParseCommand(%q) ExpectedHash = %q, expected %q", test.input, cmd.ExpectedHash, test.expected.ExpectedHash)
+		}
+
+		if cmd.NewName != test.expected.NewName {
+			t.Errorf("ParseCommand(%q) NewName = %q, expected %q", test.input, cmd.NewName, test.expected.NewName)
+		}
+
 		if cmd.Package != test.expected.Package {
 			t.Errorf("ParseCommand(%q) Package = %q, expected %q", test.input, cmd.Package, test.expected.Package)
 		}
@@ -86,20 +148,57 @@ func TestParseCommand_ValidCases(t *testing.T) {
 // TestParseCommand_ErrorCases validates proper error handling for malformed protocol messages
 // including invalid commands, missing fields, and format violations.
 func TestParseCommand_ErrorCases(t *testing.T) {
-	errorCases := []string{
-		"INVALID|package|\n",         // Invalid command
-		"INDEX||\n",                  // Empty package name
-		"INDEX\n",                    // Missing parts
-		"INDEX|package\n",            // Missing third part
-		"INDEX|package|deps|extra\n", // Too many parts
-		"",                           // Empty line
-		"INDEX|package|deps",         // Missing newline
-	}
-
-	for _, input := range errorCases {
-		_, err := ParseCommand(input)
+	errorCases := []struct {
+		input    string
+		expected error
+	}{
+		{"INVALID|package|\n", ErrUnknownCommand},    // Invalid command
+		{"INDEX||\n", ErrBadFormat},                  // Empty package name
+		{"QUERY||\n", ErrBadFormat},                  // Empty package name
+		{"INDEX\n", ErrBadFormat},                    // Missing parts
+		{"INDEX|package\n", ErrBadFormat},            // Missing third part
+		{"INDEX|package|deps|extra\n", ErrBadFormat}, // Too many parts
+		{"INDEXCAS|package|deps\n", ErrBadFormat},    // INDEXCAS without expected hash
+		{"RENAME|old|\n", ErrBadFormat},              // RENAME without a new name
+		{"RENAME|old|a,b\n", ErrBadFormat},           // RENAME to a list of names
+		{"RENAME||new\n", ErrBadFormat},              // RENAME without a package
+		{"PATH|app|\n", ErrBadFormat},                // PATH without a target
+		{"PATH|app|a,b\n", ErrBadFormat},             // PATH to a list of targets
+		{"", ErrBadFormat},                           // Empty line
+		{"INDEX|package|deps", ErrBadFormat},         // Missing newline
+		{"QUERY|a|\nQUERY|b|\n", ErrBadFormat},       // Multiple commands in one line
+		{"index|package|\n", ErrUnknownCommand},      // Command names are case-sensitive
+	}
+
+	for _, test := range errorCases {
+		_, err := ParseCommand(test.input)
 		if err == nil {
-			t.Errorf("ParseCommand(%q) should have returned an error", input)
+			t.Errorf("ParseCommand(%q) should have returned an error", test.input)
+			continue
+		}
+		if !errors.Is(err, test.expected) {
+			t.Errorf("ParseCommand(%q) error %v does not wrap %v", test.input, err, test.expected)
+		}
+	}
+}
+
+// TestParseErrorLabel validates the short labels used for verbose ERROR replies
+func TestParseErrorLabel(t *testing.T) {
+	_, unknown := ParseCommand("BOGUS|a|\n")
+	_, malformed := ParseCommand("INDEX|a\n")
+
+	tests := []struct {
+		err      error
+		expected string
+	}{
+		{unknown, "unknown-command"},
+		{malformed, "bad-format"},
+		{io.EOF, ""},
+		{nil, ""},
+	}
+	for _, test := range tests {
+		if label := ParseErrorLabel(test.err); label != test.expected {
+			t.Errorf("ParseErrorLabel(%v) = %q, expected %q", test.err, label, test.expected)
 		}
 	}
 }
@@ -135,6 +234,21 @@ func TestCommandType_String(t *testing.T) {
 		{IndexCommand, "INDEX"},
 		{RemoveCommand, "REMOVE"},
 		{QueryCommand, "QUERY"},
+		{CapsCommand, "CAPS"},
+		{StatusCommand, "STATUS"},
+		{DepthCommand, "DEPTH"},
+		{IndexCASCommand, "INDEXCAS"},
+		{SearchCommand, "SEARCH"},
+		{EdgesCommand, "EDGES"},
+		{RenameCommand, "RENAME"},
+		{AddDepCommand, "ADDDEP"},
+		{RmDepCommand, "RMDEP"},
+		{CanRemoveCommand, "CANREMOVE"},
+		{PinCommand, "PIN"},
+		{UnpinCommand, "UNPIN"},
+		{BuildCommand, "BUILD"},
+		{PathCommand, "PATH"},
+		{GenCommand, "GEN"},
 		{CommandType(999), "UNKNOWN"}, // Test default case
 	}
 
@@ -145,3 +259,283 @@ func TestCommandType_String(t *testing.T) {
 		}
 	}
 }
+
+func TestCommandType_Mutates(t *testing.T) {
+	mutating := map[CommandType]bool{
+		IndexCommand: true, RemoveCommand: true, IndexCASCommand: true, RenameCommand: true,
+		AddDepCommand: true, RmDepCommand: true, PinCommand: true, UnpinCommand: true,
+	}
+	for _, ct := range commandTypes {
+		if ct.Mutates() != mutating[ct] {
+			t.Errorf("%s.Mutates() = %t, expected %t", ct, ct.Mutates(), mutating[ct])
+		}
+	}
+}
+
+func TestParseCommandList(t *testing.T) {
+	types, err := ParseCommandList(" index, REMOVE ,Query")
+	if err != nil {
+		t.Fatalf("ParseCommandList failed: %v", err)
+	}
+	expected := []CommandType{IndexCommand, RemoveCommand, QueryCommand}
+	if !slices.Equal(types, expected) {
+		t.Errorf("ParseCommandList = %v, expected %v", types, expected)
+	}
+
+	if types, err := ParseCommandList(""); err != nil || types != nil {
+		t.Errorf("ParseCommandList(\"\") = %v, %v; expected nil, nil", types, err)
+	}
+	if _, err := ParseCommandList("INDEX,BOGUS"); !errors.Is(err, ErrUnknownCommand) {
+		t.Errorf("expected ErrUnknownCommand for an unknown name, got %v", err)
+	}
+}
+
+// TestReply_String validates reply rendering with and without a detail payload, and
+// blank-line framing of multi-line replies.
+func TestReply_String(t *testing.T) {
+	tests := []struct {
+		reply    Reply
+		expected string
+	}{
+		{NewReply(OK), "OK\n"},
+		{NewReply(FAIL), "FAIL\n"},
+		{Reply{Code: OK, Detail: "deps=3"}, "OK deps=3\n"},
+		{Reply{Code: ERROR, Detail: "bad-format"}, "ERROR bad-format\n"},
+		{Reply{Code: OK, Lines: []string{"a", "b"}}, "OK\na\nb\n\n"},
+		{Reply{Code: OK, Detail: "count=1", Lines: []string{"a"}}, "OK count=1\na\n\n"},
+		{Reply{Code: OK, RequestID: "abc"}, "OK [ID:abc]\n"},
+		{Reply{Code: OK, Detail: "deps=3", RequestID: "abc"}, "OK deps=3 [ID:abc]\n"},
+	}
+
+	for _, test := range tests {
+		if result := test.reply.String(); result != test.expected {
+			t.Errorf("Reply(%+v).String() = %q, expected %q", test.reply, result, test.expected)
+		}
+	}
+}
+
+// TestParser_EmptyDependencySlots validates tolerant and strict handling of consecutive,
+// trailing, and leading dependency separators.
+func TestParser_EmptyDependencySlots(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"INDEX|a|b,,c\n", []string{"b", "c"}},
+		{"INDEX|a|b,c,\n", []string{"b", "c"}},
+		{"INDEX|a|,b\n", []string{"b"}},
+	}
+
+	tolerant := &Parser{}
+	strict := &Parser{Strict: true}
+
+	for _, test := range tests {
+		cmd, err := tolerant.Parse(test.input)
+		if err != nil {
+			t.Errorf("tolerant Parse(%q) returned error: %v", test.input, err)
+		} else if len(cmd.Dependencies) != len(test.expected) {
+			t.Errorf("tolerant Parse(%q) Dependencies = %v, expected %v", test.input, cmd.Dependencies, test.expected)
+		} else {
+			for i, dep := range cmd.Dependencies {
+				if dep != test.expected[i] {
+					t.Errorf("tolerant Parse(%q) Dependencies[%d] = %q, expected %q", test.input, i, dep, test.expected[i])
+				}
+			}
+		}
+
+		if _, err := strict.Parse(test.input); err == nil {
+			t.Errorf("strict Parse(%q) should have returned an error", test.input)
+		}
+	}
+
+	// Well-formed lists are accepted by both modes
+	for _, p := range []*Parser{tolerant, strict} {
+		cmd, err := p.Parse("INDEX|a|b,c\n")
+		if err != nil || len(cmd.Dependencies) != 2 {
+			t.Errorf("Parse(strict=%v) of well-formed list = %v, %v", p.Strict, cmd, err)
+		}
+		if _, err := p.Parse("INDEX|a|\n"); err != nil {
+			t.Errorf("Parse(strict=%v) of empty dependency field returned error: %v", p.Strict, err)
+		}
+	}
+}
+
+// TestParser_Escapes validates that escaped separators stay inside package and dependency
+// names, and that the default parser keeps splitting on them.
+func TestParser_Escapes(t *testing.T) {
+	escaping := &Parser{Escapes: true}
+	tests := []struct {
+		input    string
+		pkg      string
+		expected []string
+	}{
+		{`INDEX|a\|b|dep` + "\n", "a|b", []string{"dep"}},
+		{`INDEX|pkg|c\,d,e` + "\n", "pkg", []string{"c,d", "e"}},
+		{`INDEX|x\|y|p\|q,r\,s` + "\n", "x|y", []string{"p|q", "r,s"}},
+		{`INDEX|back\\slash|` + "\n", `back\slash`, nil},
+		{`INDEX|trail\\|dep` + "\n", `trail\`, []string{"dep"}}, // Escaped backslash does not escape the separator
+		{"INDEX|plain|a,b\n", "plain", []string{"a", "b"}},
+	}
+	for _, test := range tests {
+		cmd, err := escaping.Parse(test.input)
+		if err != nil {
+			t.Errorf("Parse(%q) returned error: %v", test.input, err)
+			continue
+		}
+		if cmd.Package != test.pkg || fmt.Sprint(cmd.Dependencies) != fmt.Sprint(test.expected) {
+			t.Errorf("Parse(%q) = %q %q, expected %q %q", test.input, cmd.Package, cmd.Dependencies, test.pkg, test.expected)
+		}
+	}
+
+	if cmd, err := escaping.Parse(`RENAME|old|new\,name` + "\n"); err != nil || cmd.NewName != "new,name" {
+		t.Errorf("Parse of escaped RENAME target = %v, %v", cmd, err)
+	}
+	for _, input := range []string{`INDEX|pkg|dep\` + "\n", `INDEX|a\|b` + "\n"} {
+		if _, err := escaping.Parse(input); !errors.Is(err, ErrBadFormat) {
+			t.Errorf("Parse(%q) error = %v, expected %v", input, err, ErrBadFormat)
+		}
+	}
+
+	// Without escapes a backslash is an ordinary byte and separators always split
+	if _, err := ParseCommand(`INDEX|a\|b|dep` + "\n"); !errors.Is(err, ErrBadFormat) {
+		t.Errorf("default parser accepted an escaped separator: %v", err)
+	}
+	if cmd, err := ParseCommand(`INDEX|pkg|c\,d` + "\n"); err != nil || fmt.Sprint(cmd.Dependencies) != `[c\ d]` {
+		t.Errorf("default parser Dependencies = %v, %v", cmd, err)
+	}
+}
+
+// TestCutRequestID validates that only a well-formed leading request id token is split
+// off a command line.
+func TestCutRequestID(t *testing.T) {
+	tests := []struct {
+		line  string
+		id    string
+		rest  string
+		found bool
+	}{
+		{"ID:abc-123 QUERY|a|\n", "abc-123", "QUERY|a|\n", true},
+		{"QUERY|a|\n", "", "QUERY|a|\n", false},
+		{"ID: QUERY|a|\n", "", "ID: QUERY|a|\n", false},       // Empty id
+		{"ID:abc\n", "", "ID:abc\n", false},                   // No command after the token
+		{"ID:a]b QUERY|a|\n", "", "ID:a]b QUERY|a|\n", false}, // Would break the echoed token
+	}
+	for _, test := range tests {
+		id, rest, found := CutRequestID(test.line)
+		if id != test.id || rest != test.rest || found != test.found {
+			t.Errorf("CutRequestID(%q) = (%q, %q, %v), expected (%q, %q, %v)", test.line, id, rest, found, test.id, test.rest, test.found)
+		}
+	}
+}
+
+// TestParser_Labels validates that edge labels are split off INDEX dependencies at the
+// last unescaped separator, and that other commands and the default parser keep colons
+// as part of names.
+func TestParser_Labels(t *testing.T) {
+	labeling := &Parser{Labels: true, Escapes: true}
+	tests := []struct {
+		input    string
+		expected []string
+		labels   map[string]string
+	}{
+		{"INDEX|app|db:required,cache:optional\n", []string{"db", "cache"}, map[string]string{"db": "required", "cache": "optional"}},
+		{"INDEX|app|db,cache : optional\n", []string{"db", "cache"}, map[string]string{"cache": "optional"}},
+		{"INDEX|app|std:io:optional\n", []string{"std:io"}, map[string]string{"std:io": "optional"}},
+		{`INDEX|app|std\:io` + "\n", []string{"std:io"}, nil}, // Escaped separator is part of the name
+		{"INDEX|app|db,cache\n", []string{"db", "cache"}, nil},
+	}
+	for _, test := range tests {
+		cmd, err := labeling.Parse(test.input)
+		if err != nil {
+			t.Errorf("Parse(%q) returned error: %v", test.input, err)
+			continue
+		}
+		if fmt.Sprint(cmd.Dependencies) != fmt.Sprint(test.expected) || fmt.Sprint(cmd.Labels) != fmt.Sprint(test.labels) {
+			t.Errorf("Parse(%q) = %q %v, expected %q %v", test.input, cmd.Dependencies, cmd.Labels, test.expected, test.labels)
+		}
+	}
+
+	if _, err := labeling.Parse("INDEX|app|db:\n"); !errors.Is(err, ErrBadFormat) {
+		t.Errorf("Parse of an empty label error = %v, expected %v", err, ErrBadFormat)
+	}
+	if cmd, err := labeling.Parse("ADDDEP|app|db:optional\n"); err != nil || cmd.Labels != nil || fmt.Sprint(cmd.Dependencies) != "[db:optional]" {
+		t.Errorf("labels should only apply to INDEX, got %v, %v", cmd, err)
+	}
+	if cmd, err := ParseCommand("INDEX|app|db:optional\n"); err != nil || cmd.Labels != nil || fmt.Sprint(cmd.Dependencies) != "[db:optional]" {
+		t.Errorf("default parser should keep colons in names, got %v, %v", cmd, err)
+	}
+}
+
+// FuzzParseCommand feeds arbitrary input to ParseCommand and the strict parser, asserting
+// they never panic and that every accepted command is well-formed.
+func FuzzParseCommand(f *testing.F) {
+	seeds := []string{
+		"INDEX|package1|dep1,dep2\n",
+		"REMOVE|package1|\n",
+		"QUERY|package1|\n",
+		"INDEX|pkg|dep1,dep2,\n",
+		"INDEX|a|b,,c\n",
+		"INVALID|package|\n",
+		"INDEX||\n",
+		"INDEX\n",
+		"INDEX|package|deps|extra\n",
+		"",
+		"INDEX|package|deps",
+		"INDEX|a\x00b|c\n",
+		"QUERY|a|\nQUERY|b|\n",
+		"CAPS||\n",
+		"STATUS|pkg|\n",
+		"DEPTH|pkg|\n",
+		"INDEXCAS|pkg|dep|0123456789abcdef\n",
+		"INDEXCAS|pkg||\n",
+		"SEARCH|lib|\n",
+		"SEARCH|lib*-dev|\n",
+		"EDGES|pkg|\n",
+		"RENAME|old|new\n",
+		"ADDDEP|pkg|a,b\n",
+		"RMDEP|pkg|a\n",
+		"CANREMOVE|pkg|\n",
+		"INDEX|app|db:required,cache:optional\n",
+		"PIN|pkg|\n",
+		"UNPIN|pkg|\n",
+		"BUILD||\n",
+		"GEN||\n",
+		"PATH|app|base\n",
+		`INDEX|a\|b|c\,d,e\\` + "\n",
+		"INDEX|" + strings.Repeat("x", 4096) + "|" + strings.Repeat("d,", 1024) + "\n",
+	}
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+
+	strict := &Parser{Strict: true}
+	escaping := &Parser{Escapes: true}
+	labeling := &Parser{Escapes: true, Labels: true}
+	f.Fuzz(func(t *testing.T, line string) {
+		for _, parse := range []func(string) (*Command, error){ParseCommand, strict.Parse, escaping.Parse, labeling.Parse} {
+			cmd, err := parse(line)
+			if err != nil {
+				continue
+			}
+			if cmd.Package == "" && cmd.Type.RequiresPackage() {
+				t.Errorf("accepted %q with empty package", line)
+			}
+			if cmd.Type.String() == cmdUnknownStr {
+				t.Errorf("accepted %q with unrecognized type %d", line, cmd.Type)
+			}
+			if strings.Contains(cmd.Package, "\n") {
+				t.Errorf("accepted %q with newline in package %q", line, cmd.Package)
+			}
+			for _, dep := range cmd.Dependencies {
+				if dep == "" {
+					t.Errorf("accepted %q with empty dependency", line)
+				}
+			}
+			for dep, label := range cmd.Labels {
+				if label == "" || !slices.Contains(cmd.Dependencies, dep) {
+					t.Errorf("accepted %q with label %q for dependency %q", line, label, dep)
+				}
+			}
+		}
+	})
+}
@@ -51,34 +51,41 @@ func (client *TCPPackageIndexerClient) Close() error {
 // Send transmits a message to the server using the line-oriented protocol.
 // Handles connection timeouts and protocol parsing for robust test execution.
 func (client *TCPPackageIndexerClient) Send(msg string) (ResponseCode, error) {
+	code, detail, err := client.SendWithDetail(msg)
+	if err != nil {
+		return code, err
+	}
+	if detail != "" {
+		return UNKNOWN, fmt.Errorf("Error parsing message from server [%s %s]: unexpected detail", code, detail)
+	}
+	return code, nil
+}
+
+// SendWithDetail transmits a message and returns the response code together with any
+// detail payload following it on the same line (e.g. "indexed=true deps=2" for STATUS).
+func (client *TCPPackageIndexerClient) SendWithDetail(msg string) (ResponseCode, string, error) {
 	extendTimeoutFor(client.conn)
 	_, err := fmt.Fprintln(client.conn, msg)
 
 	if err != nil {
-		return UNKNOWN, fmt.Errorf("Error sending message to server: %v", err)
+		return UNKNOWN, "", fmt.Errorf("Error sending message to server: %v", err)
 	}
 
 	extendTimeoutFor(client.conn)
 	responseMsg, err := bufio.NewReader(client.conn).ReadString('\n')
 	if err != nil {
-		return UNKNOWN, fmt.Errorf("Error reading response code from server: %v", err)
+		return UNKNOWN, "", fmt.Errorf("Error reading response code from server: %v", err)
 	}
 
 	returnedString := strings.TrimRight(responseMsg, "\n")
+	code, detail, _ := strings.Cut(returnedString, " ")
 
-	if returnedString == OK {
-		return OK, nil
-	}
-
-	if returnedString == FAIL {
-		return FAIL, nil
-	}
-
-	if returnedString == ERROR {
-		return ERROR, nil
+	switch code {
+	case OK, FAIL, ERROR:
+		return ResponseCode(code), detail, nil
 	}
 
-	return UNKNOWN, fmt.Errorf("Error parsing message from server [%s]: %v", responseMsg, err)
+	return UNKNOWN, "", fmt.Errorf("Error parsing message from server [%s]: %v", responseMsg, err)
 }
 
 // MakeTCPPackageIndexClient returns a new instance of the client
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// detailSender is implemented by clients that can return the detail payload of a reply
+type detailSender interface {
+	SendWithDetail(msg string) (ResponseCode, string, error)
+}
+
+// ExpectedDependents builds the reverse-dependency view of a package graph: for every
+// package, the number of distinct packages that directly depend on it.
+func ExpectedDependents(packages []*Package) map[string]int {
+	dependents := make(map[string]map[string]bool, len(packages))
+	for _, pkg := range packages {
+		if dependents[pkg.Name] == nil {
+			dependents[pkg.Name] = make(map[string]bool)
+		}
+		for _, dep := range pkg.Dependencies {
+			if dependents[dep.Name] == nil {
+				dependents[dep.Name] = make(map[string]bool)
+			}
+			dependents[dep.Name][pkg.Name] = true
+		}
+	}
+
+	counts := make(map[string]int, len(dependents))
+	for name, set := range dependents {
+		counts[name] = len(set)
+	}
+	return counts
+}
+
+// verifyDependents cross-checks the server's reverse-dependency view against the
+// expected graph, using STATUS to read each package's direct dependent count. All
+// packages are expected to be indexed.
+func verifyDependents(client PackageIndexerClient, packages []*Package, expected map[string]int) error {
+	sender, ok := client.(detailSender)
+	if !ok {
+		return fmt.Errorf("%s cannot read reply details needed for dependency verification", client.Name())
+	}
+
+	log.Printf("%s verifying reverse dependencies of %d packages", client.Name(), len(packages))
+	for _, pkg := range packages {
+		msg := MakeStatusMessage(pkg)
+		code, detail, err := sender.SendWithDetail(msg)
+		if err != nil {
+			return fmt.Errorf("%s found error when sending message [%s]: %v", client.Name(), msg, err)
+		}
+		if code != OK {
+			return fmt.Errorf("%s expected STATUS for package [%s] to return [%s], got [%s]", client.Name(), pkg.Name, OK, code)
+		}
+
+		fields := parseStatusDetail(detail)
+		if fields["indexed"] != "true" {
+			return fmt.Errorf("%s expected package [%s] to be indexed, got [%s]", client.Name(), pkg.Name, detail)
+		}
+		dependents, err := strconv.Atoi(fields["dependents"])
+		if err != nil {
+			return fmt.Errorf("%s could not parse dependents for package [%s] from [%s]", client.Name(), pkg.Name, detail)
+		}
+		if dependents != expected[pkg.Name] {
+			return fmt.Errorf("%s expected package [%s] to have %d dependents, server reports %d", client.Name(), pkg.Name, expected[pkg.Name], dependents)
+		}
+	}
+	return nil
+}
+
+// parseStatusDetail splits a STATUS detail payload ("indexed=true deps=2 dependents=1")
+// into its key/value pairs
+func parseStatusDetail(detail string) map[string]string {
+	fields := make(map[string]string)
+	for _, field := range strings.Fields(detail) {
+		if key, value, ok := strings.Cut(field, "="); ok {
+			fields[key] = value
+		}
+	}
+	return fields
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"package-indexer/internal/server"
+)
+
+// TestVerifyDependents drives the dependency integrity check against an in-process
+// server indexed with a known graph, then breaks the graph and expects a mismatch.
+func TestVerifyDependents(t *testing.T) {
+	reserved, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to reserve port: %v", err)
+	}
+	addr := reserved.Addr().String()
+	reserved.Close()
+	host, portStr, _ := net.SplitHostPort(addr)
+	port, _ := strconv.Atoi(portStr)
+
+	srv := server.NewServer(addr, server.DefaultReadTimeout)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = srv.StartWithContext(ctx) }()
+	<-srv.Ready()
+	defer srv.Shutdown(context.Background())
+
+	graph, err := TextToPackages(&AllPackages{}, "app: lib util\nlib: base\nutil: base\nbase:\n")
+	if err != nil {
+		t.Fatalf("failed to parse graph: %v", err)
+	}
+	expected := ExpectedDependents(graph.Packages)
+	if expected["base"] != 2 || expected["lib"] != 1 || expected["app"] != 0 {
+		t.Fatalf("unexpected dependents for known graph: %v", expected)
+	}
+
+	client, err := MakeTCPPackageIndexClient("integrity-test", host, port)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer client.Close()
+	if err := bruteforceIndexesPackages(client, graph.Packages, 0); err != nil {
+		t.Fatalf("failed to index graph: %v", err)
+	}
+
+	if err := verifyDependents(client, graph.Packages, expected); err != nil {
+		t.Errorf("expected matching reverse dependencies, got %v", err)
+	}
+
+	expected["base"] = 3
+	err = verifyDependents(client, graph.Packages, expected)
+	if err == nil || !strings.Contains(err.Error(), "[base]") {
+		t.Errorf("expected mismatch for base, got %v", err)
+	}
+
+	if err := verifyDependents(&stubClient{WhatToReturn: OK}, graph.Packages, expected); err == nil {
+		t.Error("expected error for a client without reply details")
+	}
+}
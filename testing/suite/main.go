@@ -22,16 +22,33 @@ func main() {
 	host := flag.String("host", "127.0.0.1", "The host of your server")
 	port := flag.Int("port", 8080, "The port your server exposes to clients")
 	concurrencyLevel := flag.Int("concurrency", 10, "A positive value indicating how many concurrent clients to use")
+	maxWorkers := flag.Int("max-workers", 0, "Maximum number of clients running at once; segments beyond it are queued (0 means no cap)")
 	randomSeed := flag.Int64("seed", 42, "A positive value used to seed the random number generator")
 	debugMode := flag.Bool("debug", false, "Prints some extra information and opens a HTTP server on port 8081")
 	unluckiness := flag.Int("unluckiness", 5, "A % showing the probability of something bad happenning, like broken messages being sent or random disconnects")
+	reverseOrder := flag.Bool("reverse-order", false, "Submit packages with dependents before their dependencies to stress the server's FAIL-retry handling")
+	runTimeout := flag.Duration("run-timeout", 0, "Abort the whole test run with a goroutine dump if it takes longer than this (0 disables)")
+	keepalive := flag.Bool("keepalive", false, "Reuse one persistent connection per client across all test phases, reconnecting if it drops")
+	replayLog := flag.String("replay", "", "Replay a server command log file against the server instead of running the test suite")
 	flag.Parse()
+
+	// Replay mode reproduces recorded state (e.g. production traffic in staging) and exits
+	if *replayLog != "" {
+		if err := replayFile(*replayLog, *host, *port); err != nil {
+			log.Fatalf("Replay failed: %v", err)
+		}
+		return
+	}
 	
 	// Initialize random seed for deterministic chaos testing
 	rand.Seed(*randomSeed)
 
 	// Create test run instance with configured parameters
 	test := MakeTestRun(*host, *port, *concurrencyLevel, *unluckiness)
+	test.MaxWorkers = *maxWorkers
+	test.ReverseOrder = *reverseOrder
+	test.RunTimeout = *runTimeout
+	test.Keepalive = *keepalive
 
 	// Enable debug HTTP server with pprof endpoints if requested
 	if *debugMode {
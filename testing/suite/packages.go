@@ -1,24 +1,23 @@
 package main
 
 import (
+	"bufio"
 	"embed"
 	"fmt"
-	"regexp"
+	"io"
+	"log"
 	"strings"
+
+	"package-indexer/internal/indexer"
 )
 
 //go:embed data/*
 var content embed.FS
 
 // LineFormat defines the regular expression pattern for valid dependency specification lines.
-// Used for parsing package dependency data from embedded test files.
+// Shared with the server's preload parser so both accept exactly the same files.
 const (
-	LineFormat = "^\\S+:( +)?(\\S+ *)*"
-)
-
-// lineMatcher validates dependency specification lines against the required format
-var (
-	lineMatcher, _ = regexp.Compile(LineFormat)
+	LineFormat = indexer.LineFormat
 )
 
 // Package represents a package and its dependencies
@@ -36,6 +35,10 @@ func (pkg *Package) AddDependency(to *Package) {
 // Ensures consistent package instances across test operations to prevent duplicate objects.
 type AllPackages struct {
 	Packages []*Package // All registered packages for testing operations
+
+	byName  map[string]*Package // Name index over Packages for O(1) lookups in Named
+	indexed int                 // Number of leading Packages covered by byName
+	warned  bool                // Whether a duplicate name in Packages has been reported
 }
 
 // Names returns the names of all known packages
@@ -51,22 +54,38 @@ func (allPackages *AllPackages) Names() []string {
 // This factory method maintains referential integrity across the test package graph
 // by preventing duplicate package objects for the same logical package.
 func (allPackages *AllPackages) Named(name string) *Package {
-	var pkg *Package
+	allPackages.index()
 
-	for _, p := range allPackages.Packages {
-		if p.Name == name {
-			pkg = p
-		}
-	}
-
-	if pkg == nil {
+	pkg, ok := allPackages.byName[name]
+	if !ok {
 		pkg = makeUnprocessedPackage(name)
 		allPackages.Packages = append(allPackages.Packages, pkg)
+		allPackages.byName[name] = pkg
+		allPackages.indexed++
 	}
 
 	return pkg
 }
 
+// index brings byName up to date with Packages. The index is built lazily so literals
+// with preset Packages keep working; packages appended directly are indexed on the next
+// lookup, and a shrunk slice is reindexed from scratch. When a name appears
+// more than once the last occurrence wins, as before, and a warning is logged once.
+func (allPackages *AllPackages) index() {
+	if allPackages.byName == nil || allPackages.indexed > len(allPackages.Packages) {
+		allPackages.byName = make(map[string]*Package, len(allPackages.Packages))
+		allPackages.indexed = 0
+	}
+	for _, p := range allPackages.Packages[allPackages.indexed:] {
+		if _, dup := allPackages.byName[p.Name]; dup && !allPackages.warned {
+			log.Printf("Package %q is registered more than once; lookups return the last one", p.Name)
+			allPackages.warned = true
+		}
+		allPackages.byName[p.Name] = p
+	}
+	allPackages.indexed = len(allPackages.Packages)
+}
+
 // makeUnprocessedPackage creates a new package instance with empty dependencies
 func makeUnprocessedPackage(name string) *Package {
 	return &Package{
@@ -81,17 +100,7 @@ func makeUnprocessedPackage(name string) *Package {
 // first element of the array is the package name,
 // any subsequent elements are dependencies.
 func TokeniseLine(line string) ([]string, error) {
-	if !lineMatcher.MatchString(line) {
-		return nil, fmt.Errorf("Invalid line: %#v", line)
-	}
-
-	sanitisedLine := strings.Replace(strings.Trim(line, " "), "  ", " ", -1)
-	tokens := strings.Split(sanitisedLine, " ")
-
-	packageName := strings.TrimRight(tokens[0], ":")
-
-	dependenciesNames := tokens[1:len(tokens)]
-	return append([]string{packageName}, dependenciesNames...), nil
+	return indexer.TokeniseLine(line)
 }
 
 // TokensToPackage converts an array of tokens to a Package.
@@ -113,11 +122,20 @@ func TokensToPackage(allPackages *AllPackages, tokens []string) (*Package, error
 
 // TextToPackages parses a string containing a sequence of lines as per the
 // TokeniseLine function and adds all parsed contents to a AllPackages instance.
+// Blank lines and lines beginning with "#" are skipped.
 func TextToPackages(allPackages *AllPackages, text string) (*AllPackages, error) {
-	lines := strings.Split(text, "\n")
+	return TextToPackagesReader(allPackages, strings.NewReader(text))
+}
+
+// TextToPackagesReader is TextToPackages reading r line by line, so very large inputs
+// are never held in memory as a whole.
+func TextToPackagesReader(allPackages *AllPackages, r io.Reader) (*AllPackages, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), indexer.MaxSpecLineLength)
 
-	for _, l := range lines {
-		if len(l) == 0 {
+	for scanner.Scan() {
+		l := scanner.Text()
+		if indexer.IsIgnorableLine(l) {
 			continue
 		}
 
@@ -131,6 +149,9 @@ func TextToPackages(allPackages *AllPackages, text string) (*AllPackages, error)
 			return nil, err
 		}
 	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
 
 	return allPackages, nil
 }
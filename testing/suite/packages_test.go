@@ -1,7 +1,13 @@
 package main
 
 import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -17,6 +23,40 @@ func TestAllPackages_Named(t *testing.T) {
 	}
 }
 
+// TestAllPackages_NamedPreset validates lookups over a preset Packages list with a
+// duplicated name: the last occurrence wins, the collision is logged once, and the
+// index is kept rather than rebuilt on every lookup.
+func TestAllPackages_NamedPreset(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	first, second := makeUnprocessedPackage("dup"), makeUnprocessedPackage("dup")
+	allPackages := AllPackages{Packages: []*Package{first, makeUnprocessedPackage("other"), second}}
+
+	for i := 0; i < 3; i++ {
+		if got := allPackages.Named("dup"); got != second {
+			t.Fatalf("lookup %d returned %p, expected the last occurrence %p", i, got, second)
+		}
+	}
+	if allPackages.Named("other") != allPackages.Packages[1] {
+		t.Error("expected the preset package for a unique name")
+	}
+	if len(allPackages.Packages) != 3 || allPackages.indexed != 3 {
+		t.Errorf("indexed = %d, expected %d", allPackages.indexed, len(allPackages.Packages))
+	}
+	if n := strings.Count(logs.String(), `"dup"`); n != 1 {
+		t.Errorf("expected one duplicate warning, got %d in %q", n, logs.String())
+	}
+
+	// Packages appended directly are picked up by the next lookup
+	appended := makeUnprocessedPackage("appended")
+	allPackages.Packages = append(allPackages.Packages, appended)
+	if got := allPackages.Named("appended"); got != appended || len(allPackages.Packages) != 4 {
+		t.Errorf("expected the directly appended package, got %p with %d packages", got, len(allPackages.Packages))
+	}
+}
+
 // TestAddingDependencies validates that package dependency relationships are correctly
 // established and maintained through the AddDependency method.
 func TestAddingDependencies(t *testing.T) {
@@ -192,6 +232,23 @@ e: a
 		t.Errorf("Shouldn't add any packages for empty text: %#v", allPackages.Packages)
 	}
 
+	textWithComments := `# package graph with annotations
+a: b c
+
+  # indented comment
+b: c
+   
+c:
+`
+	allPackages = &AllPackages{}
+	_, err = TextToPackages(allPackages, textWithComments)
+	if err != nil {
+		t.Fatalf("Error parsing text with comments: %#v", err)
+	}
+	if names := allPackages.Names(); !reflect.DeepEqual(names, []string{"a", "b", "c"}) {
+		t.Errorf("Comments leaked into parsed packages: %#v", names)
+	}
+
 	textWithBrokenLines := `a: b c
 z
 b: c z
@@ -204,6 +261,51 @@ b: c z
 	}
 }
 
+// generatedSpecReader produces "pkgN: pkgN-1" declarations on demand, so a large input
+// never exists in memory as a whole
+type generatedSpecReader struct {
+	next, total int
+	pending     []byte
+}
+
+func (g *generatedSpecReader) Read(p []byte) (int, error) {
+	for len(g.pending) == 0 {
+		if g.next == g.total {
+			return 0, io.EOF
+		}
+		if g.next == 0 {
+			g.pending = []byte("pkg0:\n")
+		} else {
+			g.pending = []byte(fmt.Sprintf("pkg%d: pkg%d\n", g.next, g.next-1))
+		}
+		g.next++
+	}
+	n := copy(p, g.pending)
+	g.pending = g.pending[n:]
+	return n, nil
+}
+
+// TestTextToPackagesReader validates streaming a large generated input line by line
+func TestTextToPackagesReader(t *testing.T) {
+	const total = 200000
+	allPackages, err := TextToPackagesReader(&AllPackages{}, &generatedSpecReader{total: total})
+	if err != nil {
+		t.Fatalf("TextToPackagesReader returned error: %v", err)
+	}
+	if len(allPackages.Packages) != total {
+		t.Fatalf("expected %d packages, got %d", total, len(allPackages.Packages))
+	}
+
+	last := allPackages.Named(fmt.Sprintf("pkg%d", total-1))
+	if len(last.Dependencies) != 1 || last.Dependencies[0].Name != fmt.Sprintf("pkg%d", total-2) {
+		t.Errorf("unexpected dependencies for the last package: %v", last.Dependencies)
+	}
+
+	if _, err := TextToPackagesReader(&AllPackages{}, strings.NewReader("ok:\nbroken line\n")); err == nil {
+		t.Error("expected a malformed line to fail")
+	}
+}
+
 // TestParseBrewPackages validates parsing of the embedded Homebrew package data
 // used for comprehensive integration testing scenarios.
 func TestParseBrewPackages(t *testing.T) {
@@ -260,3 +362,19 @@ func TestSegmentListPackages(t *testing.T) {
 		t.Errorf("Expected %v got %v", expectedList, actualList)
 	}
 }
+
+// BenchmarkTextToPackages_LargeGraph measures building a generated 5000-package graph,
+// dominated by Named lookups for every package and dependency token.
+func BenchmarkTextToPackages_LargeGraph(b *testing.B) {
+	var text strings.Builder
+	for i := 0; i < 5000; i++ {
+		fmt.Fprintf(&text, "pkg%d: pkg%d pkg%d\n", i, i/2, i/3)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := TextToPackages(&AllPackages{}, text.String()); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
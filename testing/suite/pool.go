@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+)
+
+// dialFunc opens a new named client connection to the server
+type dialFunc func(name string) (PackageIndexerClient, error)
+
+// clientPool keeps one persistent client per segment slot so the same connections are
+// reused across the remove, index and verify phases instead of reconnecting each phase
+type clientPool struct {
+	dial dialFunc
+
+	mu      sync.Mutex
+	clients map[int]*reconnectingClient
+}
+
+// newClientPool creates an empty pool opening connections with dial
+func newClientPool(dial dialFunc) *clientPool {
+	return &clientPool{dial: dial, clients: make(map[int]*reconnectingClient)}
+}
+
+// get returns the persistent client for a slot, creating it on first use
+func (p *clientPool) get(slot int) (PackageIndexerClient, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if client, ok := p.clients[slot]; ok {
+		return client, nil
+	}
+	client := &reconnectingClient{name: fmt.Sprintf("keepalive-client[%d]", slot+1), dial: p.dial}
+	if err := client.connect(); err != nil {
+		return nil, err
+	}
+	p.clients[slot] = client
+	return client, nil
+}
+
+// dials returns the total number of connections opened by the pool's clients
+func (p *clientPool) dials() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	total := 0
+	for _, client := range p.clients {
+		total += client.dials
+	}
+	return total
+}
+
+// closeAll closes every pooled connection
+func (p *clientPool) closeAll() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for slot, client := range p.clients {
+		client.Close()
+		delete(p.clients, slot)
+	}
+}
+
+// reconnectingClient is a persistent client that transparently reconnects and retries
+// once when its connection is lost mid-run. It is used by a single worker at a time.
+type reconnectingClient struct {
+	name   string
+	dial   dialFunc
+	client PackageIndexerClient
+	dials  int
+}
+
+// Name returns this client's identifier
+func (client *reconnectingClient) Name() string {
+	return client.name
+}
+
+// Close closes the current connection, if any
+func (client *reconnectingClient) Close() error {
+	if client.client == nil {
+		return nil
+	}
+	err := client.client.Close()
+	client.client = nil
+	return err
+}
+
+// connect opens a fresh connection
+func (client *reconnectingClient) connect() error {
+	conn, err := client.dial(client.name)
+	if err != nil {
+		return err
+	}
+	client.client = conn
+	client.dials++
+	return nil
+}
+
+// reconnect replaces a broken connection
+func (client *reconnectingClient) reconnect(cause error) error {
+	log.Printf("%s lost its connection (%v), reconnecting", client.name, cause)
+	client.Close()
+	return client.connect()
+}
+
+// Send transmits a message, reconnecting and retrying once if the connection failed
+func (client *reconnectingClient) Send(msg string) (ResponseCode, error) {
+	if client.client == nil {
+		if err := client.connect(); err != nil {
+			return UNKNOWN, err
+		}
+	}
+	code, err := client.client.Send(msg)
+	if err == nil {
+		return code, nil
+	}
+	if reconnectErr := client.reconnect(err); reconnectErr != nil {
+		return UNKNOWN, reconnectErr
+	}
+	return client.client.Send(msg)
+}
+
+// SendWithDetail transmits a message returning reply details, reconnecting and retrying
+// once if the connection failed
+func (client *reconnectingClient) SendWithDetail(msg string) (ResponseCode, string, error) {
+	if client.client == nil {
+		if err := client.connect(); err != nil {
+			return UNKNOWN, "", err
+		}
+	}
+	sender, ok := client.client.(detailSender)
+	if !ok {
+		return UNKNOWN, "", fmt.Errorf("%s cannot read reply details", client.name)
+	}
+	code, detail, err := sender.SendWithDetail(msg)
+	if err == nil {
+		return code, detail, nil
+	}
+	if reconnectErr := client.reconnect(err); reconnectErr != nil {
+		return UNKNOWN, "", reconnectErr
+	}
+	return client.client.(detailSender).SendWithDetail(msg)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// flakyClient is a stub client whose first Send fails as if the connection dropped
+type flakyClient struct {
+	stubClient
+	failures int
+}
+
+// Send fails while failures remain, then behaves like the stub
+func (client *flakyClient) Send(msg string) (ResponseCode, error) {
+	if client.failures > 0 {
+		client.failures--
+		return UNKNOWN, errors.New("connection reset by peer")
+	}
+	return client.stubClient.Send(msg)
+}
+
+// TestClientPool_ReusesConnectionsAcrossPhases verifies that with keepalive each segment
+// keeps one connection across every phase.
+func TestClientPool_ReusesConnectionsAcrossPhases(t *testing.T) {
+	var mu sync.Mutex
+	var dialed []*stubClient
+	dial := func(name string) (PackageIndexerClient, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		client := &stubClient{WhatToReturn: OK}
+		dialed = append(dialed, client)
+		return client, nil
+	}
+
+	allPackages := &AllPackages{}
+	for i := 0; i < 20; i++ {
+		allPackages.Named(fmt.Sprintf("pkg-%d", i))
+	}
+	segments := SegmentListPackages(allPackages.Packages, 4)
+	run := &TestRun{ConcurrencyLevel: len(segments), pool: newClientPool(dial), exit: func(code int) {
+		t.Errorf("run terminated with exit code %d", code)
+	}}
+	defer run.pool.closeAll()
+
+	concurrentBruteforceIndexesPackages(0, run, segments)
+	concurrentverifyAllPackages(len(segments), run, segments, OK)
+	concurrentBruteforceRemovesAllPackages(2*len(segments), run, segments)
+
+	if len(dialed) != len(segments) || run.pool.dials() != len(segments) {
+		t.Fatalf("expected %d connections for %d segments, dialed %d", len(segments), len(segments), len(dialed))
+	}
+	calls := 0
+	for _, client := range dialed {
+		calls += client.NumberOfCalls
+	}
+	if calls != 3*len(allPackages.Packages) {
+		t.Errorf("expected %d calls over the pooled connections, got %d", 3*len(allPackages.Packages), calls)
+	}
+}
+
+// TestReconnectingClient_RecoversFromConnectionLoss verifies a dropped connection is
+// replaced and the failed command retried.
+func TestReconnectingClient_RecoversFromConnectionLoss(t *testing.T) {
+	dials := 0
+	client := &reconnectingClient{name: "keepalive-client[1]", dial: func(name string) (PackageIndexerClient, error) {
+		dials++
+		if dials == 1 {
+			return &flakyClient{stubClient: stubClient{WhatToReturn: OK}, failures: 1}, nil
+		}
+		return &stubClient{WhatToReturn: OK}, nil
+	}}
+
+	code, err := client.Send("QUERY|pkg|")
+	if err != nil || code != OK {
+		t.Fatalf("expected OK after reconnect, got %v (err %v)", code, err)
+	}
+	if dials != 2 || client.dials != 2 {
+		t.Errorf("expected one reconnect (2 dials), got %d", dials)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"package-indexer/internal/server"
+)
+
+// ReplayResult summarizes a command log replay
+type ReplayResult struct {
+	Replayed  int                  // Commands sent to the server
+	Skipped   int                  // Log lines that were malformed or not command records
+	Responses map[ResponseCode]int // Server responses by code
+}
+
+// ReplayCommandLog reads a command log written by the server's -command-log-file option
+// and sends each recorded command through client, in order. Malformed lines are skipped
+// and counted; a transport error aborts the replay.
+func ReplayCommandLog(client PackageIndexerClient, r io.Reader) (ReplayResult, error) {
+	result := ReplayResult{Responses: make(map[ResponseCode]int)}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var record map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			result.Skipped++
+			continue
+		}
+		line, ok := record[server.CommandLogLineKey].(string)
+		if record["msg"] != server.CommandLogMessage || !ok || line == "" {
+			result.Skipped++
+			continue
+		}
+
+		code, err := client.Send(line)
+		if err != nil {
+			return result, fmt.Errorf("replay of %q failed: %w", line, err)
+		}
+		result.Replayed++
+		result.Responses[code]++
+	}
+	return result, scanner.Err()
+}
+
+// replayFile connects to the server and replays the command log at path
+func replayFile(path string, host string, port int) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	client, err := MakeTCPPackageIndexClient("replay", host, port)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	result, err := ReplayCommandLog(client, f)
+	log.Printf("Replayed %d commands (%d skipped): %v", result.Replayed, result.Skipped, result.Responses)
+	return err
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"package-indexer/internal/server"
+)
+
+// TestReplayCommandLog replays a command log containing malformed lines against an
+// in-process server and verifies the resulting index state.
+func TestReplayCommandLog(t *testing.T) {
+	commandLog := strings.Join([]string{
+		`{"time":"2024-01-01T00:00:00Z","level":"INFO","msg":"command","connID":1,"line":"INDEX|base|","result":"OK"}`,
+		`{"time":"2024-01-01T00:00:01Z","level":"INFO","msg":"command","connID":1,"line":"INDEX|app|base","result":"OK"}`,
+		`not json at all`,
+		`{"time":"2024-01-01T00:00:02Z","level":"INFO","msg":"Client connected","connID":2}`,
+		`{"time":"2024-01-01T00:00:03Z","level":"INFO","msg":"command","connID":2,"line":"INDEX|tmp|","result":"OK"}`,
+		`{"time":"2024-01-01T00:00:04Z","level":"INFO","msg":"command","connID":2,"line":"REMOVE|tmp|","result":"OK"}`,
+		`{"time":"2024-01-01T00:00:05Z","level":"INFO","msg":"command","connID":2,"line":"REMOVE|base|","result":"FAIL"}`,
+	}, "\n")
+
+	// Reserve a free port for the in-process server
+	reserved, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to reserve port: %v", err)
+	}
+	addr := reserved.Addr().String()
+	reserved.Close()
+	host, portStr, _ := net.SplitHostPort(addr)
+	port, _ := strconv.Atoi(portStr)
+
+	srv := server.NewServer(addr, server.DefaultReadTimeout)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = srv.StartWithContext(ctx) }()
+	<-srv.Ready()
+	defer srv.Shutdown(context.Background())
+
+	client, err := MakeTCPPackageIndexClient("replay-test", host, port)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer client.Close()
+
+	result, err := ReplayCommandLog(client, strings.NewReader(commandLog))
+	if err != nil {
+		t.Fatalf("ReplayCommandLog returned error: %v", err)
+	}
+	if result.Replayed != 5 || result.Skipped != 2 {
+		t.Errorf("expected 5 replayed and 2 skipped, got %+v", result)
+	}
+	if result.Responses[OK] != 4 || result.Responses[FAIL] != 1 {
+		t.Errorf("unexpected response counts: %v", result.Responses)
+	}
+
+	for pkg, expected := range map[string]ResponseCode{"base": OK, "app": OK, "tmp": FAIL} {
+		if code, err := client.Send("QUERY|" + pkg + "|"); err != nil || code != expected {
+			t.Errorf("QUERY %s = %v, %v; expected %v", pkg, code, err, expected)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+)
+
+// ClientResult tallies the commands sent by one test client and how its run ended
+type ClientResult struct {
+	Name      string
+	Commands  int
+	Responses map[ResponseCode]int
+	Errors    int  // Sends that failed at the transport or protocol level
+	Failed    bool // The client's action returned an error
+}
+
+// ResultsAggregator collects per-client results from concurrent test clients so a run
+// ends with one consolidated tally. The zero value is ready to use.
+type ResultsAggregator struct {
+	mu      sync.Mutex
+	clients map[string]*ClientResult
+}
+
+// clientLocked returns the result entry for name, creating it if needed
+func (a *ResultsAggregator) clientLocked(name string) *ClientResult {
+	if a.clients == nil {
+		a.clients = make(map[string]*ClientResult)
+	}
+	result, ok := a.clients[name]
+	if !ok {
+		result = &ClientResult{Name: name, Responses: make(map[ResponseCode]int)}
+		a.clients[name] = result
+	}
+	return result
+}
+
+// RecordResponse records the outcome of a single command sent by the named client
+func (a *ResultsAggregator) RecordResponse(client string, code ResponseCode, err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	result := a.clientLocked(client)
+	result.Commands++
+	if err != nil {
+		result.Errors++
+		return
+	}
+	result.Responses[code]++
+}
+
+// RecordOutcome records whether the named client's action completed successfully
+func (a *ResultsAggregator) RecordOutcome(client string, err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.clientLocked(client).Failed = err != nil
+}
+
+// Clients returns a copy of every client's result, ordered by name
+func (a *ResultsAggregator) Clients() []ClientResult {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	results := make([]ClientResult, 0, len(a.clients))
+	for _, result := range a.clients {
+		copied := *result
+		copied.Responses = make(map[ResponseCode]int, len(result.Responses))
+		for code, count := range result.Responses {
+			copied.Responses[code] = count
+		}
+		results = append(results, copied)
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Name < results[j].Name })
+	return results
+}
+
+// Totals sums the results of all clients; Failed is set if any client failed
+func (a *ResultsAggregator) Totals() ClientResult {
+	totals := ClientResult{Name: "total", Responses: make(map[ResponseCode]int)}
+	for _, result := range a.Clients() {
+		totals.Commands += result.Commands
+		totals.Errors += result.Errors
+		totals.Failed = totals.Failed || result.Failed
+		for code, count := range result.Responses {
+			totals.Responses[code] += count
+		}
+	}
+	return totals
+}
+
+// FailedClients returns the names of clients whose action returned an error
+func (a *ResultsAggregator) FailedClients() []string {
+	var failed []string
+	for _, result := range a.Clients() {
+		if result.Failed {
+			failed = append(failed, result.Name)
+		}
+	}
+	return failed
+}
+
+// LogSummary logs the consolidated tally across all clients
+func (a *ResultsAggregator) LogSummary() {
+	totals := a.Totals()
+	log.Printf("RESULTS clients=%d commands=%d OK=%d FAIL=%d ERROR=%d send-errors=%d failed-clients=%v",
+		len(a.Clients()), totals.Commands, totals.Responses[OK], totals.Responses[FAIL],
+		totals.Responses[ERROR], totals.Errors, a.FailedClients())
+}
+
+// recordingClient decorates a client so every command it sends is tallied
+type recordingClient struct {
+	PackageIndexerClient
+	results *ResultsAggregator
+}
+
+// Send forwards the message and records its outcome
+func (client *recordingClient) Send(msg string) (ResponseCode, error) {
+	code, err := client.PackageIndexerClient.Send(msg)
+	client.results.RecordResponse(client.Name(), code, err)
+	return code, err
+}
+
+// SendWithDetail forwards the message to clients able to return reply details and
+// records its outcome
+func (client *recordingClient) SendWithDetail(msg string) (ResponseCode, string, error) {
+	sender, ok := client.PackageIndexerClient.(detailSender)
+	if !ok {
+		return UNKNOWN, "", fmt.Errorf("%s cannot read reply details", client.Name())
+	}
+	code, detail, err := sender.SendWithDetail(msg)
+	client.results.RecordResponse(client.Name(), code, err)
+	return code, detail, err
+}
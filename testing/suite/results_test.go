@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// namedStubClient is a stub client with a caller-chosen name
+type namedStubClient struct {
+	stubClient
+	name string
+}
+
+// Name returns the configured name
+func (client *namedStubClient) Name() string {
+	return client.name
+}
+
+// TestResultsAggregator_SumsConcurrentClients verifies per-client tallies and totals when
+// several stub clients record commands concurrently.
+func TestResultsAggregator_SumsConcurrentClients(t *testing.T) {
+	var results ResultsAggregator
+	responses := []ResponseCode{OK, FAIL, ERROR, OK}
+
+	var wg sync.WaitGroup
+	for i, code := range responses {
+		wg.Add(1)
+		go func(number int, code ResponseCode) {
+			defer wg.Done()
+			name := fmt.Sprintf("client[%d]", number)
+			client := &recordingClient{
+				PackageIndexerClient: &namedStubClient{stubClient: stubClient{WhatToReturn: code}, name: name},
+				results:              &results,
+			}
+			for j := 0; j < 10; j++ {
+				_, _ = client.Send("QUERY|pkg|")
+			}
+			var err error
+			if code == ERROR {
+				err = errors.New("boom")
+			}
+			results.RecordOutcome(name, err)
+		}(i, code)
+	}
+	wg.Wait()
+	results.RecordResponse("client[0]", UNKNOWN, errors.New("connection reset"))
+
+	clients := results.Clients()
+	if len(clients) != len(responses) {
+		t.Fatalf("expected %d clients, got %d", len(responses), len(clients))
+	}
+	if clients[0].Commands != 11 || clients[0].Responses[OK] != 10 || clients[0].Errors != 1 {
+		t.Errorf("unexpected tally for client[0]: %+v", clients[0])
+	}
+
+	totals := results.Totals()
+	if totals.Commands != 41 || totals.Responses[OK] != 20 || totals.Responses[FAIL] != 10 ||
+		totals.Responses[ERROR] != 10 || totals.Errors != 1 {
+		t.Errorf("unexpected totals: %+v", totals)
+	}
+	if !totals.Failed {
+		t.Error("expected totals to report a failed client")
+	}
+	if failed := results.FailedClients(); len(failed) != 1 || failed[0] != "client[2]" {
+		t.Errorf("expected client[2] to be the only failed client, got %v", failed)
+	}
+}
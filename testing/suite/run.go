@@ -5,6 +5,7 @@ import (
 	"log"
 	"math/rand"
 	"os"
+	"runtime/pprof"
 	"sync"
 	"time"
 )
@@ -15,8 +16,15 @@ type TestRun struct {
 	ServerPort       int
 	StartedAt        time.Time
 	ConcurrencyLevel int
+	MaxWorkers       int           // Caps goroutines processing segments concurrently (0 runs one per segment)
+	ReverseOrder     bool          // Submit dependents before their dependencies to stress FAIL-retry handling
+	RunTimeout       time.Duration // Aborts the whole run with a goroutine dump once exceeded (0 disables)
+	Keepalive        bool          // Reuse one persistent connection per segment across all phases
 	Unluckiness      int
 	waiting          sync.WaitGroup
+	results          ResultsAggregator // Per-client command tallies, summarized when the run ends
+	exit             func(code int)    // Terminates the process; replaced in tests (defaults to os.Exit)
+	pool             *clientPool       // Persistent clients shared by all phases when Keepalive is set
 }
 
 // Start starts the test
@@ -27,6 +35,10 @@ func (t *TestRun) Start() {
 	log.Printf("expected server host [%v]", t.ServerHost)
 	log.Printf("expected server port [%d]", t.ServerPort)
 	log.Printf("concurrency level    [%d]", t.ConcurrencyLevel)
+	log.Printf("max workers          [%d]", t.MaxWorkers)
+	log.Printf("reverse order        [%v]", t.ReverseOrder)
+	log.Printf("run timeout          [%v]", t.RunTimeout)
+	log.Printf("keepalive            [%v]", t.Keepalive)
 	log.Printf("unluckiness          [%d]", t.Unluckiness)
 	t.StartedAt = time.Now()
 	log.Println("TESTRUN Starting...")
@@ -35,21 +47,47 @@ func (t *TestRun) Start() {
 // Finish ends the test
 func (t *TestRun) Finish() {
 	duration := time.Since(t.StartedAt)
+	t.results.LogSummary()
 	log.Println("================")
 	log.Println("All tests passed!")
 	log.Println("================")
 	log.Printf("TESTRUN finished! (took %dms)", durationInMillis(duration))
-	os.Exit(0)
+	t.terminate(0)
 }
 
 // Fail fails the test
 func (t *TestRun) Fail(reason string) {
 	duration := time.Since(t.StartedAt)
+	t.results.LogSummary()
 	log.Println("================")
 	log.Println("  Test FAILED!  ")
 	log.Println("================")
 	log.Printf("Test failed (took %dms)\n%s", durationInMillis(duration), reason)
-	os.Exit(1)
+	t.terminate(1)
+}
+
+// terminate ends the test program with the given exit code
+func (t *TestRun) terminate(code int) {
+	if t.exit != nil {
+		t.exit(code)
+		return
+	}
+	os.Exit(code)
+}
+
+// startWatchdog arms the overall run deadline: once RunTimeout elapses the run is failed
+// with a goroutine dump, so a hung server cannot stall CI indefinitely. The returned
+// function disarms the watchdog.
+func (t *TestRun) startWatchdog() func() {
+	if t.RunTimeout <= 0 {
+		return func() {}
+	}
+	timer := time.AfterFunc(t.RunTimeout, func() {
+		log.Printf("Run timeout of %v exceeded, dumping goroutines", t.RunTimeout)
+		_ = pprof.Lookup("goroutine").WriteTo(log.Writer(), 2)
+		t.Failf("Test run did not finish within -run-timeout %v; the server may be hung", t.RunTimeout)
+	})
+	return func() { timer.Stop() }
 }
 
 // Failf fails the test with a formatted message
@@ -65,6 +103,15 @@ func (t *TestRun) Faile(err error) {
 // Run executes the test
 func (t *TestRun) Run() {
 	startedAt := time.Now()
+	defer t.startWatchdog()()
+	if t.Keepalive && t.pool == nil {
+		t.pool = newClientPool(func(name string) (PackageIndexerClient, error) {
+			return MakeTCPPackageIndexClient(name, t.ServerHost, t.ServerPort)
+		})
+	}
+	if t.pool != nil {
+		defer t.pool.closeAll()
+	}
 
 	log.Println("TESTRUN - Trying to remove, index, then remove again a large amount of packages")
 
@@ -81,12 +128,26 @@ func (t *TestRun) Run() {
 
 	log.Println("Step 2: Index all packages by brute-force")
 	clientCounter = clientCounter + t.ConcurrencyLevel
-	concurrentBruteforceIndexesPackages(clientCounter, t, segmentedPackages)
+	indexSegments := segmentedPackages
+	if t.ReverseOrder {
+		indexSegments = make([][]*Package, len(segmentedPackages))
+		for i, segment := range segmentedPackages {
+			indexSegments[i] = ReverseDependencyOrder(segment)
+		}
+	}
+	concurrentBruteforceIndexesPackages(clientCounter, t, indexSegments)
 
 	log.Println("Step 3: Verify if all packages were correctly indexed")
 	clientCounter = clientCounter + t.ConcurrencyLevel
 	concurrentverifyAllPackages(clientCounter, t, segmentedPackages, OK)
 
+	log.Println("Step 3b: Verify the server's reverse dependencies match the package graph")
+	clientCounter = clientCounter + t.ConcurrencyLevel
+	expectedDependents := ExpectedDependents(homebrewPackages.Packages)
+	runConcurrentClients(clientCounter, t, segmentedPackages, func(client PackageIndexerClient, packages []*Package, unluckiness int) error {
+		return verifyDependents(client, packages, expectedDependents)
+	})
+
 	log.Println("Step 4: Remove all installed packages")
 	clientCounter = clientCounter + t.ConcurrencyLevel
 	concurrentBruteforceRemovesAllPackages(clientCounter, t, segmentedPackages)
@@ -110,15 +171,28 @@ func MakeTestRun(serverHost string, serverPort int, concurrencyLevel int, unluck
 }
 
 func bruteforceIndexesPackages(client PackageIndexerClient, packages []*Package, changeOfBeingUnluckyInPercent int) error {
+	passes, err := indexUntilConverged(client, packages, changeOfBeingUnluckyInPercent)
+	if err != nil {
+		return err
+	}
+	log.Printf("%s converged after %d passes", client.Name(), passes)
+	return nil
+}
+
+// indexUntilConverged repeatedly submits every package until all are indexed, returning
+// how many passes over the list convergence required
+func indexUntilConverged(client PackageIndexerClient, packages []*Package, changeOfBeingUnluckyInPercent int) (int, error) {
 	totalPackages := len(packages)
+	passes := 0
 	log.Printf("%s brute-forcing indexing of %d packages", client.Name(), totalPackages)
 	for numPackagesInstalledThisItearion := 0; numPackagesInstalledThisItearion < totalPackages; {
 		numPackagesInstalledThisItearion = 0
+		passes++
 		for _, pkg := range packages {
 			if shouldSomethingBadHappen(changeOfBeingUnluckyInPercent) {
 				err := sendBrokenMessage(client)
 				if err != nil {
-					return err
+					return passes, err
 				}
 			}
 
@@ -132,7 +206,42 @@ func bruteforceIndexesPackages(client PackageIndexerClient, packages []*Package,
 		log.Printf("%s reports %v/%v packages indexed", client.Name(), numPackagesInstalledThisItearion, totalPackages)
 	}
 
-	return nil
+	return passes, nil
+}
+
+// ReverseDependencyOrder returns packages in the worst order for indexing: every package
+// precedes all of its (transitive) dependencies, so each pass can only index the packages
+// whose dependencies were indexed by an earlier pass.
+func ReverseDependencyOrder(packages []*Package) []*Package {
+	member := make(map[*Package]bool, len(packages))
+	for _, pkg := range packages {
+		member[pkg] = true
+	}
+
+	visited := make(map[*Package]bool, len(packages))
+	ordered := make([]*Package, 0, len(packages))
+	var visit func(pkg *Package)
+	visit = func(pkg *Package) {
+		if visited[pkg] {
+			return
+		}
+		visited[pkg] = true
+		for _, dep := range pkg.Dependencies {
+			visit(dep)
+		}
+		if member[pkg] {
+			ordered = append(ordered, pkg)
+		}
+	}
+	for _, pkg := range packages {
+		visit(pkg)
+	}
+
+	// ordered has dependencies first; reverse it so dependents lead
+	for i, j := 0, len(ordered)-1; i < j; i, j = i+1, j-1 {
+		ordered[i], ordered[j] = ordered[j], ordered[i]
+	}
+	return ordered
 }
 
 func indexPackage(client PackageIndexerClient, pkg *Package, expectedStatus ResponseCode) error {
@@ -199,33 +308,71 @@ func makeClient(clientName string, t *TestRun) PackageIndexerClient {
 	return client
 }
 
-// runConcurrentClients is a generic helper to run a test function across multiple clients
+// runConcurrentClients is a generic helper to run a test function across multiple clients.
+// Segments are queued and drained by a bounded pool of workers, each opening one client
+// per segment, so the concurrency level is decoupled from local goroutine pressure.
 func runConcurrentClients(
 	clientCounter int,
 	t *TestRun,
 	segmentedPackages [][]*Package,
 	action func(client PackageIndexerClient, packages []*Package, unluckiness int) error,
 ) {
-	t.waiting.Add(t.ConcurrencyLevel)
-	for _, p := range segmentedPackages {
+	type segment struct {
+		slot     int // Position in segmentedPackages, identifying the pooled client
+		number   int
+		packages []*Package
+	}
+	queue := make(chan segment, len(segmentedPackages))
+	for i, p := range segmentedPackages {
 		clientCounter++
-		go func(number int, packagesToProcess []*Package) {
-			name := fmt.Sprintf("client[%d]", number+1)
-			log.Printf("Starting %s", name)
-			defer t.waiting.Done()
+		queue <- segment{slot: i, number: clientCounter, packages: p}
+	}
+	close(queue)
 
-			client := makeClient(name, t)
-			defer client.Close()
+	workers := t.workerCount(len(segmentedPackages))
+	t.waiting.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer t.waiting.Done()
+			for seg := range queue {
+				client := &recordingClient{PackageIndexerClient: t.acquireClient(seg.slot, seg.number), results: &t.results}
+				log.Printf("Starting %s", client.Name())
 
-			err := action(client, packagesToProcess, t.Unluckiness)
-			if err != nil {
-				t.Failf("%v", err)
+				err := action(client, seg.packages, t.Unluckiness)
+				if t.pool == nil {
+					client.Close()
+				}
+				t.results.RecordOutcome(client.Name(), err)
+				if err != nil {
+					t.Failf("%v", err)
+				}
 			}
-		}(clientCounter, p)
+		}()
 	}
 	t.waiting.Wait()
 }
 
+// acquireClient returns the pooled client for a segment slot when keepalive is enabled,
+// or a fresh connection numbered after the client counter otherwise
+func (t *TestRun) acquireClient(slot int, number int) PackageIndexerClient {
+	if t.pool == nil {
+		return makeClient(fmt.Sprintf("client[%d]", number+1), t)
+	}
+	client, err := t.pool.get(slot)
+	if err != nil {
+		t.Failf("Error opening client to [%v:%d]: %v", t.ServerHost, t.ServerPort, err)
+	}
+	return client
+}
+
+// workerCount returns how many workers process the given number of segments
+func (t *TestRun) workerCount(segments int) int {
+	if t.MaxWorkers > 0 && t.MaxWorkers < segments {
+		return t.MaxWorkers
+	}
+	return segments
+}
+
 func concurrentBruteforceIndexesPackages(clientCounter int, t *TestRun, segmentedPackages [][]*Package) {
 	runConcurrentClients(clientCounter, t, segmentedPackages, bruteforceIndexesPackages)
 }
@@ -235,24 +382,9 @@ func concurrentBruteforceRemovesAllPackages(clientCounter int, t *TestRun, segme
 }
 
 func concurrentverifyAllPackages(clientCounter int, t *TestRun, segmentedPackages [][]*Package, expectedRepose ResponseCode) {
-	t.waiting.Add(t.ConcurrencyLevel)
-	for _, p := range segmentedPackages {
-		clientCounter++
-		go func(number int, packagesToProcess []*Package) {
-			name := fmt.Sprintf("client[%d]", number+1)
-			log.Printf("Starting %s", name)
-			defer t.waiting.Done()
-
-			client := makeClient(name, t)
-			defer client.Close()
-
-			err := verifyAllPackages(client, packagesToProcess, expectedRepose, t.Unluckiness)
-			if err != nil {
-				t.Failf("%v", err)
-			}
-		}(clientCounter, p)
-	}
-	t.waiting.Wait()
+	runConcurrentClients(clientCounter, t, segmentedPackages, func(client PackageIndexerClient, packages []*Package, unluckiness int) error {
+		return verifyAllPackages(client, packages, expectedRepose, unluckiness)
+	})
 }
 
 func durationInMillis(d time.Duration) int64 {
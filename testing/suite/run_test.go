@@ -1,8 +1,19 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"package-indexer/internal/server"
 )
 
 // stubClient provides a test double for PackageIndexerClient interface
@@ -99,3 +110,160 @@ func TestVerifyAllPackages(t *testing.T) {
 		t.Errorf("Expected to stop after the first failed call, got [%d] calls", aStubClient.NumberOfCalls)
 	}
 }
+
+// TestRunConcurrentClients_WorkerCap verifies that every segment is processed when the
+// worker cap is smaller than the number of segments, and that the cap is respected.
+func TestRunConcurrentClients_WorkerCap(t *testing.T) {
+	reserved, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to reserve port: %v", err)
+	}
+	addr := reserved.Addr().String()
+	reserved.Close()
+	host, portStr, _ := net.SplitHostPort(addr)
+	port, _ := strconv.Atoi(portStr)
+
+	srv := server.NewServer(addr, server.DefaultReadTimeout)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = srv.StartWithContext(ctx) }()
+	<-srv.Ready()
+	defer srv.Shutdown(context.Background())
+
+	allPackages := &AllPackages{}
+	for i := 0; i < 40; i++ {
+		allPackages.Named(fmt.Sprintf("pkg-%d", i))
+	}
+	segments := SegmentListPackages(allPackages.Packages, 8)
+
+	run := MakeTestRun(host, port, len(segments), 0)
+	run.MaxWorkers = 2
+
+	var active, peak, processed int64
+	runConcurrentClients(0, run, segments, func(client PackageIndexerClient, packages []*Package, unluckiness int) error {
+		current := atomic.AddInt64(&active, 1)
+		defer atomic.AddInt64(&active, -1)
+		for {
+			seen := atomic.LoadInt64(&peak)
+			if current <= seen || atomic.CompareAndSwapInt64(&peak, seen, current) {
+				break
+			}
+		}
+		atomic.AddInt64(&processed, int64(len(packages)))
+		return bruteforceIndexesPackages(client, packages, unluckiness)
+	})
+
+	if processed != 40 {
+		t.Errorf("expected all 40 packages processed, got %d", processed)
+	}
+	if peak > 2 {
+		t.Errorf("expected at most 2 concurrent workers, saw %d", peak)
+	}
+	if indexed := srv.GetStats().Indexed; indexed != 40 {
+		t.Errorf("expected 40 packages indexed on the server, got %d", indexed)
+	}
+}
+
+// TestReverseDependencyOrder_Converges verifies that worst-case ordering places every
+// package before its dependencies and that indexing still converges to a fully indexed
+// state, taking one pass per level of a dependency chain.
+func TestReverseDependencyOrder_Converges(t *testing.T) {
+	reserved, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to reserve port: %v", err)
+	}
+	addr := reserved.Addr().String()
+	reserved.Close()
+	host, portStr, _ := net.SplitHostPort(addr)
+	port, _ := strconv.Atoi(portStr)
+
+	srv := server.NewServer(addr, server.DefaultReadTimeout)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = srv.StartWithContext(ctx) }()
+	<-srv.Ready()
+	defer srv.Shutdown(context.Background())
+
+	graph, err := TextToPackages(&AllPackages{}, "a:\nb: a\nc: b\nd: c a\ne: d\n")
+	if err != nil {
+		t.Fatalf("failed to parse graph: %v", err)
+	}
+	ordered := ReverseDependencyOrder(graph.Packages)
+	position := make(map[string]int)
+	for i, pkg := range ordered {
+		position[pkg.Name] = i
+	}
+	for _, pkg := range ordered {
+		for _, dep := range pkg.Dependencies {
+			if position[dep.Name] < position[pkg.Name] {
+				t.Errorf("dependency %s ordered before dependent %s", dep.Name, pkg.Name)
+			}
+		}
+	}
+
+	client, err := MakeTCPPackageIndexClient("reverse-order-test", host, port)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer client.Close()
+
+	passes, err := indexUntilConverged(client, ordered, 0)
+	if err != nil {
+		t.Fatalf("indexing did not converge: %v", err)
+	}
+	if passes != 5 {
+		t.Errorf("expected 5 passes for a 5-level chain, got %d", passes)
+	}
+	if indexed := srv.GetStats().Indexed; indexed != 5 {
+		t.Errorf("expected 5 packages indexed, got %d", indexed)
+	}
+}
+
+// slowClient is a stub client whose every Send takes delay, simulating a hung server
+type slowClient struct {
+	stubClient
+	delay time.Duration
+}
+
+// Send sleeps before returning the canned response
+func (client *slowClient) Send(msg string) (ResponseCode, error) {
+	time.Sleep(client.delay)
+	return client.stubClient.Send(msg)
+}
+
+// TestRunWatchdog verifies the overall run deadline fails the run with a goroutine dump
+// when a client stalls, and that a disarmed watchdog never fires.
+func TestRunWatchdog(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	codes := make(chan int, 1)
+	run := &TestRun{RunTimeout: 50 * time.Millisecond, exit: func(code int) { codes <- code }}
+	stop := run.startWatchdog()
+	defer stop()
+
+	pkgs := []*Package{{Name: "a"}, {Name: "b"}, {Name: "c"}}
+	client := &slowClient{stubClient: stubClient{WhatToReturn: OK}, delay: 100 * time.Millisecond}
+	_ = verifyAllPackages(client, pkgs, OK, 0)
+
+	select {
+	case code := <-codes:
+		if code != 1 {
+			t.Errorf("expected exit code 1 on run timeout, got %d", code)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("run timeout did not trigger")
+	}
+	if !strings.Contains(logs.String(), "goroutine ") || !strings.Contains(logs.String(), "-run-timeout") {
+		t.Errorf("expected goroutine dump and timeout message in logs")
+	}
+
+	disarmed := &TestRun{RunTimeout: 20 * time.Millisecond, exit: func(code int) { codes <- code }}
+	disarmed.startWatchdog()()
+	select {
+	case code := <-codes:
+		t.Errorf("disarmed watchdog fired with exit code %d", code)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
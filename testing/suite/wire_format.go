@@ -34,6 +34,11 @@ func MakeQueryMessage(pkg *Package) string {
 	return fmt.Sprintf("QUERY%s%s%s", ProtocolSeparator, pkg.Name, ProtocolSeparator)
 }
 
+// MakeStatusMessage generates a message asking for a package's existence and direct edge counts
+func MakeStatusMessage(pkg *Package) string {
+	return fmt.Sprintf("STATUS%s%s%s", ProtocolSeparator, pkg.Name, ProtocolSeparator)
+}
+
 // Chaos testing data for malformed message generation
 var (
 	possibleInvalidCommands = []string{"BLINDEX", "REMOVES", "QUER", "LIZARD", "I"}